@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/SimonRichardson/formed/pkg/config"
+	"github.com/SimonRichardson/formed/pkg/fs"
+	"github.com/pkg/errors"
+)
+
+const configFlag = "config"
+
+// envConfig names the configuration file when -config isn't given.
+var envConfig = config.EnvKey(configFlag)
+
+// configurable creates the flags of every mode that can be configured, so
+// that the configuration can be checked, or printed, without running the
+// mode.
+var configurable = map[string]func() *flag.FlagSet{
+	"query":   func() *flag.FlagSet { return newQueryFlags().FlagSet },
+	"history": func() *flag.FlagSet { return newHistoryFlags().FlagSet },
+	"users":   func() *flag.FlagSet { return newUsersFlags().FlagSet },
+}
+
+// configFile adds the flag naming the configuration file to the flags.
+func configFile(flagset *flag.FlagSet) *string {
+	return flagset.String(configFlag, "", fmt.Sprintf("location of a configuration file (yaml or json), empty uses %s", envConfig))
+}
+
+// parseFlags parses the flags given on the command line, every flag that
+// isn't given is then taken from the environment or else from the
+// configuration file.
+func parseFlags(flagset *flag.FlagSet, args []string) ([]config.Setting, error) {
+	if err := flagset.Parse(args); err != nil {
+		return nil, err
+	}
+
+	path := flagset.Lookup(configFlag).Value.String()
+	if path == "" {
+		path = os.Getenv(envConfig)
+	}
+
+	var file config.File
+	if path != "" {
+		var err error
+		if file, err = config.Load(fs.New(), path); err != nil {
+			return nil, err
+		}
+		if err := file.Validate(configurableModes()...); err != nil {
+			return nil, err
+		}
+	}
+	return config.Apply(flagset, file, os.LookupEnv, configFlag)
+}
+
+func configurableModes() []string {
+	res := make([]string, 0, len(configurable))
+	for k := range configurable {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// runConfig prints the configuration a mode would run with, merged from the
+// flags, the environment and the configuration file.
+func runConfig(args []string) error {
+	flagset := flag.NewFlagSet("config", flag.ExitOnError)
+	flagset.Usage = usageFor(flagset, "config print [mode] [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return nil
+	}
+
+	switch flagset.Arg(0) {
+	case "print":
+		mode, rest := "query", flagset.Args()[1:]
+		if len(rest) > 0 && len(rest[0]) > 0 && rest[0][0] != '-' {
+			mode, rest = rest[0], rest[1:]
+		}
+
+		newFlags, ok := configurable[mode]
+		if !ok {
+			return errors.Errorf("unknown mode %q, expected one of %v", mode, configurableModes())
+		}
+
+		settings, err := parseFlags(newFlags(), rest)
+		if err != nil {
+			return err
+		}
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+		fmt.Fprintf(writer, "KEY\tVALUE\tSOURCE\n")
+		for _, v := range settings {
+			source := string(v.Source)
+			if v.Origin != "" {
+				source = fmt.Sprintf("%s (%s)", v.Source, v.Origin)
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%s\n", v.Name, v.Value, source)
+		}
+		return writer.Flush()
+
+	default:
+		flagset.Usage()
+		return errors.Errorf("unknown config command %q", flagset.Arg(0))
+	}
+}
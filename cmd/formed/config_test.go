@@ -0,0 +1,19 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestConfigurable(t *testing.T) {
+	t.Parallel()
+
+	for _, mode := range configurableModes() {
+		flagset := configurable[mode]()
+		if expected, actual := mode, flagset.Name(); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if flagset.Lookup(configFlag) == nil {
+			t.Errorf("%s: expected a -%s flag", mode, configFlag)
+		}
+	}
+}
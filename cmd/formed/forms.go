@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/SimonRichardson/formed/pkg/forms"
+	"github.com/SimonRichardson/formed/pkg/fs"
+	"github.com/SimonRichardson/formed/pkg/history"
+	"github.com/SimonRichardson/formed/pkg/schema"
+	"github.com/SimonRichardson/formed/pkg/store"
+	"github.com/SimonRichardson/formed/pkg/templates"
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	queryPath       = "/query"
+	defaultFormName = "people"
+)
+
+// openedForm holds everything required to serve one of the forms.
+type openedForm struct {
+	form             forms.Form
+	history          *history.History
+	templates        *templates.Templates
+	historyTemplates *templates.Templates
+}
+
+// loadForms reads the forms from the file at path, if no path is given then a
+// single form is described by the fallback.
+func loadForms(path string, fallback forms.FormConfig) (forms.Config, error) {
+	if path == "" {
+		return forms.Config{Forms: []forms.FormConfig{fallback}}, nil
+	}
+	return forms.LoadConfig(fs.New(), path)
+}
+
+// selectForm picks the form for the name, the name can be left empty when
+// there is only one form to pick from.
+func selectForm(config forms.Config, name string) (forms.FormConfig, error) {
+	if name == "" && len(config.Forms) == 1 {
+		return config.Forms[0], nil
+	}
+
+	if form, ok := config.Find(name); ok {
+		return form, nil
+	}
+
+	names := make([]string, len(config.Forms))
+	for k, v := range config.Forms {
+		names[k] = v.Name
+	}
+	if name == "" {
+		return forms.FormConfig{}, errors.Errorf("expected a form, one of %s", strings.Join(names, ", "))
+	}
+	return forms.FormConfig{}, errors.Errorf("unknown form %q, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// openForm loads the schema and the templates of the form and opens its
+// store, every write to the store is recorded in the history and every read
+// and write is measured by the metrics.
+func openForm(config forms.FormConfig, uiLocal bool, metrics store.Metrics, logger log.Logger) (openedForm, error) {
+	schema, err := loadSchema(config.Schema)
+	if err != nil {
+		return openedForm{}, err
+	}
+
+	history, err := openHistory(config, schema, metrics, logger)
+	if err != nil {
+		return openedForm{}, err
+	}
+
+	templates, err := gatherTemplates(config.Views, uiLocal)
+	if err != nil {
+		return openedForm{}, err
+	}
+
+	historyTemplates, err := gatherHistoryTemplates(config.Views, uiLocal)
+	if err != nil {
+		return openedForm{}, err
+	}
+
+	name := formName(config, schema)
+	title := config.Title
+	if title == "" {
+		title = name
+	}
+
+	return openedForm{
+		form: forms.Form{
+			Name:   name,
+			Title:  title,
+			Path:   fmt.Sprintf("%s/%s", queryPath, name),
+			Schema: schema,
+		},
+		history:          history,
+		templates:        templates,
+		historyTemplates: historyTemplates,
+	}, nil
+}
+
+// formName is the name of the form, when the form hasn't been named (i.e.
+// it's described by flags) then the name of the schema is used instead.
+func formName(config forms.FormConfig, schema schema.Schema) string {
+	switch {
+	case config.Name != "":
+		return config.Name
+	case schema.Name != "":
+		return schema.Name
+	}
+	return defaultFormName
+}
+
+func gatherTemplates(dir string, uiLocal bool) (*templates.Templates, error) {
+	return templates.Load(templates.ErrorView(uiLocal), map[int]templates.View{
+		http.StatusOK:                  templates.FormView(dir, uiLocal),
+		http.StatusForbidden:           templates.ForbiddenView(dir, uiLocal),
+		http.StatusUnprocessableEntity: templates.FormView(dir, uiLocal),
+		http.StatusConflict:            templates.ConflictView(dir, uiLocal),
+	})
+}
+
+func gatherHistoryTemplates(dir string, uiLocal bool) (*templates.Templates, error) {
+	return templates.Load(templates.ErrorView(uiLocal), map[int]templates.View{
+		http.StatusOK:        templates.HistoryView(dir, uiLocal),
+		http.StatusForbidden: templates.ForbiddenView(dir, uiLocal),
+	})
+}
+
+func gatherIndexTemplates(uiLocal bool) (*templates.Templates, error) {
+	return templates.Load(templates.ErrorView(uiLocal), map[int]templates.View{
+		http.StatusOK: templates.IndexView(uiLocal),
+	})
+}
+
+func loadSchema(path string) (schema.Schema, error) {
+	if path == "" {
+		return schema.Default(), nil
+	}
+	return schema.Load(fs.New(), path)
+}
+
+func openHistory(config forms.FormConfig, schema schema.Schema, metrics store.Metrics, logger log.Logger) (*history.History, error) {
+	fsys := fs.New()
+
+	timeout, err := store.LockTimeout(config.FileStore)
+	if err != nil {
+		return nil, err
+	}
+	s, err := store.Open(fsys, config.FileStore, schema.Columns())
+	if err != nil {
+		return nil, err
+	}
+	s = store.NewInstrumented(s, forForm(metrics, formName(config, schema)))
+
+	h, err := history.New(s, fsys, config.History, timeout, logger)
+	if err != nil {
+		store.Close(s)
+		return nil, err
+	}
+	return h, nil
+}
+
+// newCLILogger logs to stderr, so nothing is mixed in with the output of the
+// commands that don't serve anything.
+func newCLILogger() log.Logger {
+	return log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+
+	"github.com/SimonRichardson/formed/pkg/health"
+	"github.com/SimonRichardson/formed/pkg/templates"
+	"github.com/pkg/errors"
+)
+
+// newBuild describes the build of the process, the version is set when
+// building.
+func newBuild() health.Build {
+	return health.Build{
+		Version:   version,
+		GoVersion: runtime.Version(),
+	}
+}
+
+// formChecks checks the store of the form can be read from and written to,
+// and that its templates are loaded.
+func formChecks(opened openedForm) []health.Check {
+	return []health.Check{
+		{Name: opened.form.Name + "/store", Checker: opened.history},
+		{Name: opened.form.Name + "/templates", Checker: templatesLoaded(opened.templates, opened.historyTemplates)},
+	}
+}
+
+// templatesLoaded checks that every one of the templates has a template to
+// render a page with, rather than only the fallback.
+func templatesLoaded(ts ...*templates.Templates) health.Checker {
+	return health.CheckerFunc(func() error {
+		for _, t := range ts {
+			if t == nil || !t.Has(http.StatusOK) {
+				return errors.New("templates aren't loaded")
+			}
+		}
+		return nil
+	})
+}
+
+// handleHealth serves the health API on the mux.
+func handleHealth(mux *http.ServeMux, api *health.API) {
+	for _, path := range []string{health.PathHealth, health.PathReady, health.PathVersion} {
+		mux.Handle(path, api)
+	}
+}
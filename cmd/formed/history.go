@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/SimonRichardson/formed/pkg/forms"
+	"github.com/SimonRichardson/formed/pkg/store"
+	"github.com/pkg/errors"
+)
+
+// runHistory lists the revisions made to the store, or restores one of them.
+func runHistory(args []string) error {
+	flags := newHistoryFlags()
+
+	flags.Usage = usageFor(flags.FlagSet, "history [flags] list|restore <revision>")
+	if _, err := parseFlags(flags.FlagSet, args); err != nil {
+		return err
+	}
+
+	config, err := loadForms(*flags.formsFile, forms.FormConfig{
+		Schema:    *flags.schemaFile,
+		FileStore: *flags.fileStore,
+		History:   *flags.historyLog,
+	})
+	if err != nil {
+		return err
+	}
+
+	form, err := selectForm(config, *flags.formName)
+	if err != nil {
+		return err
+	}
+
+	schema, err := loadSchema(form.Schema)
+	if err != nil {
+		return err
+	}
+
+	history, err := openHistory(form, schema, discardStoreMetrics(), newCLILogger())
+	if err != nil {
+		return err
+	}
+	defer history.Close()
+
+	switch flags.Arg(0) {
+	case "list", "":
+		revisions, err := history.Revisions()
+		if err != nil {
+			return err
+		}
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+		fmt.Fprintf(writer, "REVISION\tTIME\tREMOTE\tADDED\tREMOVED\tCHANGED\n")
+		for _, v := range revisions {
+			fmt.Fprintf(writer, "%d\t%s\t%s\t%d\t%d\t%d\n",
+				v.ID, v.Time.Format("2006-01-02 15:04:05"), v.RemoteAddr,
+				len(v.Diff.Added), len(v.Diff.Removed), len(v.Diff.Changed),
+			)
+		}
+		return writer.Flush()
+
+	case "restore":
+		id, err := strconv.Atoi(flags.Arg(1))
+		if err != nil {
+			return errors.Errorf("expected a revision to restore, actual %q", flags.Arg(1))
+		}
+
+		version, err := history.Restore(id, store.AnyVersion, "cli")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "restored revision %d (version %s)\n", id, version)
+		return nil
+
+	default:
+		flags.Usage()
+		return errors.Errorf("unknown history command %q", flags.Arg(0))
+	}
+}
+
+// historyFlags are the flags of the history mode.
+type historyFlags struct {
+	*flag.FlagSet
+
+	fileStore  *string
+	historyLog *string
+	schemaFile *string
+	formsFile  *string
+	formName   *string
+}
+
+func newHistoryFlags() *historyFlags {
+	flagset := flag.NewFlagSet("history", flag.ExitOnError)
+	configFile(flagset)
+	return &historyFlags{
+		FlagSet: flagset,
+
+		fileStore:  flagset.String("filestore", defaultFileStore, "location of the store, a csv file path or a url (csv, json, jsonl, sqlite, wal, mem)"),
+		historyLog: flagset.String("history", defaultHistory, "location of the history of revisions"),
+		schemaFile: flagset.String("schema", "", "location of the form schema (yaml or json), empty uses a first name and last name"),
+		formsFile:  flagset.String("forms", "", "location of the forms (yaml or json), empty uses the form from the flags above"),
+		formName:   flagset.String("form", "", "name of the form in the forms file, can be empty if there's only one"),
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net"
+	"os"
+
+	"github.com/SimonRichardson/formed/pkg/listen"
+)
+
+const (
+	unixNetwork    = "unix"
+	systemdNetwork = "systemd"
+)
+
+// unixOptions describes who can connect to a unix domain socket.
+type unixOptions struct {
+	mode  os.FileMode
+	group string
+}
+
+// listenOn creates a listener for the network and address parsed by
+// parseAddr. Https is listened on over tcp, the TLS is layered on top.
+func listenOn(network, address string, options unixOptions) (net.Listener, error) {
+	switch network {
+	case unixNetwork:
+		return listen.Unix(address, options.mode, options.group)
+	case systemdNetwork:
+		return listen.Systemd(address)
+	case httpsNetwork:
+		return net.Listen("tcp", address)
+	}
+	return net.Listen(network, address)
+}
@@ -19,6 +19,9 @@ func usage() {
 	fmt.Fprintf(os.Stderr, "\n")
 	fmt.Fprintf(os.Stderr, "MODES\n")
 	fmt.Fprintf(os.Stderr, "  query        Create a query api for the backend\n")
+	fmt.Fprintf(os.Stderr, "  history      List or restore revisions of the store\n")
+	fmt.Fprintf(os.Stderr, "  users        List, change, import or export the users of the store\n")
+	fmt.Fprintf(os.Stderr, "  config       Print the configuration of a mode and where it came from\n")
 	fmt.Fprintf(os.Stderr, "\n")
 	fmt.Fprintf(os.Stderr, "VERSION\n")
 	fmt.Fprintf(os.Stderr, "  %s (%s)\n", version, runtime.Version())
@@ -54,7 +57,8 @@ func (c command) Run(args []string) {
 }
 
 const (
-	defaultAPIPort = 8080
+	defaultAPIPort     = 8080
+	defaultMetricsPort = 8081
 )
 
 var (
@@ -71,6 +75,12 @@ func main() {
 	switch strings.ToLower(os.Args[1]) {
 	case "query":
 		cmd = runQuery
+	case "history":
+		cmd = runHistory
+	case "users":
+		cmd = runUsers
+	case "config":
+		cmd = runConfig
 	default:
 		usage()
 		os.Exit(1)
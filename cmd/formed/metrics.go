@@ -0,0 +1,72 @@
+package main
+
+import (
+	"github.com/SimonRichardson/formed/pkg/query"
+	"github.com/SimonRichardson/formed/pkg/store"
+	"github.com/go-kit/kit/metrics/discard"
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	metricsNamespace = "formed"
+	metricsPath      = "/metrics"
+)
+
+// newRequestMetrics creates the metrics recorded for every request, they're
+// registered with the default prometheus registry so can only be created once.
+func newRequestMetrics() query.Metrics {
+	labels := []string{"form", "route", "method", "code"}
+	return query.Metrics{
+		Requests: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Total number of requests served.",
+		}, labels),
+		Duration: kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Time taken to serve a request.",
+			Buckets:   stdprometheus.DefBuckets,
+		}, labels),
+	}
+}
+
+// newStoreMetrics creates the metrics recorded for the reads and writes of
+// every store, they're registered with the default prometheus registry so can
+// only be created once.
+func newStoreMetrics() store.Metrics {
+	return store.Metrics{
+		Duration: kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "store",
+			Name:      "duration_seconds",
+			Help:      "Time taken to read from or write to a store.",
+			Buckets:   stdprometheus.DefBuckets,
+		}, []string{"form", "op"}),
+		Errors: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "store",
+			Name:      "errors_total",
+			Help:      "Total number of reads and writes of a store that failed.",
+		}, []string{"form", "op", "error"}),
+	}
+}
+
+// discardStoreMetrics is used when nothing is around to serve the metrics.
+func discardStoreMetrics() store.Metrics {
+	return store.Metrics{
+		Duration: discard.NewHistogram(),
+		Errors:   discard.NewCounter(),
+	}
+}
+
+// forForm labels the metrics with the name of the form.
+func forForm(m store.Metrics, name string) store.Metrics {
+	return store.Metrics{
+		Duration: m.Duration.With("form", name),
+		Errors:   m.Errors.With("form", name),
+	}
+}
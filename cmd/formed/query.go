@@ -1,47 +1,60 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
+	stdlog "log"
 	"net"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/SimonRichardson/formed/pkg/auth"
+	"github.com/SimonRichardson/formed/pkg/certs"
+	"github.com/SimonRichardson/formed/pkg/csrf"
+	"github.com/SimonRichardson/formed/pkg/forms"
 	"github.com/SimonRichardson/formed/pkg/fs"
+	"github.com/SimonRichardson/formed/pkg/health"
+	"github.com/SimonRichardson/formed/pkg/history"
+	"github.com/SimonRichardson/formed/pkg/listen"
 	"github.com/SimonRichardson/formed/pkg/query"
-	"github.com/SimonRichardson/formed/pkg/store"
 	"github.com/SimonRichardson/formed/pkg/templates"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/run"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const (
-	defaultFileStore = "./data/store.csv"
+	defaultFileStore       = "./data/store.csv"
+	defaultHistory         = "./data/history.jsonl"
+	defaultReadTimeout     = 30 * time.Second
+	defaultWriteTimeout    = 30 * time.Second
+	defaultIdleTimeout     = 2 * time.Minute
+	defaultShutdownTimeout = 30 * time.Second
+	defaultTLSReload       = 10 * time.Second
+	defaultUnixMode        = "0660"
 )
 
 // runQuery creates all the dependencies required to create and run the query
 // end point for the form component.
 func runQuery(args []string) error {
-	var (
-		flagset = flag.NewFlagSet("query", flag.ExitOnError)
-
-		debug     = flagset.Bool("debug", false, "debug logging")
-		apiAddr   = flagset.String("api", defaultAPIAddr, "listen address for query API")
-		fileStore = flagset.String("filestore", defaultFileStore, "location of where the file store")
-		uiLocal   = flagset.Bool("ui.local", false, "ignores embedded files and goes straight to the filesystem")
-	)
+	flags := newQueryFlags()
 
-	flagset.Usage = usageFor(flagset, "query [flags]")
-	if err := flagset.Parse(args); err != nil {
-		return nil
+	flags.Usage = usageFor(flags.FlagSet, "query [flags]")
+	if _, err := parseFlags(flags.FlagSet, args); err != nil {
+		return err
 	}
 
 	// Setup the logger.
 	var logger log.Logger
 	{
 		logLevel := level.AllowInfo()
-		if *debug {
+		if *flags.debug {
 			logLevel = level.AllowAll()
 		}
 		logger = log.NewLogfmtLogger(os.Stdout)
@@ -50,53 +63,383 @@ func runQuery(args []string) error {
 	}
 
 	// Parse the apiNetwork and apiAddress from the flag set
-	apiNetwork, apiAddress, err := parseAddr(*apiAddr, defaultAPIPort)
+	apiNetwork, apiAddress, err := parseAddr(*flags.apiAddr, defaultAPIPort)
+	if err != nil {
+		return err
+	}
+
+	// The metrics are served apart from the API, so they're never exposed
+	// alongside the forms.
+	var metricsNetwork, metricsAddress string
+	if *flags.metricsAddr != "" {
+		if metricsNetwork, metricsAddress, err = parseAddr(*flags.metricsAddr, defaultMetricsPort); err != nil {
+			return err
+		}
+		if metricsNetwork == httpsNetwork {
+			return errors.Errorf("expected a http address for -metrics, actual: %q", *flags.metricsAddr)
+		}
+	}
+
+	// Load all the forms to serve, without a forms file the flags describe
+	// a single form.
+	config, err := loadForms(*flags.formsFile, forms.FormConfig{
+		Schema:    *flags.schemaFile,
+		FileStore: *flags.fileStore,
+		History:   *flags.historyLog,
+	})
 	if err != nil {
 		return err
 	}
 
-	// Get all the templates for the query
-	templates, err := gatherTemplates(*uiLocal)
+	// Serving https requires a certificate, the other networks can't have
+	// one.
+	var (
+		tlsConfig   *tls.Config
+		tlsReloader *certs.Reloader
+		tlsOpts     = tlsOptions{
+			certFile:   *flags.tlsCert,
+			keyFile:    *flags.tlsKey,
+			clientCA:   *flags.tlsClientCA,
+			selfSigned: *flags.tlsSelfSigned,
+		}
+	)
+	switch {
+	case apiNetwork == httpsNetwork:
+		tlsConfig, tlsReloader, err = newTLSConfig(apiAddress, tlsOpts, log.With(logger, "component", "tls"))
+		if err != nil {
+			return err
+		}
+	case tlsOpts.enabled():
+		return errors.Errorf("expected an https address for -api to use the -tls flags, actual: %q", *flags.apiAddr)
+	}
+
+	// Every form that is posted has to hold a token issued for the session,
+	// the tokens are signed with a key that only lasts as long as the process.
+	// Over https the cookie of the session is always secure.
+	protector, err := newProtector(*flags.sameSite, *flags.secure || tlsConfig != nil)
 	if err != nil {
 		return err
 	}
 
+	// Without any authentication everyone can edit every form.
+	authenticator, err := newAuthenticator(*flags.htpasswd, *flags.tokens, *flags.proxy, *flags.proxyUser, *flags.proxyRole, *flags.editors, *flags.proxyUnix)
+	if err != nil {
+		return err
+	}
+	if authenticator == nil {
+		level.Info(logger).Log("auth", "disabled, everyone is an editor")
+	}
+
+	indexTemplates, err := gatherIndexTemplates(*flags.uiLocal)
+	if err != nil {
+		return err
+	}
+	watcher := templates.NewWatcher(log.With(logger, "component", "templates"), indexTemplates)
+
+	// Every store is closed once the server has stopped, waiting for any
+	// write that is still in progress so nothing is left half written.
+	var histories []*history.History
+	defer func() {
+		for _, h := range histories {
+			if err := h.Close(); err != nil {
+				level.Warn(logger).Log("err", errors.Wrap(err, "unable to close store"))
+			}
+		}
+	}()
+
+	// Every form is served under its own name, with an index of all the
+	// forms at the root.
+	var (
+		index          = query.NewForms(indexTemplates)
+		storeMetrics   = newStoreMetrics()
+		requestMetrics = newRequestMetrics()
+		checks         = []health.Check{
+			{Name: "index/templates", Checker: templatesLoaded(indexTemplates)},
+		}
+	)
+	for _, v := range config.Forms {
+		opened, err := openForm(v, *flags.uiLocal, storeMetrics, log.With(logger, "component", "history", "form", v.Name))
+		if err != nil {
+			return errors.Wrapf(err, "unable to open form %q", v.Name)
+		}
+		histories = append(histories, opened.history)
+		checks = append(checks, formChecks(opened)...)
+		watcher.Add(opened.templates, opened.historyTemplates)
+
+		var (
+			injector = query.NewInjector(opened.form, opened.history, protector, opened.templates, opened.historyTemplates)
+			api      = query.NewAPI(injector, log.With(logger, "component", "api", "form", opened.form.Name))
+		)
+		index.Add(opened.form, api)
+		level.Debug(logger).Log("form", opened.form.Name, "path", opened.form.Path)
+	}
+
 	// Create the api listener for the service
-	apiListener, err := net.Listen(apiNetwork, apiAddress)
+	mode, err := listen.ParseMode(*flags.unixMode)
+	if err != nil {
+		return err
+	}
+	unixOpts := unixOptions{
+		mode:  mode,
+		group: *flags.unixGroup,
+	}
+	apiListener, err := listenOn(apiNetwork, apiAddress, unixOpts)
 	if err != nil {
 		return err
 	}
+	if tlsConfig != nil {
+		apiListener = tls.NewListener(apiListener, tlsConfig)
+	}
 	level.Debug(logger).Log("API", fmt.Sprintf("%s://%s", apiNetwork, apiAddress))
 
-	// Execution group.
-	defer apiListener.Close()
+	var handler http.Handler = http.StripPrefix(queryPath, index)
+	if authenticator != nil {
+		handler = auth.Handler(authenticator, handler, log.With(logger, "component", "auth"))
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(queryPath+"/", handler)
 
-	// API that is going to handle the incoming requests.
+	// The health of the process is served outside of the query API, without
+	// authentication and without logging every probe.
 	var (
-		fsys     = fs.New()
-		store    = store.New(fsys, *fileStore)
-		injector = query.NewInjector(store, templates)
-		api      = query.NewAPI(injector, log.With(logger, "component", "api"))
+		healthAPI = health.NewAPI(checks, newBuild(), health.DefaultTimeout, log.With(logger, "component", "health"))
+		root      = http.NewServeMux()
 	)
+	handleHealth(root, healthAPI)
+	root.Handle("/", query.Instrument(mux, requestMetrics, log.With(logger, "component", "access")))
 
-	mux := http.NewServeMux()
-	mux.Handle("/query/", http.StripPrefix("/query", api))
+	// Create the metrics listener, if there is one.
+	var metricsListener net.Listener
+	if metricsNetwork != "" {
+		if metricsListener, err = listenOn(metricsNetwork, metricsAddress, unixOpts); err != nil {
+			apiListener.Close()
+			return err
+		}
+		level.Debug(logger).Log("metrics", fmt.Sprintf("%s://%s", metricsNetwork, metricsAddress))
+	}
+
+	// Execution group.
+	var g run.Group
+	{
+		server := &http.Server{
+			Handler:           root,
+			ReadHeaderTimeout: *flags.readTimeout,
+			ReadTimeout:       *flags.readTimeout,
+			WriteTimeout:      *flags.writeTimeout,
+			IdleTimeout:       *flags.idleTimeout,
+			ErrorLog:          stdlog.New(log.NewStdlibAdapter(level.Debug(log.With(logger, "component", "http"))), "", 0),
+		}
+		g.Add(func() error {
+			if err := server.Serve(apiListener); err != http.ErrServerClosed {
+				return err
+			}
+			return nil
+		}, func(error) {
+			// Stop accepting connections and wait for the requests in flight,
+			// if they take too long then the connections are closed.
+			ctx, cancel := context.WithTimeout(context.Background(), *flags.shutdownTimeout)
+			defer cancel()
+
+			if err := server.Shutdown(ctx); err != nil {
+				level.Warn(logger).Log("err", errors.Wrap(err, "requests in flight didn't finish"))
+				server.Close()
+			}
+		})
+	}
+	if metricsListener != nil {
+		mux := http.NewServeMux()
+		mux.Handle(metricsPath, promhttp.Handler())
+		handleHealth(mux, healthAPI)
 
-	return http.Serve(apiListener, mux)
+		server := &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: *flags.readTimeout,
+			ReadTimeout:       *flags.readTimeout,
+			WriteTimeout:      *flags.writeTimeout,
+			IdleTimeout:       *flags.idleTimeout,
+			ErrorLog:          stdlog.New(log.NewStdlibAdapter(level.Debug(log.With(logger, "component", "metrics"))), "", 0),
+		}
+		g.Add(func() error {
+			if err := server.Serve(metricsListener); err != http.ErrServerClosed {
+				return err
+			}
+			return nil
+		}, func(error) {
+			// Scrapes are quick, so there's no waiting around for them.
+			server.Close()
+		})
+	}
+	if *flags.uiReload > 0 {
+		stop := make(chan struct{})
+		g.Add(func() error {
+			return watcher.Run(*flags.uiReload, stop)
+		}, func(error) {
+			close(stop)
+		})
+	}
+	if tlsReloader != nil && *flags.tlsReload > 0 {
+		stop := make(chan struct{})
+		g.Add(func() error {
+			return tlsReloader.Run(*flags.tlsReload, stop)
+		}, func(error) {
+			close(stop)
+		})
+	}
+	{
+		cancel := make(chan struct{})
+		g.Add(func() error {
+			return interrupt(cancel)
+		}, func(error) {
+			close(cancel)
+		})
+	}
+
+	err = g.Run()
+	if sig, ok := err.(signalError); ok {
+		level.Info(logger).Log("signal", sig.Signal, "msg", "shut down")
+		return nil
+	}
+	return err
 }
 
-func gatherTemplates(uiLocal bool) (*templates.Templates, error) {
-	fallback, err := templates.NewErrorTemplate(uiLocal)
+func newProtector(sameSite string, secure bool) (*csrf.Protector, error) {
+	mode, err := csrf.ParseSameSite(sameSite)
 	if err != nil {
-		return nil, errors.Wrap(err, "no fallback template")
+		return nil, err
+	}
+	// Browsers drop cookies that are sent to other sites without being
+	// secure.
+	if mode == http.SameSiteNoneMode && !secure {
+		return nil, errors.New("expected -csrf.secure when -csrf.samesite is none")
 	}
 
-	formTemplate, err := templates.NewFormTemplate(uiLocal)
+	key, err := csrf.NewKey()
 	if err != nil {
-		return nil, errors.Wrap(err, "no form template")
+		return nil, err
+	}
+	return csrf.New(key, csrf.Config{
+		SameSite: mode,
+		Secure:   secure,
+	}), nil
+}
+
+// newAuthenticator chains together every authenticator that is configured, if
+// none are configured then nil is returned.
+func newAuthenticator(htpasswd, tokens, proxy, proxyUser, proxyRole, editors string, proxyUnix bool) (auth.Authenticator, error) {
+	roles := auth.Roles{}
+	for _, name := range strings.Split(editors, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			roles[name] = auth.RoleEditor
+		}
 	}
 
-	templates := templates.NewTemplates(fallback)
-	templates.Set(http.StatusOK, formTemplate)
-	return templates, nil
+	var (
+		fsys  = fs.New()
+		chain auth.Chain
+	)
+	if tokens != "" {
+		authenticator, err := auth.LoadTokens(fsys, tokens)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, authenticator)
+	}
+	if htpasswd != "" {
+		authenticator, err := auth.LoadBasic(fsys, htpasswd, roles)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, authenticator)
+	}
+	if proxy != "" || proxyUnix {
+		trusted, err := auth.ParseNetworks(proxy)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid -auth.proxy")
+		}
+		chain = append(chain, auth.NewProxy(auth.ProxyConfig{
+			Trusted:    trusted,
+			TrustUnix:  proxyUnix,
+			UserHeader: proxyUser,
+			RoleHeader: proxyRole,
+		}, roles))
+	}
+
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	return chain, nil
+}
+
+// queryFlags are the flags of the query mode.
+type queryFlags struct {
+	*flag.FlagSet
+
+	debug           *bool
+	apiAddr         *string
+	metricsAddr     *string
+	fileStore       *string
+	historyLog      *string
+	schemaFile      *string
+	formsFile       *string
+	uiLocal         *bool
+	uiReload        *time.Duration
+	sameSite        *string
+	secure          *bool
+	htpasswd        *string
+	tokens          *string
+	proxy           *string
+	proxyUser       *string
+	proxyRole       *string
+	proxyUnix       *bool
+	editors         *string
+	readTimeout     *time.Duration
+	writeTimeout    *time.Duration
+	idleTimeout     *time.Duration
+	shutdownTimeout *time.Duration
+	tlsCert         *string
+	tlsKey          *string
+	tlsClientCA     *string
+	tlsSelfSigned   *bool
+	tlsReload       *time.Duration
+	unixMode        *string
+	unixGroup       *string
+}
+
+func newQueryFlags() *queryFlags {
+	flagset := flag.NewFlagSet("query", flag.ExitOnError)
+	configFile(flagset)
+	return &queryFlags{
+		FlagSet: flagset,
+
+		debug:           flagset.Bool("debug", false, "debug logging"),
+		apiAddr:         flagset.String("api", defaultAPIAddr, "listen address for query API"),
+		metricsAddr:     flagset.String("metrics", "", "listen address for the prometheus metrics and the health checks, empty doesn't serve them"),
+		fileStore:       flagset.String("filestore", defaultFileStore, "location of the store, a csv file path or a url (csv, json, jsonl, sqlite, wal, mem)"),
+		historyLog:      flagset.String("history", defaultHistory, "location of the history of revisions, empty keeps them in memory only"),
+		schemaFile:      flagset.String("schema", "", "location of the form schema (yaml or json), empty uses a first name and last name"),
+		formsFile:       flagset.String("forms", "", "location of the forms to serve (yaml or json), empty serves a single form from the flags above"),
+		uiLocal:         flagset.Bool("ui.local", false, "ignores embedded files and goes straight to the filesystem"),
+		uiReload:        flagset.Duration("ui.reload", 0, "how often to check the views for changes, reloading the templates that changed, 0 never checks"),
+		sameSite:        flagset.String("csrf.samesite", "lax", "samesite setting of the csrf cookie (lax, strict, none, default)"),
+		secure:          flagset.Bool("csrf.secure", false, "only send the csrf cookie over https"),
+		htpasswd:        flagset.String("auth.htpasswd", "", "location of a htpasswd file (bcrypt only) for basic authentication"),
+		tokens:          flagset.String("auth.tokens", "", "location of a file of bearer tokens, one name:role:token per line"),
+		proxy:           flagset.String("auth.proxy", "", "comma separated addresses or networks of reverse proxies trusted to authenticate users"),
+		proxyUser:       flagset.String("auth.proxy.user", auth.DefaultUserHeader, "header holding the user authenticated by a trusted reverse proxy"),
+		proxyRole:       flagset.String("auth.proxy.role", "", "header holding the role (viewer or editor) of the user set by a trusted reverse proxy, empty uses -auth.editors"),
+		proxyUnix:       flagset.Bool("auth.proxy.unix", false, "trust every client of a unix:// -api socket as a reverse proxy, as they have no address"),
+		editors:         flagset.String("auth.editors", "", "comma separated users that are editors, everyone else is a viewer"),
+		readTimeout:     flagset.Duration("api.read.timeout", defaultReadTimeout, "maximum duration for reading a request, including the body"),
+		writeTimeout:    flagset.Duration("api.write.timeout", defaultWriteTimeout, "maximum duration for writing a response"),
+		idleTimeout:     flagset.Duration("api.idle.timeout", defaultIdleTimeout, "maximum duration to wait for the next request on a keep-alive connection"),
+		shutdownTimeout: flagset.Duration("shutdown.timeout", defaultShutdownTimeout, "maximum duration to wait for requests in flight to finish when shutting down"),
+		tlsCert:         flagset.String("tls.cert", "", "location of the certificate (pem) to serve https with"),
+		tlsKey:          flagset.String("tls.key", "", "location of the key (pem) of the certificate"),
+		tlsClientCA:     flagset.String("tls.client.ca", "", "location of the certificate authorities (pem) that clients have to present a certificate from"),
+		tlsSelfSigned:   flagset.Bool("tls.selfsigned", false, "serve https with a self-signed certificate, only for development"),
+		tlsReload:       flagset.Duration("tls.reload", defaultTLSReload, "how often to check the certificate files for changes, 0 never checks"),
+		unixMode:        flagset.String("api.unix.mode", defaultUnixMode, "permissions (octal) of the unix socket for a unix:// -api address"),
+		unixGroup:       flagset.String("api.unix.group", "", "group (name or id) of the unix socket for a unix:// -api address, empty keeps the group of the process"),
+	}
 }
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/SimonRichardson/formed/pkg/certs"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+const (
+	httpsNetwork = "https"
+
+	selfSignedValidFor = 365 * 24 * time.Hour
+)
+
+// tlsOptions describes how the certificate for https is found and whether
+// clients have to present a certificate of their own.
+type tlsOptions struct {
+	certFile   string
+	keyFile    string
+	clientCA   string
+	selfSigned bool
+}
+
+func (o tlsOptions) enabled() bool {
+	return o.certFile != "" || o.keyFile != "" || o.clientCA != "" || o.selfSigned
+}
+
+// newTLSConfig creates the configuration for serving https at the address.
+// The reloader is returned when the certificate is loaded from files, so that
+// changes to the files can be picked up, otherwise it's nil.
+func newTLSConfig(address string, options tlsOptions, logger log.Logger) (*tls.Config, *certs.Reloader, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	var reloader *certs.Reloader
+	switch {
+	case options.certFile != "" && options.keyFile != "":
+		var err error
+		if reloader, err = certs.NewReloader(options.certFile, options.keyFile, logger); err != nil {
+			return nil, nil, err
+		}
+		config.GetCertificate = reloader.GetCertificate
+
+	case options.certFile != "" || options.keyFile != "":
+		return nil, nil, errors.New("expected both -tls.cert and -tls.key")
+
+	case options.selfSigned:
+		cert, err := certs.SelfSigned(selfSignedHosts(address), selfSignedValidFor)
+		if err != nil {
+			return nil, nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+		level.Warn(logger).Log("msg", "serving a self-signed certificate, only use it for development", "fingerprint", certs.Fingerprint(cert))
+
+	default:
+		return nil, nil, errors.New("expected -tls.cert and -tls.key, or -tls.selfsigned, to serve https")
+	}
+
+	// Only clients with a certificate signed by one of the authorities are
+	// allowed to connect.
+	if options.clientCA != "" {
+		pool, err := certs.LoadPool(options.clientCA)
+		if err != nil {
+			return nil, nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, reloader, nil
+}
+
+// selfSignedHosts returns the hosts a self-signed certificate is valid for,
+// the host being listened on along with the loopback addresses.
+func selfSignedHosts(address string) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil || host == "" {
+		return hosts
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		return hosts
+	}
+	for _, v := range hosts {
+		if v == host {
+			return hosts
+		}
+	}
+	return append(hosts, host)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/tls"
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestNewTLSConfig(t *testing.T) {
+	t.Run("self-signed", func(t *testing.T) {
+		config, reloader, err := newTLSConfig("0.0.0.0:8443", tlsOptions{selfSigned: true}, log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reloader != nil {
+			t.Errorf("expected no reloader")
+		}
+		if expected, actual := 1, len(config.Certificates); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := tls.NoClientCert, config.ClientAuth; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	for _, testcase := range []struct {
+		name    string
+		options tlsOptions
+	}{
+		{"no certificate", tlsOptions{}},
+		{"missing key", tlsOptions{certFile: "cert.pem"}},
+		{"missing files", tlsOptions{certFile: "missing.pem", keyFile: "missing.pem"}},
+		{"missing client ca", tlsOptions{selfSigned: true, clientCA: "missing.pem"}},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			if _, _, err := newTLSConfig("localhost:8443", testcase.options, log.NewNopLogger()); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestSelfSignedHosts(t *testing.T) {
+	for _, testcase := range []struct {
+		address  string
+		expected []string
+	}{
+		{"0.0.0.0:8443", []string{"localhost", "127.0.0.1", "::1"}},
+		{"localhost:8443", []string{"localhost", "127.0.0.1", "::1"}},
+		{"formed.local:8443", []string{"localhost", "127.0.0.1", "::1", "formed.local"}},
+		{"10.0.0.1:8443", []string{"localhost", "127.0.0.1", "::1", "10.0.0.1"}},
+	} {
+		if expected, actual := testcase.expected, selfSignedHosts(testcase.address); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("%q: expected: %v, actual: %v", testcase.address, expected, actual)
+		}
+	}
+}
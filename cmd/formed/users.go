@@ -0,0 +1,444 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/SimonRichardson/formed/pkg/forms"
+	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/SimonRichardson/formed/pkg/schema"
+	"github.com/SimonRichardson/formed/pkg/store"
+	"github.com/SimonRichardson/formed/pkg/transfer"
+	"github.com/pkg/errors"
+)
+
+// formatTable lists the users as a table, every other format is a file
+// format.
+const formatTable = "table"
+
+// usersRemoteAddr is who the revisions written by the users mode are made by.
+const usersRemoteAddr = "cli"
+
+// runUsers lists, changes, imports or exports the users of a form through the
+// same store as the query api. Every change is written at the version that
+// was read, so a change made by the server in the meantime is reported as a
+// conflict instead of being overwritten.
+func runUsers(args []string) error {
+	flags := newUsersFlags()
+
+	flags.Usage = usageFor(flags.FlagSet, "users [flags] list|add|remove|edit|import|export [args]")
+	if _, err := parseFlags(flags.FlagSet, args); err != nil {
+		return err
+	}
+
+	config, err := loadForms(*flags.formsFile, forms.FormConfig{
+		Schema:    *flags.schemaFile,
+		FileStore: *flags.fileStore,
+		History:   *flags.historyLog,
+	})
+	if err != nil {
+		return err
+	}
+
+	form, err := selectForm(config, *flags.formName)
+	if err != nil {
+		return err
+	}
+
+	schema, err := loadSchema(form.Schema)
+	if err != nil {
+		return err
+	}
+
+	history, err := openHistory(form, schema, discardStoreMetrics(), newCLILogger())
+	if err != nil {
+		return err
+	}
+	defer history.Close()
+
+	var (
+		s       = history.Store(usersRemoteAddr)
+		columns = schema.Columns()
+		rest    = flags.Args()
+	)
+	if len(rest) > 0 {
+		rest = rest[1:]
+	}
+
+	switch flags.Arg(0) {
+	case "list", "":
+		users, _, err := s.Read()
+		if err != nil {
+			return err
+		}
+		if *flags.format == "" || *flags.format == formatTable {
+			return writeTable(os.Stdout, columns, users)
+		}
+
+		format, err := transfer.ParseFormat(*flags.format)
+		if err != nil {
+			return err
+		}
+		options, err := flags.options()
+		if err != nil {
+			return err
+		}
+		return transfer.Export(os.Stdout, format, columns, users, options)
+
+	case "add":
+		fields, err := parseFields(rest)
+		if err != nil {
+			return err
+		}
+
+		user := schema.New()
+		user.ID = models.NewID()
+		for k, v := range fields {
+			user.Set(k, v)
+		}
+
+		if err := updateUsers(s, schema, func(users []models.User) ([]models.User, error) {
+			return append(users, user), nil
+		}); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "added user %s\n", user.ID)
+		return nil
+
+	case "edit":
+		if len(rest) == 0 {
+			return errors.New("expected the id of a user to edit")
+		}
+		id := rest[0]
+
+		fields, err := parseFields(rest[1:])
+		if err != nil {
+			return err
+		}
+
+		if err := updateUsers(s, schema, func(users []models.User) ([]models.User, error) {
+			index := indexOf(users, id)
+			if index < 0 {
+				return nil, errors.Errorf("no user found for id %q", id)
+			}
+
+			user := users[index].Copy()
+			for k, v := range fields {
+				user.Set(k, v)
+			}
+			users[index] = user
+			return users, nil
+		}); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "edited user %s\n", id)
+		return nil
+
+	case "remove":
+		if len(rest) == 0 {
+			return errors.New("expected the ids of the users to remove")
+		}
+
+		if err := updateUsers(s, schema, func(users []models.User) ([]models.User, error) {
+			for _, id := range rest {
+				index := indexOf(users, id)
+				if index < 0 {
+					return nil, errors.Errorf("no user found for id %q", id)
+				}
+				users = append(users[:index], users[index+1:]...)
+			}
+			return users, nil
+		}); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "removed %d user(s)\n", len(rest))
+		return nil
+
+	case "import":
+		path := firstArg(rest)
+		format, err := fileFormat(*flags.format, path, transfer.CSV)
+		if err != nil {
+			return err
+		}
+		options, err := flags.options()
+		if err != nil {
+			return err
+		}
+		mode, err := transfer.ParseMode(*flags.importMode)
+		if err != nil {
+			return err
+		}
+
+		var rows []transfer.Row
+		if err := withInput(path, func(r io.Reader) error {
+			var err error
+			rows, err = transfer.Read(r, format, columns, options)
+			return err
+		}); err != nil {
+			return err
+		}
+
+		users, version, err := s.Read()
+		if err != nil {
+			return err
+		}
+
+		users, report := transfer.Import(users, rows, mode, schema)
+		report.DryRun = *flags.dryRun
+		if err := writeReport(os.Stdout, report); err != nil {
+			return err
+		}
+
+		switch {
+		case !report.Valid():
+			return errors.Errorf("%d error(s), nothing was imported", len(report.Errors))
+		case report.DryRun, !report.Changed():
+			return nil
+		}
+		return writeAt(s, users, version)
+
+	case "export":
+		path := firstArg(rest)
+		format, err := fileFormat(*flags.format, path, transfer.CSV)
+		if err != nil {
+			return err
+		}
+		options, err := flags.options()
+		if err != nil {
+			return err
+		}
+
+		users, _, err := s.Read()
+		if err != nil {
+			return err
+		}
+		return withOutput(path, func(w io.Writer) error {
+			return transfer.Export(w, format, columns, users, options)
+		})
+
+	default:
+		flags.Usage()
+		return errors.Errorf("unknown users command %q", flags.Arg(0))
+	}
+}
+
+// usersFlags are the flags of the users mode.
+type usersFlags struct {
+	*flag.FlagSet
+
+	fileStore  *string
+	historyLog *string
+	schemaFile *string
+	formsFile  *string
+	formName   *string
+	format     *string
+	delimiter  *string
+	encoding   *string
+	importMode *string
+	dryRun     *bool
+}
+
+func newUsersFlags() *usersFlags {
+	flagset := flag.NewFlagSet("users", flag.ExitOnError)
+	configFile(flagset)
+	return &usersFlags{
+		FlagSet: flagset,
+
+		fileStore:  flagset.String("filestore", defaultFileStore, "location of the store, a csv file path or a url (csv, json, jsonl, sqlite, wal, mem)"),
+		historyLog: flagset.String("history", defaultHistory, "location of the history of revisions"),
+		schemaFile: flagset.String("schema", "", "location of the form schema (yaml or json), empty uses a first name and last name"),
+		formsFile:  flagset.String("forms", "", "location of the forms (yaml or json), empty uses the form from the flags above"),
+		formName:   flagset.String("form", "", "name of the form in the forms file, can be empty if there's only one"),
+		format:     flagset.String("format", "", "format of the users (table, csv, json, ndjson or xlsx), empty lists a table and imports or exports by the extension of the file, otherwise csv"),
+		delimiter:  flagset.String("csv.delimiter", ",", "delimiter of a csv file, a single character or tab"),
+		encoding:   flagset.String("csv.encoding", string(transfer.UTF8), "encoding of a csv file (utf-8, utf-8-bom, latin1 or windows-1252)"),
+		importMode: flagset.String("import.mode", string(transfer.Merge), "how imported users are combined with the users in the store, merge updates and adds users, replace also removes every user that wasn't imported"),
+		dryRun:     flagset.Bool("import.dry-run", false, "report what an import would change without writing anything"),
+	}
+}
+
+func (f *usersFlags) options() (transfer.Options, error) {
+	delimiter, err := transfer.ParseDelimiter(*f.delimiter)
+	if err != nil {
+		return transfer.Options{}, err
+	}
+	encoding, err := transfer.ParseEncoding(*f.encoding)
+	if err != nil {
+		return transfer.Options{}, err
+	}
+	return transfer.Options{
+		Delimiter: delimiter,
+		Encoding:  encoding,
+	}, nil
+}
+
+// updateUsers reads the users, changes them with fn and then writes them back
+// at the version that was read. Only the users that fn added or changed are
+// validated, so that an invalid user already in the store doesn't get in the
+// way of fixing another one.
+func updateUsers(s store.Store, schema schema.Schema, fn func([]models.User) ([]models.User, error)) error {
+	users, version, err := s.Read()
+	if err != nil {
+		return err
+	}
+
+	before := make(map[string]models.User, len(users))
+	for _, v := range users {
+		before[v.ID] = v
+	}
+
+	changed, err := fn(append([]models.User(nil), users...))
+	if err != nil {
+		return err
+	}
+
+	for k, v := range changed {
+		if user, ok := before[v.ID]; ok && user.Equal(v) {
+			continue
+		}
+		if err := schema.ValidateRow(k, v); err != nil {
+			return err
+		}
+	}
+
+	return writeAt(s, changed, version)
+}
+
+// writeAt writes the users as long as the store is still at the version.
+func writeAt(s store.Store, users []models.User, version store.Version) error {
+	if _, err := s.Write(users, version); err != nil {
+		if _, ok := store.ErrConflict(err); ok {
+			return errors.Wrap(err, "users were changed while updating, nothing was written")
+		}
+		return err
+	}
+	return nil
+}
+
+// writeTable writes the users as a table, with the id first and then a value
+// for each of the columns.
+func writeTable(w io.Writer, columns []string, users []models.User) error {
+	header := append([]string{models.IDField}, columns...)
+
+	writer := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintf(writer, "%s\n", strings.ToUpper(strings.Join(header, "\t")))
+	for _, v := range users {
+		record, err := v.Marshal(header)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(writer, "%s\n", strings.Join(record, "\t"))
+	}
+	return writer.Flush()
+}
+
+// writeReport writes the summary of an import, followed by every row that
+// can't be imported.
+func writeReport(w io.Writer, report transfer.Report) error {
+	prefix := "imported"
+	if report.DryRun {
+		prefix = "dry run"
+	} else if !report.Valid() {
+		prefix = "not imported"
+	}
+	fmt.Fprintf(w, "%s (%s): %s\n", prefix, report.Mode, report)
+	if report.Valid() {
+		return nil
+	}
+
+	writer := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintf(writer, "\nROW\tID\tFIELD\tERROR\n")
+	for _, v := range report.Errors {
+		fmt.Fprintf(writer, "%d\t%s\t%s\t%s\n", v.Row, v.ID, v.Field, v.Message)
+	}
+	return writer.Flush()
+}
+
+// parseFields parses the values of the fields given as name=value.
+func parseFields(args []string) (models.Fields, error) {
+	if len(args) == 0 {
+		return nil, errors.New("expected the fields as name=value")
+	}
+
+	res := make(models.Fields, len(args))
+	for _, v := range args {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("expected a field as name=value, actual %q", v)
+		}
+		if parts[0] == models.IDField {
+			return nil, errors.Errorf("the %s of a user can't be changed", models.IDField)
+		}
+		res[parts[0]] = parts[1]
+	}
+	return res, nil
+}
+
+// fileFormat returns the format, or else the format named by the extension
+// of the path, or else the default format.
+func fileFormat(format, path string, defaultFormat transfer.Format) (transfer.Format, error) {
+	if format != "" {
+		return transfer.ParseFormat(format)
+	}
+	if ext := filepath.Ext(path); ext != "" {
+		if res, err := transfer.ParseFormat(ext); err == nil {
+			return res, nil
+		}
+	}
+	return defaultFormat, nil
+}
+
+// withInput reads from the file at path, or from stdin if the path is empty
+// or "-".
+func withInput(path string, fn func(io.Reader) error) error {
+	if path == "" || path == "-" {
+		return fn(os.Stdin)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "unable to open %q", path)
+	}
+	defer file.Close()
+
+	return fn(file)
+}
+
+// withOutput writes to the file at path, or to stdout if the path is empty or
+// "-".
+func withOutput(path string, fn func(io.Writer) error) error {
+	if path == "" || path == "-" {
+		return fn(os.Stdout)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return errors.Wrapf(err, "unable to create %q", path)
+	}
+	if err := fn(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func indexOf(users []models.User, id string) int {
+	for k, v := range users {
+		if v.ID == id {
+			return k
+		}
+	}
+	return -1
+}
+
+func firstArg(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
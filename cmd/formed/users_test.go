@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/SimonRichardson/formed/pkg/schema"
+	"github.com/SimonRichardson/formed/pkg/store"
+	"github.com/SimonRichardson/formed/pkg/transfer"
+)
+
+func TestParseFields(t *testing.T) {
+	t.Parallel()
+
+	fields, err := parseFields([]string{"firstname=Fred", "surname=Smith=Jones", "note="})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := (models.Fields{
+		"firstname": "Fred",
+		"surname":   "Smith=Jones",
+		"note":      "",
+	}), fields; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+
+	for _, args := range [][]string{
+		nil,
+		{"firstname"},
+		{"=Fred"},
+		{"id=1"},
+	} {
+		if _, err := parseFields(args); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	if err := writeTable(&buf, []string{"firstname", "surname"}, []models.User{
+		{ID: "1", Fields: models.Fields{"firstname": "Fred", "surname": "Smith"}},
+		{ID: "2", Fields: models.Fields{"firstname": "Jane", "surname": "Doe, Jr"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "ID  FIRSTNAME  SURNAME\n1   Fred       Smith\n2   Jane       Doe, Jr\n", buf.String(); expected != actual {
+		t.Errorf("expected: %q, actual: %q", expected, actual)
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	if err := writeReport(&buf, transfer.Report{
+		Mode: transfer.Merge,
+		Rows: 2,
+		Errors: []transfer.RowError{
+			{Row: 3, Field: "surname", Rule: schema.RuleRequired, Message: "expected Last name to not be empty"},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "not imported (merge): 2 row(s), 0 added, 0 updated, 0 removed, 0 unchanged, 1 error(s)\n"+
+		"\n"+
+		"ROW  ID  FIELD    ERROR\n"+
+		"3        surname  expected Last name to not be empty\n", buf.String(); expected != actual {
+		t.Errorf("expected: %q, actual: %q", expected, actual)
+	}
+}
+
+func TestFileFormat(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		format, path string
+		expected     transfer.Format
+	}{
+		{"", "", transfer.CSV},
+		{"", "people.XLSX", transfer.XLSX},
+		{"", "people.txt", transfer.CSV},
+		{"json", "people.xlsx", transfer.JSON},
+	} {
+		actual, err := fileFormat(testcase.format, testcase.path, transfer.CSV)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := testcase.expected; expected != actual {
+			t.Errorf("(%q, %q): expected: %v, actual: %v", testcase.format, testcase.path, expected, actual)
+		}
+	}
+
+	if _, err := fileFormat("pdf", "", transfer.CSV); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestUpdateUsers(t *testing.T) {
+	t.Parallel()
+
+	// The first user is already invalid, which shouldn't prevent changing any
+	// of the others.
+	s := store.NewMemory()
+	version, err := s.Write([]models.User{
+		{ID: "1", Fields: models.Fields{"firstname": "", "surname": "Smith"}},
+		{ID: "2", Fields: models.Fields{"firstname": "Jane", "surname": "Doe"}},
+	}, store.AnyVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		if err := updateUsers(s, schema.Default(), func(users []models.User) ([]models.User, error) {
+			users[1].Set("surname", "Smith")
+			return users, nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		users, _, err := s.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := "Smith", users[1].Get("surname"); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		err := updateUsers(s, schema.Default(), func(users []models.User) ([]models.User, error) {
+			return append(users, models.User{ID: "3", Fields: models.Fields{"firstname": "Fred"}}), nil
+		})
+		if _, ok := schema.ErrValidation(err); !ok {
+			t.Errorf("expected a validation error, actual %v", err)
+		}
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		err := updateUsers(s, schema.Default(), func(users []models.User) ([]models.User, error) {
+			// Someone else writes after the users were read.
+			if _, err := s.Write(users[1:], store.AnyVersion); err != nil {
+				t.Fatal(err)
+			}
+			return users[:1], nil
+		})
+		if _, ok := store.ErrConflict(err); !ok {
+			t.Errorf("expected a conflict, actual %v", err)
+		}
+
+		// Nothing was written over the other change.
+		users, current, err := s.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if current == version || len(users) != 1 || users[0].ID != "2" {
+			t.Errorf("expected only the other change, actual %v", users)
+		}
+	})
+}
@@ -1,18 +1,36 @@
 package main
 
 import (
+	"fmt"
 	"net"
 	"net/url"
+	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/pkg/errors"
 )
 
-// "udp://host:1234", 80 => udp host:1234 host 1234
-// "host:1234", 80       => tcp host:1234 host 1234
-// "host", 80            => tcp host:80   host 80
+// "udp://host:1234", 80         => udp host:1234 host 1234
+// "host:1234", 80               => tcp host:1234 host 1234
+// "host", 80                    => tcp host:80   host 80
+// "unix:///run/formed.sock", 80 => unix /run/formed.sock
+// "systemd://api", 80           => systemd api
 func parseAddr(addr string, defaultPort int) (network, address string, err error) {
+	// The path of a socket is case sensitive and the name of a socket passed
+	// by systemd isn't a host, so neither are parsed as a url.
+	for _, scheme := range []string{unixNetwork, systemdNetwork} {
+		if prefix := scheme + ":"; len(addr) >= len(prefix) && strings.EqualFold(addr[:len(prefix)], prefix) {
+			address = strings.TrimPrefix(addr[len(prefix):], "//")
+			if scheme == unixNetwork && address == "" {
+				return network, address, errors.Errorf("%s: expected the path of the socket", addr)
+			}
+			return scheme, address, nil
+		}
+	}
+
 	u, err := url.Parse(strings.ToLower(addr))
 	if err != nil {
 		return network, address, err
@@ -33,3 +51,27 @@ func parseAddr(addr string, defaultPort int) (network, address string, err error
 
 	return u.Scheme, u.Host, nil
 }
+
+// signalError is returned by interrupt when a signal was received.
+type signalError struct {
+	os.Signal
+}
+
+func (e signalError) Error() string {
+	return fmt.Sprintf("received signal %s", e.Signal)
+}
+
+// interrupt waits for SIGINT or SIGTERM, returning a signalError, or for
+// cancel to be closed.
+func interrupt(cancel <-chan struct{}) error {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(c)
+
+	select {
+	case sig := <-c:
+		return signalError{sig}
+	case <-cancel:
+		return errors.New("canceled")
+	}
+}
@@ -1,6 +1,12 @@
 package main
 
-import "testing"
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+)
 
 func TestParseAddr(t *testing.T) {
 	for _, testcase := range []struct {
@@ -14,6 +20,11 @@ func TestParseAddr(t *testing.T) {
 		{"udp://foo", 123, "udp", "foo:123"},
 		{"udp://foo:8080", 123, "udp", "foo:8080"},
 		{"tcp+dnssrv://testing:7650", 7650, "tcp+dnssrv", "testing:7650"},
+		{"https://foo", 123, "https", "foo:123"},
+		{"unix:///run/Formed.sock", 123, "unix", "/run/Formed.sock"},
+		{"unix:formed.sock", 123, "unix", "formed.sock"},
+		{"systemd://", 123, "systemd", ""},
+		{"SYSTEMD://api", 123, "systemd", "api"},
 	} {
 		network, address, err := parseAddr(testcase.addr, testcase.defaultPort)
 		if err != nil {
@@ -34,3 +45,47 @@ func TestParseAddr(t *testing.T) {
 		}
 	}
 }
+
+func TestInterrupt(t *testing.T) {
+	t.Run("signal", func(t *testing.T) {
+		// Catch the signal here too, so it can never end the test before
+		// interrupt is waiting for it.
+		caught := make(chan os.Signal, 1)
+		signal.Notify(caught, syscall.SIGTERM)
+		defer signal.Stop(caught)
+
+		errs := make(chan error)
+		go func() {
+			errs <- interrupt(make(chan struct{}))
+		}()
+
+		// Keep signalling until interrupt is waiting for it.
+		var err error
+	loop:
+		for {
+			select {
+			case err = <-errs:
+				break loop
+			case <-time.After(10 * time.Millisecond):
+				syscall.Kill(os.Getpid(), syscall.SIGTERM)
+			}
+		}
+
+		sig, ok := err.(signalError)
+		if !ok {
+			t.Fatalf("expected a signal error, actual: %v", err)
+		}
+		if expected, actual := os.Signal(syscall.SIGTERM), sig.Signal; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		cancel := make(chan struct{})
+		close(cancel)
+
+		if _, ok := interrupt(cancel).(signalError); ok {
+			t.Errorf("expected no signal error")
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// Role describes what an identity is allowed to do.
+type Role string
+
+// These are the roles an identity can have.
+const (
+	// RoleViewer can only read, i.e. render the form, list the users or
+	// browse the history.
+	RoleViewer Role = "viewer"
+
+	// RoleEditor can read and write, i.e. post the form, change users through
+	// the API or restore a revision.
+	RoleEditor Role = "editor"
+)
+
+// ParseRole returns the role for the name, one of viewer or editor.
+func ParseRole(name string) (Role, error) {
+	switch role := Role(name); role {
+	case RoleViewer, RoleEditor:
+		return role, nil
+	}
+	return "", errors.Errorf("unknown role %q, expected one of viewer or editor", name)
+}
+
+// Allows reports whether the role is allowed to make a request with the
+// method. Only editors are allowed to make requests that aren't safe, i.e.
+// anything other than reading.
+func (r Role) Allows(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS":
+		return r == RoleViewer || r == RoleEditor
+	}
+	return r == RoleEditor
+}
+
+// Roles holds the role of every identity that has been named, anyone else is
+// a viewer.
+type Roles map[string]Role
+
+// Get returns the role for the name.
+func (r Roles) Get(name string) Role {
+	if role, ok := r[name]; ok {
+		return role
+	}
+	return RoleViewer
+}
+
+// Identity is who made the request and what they're allowed to do.
+type Identity struct {
+	Name string
+	Role Role
+}
+
+var (
+	// ErrNoCredentials is returned when the request holds no credentials that
+	// the authenticator understands.
+	ErrNoCredentials = errors.New("no credentials")
+
+	// ErrInvalidCredentials is returned when the request holds credentials,
+	// but they're not valid.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Authenticator works out the identity of a request.
+type Authenticator interface {
+	// Authenticate returns the identity of the request. ErrNoCredentials is
+	// returned if the request holds nothing for the authenticator, so that
+	// another authenticator can be tried.
+	Authenticate(r *http.Request) (Identity, error)
+}
+
+// Chain tries every authenticator in turn, until one of them finds
+// credentials in the request.
+type Chain []Authenticator
+
+// Authenticate returns the identity from the first authenticator that finds
+// credentials in the request.
+func (c Chain) Authenticate(r *http.Request) (Identity, error) {
+	for _, a := range c {
+		identity, err := a.Authenticate(r)
+		if err == ErrNoCredentials {
+			continue
+		}
+		return identity, err
+	}
+	return Identity{}, ErrNoCredentials
+}
+
+type contextKey struct{}
+
+// NewContext returns a context that holds the identity.
+func NewContext(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, identity)
+}
+
+// FromContext returns the identity held by the context, if there is one.
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(contextKey{}).(Identity)
+	return identity, ok
+}
+
+// Handler authenticates every request before it reaches next. Requests that
+// can't be authenticated are rejected with a 401 and requests that the role of
+// the identity doesn't allow are rejected with a 403. The identity is held by
+// the context of the request that reaches next.
+func Handler(a Authenticator, next http.Handler, logger log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, err := a.Authenticate(r)
+		if err != nil {
+			level.Debug(logger).Log("remote_addr", r.RemoteAddr, "err", err)
+
+			w.Header().Set("WWW-Authenticate", `Basic realm="formed", charset="UTF-8"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if !identity.Role.Allows(r.Method) {
+			level.Debug(logger).Log("user", identity.Name, "role", identity.Role, "method", r.Method, "path", r.URL.Path, "err", "forbidden")
+
+			http.Error(w, "forbidden, only editors can make changes", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), identity)))
+	})
+}
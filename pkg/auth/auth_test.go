@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestAllows(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		role     Role
+		method   string
+		expected bool
+	}{
+		{RoleViewer, "GET", true},
+		{RoleViewer, "HEAD", true},
+		{RoleViewer, "POST", false},
+		{RoleViewer, "DELETE", false},
+		{RoleEditor, "GET", true},
+		{RoleEditor, "POST", true},
+		{RoleEditor, "PATCH", true},
+		{Role(""), "GET", false},
+	} {
+		t.Run(string(testcase.role)+" "+testcase.method, func(t *testing.T) {
+			if expected, actual := testcase.expected, testcase.role.Allows(testcase.method); expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	t.Parallel()
+
+	chain := Chain{
+		NewTokens([]Token{{Identity: Identity{Name: "ci", Role: RoleEditor}, Token: "abc"}}),
+		NewBasic(map[string][]byte{"fred": []byte(testHash)}, Roles{}),
+	}
+
+	t.Run("first with credentials", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.SetBasicAuth("fred", "secret")
+
+		identity, err := chain.Authenticate(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := (Identity{Name: "fred", Role: RoleViewer}), identity; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("invalid credentials stop the chain", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("Authorization", "Bearer bad")
+
+		if expected, actual := ErrInvalidCredentials, errOf(chain.Authenticate(request)); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("no credentials", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/", nil)
+
+		if expected, actual := ErrNoCredentials, errOf(chain.Authenticate(request)); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	var (
+		authenticator = NewTokens([]Token{
+			{Identity: Identity{Name: "viewer", Role: RoleViewer}, Token: "view"},
+			{Identity: Identity{Name: "editor", Role: RoleEditor}, Token: "edit"},
+		})
+		next = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, ok := FromContext(r.Context())
+			if !ok {
+				t.Errorf("expected an identity")
+			}
+			w.Write([]byte(identity.Name))
+		})
+		handler = Handler(authenticator, next, log.NewNopLogger())
+	)
+
+	for _, testcase := range []struct {
+		name, method, token string
+		code                int
+		body                string
+	}{
+		{"no credentials", "GET", "", http.StatusUnauthorized, ""},
+		{"invalid credentials", "GET", "bad", http.StatusUnauthorized, ""},
+		{"viewer reads", "GET", "view", http.StatusOK, "viewer"},
+		{"viewer writes", "POST", "view", http.StatusForbidden, ""},
+		{"editor reads", "GET", "edit", http.StatusOK, "editor"},
+		{"editor writes", "POST", "edit", http.StatusOK, "editor"},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			var (
+				recorder = httptest.NewRecorder()
+				request  = httptest.NewRequest(testcase.method, "/", nil)
+			)
+			if testcase.token != "" {
+				request.Header.Set("Authorization", "Bearer "+testcase.token)
+			}
+
+			handler.ServeHTTP(recorder, request)
+
+			if expected, actual := testcase.code, recorder.Code; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+			if testcase.body != "" {
+				if expected, actual := testcase.body, recorder.Body.String(); expected != actual {
+					t.Errorf("expected: %v, actual: %v", expected, actual)
+				}
+			}
+			if testcase.code == http.StatusUnauthorized && recorder.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("expected a challenge")
+			}
+		})
+	}
+}
+
+func errOf(_ Identity, err error) error {
+	return err
+}
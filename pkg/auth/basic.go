@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/SimonRichardson/formed/pkg/fs"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// unknownUser is compared against when the user isn't known, so that it takes
+// just as long to reject an unknown user as it does a wrong password.
+var unknownUser = []byte("$2a$10$xuxFH4mEIrggGiwI.3b.muLv8YrpNFYl8.r/IL1FPTMhLD9U756RG")
+
+// Basic authenticates requests using HTTP basic authentication, checking the
+// password against the bcrypt hash of the user.
+type Basic struct {
+	users map[string][]byte
+	roles Roles
+}
+
+// NewBasic creates a Basic authenticator from the bcrypt hashes of the users.
+func NewBasic(users map[string][]byte, roles Roles) *Basic {
+	return &Basic{
+		users: users,
+		roles: roles,
+	}
+}
+
+// LoadBasic creates a Basic authenticator from the htpasswd file found at
+// path.
+func LoadBasic(fsys fs.Filesystem, path string, roles Roles) (*Basic, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open htpasswd at %q", path)
+	}
+	defer file.Close()
+
+	users, err := ParseHtpasswd(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid htpasswd at %q", path)
+	}
+	return NewBasic(users, roles), nil
+}
+
+// ParseHtpasswd reads the users of a htpasswd file, one `name:hash` per line.
+// Only bcrypt hashes are supported (i.e. `htpasswd -B`).
+func ParseHtpasswd(r io.Reader) (map[string][]byte, error) {
+	var (
+		users   = make(map[string][]byte)
+		scanner = bufio.NewScanner(r)
+	)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(text, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("line %d: expected name:hash", line)
+		}
+		if _, err := bcrypt.Cost([]byte(parts[1])); err != nil {
+			return nil, errors.Errorf("line %d: expected a bcrypt hash for %q", line, parts[0])
+		}
+		if _, ok := users[parts[0]]; ok {
+			return nil, errors.Errorf("line %d: duplicate user %q", line, parts[0])
+		}
+		users[parts[0]] = []byte(parts[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// Authenticate returns the identity of the user found in the basic
+// authentication of the request.
+func (b *Basic) Authenticate(r *http.Request) (Identity, error) {
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return Identity{}, ErrNoCredentials
+	}
+
+	hash, ok := b.users[name]
+	if !ok {
+		bcrypt.CompareHashAndPassword(unknownUser, []byte(password))
+		return Identity{}, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+		return Identity{}, ErrInvalidCredentials
+	}
+
+	return Identity{
+		Name: name,
+		Role: b.roles.Get(name),
+	}, nil
+}
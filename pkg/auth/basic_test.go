@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testHash is the bcrypt hash of "secret".
+const testHash = "$2a$04$YjMHx5.yzTSuqjQAT4mm8uzuaC6Tlw9XFMN3ZrKsdna6sbeMgIuDi"
+
+func TestParseHtpasswd(t *testing.T) {
+	t.Parallel()
+
+	t.Run("valid", func(t *testing.T) {
+		users, err := ParseHtpasswd(strings.NewReader("# editors\nfred:" + testHash + "\n\njane:" + testHash + "\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := 2, len(users); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := testHash, string(users["jane"]); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	for _, testcase := range []struct {
+		name, input, message string
+	}{
+		{"missing hash", "fred\n", "line 1: expected name:hash"},
+		{"not bcrypt", "fred:{SHA}abc\n", `line 1: expected a bcrypt hash for "fred"`},
+		{"duplicate", "fred:" + testHash + "\nfred:" + testHash + "\n", `line 2: duplicate user "fred"`},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			_, err := ParseHtpasswd(strings.NewReader(testcase.input))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if expected, actual := testcase.message, err.Error(); expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		})
+	}
+}
+
+func TestBasic(t *testing.T) {
+	t.Parallel()
+
+	basic := NewBasic(map[string][]byte{
+		"fred": []byte(testHash),
+		"jane": []byte(testHash),
+	}, Roles{"jane": RoleEditor})
+
+	for _, testcase := range []struct {
+		name, user, password string
+		identity             Identity
+		err                  error
+	}{
+		{"viewer", "fred", "secret", Identity{Name: "fred", Role: RoleViewer}, nil},
+		{"editor", "jane", "secret", Identity{Name: "jane", Role: RoleEditor}, nil},
+		{"wrong password", "fred", "guess", Identity{}, ErrInvalidCredentials},
+		{"unknown user", "bob", "secret", Identity{}, ErrInvalidCredentials},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/", nil)
+			request.SetBasicAuth(testcase.user, testcase.password)
+
+			identity, err := basic.Authenticate(request)
+			if expected, actual := testcase.err, err; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+			if expected, actual := testcase.identity, identity; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		})
+	}
+
+	t.Run("no credentials", func(t *testing.T) {
+		_, err := basic.Authenticate(httptest.NewRequest("GET", "/", nil))
+		if expected, actual := ErrNoCredentials, err; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// These are the headers a reverse proxy is expected to set, if no other
+// headers are configured.
+const (
+	DefaultUserHeader = "X-Forwarded-User"
+	DefaultRoleHeader = "X-Forwarded-Role"
+)
+
+// ProxyConfig describes which reverse proxies are trusted and which headers
+// they set.
+type ProxyConfig struct {
+	// Trusted holds the networks the reverse proxies connect from, requests
+	// from anywhere else never have their headers trusted.
+	Trusted []*net.IPNet
+
+	// TrustUnix trusts every request that arrives over a unix socket, which
+	// has no address to check against Trusted. Only those who can connect to
+	// the socket, as set by its permissions, can send such a request.
+	TrustUnix bool
+
+	// UserHeader holds the name of the authenticated user.
+	UserHeader string
+
+	// RoleHeader optionally holds the role of the user, if it's empty or
+	// missing then the role is found in the roles.
+	RoleHeader string
+}
+
+// ParseNetworks parses a comma separated list of networks, a single address
+// is taken to be a network of its own.
+func ParseNetworks(value string) ([]*net.IPNet, error) {
+	var res []*net.IPNet
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, errors.Errorf("invalid address %q", v)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			res = append(res, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid network %q", v)
+		}
+		res = append(res, network)
+	}
+	return res, nil
+}
+
+// Proxy authenticates requests from a trusted reverse proxy, which has
+// already authenticated the user and passes the name on in a header.
+type Proxy struct {
+	config ProxyConfig
+	roles  Roles
+}
+
+// NewProxy creates a Proxy authenticator.
+func NewProxy(config ProxyConfig, roles Roles) *Proxy {
+	if config.UserHeader == "" {
+		config.UserHeader = DefaultUserHeader
+	}
+	return &Proxy{
+		config: config,
+		roles:  roles,
+	}
+}
+
+// Authenticate returns the identity named by the headers of the request, if
+// the request came from a trusted reverse proxy.
+func (p *Proxy) Authenticate(r *http.Request) (Identity, error) {
+	name := r.Header.Get(p.config.UserHeader)
+	if name == "" || !p.trusted(r) {
+		return Identity{}, ErrNoCredentials
+	}
+
+	role := p.roles.Get(name)
+	if p.config.RoleHeader != "" {
+		if value := r.Header.Get(p.config.RoleHeader); value != "" {
+			var err error
+			if role, err = ParseRole(value); err != nil {
+				return Identity{}, ErrInvalidCredentials
+			}
+		}
+	}
+
+	return Identity{
+		Name: name,
+		Role: role,
+	}, nil
+}
+
+// trusted returns if the request came from a trusted reverse proxy. The peer
+// of a unix socket has no address, its RemoteAddr is empty or "@", so the
+// listener the request arrived on is checked instead.
+func (p *Proxy) trusted(r *http.Request) bool {
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok && addr.Network() == "unix" {
+		return p.config.TrustUnix
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range p.config.Trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseNetworks(t *testing.T) {
+	t.Parallel()
+
+	networks, err := ParseNetworks("127.0.0.1, 10.0.0.0/8,::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "127.0.0.1/32 10.0.0.0/8 ::1/128", networksString(networks); expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+
+	if _, err := ParseNetworks("10.0.0.0/33"); err == nil {
+		t.Errorf("expected an error")
+	}
+	if _, err := ParseNetworks("localhost"); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestProxy(t *testing.T) {
+	t.Parallel()
+
+	trusted, err := ParseNetworks("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := NewProxy(ProxyConfig{
+		Trusted:    trusted,
+		RoleHeader: DefaultRoleHeader,
+	}, Roles{"jane": RoleEditor})
+
+	for _, testcase := range []struct {
+		name, remoteAddr, user, role string
+		identity                     Identity
+		err                          error
+	}{
+		{"trusted", "10.0.0.1:1234", "fred", "", Identity{Name: "fred", Role: RoleViewer}, nil},
+		{"trusted editor", "10.0.0.1:1234", "jane", "", Identity{Name: "jane", Role: RoleEditor}, nil},
+		{"role from the proxy", "10.0.0.1:1234", "fred", "editor", Identity{Name: "fred", Role: RoleEditor}, nil},
+		{"unknown role from the proxy", "10.0.0.1:1234", "fred", "admin", Identity{}, ErrInvalidCredentials},
+		{"untrusted", "192.168.0.1:1234", "fred", "editor", Identity{}, ErrNoCredentials},
+		{"missing user", "10.0.0.1:1234", "", "", Identity{}, ErrNoCredentials},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/", nil)
+			request.RemoteAddr = testcase.remoteAddr
+			if testcase.user != "" {
+				request.Header.Set(DefaultUserHeader, testcase.user)
+			}
+			if testcase.role != "" {
+				request.Header.Set(DefaultRoleHeader, testcase.role)
+			}
+
+			identity, err := proxy.Authenticate(request)
+			if expected, actual := testcase.err, err; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+			if expected, actual := testcase.identity, identity; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		})
+	}
+}
+
+func TestProxyUnix(t *testing.T) {
+	t.Parallel()
+
+	trusted, err := ParseNetworks("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testcase := range []struct {
+		name       string
+		trustUnix  bool
+		remoteAddr string
+		identity   Identity
+		err        error
+	}{
+		{"trusted", true, "@", Identity{Name: "fred", Role: RoleViewer}, nil},
+		{"trusted without an address", true, "", Identity{Name: "fred", Role: RoleViewer}, nil},
+		{"untrusted", false, "@", Identity{}, ErrNoCredentials},
+		{"untrusted with a trusted address", false, "10.0.0.1:1234", Identity{}, ErrNoCredentials},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			proxy := NewProxy(ProxyConfig{
+				Trusted:   trusted,
+				TrustUnix: testcase.trustUnix,
+			}, Roles{})
+
+			request := httptest.NewRequest("GET", "/", nil)
+			request.RemoteAddr = testcase.remoteAddr
+			request.Header.Set(DefaultUserHeader, "fred")
+			request = request.WithContext(context.WithValue(request.Context(), http.LocalAddrContextKey, &net.UnixAddr{Name: "/run/formed.sock", Net: "unix"}))
+
+			identity, err := proxy.Authenticate(request)
+			if expected, actual := testcase.err, err; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+			if expected, actual := testcase.identity, identity; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		})
+	}
+
+	t.Run("over a unix socket", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "testdata")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "formed.sock")
+		listener, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		proxy := NewProxy(ProxyConfig{TrustUnix: true}, Roles{})
+		server := &http.Server{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				identity, err := proxy.Authenticate(r)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusUnauthorized)
+					return
+				}
+				io.WriteString(w, identity.Name)
+			}),
+		}
+		go server.Serve(listener)
+		defer server.Close()
+
+		client := &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", path)
+				},
+			},
+		}
+		request, err := http.NewRequest("GET", "http://formed/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set(DefaultUserHeader, "fred")
+
+		response, err := client.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+
+		body, err := ioutil.ReadAll(response.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := http.StatusOK, response.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := "fred", string(body); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func networksString(networks []*net.IPNet) string {
+	res := make([]string, len(networks))
+	for k, v := range networks {
+		res[k] = v.String()
+	}
+	return strings.Join(res, " ")
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/SimonRichardson/formed/pkg/fs"
+	"github.com/pkg/errors"
+)
+
+// Token is a static bearer token, along with the identity it belongs to.
+type Token struct {
+	Identity
+	Token string
+}
+
+// Tokens authenticates requests using static bearer tokens, i.e. the
+// `Authorization: Bearer <token>` header.
+type Tokens struct {
+	tokens []Token
+}
+
+// NewTokens creates a Tokens authenticator from the tokens.
+func NewTokens(tokens []Token) *Tokens {
+	return &Tokens{
+		tokens: tokens,
+	}
+}
+
+// LoadTokens creates a Tokens authenticator from the file found at path.
+func LoadTokens(fsys fs.Filesystem, path string) (*Tokens, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open tokens at %q", path)
+	}
+	defer file.Close()
+
+	tokens, err := ParseTokens(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid tokens at %q", path)
+	}
+	return NewTokens(tokens), nil
+}
+
+// ParseTokens reads the tokens, one `name:role:token` per line.
+func ParseTokens(r io.Reader) ([]Token, error) {
+	var (
+		tokens  []Token
+		scanner = bufio.NewScanner(r)
+	)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(text, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			return nil, errors.Errorf("line %d: expected name:role:token", line)
+		}
+		role, err := ParseRole(parts[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+		tokens = append(tokens, Token{
+			Identity: Identity{Name: parts[0], Role: role},
+			Token:    parts[2],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Authenticate returns the identity the bearer token of the request belongs
+// to.
+func (t *Tokens) Authenticate(r *http.Request) (Identity, error) {
+	header := r.Header.Get("Authorization")
+	if len(header) < len("Bearer ") || !strings.EqualFold(header[:len("Bearer ")], "Bearer ") {
+		return Identity{}, ErrNoCredentials
+	}
+
+	// Compare the digests, so that every comparison takes just as long
+	// whatever the length of the token.
+	digest := sha256.Sum256([]byte(strings.TrimSpace(header[len("Bearer "):])))
+	for _, v := range t.tokens {
+		expected := sha256.Sum256([]byte(v.Token))
+		if subtle.ConstantTimeCompare(digest[:], expected[:]) == 1 {
+			return v.Identity, nil
+		}
+	}
+	return Identity{}, ErrInvalidCredentials
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTokens(t *testing.T) {
+	t.Parallel()
+
+	t.Run("valid", func(t *testing.T) {
+		tokens, err := ParseTokens(strings.NewReader("# ci\nci:editor:abc:def\ndashboard:viewer:xyz\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []Token{
+			{Identity: Identity{Name: "ci", Role: RoleEditor}, Token: "abc:def"},
+			{Identity: Identity{Name: "dashboard", Role: RoleViewer}, Token: "xyz"},
+		}
+		if actual := tokens; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	for _, testcase := range []struct {
+		name, input string
+	}{
+		{"missing token", "ci:editor\n"},
+		{"empty token", "ci:editor:\n"},
+		{"unknown role", "ci:admin:abc\n"},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			if _, err := ParseTokens(strings.NewReader(testcase.input)); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestTokens(t *testing.T) {
+	t.Parallel()
+
+	tokens := NewTokens([]Token{
+		{Identity: Identity{Name: "ci", Role: RoleEditor}, Token: "abc"},
+	})
+
+	for _, testcase := range []struct {
+		name, header string
+		identity     Identity
+		err          error
+	}{
+		{"valid", "Bearer abc", Identity{Name: "ci", Role: RoleEditor}, nil},
+		{"case of the scheme", "bearer abc", Identity{Name: "ci", Role: RoleEditor}, nil},
+		{"invalid", "Bearer abd", Identity{}, ErrInvalidCredentials},
+		{"another scheme", "Basic abc", Identity{}, ErrNoCredentials},
+		{"missing", "", Identity{}, ErrNoCredentials},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/", nil)
+			if testcase.header != "" {
+				request.Header.Set("Authorization", testcase.header)
+			}
+
+			identity, err := tokens.Authenticate(request)
+			if expected, actual := testcase.err, err; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+			if expected, actual := testcase.identity, identity; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		})
+	}
+}
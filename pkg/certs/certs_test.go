@@ -0,0 +1,173 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestSelfSigned(t *testing.T) {
+	t.Parallel()
+
+	cert, err := SelfSigned([]string{"localhost", "127.0.0.1"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cert.Leaf.VerifyHostname("localhost"); err != nil {
+		t.Error(err)
+	}
+	if err := cert.Leaf.VerifyHostname("127.0.0.1"); err != nil {
+		t.Error(err)
+	}
+	if err := cert.Leaf.VerifyHostname("example.com"); err == nil {
+		t.Errorf("expected an error")
+	}
+	if expected, actual := 95, len(Fingerprint(cert)); expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+}
+
+func TestReloader(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		certFile = filepath.Join(dir, "cert.pem")
+		keyFile  = filepath.Join(dir, "key.pem")
+		modTime  = time.Now().Add(-time.Hour)
+	)
+
+	first := writePair(t, certFile, keyFile, modTime)
+	reloader, err := NewReloader(certFile, keyFile, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("loaded", func(t *testing.T) {
+		if expected, actual := Fingerprint(first), current(t, reloader); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		reloaded, err := reloader.Reload()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reloaded {
+			t.Errorf("expected nothing to be reloaded")
+		}
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		second := writePair(t, certFile, keyFile, modTime.Add(time.Minute))
+
+		reloaded, err := reloader.Reload()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reloaded {
+			t.Errorf("expected the certificate to be reloaded")
+		}
+		if expected, actual := Fingerprint(second), current(t, reloader); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("invalid keeps the last certificate", func(t *testing.T) {
+		before := current(t, reloader)
+
+		if err := ioutil.WriteFile(certFile, []byte("bad"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(certFile, modTime.Add(2*time.Minute), modTime.Add(2*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := reloader.Reload(); err == nil {
+			t.Errorf("expected an error")
+		}
+		if expected, actual := before, current(t, reloader); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestLoadPool(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		certFile = filepath.Join(dir, "cert.pem")
+		keyFile  = filepath.Join(dir, "key.pem")
+	)
+	cert := writePair(t, certFile, keyFile, time.Now())
+
+	pool, err := LoadPool(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{Roots: pool, DNSName: "localhost"}); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := LoadPool(keyFile); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func current(t *testing.T, reloader *Reloader) string {
+	cert, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Fingerprint(*cert)
+}
+
+func writePair(t *testing.T, certFile, keyFile string, modTime time.Time) tls.Certificate {
+	cert, err := SelfSigned([]string{"localhost"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, block := range map[string]*pem.Block{
+		certFile: &pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]},
+		keyFile:  &pem.Block{Type: "EC PRIVATE KEY", Bytes: key},
+	} {
+		var buf bytes.Buffer
+		if err := pem.Encode(&buf, block); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, buf.Bytes(), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cert
+}
@@ -0,0 +1,240 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/SimonRichardson/formed/pkg/fs"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// EnvPrefix is the prefix of every environment variable that sets a flag,
+// i.e. FORMED_API_READ_TIMEOUT sets -api.read.timeout.
+const EnvPrefix = "FORMED_"
+
+// Source is where the value of a setting came from, in order of precedence,
+// a flag always wins over the environment, which wins over the file.
+type Source string
+
+// These are the sources of a setting.
+const (
+	SourceFlag    Source = "flag"
+	SourceEnv     Source = "env"
+	SourceFile    Source = "file"
+	SourceDefault Source = "default"
+)
+
+// File holds the settings read from a configuration file, for every mode of
+// the CLI, keyed by the name of the flag without the dash.
+//
+//	query:
+//	  api: tcp://0.0.0.0:8080
+//	  auth:
+//	    htpasswd: ./data/htpasswd
+//	    editors: [fred, jane]
+//
+// Nested keys are joined with dots (auth.htpasswd) and lists are joined with
+// commas (auth.editors).
+type File struct {
+	Path  string
+	Modes map[string]map[string]string
+}
+
+// Load reads the configuration file at path.
+func Load(fsys fs.Filesystem, path string) (File, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return File{}, errors.Wrapf(err, "unable to open config at %q", path)
+	}
+	defer file.Close()
+
+	b, err := ioutil.ReadAll(file)
+	if err != nil {
+		return File{}, errors.Wrapf(err, "unable to read config at %q", path)
+	}
+	return Parse(path, b)
+}
+
+// Parse reads the configuration from YAML, or JSON, the path is only used to
+// describe where any error is.
+func Parse(path string, b []byte) (File, error) {
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return File{}, errors.Wrapf(err, "invalid config at %q", path)
+	}
+
+	res := File{
+		Path:  path,
+		Modes: make(map[string]map[string]string, len(raw)),
+	}
+	for mode, value := range raw {
+		section, ok := value.(map[interface{}]interface{})
+		if !ok && value != nil {
+			return File{}, errors.Errorf("%s: expected the settings of the mode %q, actual %v", path, mode, value)
+		}
+
+		settings := make(map[string]string)
+		if err := flatten(mode, "", section, settings); err != nil {
+			return File{}, errors.Wrapf(err, "%s", path)
+		}
+		res.Modes[mode] = settings
+	}
+	return res, nil
+}
+
+// Validate makes sure that the file only configures the modes given.
+func (f File) Validate(modes ...string) error {
+	known := make(map[string]struct{}, len(modes))
+	for _, v := range modes {
+		known[v] = struct{}{}
+	}
+	names := make([]string, 0, len(f.Modes))
+	for k := range f.Modes {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, ok := known[name]; !ok {
+			return errors.Errorf("%s: unknown mode %q, expected one of %s", f.Path, name, strings.Join(modes, ", "))
+		}
+	}
+	return nil
+}
+
+func flatten(mode, prefix string, section map[interface{}]interface{}, res map[string]string) error {
+	for k, v := range section {
+		name := fmt.Sprint(k)
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		if value, ok := v.(map[interface{}]interface{}); ok {
+			if err := flatten(mode, name, value, res); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// The same key can be written both nested and with dots.
+		if _, ok := res[name]; ok {
+			return errors.Errorf("duplicate key %q", mode+"."+name)
+		}
+
+		switch value := v.(type) {
+		case []interface{}:
+			values := make([]string, len(value))
+			for i, v := range value {
+				if !isScalar(v) {
+					return errors.Errorf("key %q: expected a list of values", mode+"."+name)
+				}
+				values[i] = fmt.Sprint(v)
+			}
+			res[name] = strings.Join(values, ",")
+		case nil:
+			res[name] = ""
+		default:
+			res[name] = fmt.Sprint(value)
+		}
+	}
+	return nil
+}
+
+func isScalar(v interface{}) bool {
+	switch v.(type) {
+	case map[interface{}]interface{}, []interface{}:
+		return false
+	}
+	return true
+}
+
+// Setting is the value that a flag ended up with and where it came from.
+type Setting struct {
+	Name   string
+	Value  string
+	Source Source
+
+	// Origin is the environment variable or the file that the value came
+	// from, it's empty for a flag or a default.
+	Origin string
+}
+
+// EnvKey returns the environment variable for the flag, i.e.
+// api.read.timeout is FORMED_API_READ_TIMEOUT.
+func EnvKey(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(name))
+}
+
+// Apply sets every flag that wasn't given on the command line, first from
+// the environment and then from the settings of the mode (the name of the
+// flagset) in the file. Any flag named in skip is left alone, i.e. the flag
+// naming the file. The settings of every flag are returned, sorted by name.
+func Apply(flagset *flag.FlagSet, file File, lookupEnv func(string) (string, bool), skip ...string) ([]Setting, error) {
+	var (
+		mode     = flagset.Name()
+		settings = file.Modes[mode]
+		given    = make(map[string]struct{})
+		skipped  = make(map[string]struct{}, len(skip))
+	)
+	flagset.Visit(func(f *flag.Flag) {
+		given[f.Name] = struct{}{}
+	})
+	for _, v := range skip {
+		skipped[v] = struct{}{}
+	}
+
+	// Every key in the file has to be a flag, otherwise a typo would go
+	// unnoticed.
+	for _, name := range sortedKeys(settings) {
+		_, skip := skipped[name]
+		if f := flagset.Lookup(name); f == nil || skip {
+			return nil, errors.Errorf("%s: unknown key %q", file.Path, mode+"."+name)
+		}
+	}
+
+	var (
+		res []Setting
+		err error
+	)
+	flagset.VisitAll(func(f *flag.Flag) {
+		if _, ok := skipped[f.Name]; ok || err != nil {
+			return
+		}
+
+		setting := Setting{
+			Name:   f.Name,
+			Source: SourceDefault,
+		}
+		if _, ok := given[f.Name]; ok {
+			setting.Source = SourceFlag
+		} else if value, ok := lookupEnv(EnvKey(f.Name)); ok {
+			if e := flagset.Set(f.Name, value); e != nil {
+				err = errors.Errorf("invalid value %q for %s: %v", value, EnvKey(f.Name), e)
+				return
+			}
+			setting.Source, setting.Origin = SourceEnv, EnvKey(f.Name)
+		} else if value, ok := settings[f.Name]; ok {
+			if e := flagset.Set(f.Name, value); e != nil {
+				err = errors.Errorf("%s: invalid value %q for key %q: %v", file.Path, value, mode+"."+f.Name, e)
+				return
+			}
+			setting.Source, setting.Origin = SourceFile, file.Path
+		}
+		setting.Value = f.Value.String()
+		res = append(res, setting)
+	})
+	return res, err
+}
+
+func sortedKeys(m map[string]string) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
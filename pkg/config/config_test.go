@@ -0,0 +1,211 @@
+package config
+
+import (
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	t.Run("nested and lists", func(t *testing.T) {
+		file, err := Parse("formed.yaml", []byte(`
+query:
+  api: tcp://0.0.0.0:8080
+  api.read.timeout: 10s
+  auth:
+    htpasswd: ./data/htpasswd
+    editors: [fred, jane]
+  csrf.secure: true
+history:
+`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := map[string]map[string]string{
+			"query": map[string]string{
+				"api":              "tcp://0.0.0.0:8080",
+				"api.read.timeout": "10s",
+				"auth.htpasswd":    "./data/htpasswd",
+				"auth.editors":     "fred,jane",
+				"csrf.secure":      "true",
+			},
+			"history": map[string]string{},
+		}, file.Modes; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		file, err := Parse("formed.json", []byte(`{"query": {"api": "tcp://0.0.0.0:8080"}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := "tcp://0.0.0.0:8080", file.Modes["query"]["api"]; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	for _, testcase := range []struct {
+		name, body, err string
+	}{
+		{"not a mode", "query: tcp://0.0.0.0:8080", `mode "query"`},
+		{"duplicate key", "query:\n  auth.editors: fred\n  auth:\n    editors: jane", `duplicate key "query.auth.editors"`},
+		{"list of maps", "query:\n  auth.editors:\n    - name: fred", `key "query.auth.editors"`},
+		{"invalid", "query: [", "invalid config"},
+	} {
+		_, err := Parse("formed.yaml", []byte(testcase.body))
+		if err == nil {
+			t.Errorf("%s: expected an error", testcase.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), testcase.err) {
+			t.Errorf("%s: expected: %q in %q", testcase.name, testcase.err, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	file := File{
+		Path:  "formed.yaml",
+		Modes: map[string]map[string]string{"qeury": nil},
+	}
+	err := file.Validate("history", "query")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if expected, actual := `formed.yaml: unknown mode "qeury", expected one of history, query`, err.Error(); expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+}
+
+func TestEnvKey(t *testing.T) {
+	t.Parallel()
+
+	if expected, actual := "FORMED_API_READ_TIMEOUT", EnvKey("api.read.timeout"); expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+}
+
+func TestApply(t *testing.T) {
+	t.Parallel()
+
+	newFlags := func() (*flag.FlagSet, *string, *string, *time.Duration) {
+		flagset := flag.NewFlagSet("query", flag.ContinueOnError)
+		flagset.String("config", "", "")
+		var (
+			api     = flagset.String("api", "tcp://0.0.0.0:8080", "")
+			forms   = flagset.String("forms", "", "")
+			timeout = flagset.Duration("api.read.timeout", time.Second, "")
+		)
+		return flagset, api, forms, timeout
+	}
+
+	file := File{
+		Path: "formed.yaml",
+		Modes: map[string]map[string]string{
+			"query": map[string]string{
+				"api":              "tcp://127.0.0.1:1",
+				"forms":            "./forms.yaml",
+				"api.read.timeout": "10s",
+			},
+		},
+	}
+
+	t.Run("precedence", func(t *testing.T) {
+		flagset, api, forms, timeout := newFlags()
+		if err := flagset.Parse([]string{"-api", "tcp://127.0.0.1:3"}); err != nil {
+			t.Fatal(err)
+		}
+
+		settings, err := Apply(flagset, file, env(map[string]string{
+			"FORMED_API":   "tcp://127.0.0.1:2",
+			"FORMED_FORMS": "./other.yaml",
+		}), "config")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := "tcp://127.0.0.1:3", *api; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := "./other.yaml", *forms; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 10*time.Second, *timeout; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := []Setting{
+			{Name: "api", Value: "tcp://127.0.0.1:3", Source: SourceFlag},
+			{Name: "api.read.timeout", Value: "10s", Source: SourceFile, Origin: "formed.yaml"},
+			{Name: "forms", Value: "./other.yaml", Source: SourceEnv, Origin: "FORMED_FORMS"},
+		}, settings; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		flagset, api, _, _ := newFlags()
+		settings, err := Apply(flagset, File{}, env(nil), "config")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := "tcp://0.0.0.0:8080", *api; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := SourceDefault, settings[0].Source; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	for _, testcase := range []struct {
+		name string
+		file File
+		env  map[string]string
+		err  string
+	}{
+		{
+			name: "unknown key",
+			file: File{Path: "formed.yaml", Modes: map[string]map[string]string{"query": {"apii": "x"}}},
+			err:  `formed.yaml: unknown key "query.apii"`,
+		},
+		{
+			name: "config in the file",
+			file: File{Path: "formed.yaml", Modes: map[string]map[string]string{"query": {"config": "x"}}},
+			err:  `formed.yaml: unknown key "query.config"`,
+		},
+		{
+			name: "invalid value in the file",
+			file: File{Path: "formed.yaml", Modes: map[string]map[string]string{"query": {"api.read.timeout": "soon"}}},
+			err:  `formed.yaml: invalid value "soon" for key "query.api.read.timeout"`,
+		},
+		{
+			name: "invalid value in the environment",
+			env:  map[string]string{"FORMED_API_READ_TIMEOUT": "soon"},
+			err:  `invalid value "soon" for FORMED_API_READ_TIMEOUT`,
+		},
+	} {
+		flagset, _, _, _ := newFlags()
+		_, err := Apply(flagset, testcase.file, env(testcase.env), "config")
+		if err == nil {
+			t.Errorf("%s: expected an error", testcase.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), testcase.err) {
+			t.Errorf("%s: expected: %q in %q", testcase.name, testcase.err, err)
+		}
+	}
+}
+
+func env(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := values[key]
+		return value, ok
+	}
+}
@@ -0,0 +1,385 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/SimonRichardson/formed/pkg/forms"
+	"github.com/SimonRichardson/formed/pkg/fs"
+	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/SimonRichardson/formed/pkg/schema"
+	"github.com/SimonRichardson/formed/pkg/store"
+	"github.com/pkg/errors"
+)
+
+const (
+	apiPathUsers = "/api/v1/users"
+)
+
+type api struct {
+	store   store.Store
+	form    forms.Form
+	writer  http.ResponseWriter
+	request *http.Request
+}
+
+// NewAPI creates a JSON controller with the correct dependencies for the
+// query.API, users are validated using the schema of the form.
+func NewAPI(s store.Store, f forms.Form, w http.ResponseWriter, r *http.Request) APIController {
+	return &api{
+		store:   s,
+		form:    f,
+		writer:  w,
+		request: r,
+	}
+}
+
+// List writes out all the users in the store. If the query asks for a page,
+// either with an offset or after the id of a user, then only the users of the
+// page are written out, along with where the page is.
+func (a *api) List() {
+	query := a.request.URL.Query()
+	if !paged(query) {
+		users, version, ok := a.read()
+		if !ok {
+			return
+		}
+
+		a.render(http.StatusOK, version, usersResource{
+			Users:   users,
+			Version: version,
+		})
+		return
+	}
+
+	window, err := parseWindow(query, defaultPageLimit)
+	if err != nil {
+		a.error(http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := store.ReadPage(a.store, window)
+	if err != nil {
+		if _, ok := store.ErrCursor(err); ok {
+			a.error(http.StatusBadRequest, err)
+			return
+		}
+		a.error(storeStatus(err), errors.Wrap(err, "unable to read users"))
+		return
+	}
+
+	a.render(http.StatusOK, page.Version, usersResource{
+		Users:   page.Users,
+		Version: page.Version,
+		Page: &pageResource{
+			Offset: page.Offset,
+			Limit:  window.Limit,
+			Total:  page.Total,
+			Next:   page.Next,
+		},
+	})
+}
+
+// Create decodes a user from the request body and appends it to the
+// users in the store. The user is always given a new id.
+func (a *api) Create() {
+	user := a.form.Schema.New()
+	if !a.decode(&user) {
+		return
+	}
+	user.ID = models.NewID()
+
+	users, version, ok := a.readForWrite()
+	if !ok {
+		return
+	}
+
+	if !a.validate(len(users), user) {
+		return
+	}
+
+	users = append(users, user)
+	if version, ok = a.write(users, version); !ok {
+		return
+	}
+
+	a.writer.Header().Set("Location", fmt.Sprintf("%s%s/%s", a.form.Path, apiPathUsers, user.ID))
+	a.render(http.StatusCreated, version, user)
+}
+
+// Get writes out the user found at id. If no user is found then a not
+// found error will be written.
+func (a *api) Get(id string) {
+	users, version, ok := a.read()
+	if !ok {
+		return
+	}
+
+	index, ok := a.index(users, id)
+	if !ok {
+		return
+	}
+
+	a.render(http.StatusOK, version, users[index])
+}
+
+// Replace decodes a user from the request body and replaces the user
+// found at id with it. The id can't be changed.
+func (a *api) Replace(id string) {
+	user := a.form.Schema.New()
+	if !a.decode(&user) {
+		return
+	}
+	user.ID = id
+
+	users, version, ok := a.readForWrite()
+	if !ok {
+		return
+	}
+
+	index, ok := a.index(users, id)
+	if !ok {
+		return
+	}
+
+	if !a.validate(index, user) {
+		return
+	}
+
+	users[index] = user
+	if version, ok = a.write(users, version); !ok {
+		return
+	}
+
+	a.render(http.StatusOK, version, user)
+}
+
+// Patch decodes the fields present in the request body and merges them
+// into the user found at id.
+func (a *api) Patch(id string) {
+	users, version, ok := a.readForWrite()
+	if !ok {
+		return
+	}
+
+	index, ok := a.index(users, id)
+	if !ok {
+		return
+	}
+
+	// Decoding over the top of the existing user only replaces the fields
+	// that are present in the request body.
+	user := users[index]
+	if !a.decode(&user) {
+		return
+	}
+	user.ID = id
+
+	if !a.validate(index, user) {
+		return
+	}
+
+	users[index] = user
+	if version, ok = a.write(users, version); !ok {
+		return
+	}
+
+	a.render(http.StatusOK, version, user)
+}
+
+// Delete removes the user found at id from the store.
+func (a *api) Delete(id string) {
+	users, version, ok := a.readForWrite()
+	if !ok {
+		return
+	}
+
+	index, ok := a.index(users, id)
+	if !ok {
+		return
+	}
+
+	users = append(users[:index], users[index+1:]...)
+	if version, ok = a.write(users, version); !ok {
+		return
+	}
+
+	a.writer.Header().Set("ETag", etag(version))
+	a.writer.WriteHeader(http.StatusNoContent)
+}
+
+// NotFound declares a route that doesn't exist, so an error will be
+// written.
+func (a *api) NotFound() {
+	a.error(http.StatusNotFound, errors.New("not found"))
+}
+
+// MethodNotAllowed declares a route that exists, but doesn't support the
+// method requested, so an error will be written.
+func (a *api) MethodNotAllowed() {
+	a.error(http.StatusMethodNotAllowed, errors.Errorf("method %s not allowed", a.request.Method))
+}
+
+func (a *api) read() ([]models.User, store.Version, bool) {
+	users, version, err := a.store.Read()
+	if err != nil {
+		a.error(storeStatus(err), errors.Wrap(err, "unable to read users"))
+		return nil, store.AnyVersion, false
+	}
+	return users, version, true
+}
+
+// readForWrite reads the users, but also checks the version the client
+// expects (If-Match) against the version that was read. A request that could
+// have been sent by another site is forbidden, see checkSameSite.
+func (a *api) readForWrite() ([]models.User, store.Version, bool) {
+	if err := checkSameSite(a.request); err != nil {
+		a.error(http.StatusForbidden, err)
+		return nil, store.AnyVersion, false
+	}
+
+	users, version, ok := a.read()
+	if !ok {
+		return nil, store.AnyVersion, false
+	}
+
+	if match := ifMatch(a.request); match != store.AnyVersion && match != version {
+		a.error(http.StatusPreconditionFailed, errors.Errorf("expected version %q, actual version %q", match, version))
+		return nil, store.AnyVersion, false
+	}
+
+	return users, version, true
+}
+
+func (a *api) write(users []models.User, version store.Version) (store.Version, bool) {
+	version, err := a.store.Write(users, version)
+	if err != nil {
+		if conflict, ok := store.ErrConflict(err); ok {
+			a.error(http.StatusConflict, conflict)
+			return store.AnyVersion, false
+		}
+		a.error(storeStatus(err), errors.Wrap(err, "unable to write users"))
+		return store.AnyVersion, false
+	}
+	return version, true
+}
+
+// storeStatus returns the status code for an error from the store. Another
+// process holding on to the lock for the store is only temporary, so the
+// request can be tried again.
+func storeStatus(err error) int {
+	if _, ok := fs.ErrLockTimeout(err); ok {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func (a *api) decode(user *models.User) bool {
+	if !isJSON(a.request) {
+		a.error(http.StatusUnsupportedMediaType, errors.Errorf("expected a Content-Type of %q", mimeJSON))
+		return false
+	}
+	if err := json.NewDecoder(a.request.Body).Decode(user); err != nil {
+		a.error(http.StatusBadRequest, errors.Wrap(err, "invalid user data"))
+		return false
+	}
+	return true
+}
+
+// validate checks the user that will be held at index against the schema, so
+// the row of every violation matches the position of the user.
+func (a *api) validate(index int, user models.User) bool {
+	if err := a.form.Schema.ValidateRow(index, user); err != nil {
+		a.error(http.StatusUnprocessableEntity, err)
+		return false
+	}
+	return true
+}
+
+func (a *api) index(users []models.User, id string) (int, bool) {
+	for k, v := range users {
+		if v.ID == id {
+			return k, true
+		}
+	}
+	a.error(http.StatusNotFound, errors.Errorf("no user found for %q", id))
+	return 0, false
+}
+
+func (a *api) error(code int, err error) {
+	renderJSONError(a.writer, code, err)
+}
+
+func (a *api) render(code int, version store.Version, data interface{}) {
+	renderJSON(a.writer, code, version, data)
+}
+
+type usersResource struct {
+	Users   []models.User `json:"users"`
+	Version store.Version `json:"version"`
+	Page    *pageResource `json:"page,omitempty"`
+}
+
+// pageResource describes where a page of users is. Next is the id to read the
+// page that follows after, it's empty for the last page.
+type pageResource struct {
+	Offset int    `json:"offset"`
+	Limit  int    `json:"limit"`
+	Total  int    `json:"total"`
+	Next   string `json:"next,omitempty"`
+}
+
+type errorResource struct {
+	Error errorBody `json:"error"`
+}
+
+type errorBody struct {
+	Status     int                `json:"status"`
+	Message    string             `json:"message"`
+	Violations []schema.Violation `json:"violations,omitempty"`
+}
+
+// renderJSON writes the data as JSON, along with the version as an ETag if
+// there is one.
+func renderJSON(w http.ResponseWriter, code int, version store.Version, data interface{}) {
+	header := w.Header()
+	header.Set("Content-Type", "application/json; charset=utf-8")
+	if version != store.AnyVersion {
+		header.Set("ETag", etag(version))
+	}
+	w.WriteHeader(code)
+
+	json.NewEncoder(w).Encode(data)
+}
+
+// renderJSONError writes the error as a structured JSON error, including
+// every violation if the error is a validation error.
+func renderJSONError(w http.ResponseWriter, code int, err error) {
+	body := errorBody{
+		Status:  code,
+		Message: err.Error(),
+	}
+	if validation, ok := schema.ErrValidation(err); ok {
+		body.Violations = validation.Violations
+	}
+	renderJSON(w, code, store.AnyVersion, errorResource{
+		Error: body,
+	})
+}
+
+func etag(version store.Version) string {
+	return fmt.Sprintf("%q", version)
+}
+
+// ifMatch returns the version held in the If-Match header, a missing header
+// or a wildcard matches any version.
+func ifMatch(r *http.Request) store.Version {
+	match := strings.TrimSpace(r.Header.Get("If-Match"))
+	match = strings.TrimPrefix(match, "W/")
+	if match == "*" {
+		return store.AnyVersion
+	}
+	return store.Version(strings.Trim(match, `"`))
+}
@@ -0,0 +1,601 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SimonRichardson/formed/pkg/fs"
+	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/SimonRichardson/formed/pkg/schema"
+	"github.com/SimonRichardson/formed/pkg/store"
+	"github.com/SimonRichardson/formed/pkg/store/mock_store"
+	"github.com/golang/mock/gomock"
+)
+
+func TestAPIList(t *testing.T) {
+	t.Parallel()
+
+	t.Run("users", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore  = mock_store.NewMockStore(ctrl)
+			recorder   = httptest.NewRecorder()
+			controller = NewAPI(mockStore, testForm, recorder, httptest.NewRequest("GET", "/", nil))
+		)
+
+		mockStore.EXPECT().
+			Read().
+			Return([]models.User{models.User{ID: "a1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}}}, store.Version("abc"), nil)
+
+		controller.List()
+
+		if expected, actual := http.StatusOK, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := `"abc"`, recorder.Header().Get("ETag"); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		var resource usersResource
+		if err := json.NewDecoder(recorder.Body).Decode(&resource); err != nil {
+			t.Fatal(err)
+		}
+
+		want := usersResource{
+			Users: []models.User{
+				models.User{ID: "a1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+			},
+			Version: "abc",
+		}
+		if expected, actual := want, resource; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("pages", func(t *testing.T) {
+		users := []models.User{
+			models.User{ID: "a1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+			models.User{ID: "b2", Fields: models.Fields{"firstname": "jane", "surname": "smith"}},
+			models.User{ID: "c3", Fields: models.Fields{"firstname": "joe", "surname": "bloggs"}},
+		}
+
+		for _, testcase := range []struct {
+			name, query string
+			users       []models.User
+			page        pageResource
+		}{
+			{"first page", "limit=2", users[:2], pageResource{Offset: 0, Limit: 2, Total: 3, Next: "b2"}},
+			{"offset", "offset=1&limit=2", users[1:], pageResource{Offset: 1, Limit: 2, Total: 3}},
+			{"after", "after=a1&limit=1", users[1:2], pageResource{Offset: 1, Limit: 1, Total: 3, Next: "b2"}},
+			{"default limit", "offset=2", users[2:], pageResource{Offset: 2, Limit: defaultPageLimit, Total: 3}},
+		} {
+			t.Run(testcase.name, func(t *testing.T) {
+				ctrl := gomock.NewController(t)
+				defer ctrl.Finish()
+
+				var (
+					mockStore  = mock_store.NewMockStore(ctrl)
+					recorder   = httptest.NewRecorder()
+					controller = NewAPI(mockStore, testForm, recorder, httptest.NewRequest("GET", "/?"+testcase.query, nil))
+				)
+
+				expectScan(mockStore, users, store.Version("abc"), nil)
+
+				controller.List()
+
+				if expected, actual := http.StatusOK, recorder.Code; expected != actual {
+					t.Errorf("expected: %v, actual: %v", expected, actual)
+				}
+
+				var resource usersResource
+				if err := json.NewDecoder(recorder.Body).Decode(&resource); err != nil {
+					t.Fatal(err)
+				}
+
+				want := usersResource{
+					Users:   testcase.users,
+					Version: "abc",
+					Page:    &testcase.page,
+				}
+				if expected, actual := want, resource; !reflect.DeepEqual(expected, actual) {
+					t.Errorf("expected: %v, actual: %v", expected, actual)
+				}
+			})
+		}
+	})
+
+	t.Run("invalid page", func(t *testing.T) {
+		for _, query := range []string{
+			"limit=0",
+			"limit=abc",
+			"offset=-1",
+			"offset=1&after=a1",
+		} {
+			ctrl := gomock.NewController(t)
+
+			var (
+				mockStore  = mock_store.NewMockStore(ctrl)
+				recorder   = httptest.NewRecorder()
+				controller = NewAPI(mockStore, testForm, recorder, httptest.NewRequest("GET", "/?"+query, nil))
+			)
+
+			controller.List()
+
+			if expected, actual := http.StatusBadRequest, recorder.Code; expected != actual {
+				t.Errorf("%s: expected: %v, actual: %v", query, expected, actual)
+			}
+			ctrl.Finish()
+		}
+	})
+
+	t.Run("unknown cursor", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore  = mock_store.NewMockStore(ctrl)
+			recorder   = httptest.NewRecorder()
+			controller = NewAPI(mockStore, testForm, recorder, httptest.NewRequest("GET", "/?after=z9", nil))
+		)
+
+		expectScan(mockStore, []models.User{models.User{ID: "a1"}}, store.Version("abc"), nil)
+
+		controller.List()
+
+		if expected, actual := http.StatusBadRequest, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("store error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore  = mock_store.NewMockStore(ctrl)
+			recorder   = httptest.NewRecorder()
+			controller = NewAPI(mockStore, testForm, recorder, httptest.NewRequest("GET", "/", nil))
+		)
+
+		mockStore.EXPECT().
+			Read().
+			Return(nil, store.AnyVersion, errors.New("permissions error"))
+
+		controller.List()
+
+		if expected, actual := http.StatusInternalServerError, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		var resource errorResource
+		if err := json.NewDecoder(recorder.Body).Decode(&resource); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := http.StatusInternalServerError, resource.Error.Status; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("store locked", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore  = mock_store.NewMockStore(ctrl)
+			recorder   = httptest.NewRecorder()
+			controller = NewAPI(mockStore, testForm, recorder, httptest.NewRequest("GET", "/", nil))
+		)
+
+		mockStore.EXPECT().
+			Read().
+			Return(nil, store.AnyVersion, &fs.LockTimeoutError{Path: "users.csv", Mode: fs.Shared, Timeout: time.Second})
+
+		controller.List()
+
+		if expected, actual := http.StatusServiceUnavailable, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestAPICreate(t *testing.T) {
+	t.Parallel()
+
+	t.Run("valid user", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore  = mock_store.NewMockStore(ctrl)
+			recorder   = httptest.NewRecorder()
+			request    = newJSONRequest("POST", "/", strings.NewReader(`{"firstname":"jane","surname":"doe"}`))
+			controller = NewAPI(mockStore, testForm, recorder, request)
+		)
+
+		mockStore.EXPECT().
+			Read().
+			Return([]models.User{models.User{ID: "a1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}}}, store.Version("abc"), nil)
+		var written []models.User
+		mockStore.EXPECT().
+			Write(gomock.Any(), store.Version("abc")).
+			Do(func(users []models.User, version store.Version) {
+				written = users
+			}).
+			Return(store.Version("def"), nil)
+
+		controller.Create()
+
+		if expected, actual := http.StatusCreated, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		// The new user is given an id, which addresses it from then on.
+		if expected, actual := 2, len(written); expected != actual {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+		created := written[1]
+		if expected, actual := true, created.ID != "" && created.ID != "a1"; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := "jane", created.Get("firstname"); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := "/query/people/api/v1/users/"+created.ID, recorder.Header().Get("Location"); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := `"def"`, recorder.Header().Get("ETag"); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("invalid user", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore  = mock_store.NewMockStore(ctrl)
+			recorder   = httptest.NewRecorder()
+			request    = newJSONRequest("POST", "/", strings.NewReader(`{"firstname":"jane"}`))
+			controller = NewAPI(mockStore, testForm, recorder, request)
+		)
+
+		mockStore.EXPECT().
+			Read().
+			Return([]models.User{models.User{ID: "a1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}}}, store.Version("abc"), nil)
+
+		controller.Create()
+
+		if expected, actual := http.StatusUnprocessableEntity, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		var res errorResource
+		if err := json.NewDecoder(recorder.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+
+		// The row of the violation is the id the user would have been given.
+		want := []schema.Violation{
+			schema.Violation{Row: 1, Field: "surname", Rule: schema.RuleRequired, Message: "expected Last name to not be empty"},
+		}
+		if expected, actual := want, res.Error.Violations; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore  = mock_store.NewMockStore(ctrl)
+			recorder   = httptest.NewRecorder()
+			request    = newJSONRequest("POST", "/", strings.NewReader(`{`))
+			controller = NewAPI(mockStore, testForm, recorder, request)
+		)
+
+		controller.Create()
+
+		if expected, actual := http.StatusBadRequest, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("text/plain body", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore  = mock_store.NewMockStore(ctrl)
+			recorder   = httptest.NewRecorder()
+			request    = httptest.NewRequest("POST", "/", strings.NewReader(`{"firstname":"jane","surname":"doe"}`))
+			controller = NewAPI(mockStore, testForm, recorder, request)
+		)
+		request.Header.Set("Content-Type", "text/plain")
+
+		controller.Create()
+
+		if expected, actual := http.StatusUnsupportedMediaType, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("cross-origin", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore  = mock_store.NewMockStore(ctrl)
+			recorder   = httptest.NewRecorder()
+			request    = newJSONRequest("POST", "/", strings.NewReader(`{"firstname":"jane","surname":"doe"}`))
+			controller = NewAPI(mockStore, testForm, recorder, request)
+		)
+		request.Header.Set("Origin", "https://evil.example.com")
+
+		controller.Create()
+
+		if expected, actual := http.StatusForbidden, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore  = mock_store.NewMockStore(ctrl)
+			recorder   = httptest.NewRecorder()
+			request    = newJSONRequest("POST", "/", strings.NewReader(`{"firstname":"jane","surname":"doe"}`))
+			controller = NewAPI(mockStore, testForm, recorder, request)
+		)
+
+		mockStore.EXPECT().
+			Read().
+			Return([]models.User{}, store.Version("abc"), nil)
+		mockStore.EXPECT().
+			Write(gomock.Any(), store.Version("abc")).
+			Return(store.AnyVersion, &store.ConflictError{Expected: "abc", Actual: "def"})
+
+		controller.Create()
+
+		if expected, actual := http.StatusConflict, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("precondition failed", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore  = mock_store.NewMockStore(ctrl)
+			recorder   = httptest.NewRecorder()
+			request    = newJSONRequest("POST", "/", strings.NewReader(`{"firstname":"jane","surname":"doe"}`))
+			controller = NewAPI(mockStore, testForm, recorder, request)
+		)
+
+		request.Header.Set("If-Match", `"old"`)
+
+		mockStore.EXPECT().
+			Read().
+			Return([]models.User{}, store.Version("abc"), nil)
+
+		controller.Create()
+
+		if expected, actual := http.StatusPreconditionFailed, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestAPIGet(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name string
+		id   string
+		code int
+	}{
+		{"found", "b2", http.StatusOK},
+		{"not found", "c3", http.StatusNotFound},
+		{"position", "1", http.StatusNotFound},
+		{"empty", "", http.StatusNotFound},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var (
+				mockStore  = mock_store.NewMockStore(ctrl)
+				recorder   = httptest.NewRecorder()
+				controller = NewAPI(mockStore, testForm, recorder, httptest.NewRequest("GET", "/", nil))
+			)
+
+			mockStore.EXPECT().
+				Read().
+				Return([]models.User{
+					models.User{ID: "a1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+					models.User{ID: "b2", Fields: models.Fields{"firstname": "jane", "surname": "doe"}},
+				}, store.Version("abc"), nil)
+
+			controller.Get(testcase.id)
+
+			if expected, actual := testcase.code, recorder.Code; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		})
+	}
+}
+
+func TestAPIReplace(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		mockStore  = mock_store.NewMockStore(ctrl)
+		recorder   = httptest.NewRecorder()
+		request    = newJSONRequest("PUT", "/", strings.NewReader(`{"firstname":"jane","surname":"doe"}`))
+		controller = NewAPI(mockStore, testForm, recorder, request)
+	)
+
+	request.Header.Set("If-Match", `"abc"`)
+
+	mockStore.EXPECT().
+		Read().
+		Return([]models.User{models.User{ID: "a1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}}}, store.Version("abc"), nil)
+	mockStore.EXPECT().
+		Write([]models.User{models.User{ID: "a1", Fields: models.Fields{"firstname": "jane", "surname": "doe"}}}, store.Version("abc")).
+		Return(store.Version("def"), nil)
+
+	controller.Replace("a1")
+
+	if expected, actual := http.StatusOK, recorder.Code; expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+}
+
+func TestAPIPatch(t *testing.T) {
+	t.Parallel()
+
+	t.Run("merge fields", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore  = mock_store.NewMockStore(ctrl)
+			recorder   = httptest.NewRecorder()
+			request    = newJSONRequest("PATCH", "/", strings.NewReader(`{"surname":"bloggs"}`))
+			controller = NewAPI(mockStore, testForm, recorder, request)
+		)
+
+		mockStore.EXPECT().
+			Read().
+			Return([]models.User{models.User{ID: "a1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}}}, store.Version("abc"), nil)
+		mockStore.EXPECT().
+			Write([]models.User{models.User{ID: "a1", Fields: models.Fields{"firstname": "fred", "surname": "bloggs"}}}, store.Version("abc")).
+			Return(store.Version("def"), nil)
+
+		controller.Patch("a1")
+
+		if expected, actual := http.StatusOK, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("empty field", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore  = mock_store.NewMockStore(ctrl)
+			recorder   = httptest.NewRecorder()
+			request    = newJSONRequest("PATCH", "/", strings.NewReader(`{"surname":""}`))
+			controller = NewAPI(mockStore, testForm, recorder, request)
+		)
+
+		mockStore.EXPECT().
+			Read().
+			Return([]models.User{models.User{ID: "a1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}}}, store.Version("abc"), nil)
+
+		controller.Patch("a1")
+
+		if expected, actual := http.StatusUnprocessableEntity, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestAPIDelete(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		mockStore  = mock_store.NewMockStore(ctrl)
+		recorder   = httptest.NewRecorder()
+		controller = NewAPI(mockStore, testForm, recorder, newJSONRequest("DELETE", "/", nil))
+	)
+
+	mockStore.EXPECT().
+		Read().
+		Return([]models.User{
+			models.User{ID: "a1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+			models.User{ID: "b2", Fields: models.Fields{"firstname": "jane", "surname": "doe"}},
+		}, store.Version("abc"), nil)
+	mockStore.EXPECT().
+		Write([]models.User{models.User{ID: "b2", Fields: models.Fields{"firstname": "jane", "surname": "doe"}}}, store.Version("abc")).
+		Return(store.Version("def"), nil)
+
+	controller.Delete("a1")
+
+	if expected, actual := http.StatusNoContent, recorder.Code; expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+}
+
+func TestAPIDeleteCrossSite(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// A plain form can't send DELETE, but a script on another site can send
+	// a request without a body or headers that aren't safe.
+	var (
+		mockStore  = mock_store.NewMockStore(ctrl)
+		recorder   = httptest.NewRecorder()
+		controller = NewAPI(mockStore, testForm, recorder, httptest.NewRequest("DELETE", "/", nil))
+	)
+
+	controller.Delete("a1")
+
+	if expected, actual := http.StatusForbidden, recorder.Code; expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	t.Parallel()
+
+	t.Run("not found", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		NewAPI(nil, testForm, recorder, httptest.NewRequest("GET", "/bad", nil)).NotFound()
+
+		if expected, actual := http.StatusNotFound, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := "application/json; charset=utf-8", recorder.Header().Get("Content-Type"); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		NewAPI(nil, testForm, recorder, httptest.NewRequest("TRACE", "/", nil)).MethodNotAllowed()
+
+		if expected, actual := http.StatusMethodNotAllowed, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+// newJSONRequest creates a request with a JSON body, as a script would send
+// it.
+func newJSONRequest(method, path string, body io.Reader) *http.Request {
+	request := httptest.NewRequest(method, path, body)
+	request.Header.Set("Content-Type", mimeJSON)
+	return request
+}
@@ -19,3 +19,76 @@ type Controller interface {
 	// rendered.
 	NotFound()
 }
+
+// APIController describes a controller that exposes the users held in the
+// store as a JSON resource, so that the data can be scripted against.
+// Every response, including errors, is encoded as JSON.
+type APIController interface {
+	// List writes out all the users in the store.
+	List()
+
+	// Create decodes a user from the request body and appends it to the
+	// users in the store.
+	Create()
+
+	// Get writes out the user found at id. If no user is found then a not
+	// found error will be written.
+	Get(id string)
+
+	// Replace decodes a user from the request body and replaces the user
+	// found at id with it.
+	Replace(id string)
+
+	// Patch decodes the fields present in the request body and merges them
+	// into the user found at id.
+	Patch(id string)
+
+	// Delete removes the user found at id from the store.
+	Delete(id string)
+
+	// Export writes out all the users in the store as a file, i.e. csv.
+	Export()
+
+	// Import reads users from the file held in the request body and imports
+	// them in to the store, writing out a report of what changed.
+	Import()
+
+	// NotFound declares a route that doesn't exist, so an error will be
+	// written.
+	NotFound()
+
+	// MethodNotAllowed declares a route that exists, but doesn't support the
+	// method requested, so an error will be written.
+	MethodNotAllowed()
+}
+
+// HistoryController describes a controller that shows the revisions made to
+// the store, so that any of them can be restored.
+type HistoryController interface {
+	// List renders all the revisions, newest first.
+	List()
+
+	// Get renders the revision found at id, including the users as they were
+	// after the revision was made.
+	Get(id string)
+
+	// Restore writes the users held by the revision found at id back to the
+	// store. If an error occurs whilst attempting to restore, then an error
+	// will be rendered.
+	Restore(id string)
+
+	// NotFound declares a route that doesn't exist, so an error will be
+	// rendered.
+	NotFound()
+}
+
+// IndexController describes a controller that lists all the forms that are
+// served, so that one of them can be picked.
+type IndexController interface {
+	// List renders all the forms.
+	List()
+
+	// NotFound declares a route, or a form, that doesn't exist, so an error
+	// will be rendered.
+	NotFound()
+}
@@ -1,57 +1,171 @@
 package controllers
 
 import (
-	"errors"
+	"fmt"
 	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/SimonRichardson/formed/pkg/schema"
+	"github.com/pkg/errors"
 )
 
-// UserForm creates a nice simple way to decode a form
+// formKeyPattern matches the keys of the form, i.e. people[0][firstname].
+// Each row is numbered so that fields that aren't always sent, like an
+// unchecked checkbox, don't shift the values of the rows that follow.
+var formKeyPattern = regexp.MustCompile(`^people\[(\d+)\]\[([^\]]+)\]$`)
+
+// formKey returns the key of the form for the field at row.
+func formKey(row int, field string) string {
+	return fmt.Sprintf("people[%d][%s]", row, field)
+}
+
+// The actions that the buttons of the form can ask for, each of them changes
+// the rows and renders the form again without writing anything. A form sent
+// without an action is saved.
+const (
+	ActionAdd    = "add"
+	ActionRemove = "remove"
+	ActionUp     = "up"
+	ActionDown   = "down"
+)
+
+// Action describes the button that sent the form, along with the row the
+// button belongs to. An action without a name saves the form.
+type Action struct {
+	Name string
+	Row  int
+}
+
+// UserForm creates a nice simple way to decode a form, each row holds the
+// values sent for one user keyed by the field name.
 type UserForm struct {
-	FirstNames, Surnames []string
+	Rows   []map[string]string
+	Action Action
 }
 
 // DecodeFrom gets the values from a map and puts them into a more structured
 // object
 func (f *UserForm) DecodeFrom(values url.Values) error {
-	// first decode the firstnames
-	names, ok := values[formKeyFirstName]
-	if !ok || len(names) == 0 {
-		return errors.New("expected a series of firstnames")
+	rows := make(map[int]map[string]string)
+	for key, v := range values {
+		match := formKeyPattern.FindStringSubmatch(key)
+		if match == nil {
+			continue
+		}
+
+		index, err := strconv.Atoi(match[1])
+		if err != nil {
+			return errors.Errorf("invalid row for %q", key)
+		}
+		if _, ok := rows[index]; !ok {
+			rows[index] = make(map[string]string)
+		}
+		if len(v) > 0 {
+			rows[index][match[2]] = v[0]
+		}
 	}
 
-	f.FirstNames = names
+	// A form without any rows is only valid if it was rendered by us, which
+	// is known by the version that is always sent with it.
+	if _, ok := values[formKeyVersion]; len(rows) == 0 && !ok {
+		return errors.New("expected a series of people")
+	}
 
-	// secondly decode the surnames
-	names, ok = values[formKeySurname]
-	if !ok || len(names) == 0 {
-		return errors.New("expected a series of surnames")
+	// Keep the order of the rows, but without any gaps between them.
+	indexes := make([]int, 0, len(rows))
+	for k := range rows {
+		indexes = append(indexes, k)
 	}
-	if len(names) != len(f.FirstNames) {
-		return errors.New("expected the same number of firstnames and surnames")
+	sort.Ints(indexes)
+
+	f.Rows = make([]map[string]string, len(indexes))
+	for k, v := range indexes {
+		f.Rows[k] = rows[v]
 	}
 
-	f.Surnames = names
+	action, err := decodeAction(values.Get(formKeyAction), indexes)
+	if err != nil {
+		return err
+	}
+	f.Action = action
 
 	return nil
 }
 
-// Users takes the form data and converts it into a slice of models.User. If the
-// names are empty it will return an error.
-func (f *UserForm) Users() ([]models.User, error) {
-	users := make([]models.User, len(f.FirstNames))
+// Apply changes the rows as the action asks for, adding a blank row, removing
+// a row or moving a row up or down.
+func (f *UserForm) Apply() {
+	row := f.Action.Row
+	switch f.Action.Name {
+	case ActionAdd:
+		f.Rows = append(f.Rows, make(map[string]string))
+	case ActionRemove:
+		f.Rows = append(f.Rows[:row], f.Rows[row+1:]...)
+	case ActionUp:
+		if row > 0 {
+			f.Rows[row-1], f.Rows[row] = f.Rows[row], f.Rows[row-1]
+		}
+	case ActionDown:
+		if row < len(f.Rows)-1 {
+			f.Rows[row], f.Rows[row+1] = f.Rows[row+1], f.Rows[row]
+		}
+	}
+}
 
-	for k, v := range f.FirstNames {
-		if len(v) == 0 || len(f.Surnames[k]) == 0 {
-			return nil, errors.New("expected names to not be empty")
+// decodeAction reads the action from the value of the button, i.e. remove:2.
+// The row is the one sent with the form, so it's translated in to the index of
+// the row once any gaps have been removed.
+func decodeAction(value string, indexes []int) (Action, error) {
+	if value == "" {
+		return Action{}, nil
+	}
+
+	parts := strings.SplitN(value, ":", 2)
+	switch parts[0] {
+	case ActionAdd:
+		return Action{Name: ActionAdd}, nil
+	case ActionRemove, ActionUp, ActionDown:
+		if len(parts) != 2 {
+			return Action{}, errors.Errorf("expected a row for %q", value)
+		}
+		row, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return Action{}, errors.Errorf("invalid row for %q", value)
+		}
+		for k, v := range indexes {
+			if v == row {
+				return Action{Name: parts[0], Row: k}, nil
+			}
 		}
+		return Action{}, errors.Errorf("no row found for %q", value)
+	}
+	return Action{}, errors.Errorf("unknown action %q", value)
+}
+
+// Users takes the form data and converts it into a slice of models.User,
+// using the schema to find the fields of each user. Rows that have been added
+// don't have an id yet, they're given one when they're written. If any of the users are
+// not valid according to the schema, the users are still returned along with
+// a *schema.ValidationError, so that the form can be rendered again with the
+// values that were submitted.
+func (f *UserForm) Users(s schema.Schema) ([]models.User, error) {
+	users := make([]models.User, len(f.Rows))
 
-		users[k] = models.User{
-			FirstName: v,
-			Surname:   f.Surnames[k],
+	for k, v := range f.Rows {
+		user := s.New()
+		for name, value := range v {
+			if name == models.IDField {
+				user.ID = value
+				continue
+			}
+			user.Set(name, value)
 		}
+		users[k] = user
 	}
 
-	return users, nil
+	return users, s.Validate(users...)
 }
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/SimonRichardson/formed/pkg/schema"
 )
 
 func TestDecodeFrom(t *testing.T) {
@@ -19,54 +20,59 @@ func TestDecodeFrom(t *testing.T) {
 		}
 	})
 
-	t.Run("no firstnames data", func(t *testing.T) {
+	t.Run("no people data", func(t *testing.T) {
 		var form UserForm
 		err := form.DecodeFrom(map[string][]string{
-			formKeyFirstName: []string{},
+			formKeyVersion: []string{"abc"},
 		})
+		if err != nil {
+			t.Fatal(err)
+		}
 
-		if expected, actual := true, err != nil; expected != actual {
+		if expected, actual := 0, len(form.Rows); expected != actual {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
 		}
 	})
 
-	t.Run("no surnames data", func(t *testing.T) {
+	t.Run("valid data", func(t *testing.T) {
 		var form UserForm
 		err := form.DecodeFrom(map[string][]string{
-			formKeyFirstName: []string{"fred"},
-			formKeySurname:   []string{},
+			formKey(0, "firstname"): []string{"fred"},
+			formKey(0, "surname"):   []string{"bloggs"},
+			formKey(1, "firstname"): []string{"john"},
+			formKey(1, "surname"):   []string{"smith"},
 		})
-
-		if expected, actual := true, err != nil; expected != actual {
-			t.Errorf("expected: %v, actual: %v", expected, actual)
+		if err != nil {
+			t.Fatal(err)
 		}
-	})
 
-	t.Run("misstmatch data", func(t *testing.T) {
-		var form UserForm
-		err := form.DecodeFrom(map[string][]string{
-			formKeyFirstName: []string{"fred", "john"},
-			formKeySurname:   []string{"bloggs"},
-		})
+		want := UserForm{
+			Rows: []map[string]string{
+				map[string]string{"firstname": "fred", "surname": "bloggs"},
+				map[string]string{"firstname": "john", "surname": "smith"},
+			},
+		}
 
-		if expected, actual := true, err != nil; expected != actual {
+		if expected, actual := want, form; !reflect.DeepEqual(expected, actual) {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
 		}
 	})
 
-	t.Run("valid data", func(t *testing.T) {
+	t.Run("rows keep their order without gaps", func(t *testing.T) {
 		var form UserForm
 		err := form.DecodeFrom(map[string][]string{
-			formKeyFirstName: []string{"fred", "john"},
-			formKeySurname:   []string{"bloggs", "smith"},
+			formKey(10, "firstname"): []string{"john"},
+			formKey(2, "firstname"):  []string{"fred"},
 		})
 		if err != nil {
 			t.Fatal(err)
 		}
 
 		want := UserForm{
-			FirstNames: []string{"fred", "john"},
-			Surnames:   []string{"bloggs", "smith"},
+			Rows: []map[string]string{
+				map[string]string{"firstname": "fred"},
+				map[string]string{"firstname": "john"},
+			},
 		}
 
 		if expected, actual := want, form; !reflect.DeepEqual(expected, actual) {
@@ -75,16 +81,112 @@ func TestDecodeFrom(t *testing.T) {
 	})
 }
 
+func TestDecodeAction(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name, value string
+		want        Action
+		valid       bool
+	}{
+		{"save", "", Action{}, true},
+		{"add", "add", Action{Name: ActionAdd}, true},
+		{"remove", "remove:4", Action{Name: ActionRemove, Row: 1}, true},
+		{"up", "up:9", Action{Name: ActionUp, Row: 2}, true},
+		{"down", "down:2", Action{Name: ActionDown, Row: 0}, true},
+		{"no row", "remove", Action{}, false},
+		{"invalid row", "up:first", Action{}, false},
+		{"missing row", "down:3", Action{}, false},
+		{"unknown", "sort:1", Action{}, false},
+	} {
+		action, err := decodeAction(testcase.value, []int{2, 4, 9})
+		if expected, actual := testcase.valid, err == nil; expected != actual {
+			t.Errorf("%s: expected: %v, actual: %v (%v)", testcase.name, expected, actual, err)
+		}
+		if expected, actual := testcase.want, action; expected != actual {
+			t.Errorf("%s: expected: %v, actual: %v", testcase.name, expected, actual)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	t.Parallel()
+
+	rows := func() []map[string]string {
+		return []map[string]string{
+			map[string]string{"firstname": "a"},
+			map[string]string{"firstname": "b"},
+			map[string]string{"firstname": "c"},
+		}
+	}
+
+	for _, testcase := range []struct {
+		name   string
+		action Action
+		want   []string
+	}{
+		{"save", Action{}, []string{"a", "b", "c"}},
+		{"add", Action{Name: ActionAdd}, []string{"a", "b", "c", ""}},
+		{"remove", Action{Name: ActionRemove, Row: 1}, []string{"a", "c"}},
+		{"up", Action{Name: ActionUp, Row: 2}, []string{"a", "c", "b"}},
+		{"up first", Action{Name: ActionUp, Row: 0}, []string{"a", "b", "c"}},
+		{"down", Action{Name: ActionDown, Row: 0}, []string{"b", "a", "c"}},
+		{"down last", Action{Name: ActionDown, Row: 2}, []string{"a", "b", "c"}},
+	} {
+		form := &UserForm{
+			Rows:   rows(),
+			Action: testcase.action,
+		}
+		form.Apply()
+
+		names := make([]string, len(form.Rows))
+		for k, v := range form.Rows {
+			names[k] = v["firstname"]
+		}
+		if expected, actual := testcase.want, names; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("%s: expected: %v, actual: %v", testcase.name, expected, actual)
+		}
+	}
+}
+
 func TestUsers(t *testing.T) {
 	t.Parallel()
 
 	t.Run("invalid data", func(t *testing.T) {
 		form := &UserForm{
-			FirstNames: []string{""},
-			Surnames:   []string{""},
+			Rows: []map[string]string{
+				map[string]string{"firstname": "fred", "surname": "bloggs"},
+				map[string]string{"firstname": "", "surname": "smith"},
+			},
 		}
 
-		_, err := form.Users()
+		users, err := form.Users(schema.Default())
+
+		validation, ok := schema.ErrValidation(err)
+		if !ok {
+			t.Fatalf("expected: validation error, actual: %v", err)
+		}
+		want := []schema.Violation{
+			schema.Violation{Row: 1, Field: "firstname", Rule: schema.RuleRequired, Message: "expected First name to not be empty"},
+		}
+		if expected, actual := want, validation.Violations; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		// The submitted users are kept, so they can be rendered again.
+		if expected, actual := "smith", users[1].Get("surname"); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("unexpected field", func(t *testing.T) {
+		form := &UserForm{
+			Rows: []map[string]string{
+				map[string]string{"firstname": "fred", "surname": "bloggs", "age": "42"},
+			},
+		}
+
+		_, err := form.Users(schema.Default())
 
 		if expected, actual := true, err != nil; expected != actual {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
@@ -93,17 +195,75 @@ func TestUsers(t *testing.T) {
 
 	t.Run("valid data", func(t *testing.T) {
 		form := &UserForm{
-			FirstNames: []string{"fred"},
-			Surnames:   []string{"bloggs"},
+			Rows: []map[string]string{
+				map[string]string{"firstname": "fred", "surname": "bloggs"},
+			},
 		}
 
-		users, err := form.Users()
+		users, err := form.Users(schema.Default())
 		if err != nil {
 			t.Error(err)
 		}
 
 		want := []models.User{
-			models.User{"fred", "bloggs"},
+			models.User{Fields: models.Fields{"firstname": "fred", "surname": "bloggs"}},
+		}
+
+		if expected, actual := want, users; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("rows keep their id", func(t *testing.T) {
+		form := &UserForm{
+			Rows: []map[string]string{
+				map[string]string{"id": "f1", "firstname": "fred", "surname": "bloggs"},
+				map[string]string{"firstname": "jane", "surname": "doe"},
+			},
+		}
+
+		users, err := form.Users(schema.Default())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []models.User{
+			models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "bloggs"}},
+			models.User{Fields: models.Fields{"firstname": "jane", "surname": "doe"}},
+		}
+
+		if expected, actual := want, users; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("unchecked checkbox", func(t *testing.T) {
+		s, err := schema.Parse([]byte(`
+fields:
+  - name: name
+    required: true
+  - name: subscribed
+    type: checkbox
+`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		form := &UserForm{
+			Rows: []map[string]string{
+				map[string]string{"name": "fred", "subscribed": "true"},
+				map[string]string{"name": "jane"},
+			},
+		}
+
+		users, err := form.Users(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []models.User{
+			models.User{Fields: models.Fields{"name": "fred", "subscribed": "true"}},
+			models.User{Fields: models.Fields{"name": "jane", "subscribed": ""}},
 		}
 
 		if expected, actual := want, users; !reflect.DeepEqual(expected, actual) {
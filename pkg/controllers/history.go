@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/SimonRichardson/formed/pkg/csrf"
+	"github.com/SimonRichardson/formed/pkg/forms"
+	"github.com/SimonRichardson/formed/pkg/history"
+	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/SimonRichardson/formed/pkg/store"
+	"github.com/SimonRichardson/formed/pkg/templates"
+	"github.com/pkg/errors"
+)
+
+type historyPage struct {
+	history   *history.History
+	store     store.Store
+	form      forms.Form
+	protector *csrf.Protector
+	templates *templates.Templates
+	writer    http.ResponseWriter
+	request   *http.Request
+}
+
+// NewHistory creates a controller that renders the history as HTML, with the
+// correct dependencies for the query.API. The schema of the form describes
+// the columns the users are rendered with. Restoring a revision requires the
+// token issued by the protector.
+func NewHistory(h *history.History, s store.Store, f forms.Form, p *csrf.Protector, t *templates.Templates, w http.ResponseWriter, r *http.Request) HistoryController {
+	return &historyPage{
+		history:   h,
+		store:     s,
+		form:      f,
+		protector: p,
+		templates: t,
+		writer:    w,
+		request:   r,
+	}
+}
+
+// List renders all the revisions, newest first.
+func (h *historyPage) List() {
+	revisions, err := h.history.Revisions()
+	if err != nil {
+		h.render(storeStatus(err), errors.Wrap(err, "unable to read history"))
+		return
+	}
+
+	h.renderRevisions(revisions)
+}
+
+// Get renders the revision found at id, including the users as they were
+// after the revision was made.
+func (h *historyPage) Get(id string) {
+	revision, ok, err := findRevision(h.history, id)
+	if err != nil {
+		h.render(storeStatus(err), errors.Wrap(err, "unable to read history"))
+		return
+	}
+	if !ok {
+		h.render(http.StatusNotFound, errors.Errorf("no revision found for %q", id))
+		return
+	}
+
+	h.renderRevisions([]history.Revision{revision})
+}
+
+// Restore writes the users held by the revision found at id back to the
+// store. If an error occurs whilst attempting to restore, then an error
+// will be rendered.
+func (h *historyPage) Restore(id string) {
+	if err := h.request.ParseForm(); err != nil {
+		h.render(http.StatusBadRequest, errors.Wrap(err, "invalid form data"))
+		return
+	}
+	if err := h.protector.Verify(h.request); err != nil {
+		h.render(http.StatusForbidden, forbiddenView{
+			Form: h.form,
+			Err:  err,
+		})
+		return
+	}
+
+	revision, ok, err := findRevision(h.history, id)
+	if err != nil {
+		h.render(storeStatus(err), errors.Wrap(err, "unable to read history"))
+		return
+	}
+	if !ok {
+		h.render(http.StatusNotFound, errors.Errorf("no revision found for %q", id))
+		return
+	}
+
+	version := store.Version(h.request.Form.Get(formKeyVersion))
+	if _, err := h.history.Restore(revision.ID, version, h.request.RemoteAddr); err != nil {
+		if conflict, ok := store.ErrConflict(err); ok {
+			h.render(http.StatusConflict, conflict)
+			return
+		}
+		h.render(storeStatus(err), errors.Wrap(err, "unable to restore revision"))
+		return
+	}
+
+	http.Redirect(h.writer, h.request, h.form.Path+"/", http.StatusSeeOther)
+}
+
+// NotFound declares a route that doesn't exist, so an error will be
+// rendered.
+func (h *historyPage) NotFound() {
+	h.render(http.StatusNotFound, errors.New("not found"))
+}
+
+func (h *historyPage) renderRevisions(revisions []history.Revision) {
+	// The current version is required to restore a revision, none of the
+	// users are.
+	version, err := h.store.Scan(func(models.User) error { return nil })
+	if err != nil {
+		version = store.AnyVersion
+	}
+
+	token, err := h.protector.Token(h.writer, h.request)
+	if err != nil {
+		h.render(http.StatusInternalServerError, err)
+		return
+	}
+
+	h.render(http.StatusOK, historyView{
+		Form:      h.form,
+		Revisions: revisions,
+		Version:   version,
+		CSRFToken: token,
+	})
+}
+
+func (h *historyPage) render(code int, data interface{}) {
+	h.writer.WriteHeader(code)
+
+	template := h.templates.Get(code)
+	template.Execute(h.writer, data)
+}
+
+// historyView is the data rendered by the history template.
+type historyView struct {
+	forms.Form
+	Revisions []history.Revision
+	Version   store.Version
+	CSRFToken string
+}
+
+func findRevision(h *history.History, id string) (history.Revision, bool, error) {
+	revisionID, err := strconv.Atoi(id)
+	if err != nil {
+		return history.Revision{}, false, nil
+	}
+	return h.Revision(revisionID)
+}
@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/SimonRichardson/formed/pkg/history"
+	"github.com/SimonRichardson/formed/pkg/store"
+	"github.com/pkg/errors"
+)
+
+type historyAPI struct {
+	history *history.History
+	writer  http.ResponseWriter
+	request *http.Request
+}
+
+// NewHistoryAPI creates a controller that writes the history as JSON, with
+// the correct dependencies for the query.API
+func NewHistoryAPI(h *history.History, w http.ResponseWriter, r *http.Request) HistoryController {
+	return &historyAPI{
+		history: h,
+		writer:  w,
+		request: r,
+	}
+}
+
+// List writes out all the revisions, newest first.
+func (h *historyAPI) List() {
+	revisions, err := h.history.Revisions()
+	if err != nil {
+		renderJSONError(h.writer, storeStatus(err), errors.Wrap(err, "unable to read history"))
+		return
+	}
+
+	renderJSON(h.writer, http.StatusOK, store.AnyVersion, revisionsResource{
+		Revisions: revisions,
+	})
+}
+
+// Get writes out the revision found at id, including the users as they were
+// after the revision was made.
+func (h *historyAPI) Get(id string) {
+	revision, ok, err := findRevision(h.history, id)
+	if err != nil {
+		renderJSONError(h.writer, storeStatus(err), errors.Wrap(err, "unable to read history"))
+		return
+	}
+	if !ok {
+		renderJSONError(h.writer, http.StatusNotFound, errors.Errorf("no revision found for %q", id))
+		return
+	}
+
+	renderJSON(h.writer, http.StatusOK, store.AnyVersion, revision)
+}
+
+// Restore writes the users held by the revision found at id back to the
+// store. The version the client expects can be sent as If-Match. A request
+// that could have been sent by another site is forbidden, see checkSameSite.
+func (h *historyAPI) Restore(id string) {
+	if err := checkSameSite(h.request); err != nil {
+		renderJSONError(h.writer, http.StatusForbidden, err)
+		return
+	}
+
+	revision, ok, err := findRevision(h.history, id)
+	if err != nil {
+		renderJSONError(h.writer, storeStatus(err), errors.Wrap(err, "unable to read history"))
+		return
+	}
+	if !ok {
+		renderJSONError(h.writer, http.StatusNotFound, errors.Errorf("no revision found for %q", id))
+		return
+	}
+
+	version, err := h.history.Restore(revision.ID, ifMatch(h.request), h.request.RemoteAddr)
+	if err != nil {
+		if conflict, ok := store.ErrConflict(err); ok {
+			renderJSONError(h.writer, http.StatusPreconditionFailed, conflict)
+			return
+		}
+		renderJSONError(h.writer, storeStatus(err), errors.Wrap(err, "unable to restore revision"))
+		return
+	}
+
+	renderJSON(h.writer, http.StatusOK, version, restoredResource{
+		Revision: revision.ID,
+		Version:  version,
+	})
+}
+
+// NotFound declares a route that doesn't exist, so an error will be
+// written.
+func (h *historyAPI) NotFound() {
+	renderJSONError(h.writer, http.StatusNotFound, errors.New("not found"))
+}
+
+type revisionsResource struct {
+	Revisions []history.Revision `json:"revisions"`
+}
+
+type restoredResource struct {
+	Revision int           `json:"revision"`
+	Version  store.Version `json:"version"`
+}
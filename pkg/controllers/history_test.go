@@ -0,0 +1,259 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SimonRichardson/formed/pkg/fs"
+	"github.com/SimonRichardson/formed/pkg/history"
+	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/SimonRichardson/formed/pkg/store"
+	"github.com/SimonRichardson/formed/pkg/templates"
+	"github.com/go-kit/kit/log"
+)
+
+func TestHistoryRestore(t *testing.T) {
+	t.Parallel()
+
+	fallback, err := templates.NewErrorTemplate(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates := templates.NewTemplates(fallback)
+
+	t.Run("redirects after restore", func(t *testing.T) {
+		h, s, version := newHistory(t)
+
+		var (
+			form       = url.Values{formKeyVersion: []string{string(version)}}
+			request    = newFormRequest("/history/1/restore", form)
+			recorder   = httptest.NewRecorder()
+			controller = NewHistory(h, s, testForm, testProtector, templates, recorder, request)
+		)
+
+		withSession(t, request)
+		controller.Restore("1")
+
+		if expected, actual := http.StatusSeeOther, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		users, _, err := s.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := []models.User{models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}}}, users; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		h, s, _ := newHistory(t)
+
+		var (
+			form       = url.Values{formKeyVersion: []string{"stale"}}
+			request    = newFormRequest("/history/1/restore", form)
+			recorder   = httptest.NewRecorder()
+			controller = NewHistory(h, s, testForm, testProtector, templates, recorder, request)
+		)
+
+		withSession(t, request)
+		controller.Restore("1")
+
+		if expected, actual := http.StatusConflict, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("missing revision", func(t *testing.T) {
+		h, s, _ := newHistory(t)
+
+		var (
+			request    = newFormRequest("/history/9/restore", url.Values{})
+			recorder   = httptest.NewRecorder()
+			controller = NewHistory(h, s, testForm, testProtector, templates, recorder, request)
+		)
+
+		withSession(t, request)
+		controller.Restore("9")
+
+		if expected, actual := http.StatusNotFound, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestHistoryRestoreForbidden(t *testing.T) {
+	t.Parallel()
+
+	fallback, err := templates.NewErrorTemplate(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates := templates.NewTemplates(fallback)
+
+	h, s, version := newHistory(t)
+
+	var (
+		form       = url.Values{formKeyVersion: []string{string(version)}}
+		request    = newFormRequest("/history/1/restore", form)
+		recorder   = httptest.NewRecorder()
+		controller = NewHistory(h, s, testForm, testProtector, templates, recorder, request)
+	)
+
+	controller.Restore("1")
+
+	if expected, actual := http.StatusForbidden, recorder.Code; expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+
+	users, _, err := s.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "j2", users[0].ID; expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+}
+
+func TestHistoryAPI(t *testing.T) {
+	t.Parallel()
+
+	t.Run("list", func(t *testing.T) {
+		h, _, _ := newHistory(t)
+
+		var (
+			recorder   = httptest.NewRecorder()
+			controller = NewHistoryAPI(h, recorder, httptest.NewRequest("GET", "/", nil))
+		)
+
+		controller.List()
+
+		if expected, actual := http.StatusOK, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		var resource revisionsResource
+		if err := json.NewDecoder(recorder.Body).Decode(&resource); err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := 2, len(resource.Revisions); expected != actual {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 2, resource.Revisions[0].ID; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("get missing revision", func(t *testing.T) {
+		h, _, _ := newHistory(t)
+
+		var (
+			recorder   = httptest.NewRecorder()
+			controller = NewHistoryAPI(h, recorder, httptest.NewRequest("GET", "/", nil))
+		)
+
+		controller.Get("nope")
+
+		if expected, actual := http.StatusNotFound, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("restore without a body", func(t *testing.T) {
+		h, _, _ := newHistory(t)
+
+		var (
+			request    = httptest.NewRequest("POST", "/", nil)
+			recorder   = httptest.NewRecorder()
+			controller = NewHistoryAPI(h, recorder, request)
+		)
+
+		controller.Restore("1")
+
+		if expected, actual := http.StatusForbidden, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("restore with stale if-match", func(t *testing.T) {
+		h, _, _ := newHistory(t)
+
+		var (
+			request    = httptest.NewRequest("POST", "/", nil)
+			recorder   = httptest.NewRecorder()
+			controller = NewHistoryAPI(h, recorder, request)
+		)
+		request.Header.Set("If-Match", `"stale"`)
+		request.Header.Set(headerRequestedWith, "XMLHttpRequest")
+
+		withSession(t, request)
+		controller.Restore("1")
+
+		if expected, actual := http.StatusPreconditionFailed, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		h, _, version := newHistory(t)
+
+		var (
+			request    = httptest.NewRequest("POST", "/", nil)
+			recorder   = httptest.NewRecorder()
+			controller = NewHistoryAPI(h, recorder, request)
+		)
+		request.Header.Set("If-Match", etag(version))
+		request.Header.Set(headerRequestedWith, "XMLHttpRequest")
+
+		withSession(t, request)
+		controller.Restore("1")
+
+		if expected, actual := http.StatusOK, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		var resource restoredResource
+		if err := json.NewDecoder(recorder.Body).Decode(&resource); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := 1, resource.Revision; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := etag(resource.Version), recorder.Header().Get("ETag"); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+// newHistory returns a history with two revisions, along with the version of
+// the store after the last one.
+func newHistory(t *testing.T) (*history.History, store.Store, store.Version) {
+	s := store.NewMemory()
+	h, err := history.New(s, fs.New(), "", store.DefaultLockTimeout, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := h.Store("10.0.0.1:1234")
+	if _, err := w.Write([]models.User{models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}}}, store.AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+	version, err := w.Write([]models.User{models.User{ID: "j2", Fields: models.Fields{"firstname": "jane", "surname": "doe"}}}, store.AnyVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h, s, version
+}
+
+func newFormRequest(path string, form url.Values) *http.Request {
+	request := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return request
+}
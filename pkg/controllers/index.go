@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/SimonRichardson/formed/pkg/forms"
+	"github.com/SimonRichardson/formed/pkg/templates"
+	"github.com/pkg/errors"
+)
+
+type indexPage struct {
+	forms     []forms.Form
+	templates *templates.Templates
+	writer    http.ResponseWriter
+	request   *http.Request
+}
+
+// NewIndex creates a controller that renders the forms as HTML, with the
+// correct dependencies for the query.Forms
+func NewIndex(f []forms.Form, t *templates.Templates, w http.ResponseWriter, r *http.Request) IndexController {
+	return &indexPage{
+		forms:     f,
+		templates: t,
+		writer:    w,
+		request:   r,
+	}
+}
+
+// List renders all the forms.
+func (i *indexPage) List() {
+	i.render(http.StatusOK, indexView{
+		Forms: i.forms,
+	})
+}
+
+// NotFound declares a route, or a form, that doesn't exist, so an error will
+// be rendered.
+func (i *indexPage) NotFound() {
+	i.render(http.StatusNotFound, errors.New("not found"))
+}
+
+func (i *indexPage) render(code int, data interface{}) {
+	i.writer.WriteHeader(code)
+
+	template := i.templates.Get(code)
+	template.Execute(i.writer, data)
+}
+
+// indexView is the data rendered by the index template.
+type indexView struct {
+	Forms []forms.Form
+}
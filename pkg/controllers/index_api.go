@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/SimonRichardson/formed/pkg/forms"
+	"github.com/SimonRichardson/formed/pkg/store"
+	"github.com/pkg/errors"
+)
+
+type indexAPI struct {
+	forms  []forms.Form
+	writer http.ResponseWriter
+}
+
+// NewIndexAPI creates a controller that writes the forms as JSON, with the
+// correct dependencies for the query.Forms
+func NewIndexAPI(f []forms.Form, w http.ResponseWriter, r *http.Request) IndexController {
+	return &indexAPI{
+		forms:  f,
+		writer: w,
+	}
+}
+
+// List writes out all the forms.
+func (i *indexAPI) List() {
+	resources := make([]formResource, len(i.forms))
+	for k, v := range i.forms {
+		resources[k] = formResource{
+			Name:  v.Name,
+			Title: v.Title,
+			Path:  v.Path,
+		}
+	}
+
+	renderJSON(i.writer, http.StatusOK, store.AnyVersion, formsResource{
+		Forms: resources,
+	})
+}
+
+// NotFound declares a route, or a form, that doesn't exist, so an error will
+// be written.
+func (i *indexAPI) NotFound() {
+	renderJSONError(i.writer, http.StatusNotFound, errors.New("not found"))
+}
+
+type formResource struct {
+	Name  string `json:"name"`
+	Title string `json:"title"`
+	Path  string `json:"path"`
+}
+
+type formsResource struct {
+	Forms []formResource `json:"forms"`
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SimonRichardson/formed/pkg/forms"
+	"github.com/SimonRichardson/formed/pkg/templates"
+)
+
+func TestIndex(t *testing.T) {
+	t.Parallel()
+
+	fallback, err := templates.NewErrorTemplate(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := templates.NewIndexTemplate(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates := templates.NewTemplates(fallback)
+	templates.Set(http.StatusOK, index)
+
+	t.Run("list", func(t *testing.T) {
+		var (
+			recorder   = httptest.NewRecorder()
+			controller = NewIndex([]forms.Form{testForm}, templates, recorder, httptest.NewRequest("GET", "/", nil))
+		)
+
+		controller.List()
+
+		if expected, actual := http.StatusOK, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := true, strings.Contains(recorder.Body.String(), `href="/query/people/"`); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		var (
+			recorder   = httptest.NewRecorder()
+			controller = NewIndex([]forms.Form{testForm}, templates, recorder, httptest.NewRequest("GET", "/", nil))
+		)
+
+		controller.NotFound()
+
+		if expected, actual := http.StatusNotFound, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestIndexAPI(t *testing.T) {
+	t.Parallel()
+
+	var (
+		recorder   = httptest.NewRecorder()
+		controller = NewIndexAPI([]forms.Form{testForm}, recorder, httptest.NewRequest("GET", "/", nil))
+	)
+
+	controller.List()
+
+	if expected, actual := http.StatusOK, recorder.Code; expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+
+	var resource formsResource
+	if err := json.NewDecoder(recorder.Body).Decode(&resource); err != nil {
+		t.Fatal(err)
+	}
+
+	want := formsResource{
+		Forms: []formResource{
+			formResource{Name: "people", Title: "People", Path: "/query/people"},
+		},
+	}
+	if expected, actual := want, resource; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+}
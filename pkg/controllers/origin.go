@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	mimeJSON = "application/json"
+
+	// headerRequestedWith can be sent by scripts instead of a Content-Type,
+	// i.e. when there is no body. Browsers never send it on behalf of another
+	// site without asking the server first.
+	headerRequestedWith = "X-Requested-With"
+)
+
+// checkSameSite makes sure a write to the JSON API wasn't sent by a browser
+// on behalf of another site, as the API has no token like the form does. A
+// request with an Origin other than the host is refused, along with a request
+// that only carries what a plain HTML form can send: no Content-Type, or one
+// of text/plain, application/x-www-form-urlencoded or multipart/form-data.
+// Sending any other Content-Type, or the X-Requested-With header, is enough.
+func checkSameSite(r *http.Request) error {
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || u.Host != r.Host {
+			return errors.Errorf("cross-origin request from %q refused", origin)
+		}
+	}
+
+	if r.Header.Get(headerRequestedWith) != "" {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "", "text/plain", "application/x-www-form-urlencoded", "multipart/form-data":
+		return errors.Errorf("expected a Content-Type other than %q, or the %s header", mediaType, headerRequestedWith)
+	}
+	return nil
+}
+
+// isJSON returns if the body of the request is JSON.
+func isJSON(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == mimeJSON
+}
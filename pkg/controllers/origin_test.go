@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckSameSite(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name, contentType, origin, requestedWith string
+		valid                                    bool
+	}{
+		{"json", "application/json", "", "", true},
+		{"json with charset", "application/json; charset=utf-8", "", "", true},
+		{"csv", "text/csv", "", "", true},
+		{"same origin", "application/json", "http://example.com", "", true},
+		{"requested with", "", "", "XMLHttpRequest", true},
+		{"no content type", "", "", "", false},
+		{"text/plain", "text/plain", "", "", false},
+		{"form", "application/x-www-form-urlencoded", "", "", false},
+		{"multipart", "multipart/form-data; boundary=x", "", "", false},
+		{"foreign origin", "application/json", "https://evil.example.com", "", false},
+		{"null origin", "application/json", "null", "XMLHttpRequest", false},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			request := httptest.NewRequest("POST", "http://example.com/", nil)
+			if testcase.contentType != "" {
+				request.Header.Set("Content-Type", testcase.contentType)
+			}
+			if testcase.origin != "" {
+				request.Header.Set("Origin", testcase.origin)
+			}
+			if testcase.requestedWith != "" {
+				request.Header.Set(headerRequestedWith, testcase.requestedWith)
+			}
+
+			err := checkSameSite(request)
+			if expected, actual := testcase.valid, err == nil; expected != actual {
+				t.Errorf("expected: %v, actual: %v (%v)", expected, actual, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/SimonRichardson/formed/pkg/store"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 1000
+
+	pageKeyOffset = "offset"
+	pageKeyLimit  = "limit"
+	pageKeyAfter  = "after"
+	pageKeyIDs    = "page"
+)
+
+// paged returns if any of the values ask for a page of the users.
+func paged(values url.Values) bool {
+	for _, key := range []string{pageKeyOffset, pageKeyLimit, pageKeyAfter} {
+		if _, ok := values[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseWindow reads the window of the page from the values, either an offset
+// or the id of the user to read after, along with a limit. Without a limit the
+// default limit is used.
+func parseWindow(values url.Values, defaultLimit int) (store.Window, error) {
+	window := store.Window{
+		Limit: defaultLimit,
+		After: values.Get(pageKeyAfter),
+	}
+
+	var err error
+	if value := values.Get(pageKeyLimit); value != "" {
+		if window.Limit, err = strconv.Atoi(value); err != nil {
+			return store.Window{}, errors.Errorf("invalid limit %q", value)
+		}
+		if window.Limit < 1 || window.Limit > maxPageLimit {
+			return store.Window{}, errors.Errorf("expected a limit between 1 and %d, actual %d", maxPageLimit, window.Limit)
+		}
+	}
+
+	if value := values.Get(pageKeyOffset); value != "" {
+		if window.After != "" {
+			return store.Window{}, errors.New("expected either an offset or after, not both")
+		}
+		if window.Offset, err = strconv.Atoi(value); err != nil {
+			return store.Window{}, errors.Errorf("invalid offset %q", value)
+		}
+		if window.Offset < 0 {
+			return store.Window{}, errors.Errorf("expected an offset of 0 or more, actual %d", window.Offset)
+		}
+	}
+
+	return window, nil
+}
+
+// pageView is the page of users rendered by the form. The ids of the users
+// rendered are sent back with the form, so that saving only replaces those
+// users, wherever they are by then. Total is only known when the page was
+// read from the store.
+type pageView struct {
+	Offset int
+	Limit  int
+	Total  int
+	IDs    []string
+}
+
+func newPageView(page store.Page, limit int) *pageView {
+	ids := make([]string, len(page.Users))
+	for k, v := range page.Users {
+		ids[k] = v.ID
+	}
+	return &pageView{
+		Offset: page.Offset,
+		Limit:  limit,
+		Total:  page.Total,
+		IDs:    ids,
+	}
+}
+
+// decodePageView reads the page that was sent back with the form. A form
+// without a page holds every user.
+func decodePageView(values url.Values) (*pageView, error) {
+	if _, ok := values[pageKeyOffset]; !ok {
+		return nil, nil
+	}
+
+	var (
+		res = &pageView{
+			Limit: defaultPageLimit,
+			IDs:   values[pageKeyIDs],
+		}
+		err error
+	)
+	for _, field := range []struct {
+		key   string
+		value *int
+	}{
+		{pageKeyOffset, &res.Offset},
+		{pageKeyLimit, &res.Limit},
+	} {
+		value := values.Get(field.key)
+		if value == "" {
+			continue
+		}
+		if *field.value, err = strconv.Atoi(value); err != nil || *field.value < 0 {
+			return nil, errors.Errorf("invalid %s %q", field.key, value)
+		}
+	}
+	if res.Limit < 1 || res.Limit > maxPageLimit {
+		return nil, errors.Errorf("expected a limit between 1 and %d, actual %d", maxPageLimit, res.Limit)
+	}
+	return res, nil
+}
+
+// Count returns the number of users of the page.
+func (p pageView) Count() int {
+	return len(p.IDs)
+}
+
+// First returns the position of the first user of the page, counting from 1.
+func (p pageView) First() int {
+	return p.Offset + 1
+}
+
+// Last returns the position of the last user of the page, counting from 1.
+func (p pageView) Last() int {
+	return p.Offset + p.Count()
+}
+
+// HasPrevious returns if there are users before the page.
+func (p pageView) HasPrevious() bool {
+	return p.Offset > 0
+}
+
+// Previous returns the offset of the page before.
+func (p pageView) Previous() int {
+	if p.Offset < p.Limit {
+		return 0
+	}
+	return p.Offset - p.Limit
+}
+
+// HasNext returns if there are users after the page.
+func (p pageView) HasNext() bool {
+	return p.Last() < p.Total
+}
+
+// Next returns the offset of the page after.
+func (p pageView) Next() int {
+	return p.Last()
+}
+
+// URL returns the query of the page, relative to the form.
+func (p pageView) URL(offset int) string {
+	values := url.Values{}
+	values.Set(pageKeyOffset, strconv.Itoa(offset))
+	values.Set(pageKeyLimit, strconv.Itoa(p.Limit))
+	return "?" + values.Encode()
+}
+
+// window returns the users of the page from all the users, matched by id.
+func (p pageView) window(users []models.User) []models.User {
+	ids := p.replaced(nil)
+
+	res := make([]models.User, 0, len(p.IDs))
+	for _, v := range users {
+		if _, ok := ids[v.ID]; ok {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// splice scans the users of the store, replacing the users of the page with
+// the users that were submitted, every other user is left as it is. Users are
+// matched by id, so users added or removed before the page since it was
+// rendered don't move what is replaced. The submitted users take the place of
+// the first user of the page that is still held by the store, or the offset
+// of the page if none of them are. The version of the users that were scanned
+// is returned.
+func (p pageView) splice(s store.Store, submitted []models.User) ([]models.User, store.Version, error) {
+	var (
+		onPage   = p.replaced(nil)
+		replaced = p.replaced(submitted)
+		res      = make([]models.User, 0)
+		at       = -1
+	)
+	version, err := s.Scan(func(user models.User) error {
+		if _, ok := replaced[user.ID]; ok {
+			if _, ok := onPage[user.ID]; ok && at < 0 {
+				at = len(res)
+			}
+			return nil
+		}
+		res = append(res, user)
+		return nil
+	})
+	if err != nil {
+		return nil, store.AnyVersion, err
+	}
+
+	if at < 0 {
+		at = p.Offset
+		if at > len(res) {
+			at = len(res)
+		}
+	}
+
+	// Make room for the submitted users, then move everything after them
+	// along.
+	n := len(res)
+	res = append(res, submitted...)
+	copy(res[at+len(submitted):], res[at:n])
+	copy(res[at:], submitted)
+	return res, version, nil
+}
+
+// replaced returns the ids of the users that are replaced by the submitted
+// users: the users of the page along with any user that was submitted.
+func (p pageView) replaced(submitted []models.User) map[string]struct{} {
+	res := make(map[string]struct{}, len(p.IDs)+len(submitted))
+	for _, id := range p.IDs {
+		res[id] = struct{}{}
+	}
+	for _, v := range submitted {
+		if v.ID != "" {
+			res[v.ID] = struct{}{}
+		}
+	}
+	return res
+}
@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/SimonRichardson/formed/pkg/store"
+)
+
+func TestPageViewSplice(t *testing.T) {
+	t.Parallel()
+
+	var (
+		a1 = models.User{ID: "a1", Fields: models.Fields{"firstname": "a"}}
+		b2 = models.User{ID: "b2", Fields: models.Fields{"firstname": "b"}}
+		c3 = models.User{ID: "c3", Fields: models.Fields{"firstname": "c"}}
+		d4 = models.User{ID: "d4", Fields: models.Fields{"firstname": "d"}}
+		x  = models.User{Fields: models.Fields{"firstname": "x"}}
+	)
+
+	for _, testcase := range []struct {
+		name      string
+		current   []models.User
+		page      pageView
+		submitted []models.User
+		ids       []string
+	}{
+		{"replace", []models.User{a1, b2, c3}, pageView{Offset: 1, IDs: []string{"b2"}}, []models.User{b2}, []string{"a1", "b2", "c3"}},
+		{"add", []models.User{a1, b2, c3}, pageView{Offset: 1, IDs: []string{"b2"}}, []models.User{b2, x}, []string{"a1", "b2", "", "c3"}},
+		{"remove", []models.User{a1, b2, c3}, pageView{Offset: 0, IDs: []string{"a1", "b2"}}, []models.User{}, []string{"c3"}},
+		{"inserted before the page", []models.User{d4, a1, b2, c3}, pageView{Offset: 1, IDs: []string{"b2"}}, []models.User{b2}, []string{"d4", "a1", "b2", "c3"}},
+		{"removed before the page", []models.User{b2, c3}, pageView{Offset: 1, IDs: []string{"b2", "c3"}}, []models.User{c3}, []string{"c3"}},
+		{"page removed since", []models.User{a1}, pageView{Offset: 1, IDs: []string{"b2"}}, []models.User{x}, []string{"a1", ""}},
+		{"empty page", []models.User{}, pageView{Offset: 0}, []models.User{x}, []string{""}},
+		{"submitted from another page", []models.User{a1, b2, c3}, pageView{Offset: 2, IDs: []string{"c3"}}, []models.User{a1, c3}, []string{"b2", "a1", "c3"}},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			s := store.NewMemory()
+			version, err := s.Write(testcase.current, store.AnyVersion)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, actualVersion, err := testcase.page.splice(s, testcase.submitted)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ids := make([]string, len(res))
+			for k, v := range res {
+				ids[k] = v.ID
+			}
+			if expected, actual := testcase.ids, ids; !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+			if expected, actual := version, actualVersion; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		})
+	}
+}
+
+func TestPageViewNavigation(t *testing.T) {
+	t.Parallel()
+
+	page := pageView{Offset: 10, Limit: 10, Total: 25, IDs: make([]string, 10)}
+
+	if expected, actual := 11, page.First(); expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+	if expected, actual := 20, page.Last(); expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+	if expected, actual := 0, page.Previous(); expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+	if expected, actual := 20, page.Next(); expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+	if expected, actual := "?limit=10&offset=20", page.URL(page.Next()); expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+	if !page.HasPrevious() || !page.HasNext() {
+		t.Errorf("expected: a page before and after %v", page)
+	}
+
+	last := pageView{Offset: 20, Limit: 10, Total: 25, IDs: make([]string, 5)}
+	if last.HasNext() {
+		t.Errorf("expected: no page after %v", last)
+	}
+}
@@ -2,29 +2,40 @@ package controllers
 
 import (
 	"net/http"
+	"strconv"
 
+	"github.com/SimonRichardson/formed/pkg/auth"
+	"github.com/SimonRichardson/formed/pkg/csrf"
+	"github.com/SimonRichardson/formed/pkg/forms"
+	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/SimonRichardson/formed/pkg/schema"
 	"github.com/SimonRichardson/formed/pkg/store"
 	"github.com/SimonRichardson/formed/pkg/templates"
 	"github.com/pkg/errors"
 )
 
-// go doesn't provide this sort of form iteration, so it just provides a slice
 const (
-	formKeyFirstName = "people[][firstname]"
-	formKeySurname   = "people[][surname]"
+	formKeyVersion = "version"
+	formKeyAction  = "action"
 )
 
 type real struct {
 	store     store.Store
+	form      forms.Form
+	protector *csrf.Protector
 	templates *templates.Templates
 	writer    http.ResponseWriter
 	request   *http.Request
 }
 
-// New creates a controller with the correct dependencies for the query.API
-func New(s store.Store, t *templates.Templates, w http.ResponseWriter, r *http.Request) Controller {
+// New creates a controller with the correct dependencies for the query.API,
+// the form is decoded and validated using the schema of the form. Every form
+// that is posted has to hold the token issued by the protector.
+func New(s store.Store, f forms.Form, p *csrf.Protector, t *templates.Templates, w http.ResponseWriter, r *http.Request) Controller {
 	return &real{
 		store:     s,
+		form:      f,
+		protector: p,
 		templates: t,
 		writer:    w,
 		request:   r,
@@ -32,55 +43,161 @@ func New(s store.Store, t *templates.Templates, w http.ResponseWriter, r *http.R
 }
 
 // Get defines a method for filling in the form from the store, if it finds
-// nothing then it will return defaults. If an error occurs whilst
-// attempting to get, then an error will be rendered.
+// nothing then an empty form is rendered. Only a page of the users is
+// rendered, which is picked by the offset and limit of the query. If an error
+// occurs whilst attempting to get, then an error will be rendered.
 func (r *real) Get() {
-	// Read the store and then render the correct output
-	users, err := r.store.Read()
+	window, err := parseWindow(r.request.URL.Query(), defaultPageLimit)
 	if err != nil {
-		r.render(http.StatusInternalServerError, err)
+		r.render(http.StatusBadRequest, err)
+		return
+	}
+
+	// Read the page from the store and then render the correct output
+	page, err := store.ReadPage(r.store, window)
+	if err != nil {
+		if _, ok := store.ErrCursor(err); ok {
+			r.render(http.StatusBadRequest, err)
+			return
+		}
+		r.render(storeStatus(err), err)
 		return
 	}
 
-	if len(users) == 0 {
-		r.render(http.StatusNotFound, errors.New("no users found"))
+	// Issue the token before anything is written, as it might have to start
+	// a new session.
+	token, err := r.protector.Token(r.writer, r.request)
+	if err != nil {
+		r.render(http.StatusInternalServerError, err)
 		return
 	}
 
-	r.render(http.StatusOK, users)
+	r.render(http.StatusOK, formView{
+		Form:      r.form,
+		Users:     page.Users,
+		Version:   page.Version,
+		Page:      newPageView(page, window.Limit),
+		CSRFToken: token,
+		ReadOnly:  readOnly(r.request),
+	})
 }
 
 // Post consumes a form that will put the data in to the underlying store.
 // If an error occurs whilst attempting to save, then an error will be
-// rendered.
+// rendered. If the store has changed since the form was rendered then a
+// conflict is rendered showing both the submitted and the current users.
+// A form of a page only replaces the users of that page.
+// A form without the token of the session is forbidden.
 func (r *real) Post() {
 	if err := r.request.ParseForm(); err != nil {
 		r.render(http.StatusBadRequest, errors.Wrap(err, "invalid form data"))
 		return
 	}
 
-	// Extract the firstnames, surnames
+	// Make sure the form was rendered by us for this session, otherwise
+	// another site could post a form that overwrites every user.
+	if err := r.protector.Verify(r.request); err != nil {
+		r.render(http.StatusForbidden, forbiddenView{
+			Form: r.form,
+			Err:  err,
+		})
+		return
+	}
+	token, err := r.protector.Token(r.writer, r.request)
+	if err != nil {
+		r.render(http.StatusInternalServerError, err)
+		return
+	}
+
+	// Extract the rows of the form
 	var userForm UserForm
 	if err := userForm.DecodeFrom(r.request.Form); err != nil {
 		r.render(http.StatusBadRequest, errors.Wrap(err, "invalid form user data"))
 		return
 	}
+	page, err := decodePageView(r.request.Form)
+	if err != nil {
+		r.render(http.StatusBadRequest, errors.Wrap(err, "invalid form page"))
+		return
+	}
 
-	// Convert the form data to actual users
-	users, err := userForm.Users()
+	// Adding, removing or moving a row renders the form again with the rows
+	// changed, nothing is written until the form is saved. Violations aren't
+	// shown yet, as a blank row is expected to be invalid.
+	version := store.Version(r.request.Form.Get(formKeyVersion))
+	if userForm.Action.Name != "" {
+		userForm.Apply()
+		users, _ := userForm.Users(r.form.Schema)
+		r.render(http.StatusOK, formView{
+			Form:      r.form,
+			Users:     users,
+			Version:   version,
+			Page:      page,
+			CSRFToken: token,
+		})
+		return
+	}
+
+	// Convert the form data to actual users, if any of them aren't valid then
+	// render the form again with what was submitted, so nothing is lost.
+	users, err := userForm.Users(r.form.Schema)
 	if err != nil {
+		if validation, ok := schema.ErrValidation(err); ok {
+			r.render(http.StatusUnprocessableEntity, formView{
+				Form:      r.form,
+				Users:     users,
+				Version:   version,
+				Page:      page,
+				Errors:    validation,
+				CSRFToken: token,
+			})
+			return
+		}
 		r.render(http.StatusBadRequest, errors.Wrap(err, "invalid user data"))
 		return
 	}
 
-	// Write the users to the underlying store
-	if err := r.store.Write(users); err != nil {
-		r.render(http.StatusInternalServerError, errors.Wrap(err, "invalid user data"))
+	// The users of a page replace the users of the same page in the store,
+	// every other user is written back as it is. A form without a version
+	// still has to be written at the version that was spliced, so nobody
+	// else's users are lost.
+	submitted := users
+	if page != nil {
+		spliced, current, err := page.splice(r.store, submitted)
+		if err != nil {
+			r.render(storeStatus(err), errors.Wrap(err, "unable to read users"))
+			return
+		}
+		if version == store.AnyVersion {
+			version = current
+		}
+		users = spliced
+	}
+
+	// Write the users to the underlying store, only if nobody else has written
+	// since the form was rendered. A form without a version is written
+	// regardless.
+	if _, err := r.store.Write(users, version); err != nil {
+		if conflict, ok := store.ErrConflict(err); ok {
+			r.render(http.StatusConflict, conflictView{
+				ConflictError: conflict,
+				Form:          r.form,
+				Submitted:     submitted,
+				Page:          page,
+				CSRFToken:     token,
+			})
+			return
+		}
+		r.render(storeStatus(err), errors.Wrap(err, "invalid user data"))
 		return
 	}
 
 	// Once we've written, let's redirect to the correct page
-	http.Redirect(r.writer, r.request, "/query", http.StatusSeeOther)
+	location := r.form.Path + "/"
+	if page != nil {
+		location += page.URL(page.Offset)
+	}
+	http.Redirect(r.writer, r.request, location, http.StatusSeeOther)
 }
 
 // NotFound declares a route that doesn't exist, so an error will be
@@ -89,6 +206,100 @@ func (r *real) NotFound() {
 	r.render(http.StatusNotFound, errors.New("not found"))
 }
 
+// readOnly reports whether the identity that made the request isn't allowed
+// to write. Any post from them is forbidden, even one that only adds, removes
+// or moves a row, so the form is rendered without the buttons that send it.
+// Without authentication there is no identity and everyone can write.
+func readOnly(r *http.Request) bool {
+	identity, ok := auth.FromContext(r.Context())
+	return ok && !identity.Role.Allows("POST")
+}
+
+// formView is the data rendered by the form template. Errors holds the
+// violations of the users that were submitted, if any. Page is the page of
+// the users that are rendered, it's nil when every user is rendered.
+// ReadOnly hides the buttons that send the form, for anyone that isn't
+// allowed to write.
+type formView struct {
+	forms.Form
+	Users     []models.User
+	Version   store.Version
+	Page      *pageView
+	Errors    *schema.ValidationError
+	CSRFToken string
+	ReadOnly  bool
+}
+
+// Row returns the view of the user at row, so that the template can render
+// the row along with any violations of its fields.
+func (v formView) Row(row int, user models.User) rowView {
+	res := rowView{
+		Index:    strconv.Itoa(row),
+		Fields:   v.Schema.Fields,
+		User:     user,
+		ReadOnly: v.ReadOnly,
+	}
+	if v.Errors != nil {
+		res.Violations = make(map[string]string)
+		for _, violation := range v.Errors.Violations {
+			if violation.Row == row {
+				res.Violations[violation.Field] = violation.Message
+			}
+		}
+	}
+	return res
+}
+
+// Blank returns the view of an empty row, which scripts can copy when adding
+// a row. The index is a placeholder that has to be replaced.
+func (v formView) Blank() rowView {
+	return rowView{
+		Index:    "__row__",
+		Fields:   v.Schema.Fields,
+		User:     v.Schema.New(),
+		ReadOnly: v.ReadOnly,
+	}
+}
+
+// rowView is the data rendered for a single row of the form.
+type rowView struct {
+	Index      string
+	Fields     []schema.Field
+	User       models.User
+	Violations map[string]string
+	ReadOnly   bool
+}
+
+// conflictView is the data rendered by the conflict template. The current
+// users are held in the store.ConflictError. Page is the page of the users
+// that were submitted, it's nil when every user was submitted.
+type conflictView struct {
+	*store.ConflictError
+	forms.Form
+	Submitted []models.User
+	Page      *pageView
+	CSRFToken string
+}
+
+// Latest returns the current users of the page that was submitted.
+func (v conflictView) Latest() []models.User {
+	if v.Page == nil {
+		return v.Users
+	}
+	return v.Page.window(v.Users)
+}
+
+// forbiddenView is the data rendered when a form is posted without the token
+// of the session.
+type forbiddenView struct {
+	forms.Form
+	Err error
+}
+
+func (v forbiddenView) Error() string {
+	return v.Err.Error()
+}
+
 func (r *real) render(code int, data interface{}) {
 	r.writer.WriteHeader(code)
 
@@ -4,14 +4,31 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
 	"testing"
 
+	"github.com/SimonRichardson/formed/pkg/auth"
+	"github.com/SimonRichardson/formed/pkg/csrf"
+	"github.com/SimonRichardson/formed/pkg/forms"
 	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/SimonRichardson/formed/pkg/schema"
+	"github.com/SimonRichardson/formed/pkg/store"
 	"github.com/SimonRichardson/formed/pkg/store/mock_store"
 	"github.com/SimonRichardson/formed/pkg/templates"
 	"github.com/golang/mock/gomock"
 )
 
+var testForm = forms.Form{
+	Name:   "people",
+	Title:  "People",
+	Path:   "/query/people",
+	Schema: schema.Default(),
+}
+
+var testProtector = csrf.New([]byte("key"), csrf.Config{})
+
 func TestGet(t *testing.T) {
 	t.Parallel()
 
@@ -19,6 +36,13 @@ func TestGet(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	formTemplate, err := templates.NewFormTemplate("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withFormTemplates := templates.NewTemplates(fallback)
+	withFormTemplates.Set(http.StatusOK, formTemplate)
+
 	templates := templates.NewTemplates(fallback)
 
 	t.Run("status code with no users", func(t *testing.T) {
@@ -26,18 +50,16 @@ func TestGet(t *testing.T) {
 		defer ctrl.Finish()
 
 		var (
-			store      = mock_store.NewMockStore(ctrl)
+			mockStore  = mock_store.NewMockStore(ctrl)
 			recorder   = httptest.NewRecorder()
-			controller = New(store, templates, recorder, httptest.NewRequest("GET", "/", nil))
+			controller = New(mockStore, testForm, testProtector, templates, recorder, httptest.NewRequest("GET", "/", nil))
 		)
 
-		store.EXPECT().
-			Read().
-			Return([]models.User{}, nil)
+		expectScan(mockStore, []models.User{}, store.Version("abc"), nil)
 
 		controller.Get()
 
-		if expected, actual := http.StatusNotFound, recorder.Code; expected != actual {
+		if expected, actual := http.StatusOK, recorder.Code; expected != actual {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
 		}
 	})
@@ -47,14 +69,12 @@ func TestGet(t *testing.T) {
 		defer ctrl.Finish()
 
 		var (
-			store      = mock_store.NewMockStore(ctrl)
+			mockStore  = mock_store.NewMockStore(ctrl)
 			recorder   = httptest.NewRecorder()
-			controller = New(store, templates, recorder, httptest.NewRequest("GET", "/", nil))
+			controller = New(mockStore, testForm, testProtector, templates, recorder, httptest.NewRequest("GET", "/", nil))
 		)
 
-		store.EXPECT().
-			Read().
-			Return([]models.User{models.User{"Joe", "Smith"}}, nil)
+		expectScan(mockStore, []models.User{models.User{Fields: models.Fields{"firstname": "Joe", "surname": "Smith"}}}, store.Version("abc"), nil)
 
 		controller.Get()
 
@@ -68,14 +88,12 @@ func TestGet(t *testing.T) {
 		defer ctrl.Finish()
 
 		var (
-			store      = mock_store.NewMockStore(ctrl)
+			mockStore  = mock_store.NewMockStore(ctrl)
 			recorder   = httptest.NewRecorder()
-			controller = New(store, templates, recorder, httptest.NewRequest("GET", "/", nil))
+			controller = New(mockStore, testForm, testProtector, templates, recorder, httptest.NewRequest("GET", "/", nil))
 		)
 
-		store.EXPECT().
-			Read().
-			Return(nil, errors.New("permissions error"))
+		expectScan(mockStore, nil, store.AnyVersion, errors.New("permissions error"))
 
 		controller.Get()
 
@@ -83,6 +101,80 @@ func TestGet(t *testing.T) {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
 		}
 	})
+
+	t.Run("status code with invalid page", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore  = mock_store.NewMockStore(ctrl)
+			recorder   = httptest.NewRecorder()
+			controller = New(mockStore, testForm, testProtector, templates, recorder, httptest.NewRequest("GET", "/?offset=-1", nil))
+		)
+
+		controller.Get()
+
+		if expected, actual := http.StatusBadRequest, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("page of users", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore  = mock_store.NewMockStore(ctrl)
+			recorder   = httptest.NewRecorder()
+			controller = New(mockStore, testForm, testProtector, templates, recorder, httptest.NewRequest("GET", "/?offset=1&limit=1", nil))
+		)
+
+		expectScan(mockStore, []models.User{
+			models.User{ID: "a1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+			models.User{ID: "b2", Fields: models.Fields{"firstname": "jane", "surname": "smith"}},
+			models.User{ID: "c3", Fields: models.Fields{"firstname": "joe", "surname": "bloggs"}},
+		}, store.Version("abc"), nil)
+
+		controller.Get()
+
+		if expected, actual := http.StatusOK, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("viewers get the form without the buttons", func(t *testing.T) {
+		for role, want := range map[auth.Role]bool{
+			auth.RoleViewer: false,
+			auth.RoleEditor: true,
+		} {
+			ctrl := gomock.NewController(t)
+
+			var (
+				mockStore = mock_store.NewMockStore(ctrl)
+				recorder  = httptest.NewRecorder()
+				request   = httptest.NewRequest("GET", "/", nil)
+			)
+			request = request.WithContext(auth.NewContext(request.Context(), auth.Identity{Name: "fred", Role: role}))
+			controller := New(mockStore, testForm, testProtector, withFormTemplates, recorder, request)
+
+			expectScan(mockStore, []models.User{
+				models.User{ID: "a1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+			}, store.Version("abc"), nil)
+
+			controller.Get()
+
+			if expected, actual := http.StatusOK, recorder.Code; expected != actual {
+				t.Errorf("%s: expected: %v, actual: %v", role, expected, actual)
+			}
+			body := recorder.Body.String()
+			for _, button := range []string{`value="add"`, `value="remove:0"`, `type="submit" value="OK"`} {
+				if expected, actual := want, strings.Contains(body, button); expected != actual {
+					t.Errorf("%s: %s expected: %v, actual: %v", role, button, expected, actual)
+				}
+			}
+			ctrl.Finish()
+		}
+	})
 }
 
 func TestPost(t *testing.T) {
@@ -92,6 +184,14 @@ func TestPost(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	formTemplate, err := templates.NewFormTemplate("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withFormTemplates := templates.NewTemplates(fallback)
+	withFormTemplates.Set(http.StatusOK, formTemplate)
+	withFormTemplates.Set(http.StatusUnprocessableEntity, formTemplate)
+
 	templates := templates.NewTemplates(fallback)
 
 	t.Run("valid form data", func(t *testing.T) {
@@ -99,28 +199,128 @@ func TestPost(t *testing.T) {
 		defer ctrl.Finish()
 
 		var (
-			store      = mock_store.NewMockStore(ctrl)
+			mockStore  = mock_store.NewMockStore(ctrl)
 			recorder   = httptest.NewRecorder()
 			request    = httptest.NewRequest("POST", "/", nil)
-			controller = New(store, templates, recorder, request)
+			controller = New(mockStore, testForm, testProtector, templates, recorder, request)
 		)
 
 		request.Form = map[string][]string{
-			formKeyFirstName: []string{"fred"},
-			formKeySurname:   []string{"bloggs"},
+			formKey(0, "firstname"): []string{"fred"},
+			formKey(0, "surname"):   []string{"bloggs"},
 		}
+		withSession(t, request)
 
-		store.EXPECT().
+		mockStore.EXPECT().
 			Write([]models.User{
-				models.User{"fred", "bloggs"},
-			}).
-			Return(nil)
+				models.User{Fields: models.Fields{"firstname": "fred", "surname": "bloggs"}},
+			}, store.AnyVersion).
+			Return(store.Version("abc"), nil)
 
 		controller.Post()
 
 		if expected, actual := http.StatusSeeOther, recorder.Code; expected != actual {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
 		}
+		if expected, actual := "/query/people/", recorder.Header().Get("Location"); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("form data with current version", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore  = mock_store.NewMockStore(ctrl)
+			recorder   = httptest.NewRecorder()
+			request    = httptest.NewRequest("POST", "/", nil)
+			controller = New(mockStore, testForm, testProtector, templates, recorder, request)
+		)
+
+		request.Form = map[string][]string{
+			formKey(0, "firstname"): []string{"fred"},
+			formKey(0, "surname"):   []string{"bloggs"},
+			formKeyVersion:          []string{"abc"},
+		}
+		withSession(t, request)
+
+		mockStore.EXPECT().
+			Write([]models.User{
+				models.User{Fields: models.Fields{"firstname": "fred", "surname": "bloggs"}},
+			}, store.Version("abc")).
+			Return(store.Version("def"), nil)
+
+		controller.Post()
+
+		if expected, actual := http.StatusSeeOther, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("form data with stale version", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore  = mock_store.NewMockStore(ctrl)
+			recorder   = httptest.NewRecorder()
+			request    = httptest.NewRequest("POST", "/", nil)
+			controller = New(mockStore, testForm, testProtector, templates, recorder, request)
+		)
+
+		request.Form = map[string][]string{
+			formKey(0, "firstname"): []string{"fred"},
+			formKey(0, "surname"):   []string{"bloggs"},
+			formKeyVersion:          []string{"abc"},
+		}
+		withSession(t, request)
+
+		mockStore.EXPECT().
+			Write([]models.User{
+				models.User{Fields: models.Fields{"firstname": "fred", "surname": "bloggs"}},
+			}, store.Version("abc")).
+			Return(store.AnyVersion, &store.ConflictError{
+				Expected: "abc",
+				Actual:   "def",
+				Users:    []models.User{models.User{Fields: models.Fields{"firstname": "jane", "surname": "doe"}}},
+			})
+
+		controller.Post()
+
+		if expected, actual := http.StatusConflict, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("form data with store error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore  = mock_store.NewMockStore(ctrl)
+			recorder   = httptest.NewRecorder()
+			request    = httptest.NewRequest("POST", "/", nil)
+			controller = New(mockStore, testForm, testProtector, templates, recorder, request)
+		)
+
+		request.Form = map[string][]string{
+			formKey(0, "firstname"): []string{"fred"},
+			formKey(0, "surname"):   []string{"bloggs"},
+		}
+		withSession(t, request)
+
+		mockStore.EXPECT().
+			Write([]models.User{
+				models.User{Fields: models.Fields{"firstname": "fred", "surname": "bloggs"}},
+			}, store.AnyVersion).
+			Return(store.AnyVersion, errors.New("disk full"))
+
+		controller.Post()
+
+		if expected, actual := http.StatusInternalServerError, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
 	})
 
 	t.Run("invalid form data", func(t *testing.T) {
@@ -128,16 +328,175 @@ func TestPost(t *testing.T) {
 		defer ctrl.Finish()
 
 		var (
-			store      = mock_store.NewMockStore(ctrl)
+			mockStore  = mock_store.NewMockStore(ctrl)
 			recorder   = httptest.NewRecorder()
 			request    = httptest.NewRequest("POST", "/", nil)
-			controller = New(store, templates, recorder, request)
+			controller = New(mockStore, testForm, testProtector, withFormTemplates, recorder, request)
 		)
 
 		request.Form = map[string][]string{
-			formKeyFirstName: []string{"fred"},
-			formKeySurname:   []string{""},
+			formKey(0, "firstname"): []string{"fred"},
+			formKey(0, "surname"):   []string{""},
+			formKeyVersion:          []string{"abc"},
 		}
+		withSession(t, request)
+
+		controller.Post()
+
+		if expected, actual := http.StatusUnprocessableEntity, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		// The submitted values, the version and the violation are all rendered.
+		body := recorder.Body.String()
+		for _, want := range []string{
+			`name="people[0][firstname]" value="fred"`,
+			`name="version" value="abc"`,
+			"expected Last name to not be empty",
+		} {
+			if expected, actual := true, strings.Contains(body, want); expected != actual {
+				t.Errorf("expected: %q in %q", want, body)
+			}
+		}
+	})
+
+	t.Run("form data with an action", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore  = mock_store.NewMockStore(ctrl)
+			recorder   = httptest.NewRecorder()
+			request    = httptest.NewRequest("POST", "/", nil)
+			controller = New(mockStore, testForm, testProtector, withFormTemplates, recorder, request)
+		)
+
+		request.Form = map[string][]string{
+			formKey(0, "firstname"): []string{"fred"},
+			formKey(0, "surname"):   []string{"bloggs"},
+			formKey(1, "firstname"): []string{"john"},
+			formKey(1, "surname"):   []string{""},
+			formKeyVersion:          []string{"abc"},
+			formKeyAction:           []string{"up:1"},
+		}
+		withSession(t, request)
+
+		// Nothing is written, the form is only rendered again.
+		controller.Post()
+
+		if expected, actual := http.StatusOK, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		body := recorder.Body.String()
+		for _, want := range []string{
+			`name="people[0][firstname]" value="john"`,
+			`name="people[1][firstname]" value="fred"`,
+			`name="version" value="abc"`,
+		} {
+			if expected, actual := true, strings.Contains(body, want); expected != actual {
+				t.Errorf("expected: %q in %q", want, body)
+			}
+		}
+		if expected, actual := false, strings.Contains(body, `class="error"`); expected != actual {
+			t.Errorf("expected: no violations in %q", body)
+		}
+	})
+
+	t.Run("form data with every row removed", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore  = mock_store.NewMockStore(ctrl)
+			recorder   = httptest.NewRecorder()
+			request    = httptest.NewRequest("POST", "/", nil)
+			controller = New(mockStore, testForm, testProtector, templates, recorder, request)
+		)
+
+		request.Form = map[string][]string{
+			formKeyVersion: []string{"abc"},
+		}
+		withSession(t, request)
+
+		mockStore.EXPECT().
+			Write([]models.User{}, store.Version("abc")).
+			Return(store.Version("def"), nil)
+
+		controller.Post()
+
+		if expected, actual := http.StatusSeeOther, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("form data of a page", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore  = mock_store.NewMockStore(ctrl)
+			recorder   = httptest.NewRecorder()
+			request    = httptest.NewRequest("POST", "/", nil)
+			controller = New(mockStore, testForm, testProtector, templates, recorder, request)
+		)
+
+		// The second and third users were rendered, but only one of them is
+		// sent back. Another user was added to the front since, which doesn't
+		// move the users that are replaced.
+		request.Form = map[string][]string{
+			formKey(0, "id"):        []string{"b2"},
+			formKey(0, "firstname"): []string{"jane"},
+			formKey(0, "surname"):   []string{"bloggs"},
+			pageKeyOffset:           []string{"1"},
+			pageKeyLimit:            []string{"2"},
+			pageKeyIDs:              []string{"b2", "c3"},
+		}
+		withSession(t, request)
+
+		expectScan(mockStore, []models.User{
+			models.User{ID: "z0", Fields: models.Fields{"firstname": "amy", "surname": "adams"}},
+			models.User{ID: "a1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+			models.User{ID: "b2", Fields: models.Fields{"firstname": "jane", "surname": "smith"}},
+			models.User{ID: "c3", Fields: models.Fields{"firstname": "joe", "surname": "bloggs"}},
+			models.User{ID: "d4", Fields: models.Fields{"firstname": "ann", "surname": "jones"}},
+		}, store.Version("abc"), nil)
+		mockStore.EXPECT().
+			Write([]models.User{
+				models.User{ID: "z0", Fields: models.Fields{"firstname": "amy", "surname": "adams"}},
+				models.User{ID: "a1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+				models.User{ID: "b2", Fields: models.Fields{"firstname": "jane", "surname": "bloggs"}},
+				models.User{ID: "d4", Fields: models.Fields{"firstname": "ann", "surname": "jones"}},
+			}, store.Version("abc")).
+			Return(store.Version("def"), nil)
+
+		controller.Post()
+
+		if expected, actual := http.StatusSeeOther, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := "/query/people/?limit=2&offset=1", recorder.Header().Get("Location"); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("form data with an invalid page", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore  = mock_store.NewMockStore(ctrl)
+			recorder   = httptest.NewRecorder()
+			request    = httptest.NewRequest("POST", "/", nil)
+			controller = New(mockStore, testForm, testProtector, templates, recorder, request)
+		)
+
+		request.Form = map[string][]string{
+			formKey(0, "firstname"): []string{"fred"},
+			formKey(0, "surname"):   []string{"bloggs"},
+			pageKeyOffset:           []string{"-1"},
+		}
+		withSession(t, request)
 
 		controller.Post()
 
@@ -151,13 +510,14 @@ func TestPost(t *testing.T) {
 		defer ctrl.Finish()
 
 		var (
-			store      = mock_store.NewMockStore(ctrl)
+			mockStore  = mock_store.NewMockStore(ctrl)
 			recorder   = httptest.NewRecorder()
 			request    = httptest.NewRequest("POST", "/", nil)
-			controller = New(store, templates, recorder, request)
+			controller = New(mockStore, testForm, testProtector, templates, recorder, request)
 		)
 
 		request.Form = map[string][]string{}
+		withSession(t, request)
 
 		controller.Post()
 
@@ -167,6 +527,120 @@ func TestPost(t *testing.T) {
 	})
 }
 
+func TestCSRF(t *testing.T) {
+	t.Parallel()
+
+	fallback, err := templates.NewErrorTemplate(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	formTemplate, err := templates.NewFormTemplate("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forbiddenTemplate, err := templates.NewForbiddenTemplate("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates := templates.NewTemplates(fallback)
+	templates.Set(http.StatusOK, formTemplate)
+	templates.Set(http.StatusForbidden, forbiddenTemplate)
+
+	tokenInput := regexp.MustCompile(`name="csrf" value="([^"]+)"`)
+
+	t.Run("token lifecycle", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore  = mock_store.NewMockStore(ctrl)
+			recorder   = httptest.NewRecorder()
+			controller = New(mockStore, testForm, testProtector, templates, recorder, httptest.NewRequest("GET", "/", nil))
+		)
+
+		expectScan(mockStore, []models.User{}, store.Version("abc"), nil)
+
+		// The form is rendered with the token, along with the session cookie.
+		controller.Get()
+
+		cookies := recorder.Result().Cookies()
+		if expected, actual := 1, len(cookies); expected != actual {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+		match := tokenInput.FindStringSubmatch(recorder.Body.String())
+		if match == nil {
+			t.Fatalf("expected a token in: %s", recorder.Body.String())
+		}
+
+		// Posting the form back within the session is written.
+		request := newFormRequest("/", url.Values{
+			csrf.FormKey:            []string{match[1]},
+			formKey(0, "firstname"): []string{"fred"},
+			formKey(0, "surname"):   []string{"bloggs"},
+		})
+		request.AddCookie(cookies[0])
+
+		mockStore.EXPECT().
+			Write([]models.User{
+				models.User{Fields: models.Fields{"firstname": "fred", "surname": "bloggs"}},
+			}, store.AnyVersion).
+			Return(store.Version("def"), nil)
+
+		recorder = httptest.NewRecorder()
+		New(mockStore, testForm, testProtector, templates, recorder, request).Post()
+
+		if expected, actual := http.StatusSeeOther, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	for _, testcase := range []struct {
+		name    string
+		session bool
+		token   string
+	}{
+		{"missing session", false, "abc"},
+		{"missing token", true, ""},
+		{"token of another session", true, "abc"},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var (
+				mockStore = mock_store.NewMockStore(ctrl)
+				recorder  = httptest.NewRecorder()
+				request   = newFormRequest("/", url.Values{
+					formKey(0, "firstname"): []string{"fred"},
+					formKey(0, "surname"):   []string{"bloggs"},
+				})
+				controller = New(mockStore, testForm, testProtector, templates, recorder, request)
+			)
+
+			if testcase.session {
+				withSession(t, request)
+			} else if err := request.ParseForm(); err != nil {
+				t.Fatal(err)
+			}
+			if testcase.token != "" {
+				request.Form.Set(csrf.FormKey, testcase.token)
+			} else {
+				request.Form.Del(csrf.FormKey)
+			}
+
+			// Nothing is read or written.
+			controller.Post()
+
+			if expected, actual := http.StatusForbidden, recorder.Code; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+			if expected, actual := `href="/query/people/"`, recorder.Body.String(); !strings.Contains(actual, expected) {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		})
+	}
+}
+
 func TestNotFound(t *testing.T) {
 	t.Parallel()
 
@@ -181,9 +655,9 @@ func TestNotFound(t *testing.T) {
 		defer ctrl.Finish()
 
 		var (
-			store      = mock_store.NewMockStore(ctrl)
+			mockStore  = mock_store.NewMockStore(ctrl)
 			recorder   = httptest.NewRecorder()
-			controller = New(store, templates, recorder, httptest.NewRequest("POST", "/bad", nil))
+			controller = New(mockStore, testForm, testProtector, templates, recorder, httptest.NewRequest("POST", "/bad", nil))
 		)
 
 		controller.NotFound()
@@ -193,3 +667,39 @@ func TestNotFound(t *testing.T) {
 		}
 	})
 }
+
+// withSession starts a session for the request and holds the token of the
+// session in the form, as if the form was rendered for the session.
+func withSession(t *testing.T, request *http.Request) {
+	if err := request.ParseForm(); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	token, err := testProtector.Token(recorder, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cookie := range recorder.Result().Cookies() {
+		request.AddCookie(cookie)
+	}
+	request.Form.Set(csrf.FormKey, token)
+}
+
+// expectScan expects the store to be scanned, every user is passed to the
+// function of the scan unless there is an error.
+func expectScan(mockStore *mock_store.MockStore, users []models.User, version store.Version, err error) {
+	mockStore.EXPECT().
+		Scan(gomock.Any()).
+		DoAndReturn(func(fn func(models.User) error) (store.Version, error) {
+			if err != nil {
+				return store.AnyVersion, err
+			}
+			for _, user := range users {
+				if err := fn(user); err != nil {
+					return store.AnyVersion, err
+				}
+			}
+			return version, nil
+		})
+}
@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/SimonRichardson/formed/pkg/store"
+	"github.com/SimonRichardson/formed/pkg/transfer"
+	"github.com/pkg/errors"
+)
+
+// maxImportSize is the largest file that can be imported.
+const maxImportSize = 32 << 20
+
+// Export writes out all the users in the store as a file, in the format
+// (csv, json, ndjson or xlsx) given by the query string. A csv file can also
+// be given a delimiter and an encoding.
+func (a *api) Export() {
+	format, options, ok := a.transferOptions()
+	if !ok {
+		return
+	}
+
+	users, version, ok := a.read()
+	if !ok {
+		return
+	}
+
+	// Encode everything to nowhere first, so that an error can still be
+	// written as JSON, i.e. a name that can't be written as latin1. The file
+	// itself is then written straight out, rather than held in memory.
+	columns := a.form.Schema.Columns()
+	if err := transfer.Export(ioutil.Discard, format, columns, users, options); err != nil {
+		a.error(http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	header := a.writer.Header()
+	header.Set("Content-Type", transfer.ContentType(format, options))
+	header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", a.form.Name+"."+string(format)))
+	header.Set("ETag", etag(version))
+	a.writer.WriteHeader(http.StatusOK)
+
+	// The users have already been encoded once, so the only error left is
+	// the client going away, which there is no one to tell about.
+	transfer.Export(a.writer, format, columns, users, options)
+}
+
+// Import reads users from the file held in the request body and imports them
+// in to the store, in the mode (merge or replace) given by the query string.
+// A report of what changed is written out, nothing is written to the store
+// if any row can't be imported, or if it's a dry run.
+func (a *api) Import() {
+	format, options, ok := a.transferOptions()
+	if !ok {
+		return
+	}
+
+	query := a.request.URL.Query()
+	mode, err := transfer.ParseMode(query.Get("mode"))
+	if err != nil {
+		a.error(http.StatusBadRequest, err)
+		return
+	}
+	dryRun := false
+	if value := query.Get("dry_run"); value != "" {
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			a.error(http.StatusBadRequest, errors.Errorf("invalid dry_run %q", value))
+			return
+		}
+	}
+
+	body := http.MaxBytesReader(a.writer, a.request.Body, maxImportSize)
+	rows, err := transfer.Read(body, format, a.form.Schema.Columns(), options)
+	if err != nil {
+		a.error(http.StatusBadRequest, errors.Wrap(err, "unable to import"))
+		return
+	}
+
+	users, version, ok := a.readForWrite()
+	if !ok {
+		return
+	}
+
+	users, report := transfer.Import(users, rows, mode, a.form.Schema)
+	report.DryRun = dryRun
+
+	switch {
+	case !report.Valid():
+		a.render(http.StatusUnprocessableEntity, version, importResource{
+			Report:  report,
+			Version: version,
+		})
+		return
+	case dryRun, !report.Changed():
+		a.render(http.StatusOK, version, importResource{
+			Report:  report,
+			Version: version,
+		})
+		return
+	}
+
+	if version, ok = a.write(users, version); !ok {
+		return
+	}
+	a.render(http.StatusOK, version, importResource{
+		Report:  report,
+		Version: version,
+	})
+}
+
+// transferOptions reads the format of the file from the query string, csv if
+// there isn't one, along with the options for a csv file.
+func (a *api) transferOptions() (transfer.Format, transfer.Options, bool) {
+	query := a.request.URL.Query()
+
+	format := transfer.CSV
+	if value := query.Get("format"); value != "" {
+		var err error
+		if format, err = transfer.ParseFormat(value); err != nil {
+			a.error(http.StatusBadRequest, err)
+			return "", transfer.Options{}, false
+		}
+	}
+
+	delimiter, err := transfer.ParseDelimiter(query.Get("delimiter"))
+	if err != nil {
+		a.error(http.StatusBadRequest, err)
+		return "", transfer.Options{}, false
+	}
+	encoding, err := transfer.ParseEncoding(query.Get("encoding"))
+	if err != nil {
+		a.error(http.StatusBadRequest, err)
+		return "", transfer.Options{}, false
+	}
+
+	return format, transfer.Options{
+		Delimiter: delimiter,
+		Encoding:  encoding,
+	}, true
+}
+
+type importResource struct {
+	Report  transfer.Report `json:"report"`
+	Version store.Version   `json:"version"`
+}
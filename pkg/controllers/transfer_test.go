@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/SimonRichardson/formed/pkg/schema"
+	"github.com/SimonRichardson/formed/pkg/store"
+	"github.com/SimonRichardson/formed/pkg/store/mock_store"
+	"github.com/SimonRichardson/formed/pkg/transfer"
+	"github.com/golang/mock/gomock"
+)
+
+func TestAPIExport(t *testing.T) {
+	t.Parallel()
+
+	t.Run("csv", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore  = mock_store.NewMockStore(ctrl)
+			recorder   = httptest.NewRecorder()
+			controller = NewAPI(mockStore, testForm, recorder, httptest.NewRequest("GET", "/?delimiter=%3B&encoding=latin1", nil))
+		)
+
+		mockStore.EXPECT().
+			Read().
+			Return([]models.User{models.User{ID: "a1", Fields: models.Fields{"firstname": "zoë", "surname": "smith"}}}, store.Version("abc"), nil)
+
+		controller.Export()
+
+		if expected, actual := http.StatusOK, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := "text/csv; charset=latin1", recorder.Header().Get("Content-Type"); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := `attachment; filename="people.csv"`, recorder.Header().Get("Content-Disposition"); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := "id;firstname;surname\na1;zo\xeb;smith\n", recorder.Body.String(); expected != actual {
+			t.Errorf("expected: %q, actual: %q", expected, actual)
+		}
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore  = mock_store.NewMockStore(ctrl)
+			recorder   = httptest.NewRecorder()
+			controller = NewAPI(mockStore, testForm, recorder, httptest.NewRequest("GET", "/?format=pdf", nil))
+		)
+
+		controller.Export()
+
+		if expected, actual := http.StatusBadRequest, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestAPIImport(t *testing.T) {
+	t.Parallel()
+
+	current := []models.User{models.User{ID: "a1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}}}
+
+	serve := func(t *testing.T, mockStore store.Store, path, body string) (*httptest.ResponseRecorder, importResource) {
+		var (
+			recorder = httptest.NewRecorder()
+			request  = httptest.NewRequest("POST", path, strings.NewReader(body))
+		)
+		request.Header.Set("Content-Type", "text/csv")
+		NewAPI(mockStore, testForm, recorder, request).Import()
+
+		var resource importResource
+		if err := json.NewDecoder(recorder.Body).Decode(&resource); err != nil {
+			t.Fatal(err)
+		}
+		return recorder, resource
+	}
+
+	t.Run("merge", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockStore := mock_store.NewMockStore(ctrl)
+		mockStore.EXPECT().
+			Read().
+			Return(current, store.Version("abc"), nil)
+		var written []models.User
+		mockStore.EXPECT().
+			Write(gomock.Any(), store.Version("abc")).
+			Do(func(users []models.User, version store.Version) {
+				written = users
+			}).
+			Return(store.Version("def"), nil)
+
+		recorder, resource := serve(t, mockStore, "/?format=ndjson", `{"id":"a1","surname":"jones"}`+"\n"+`{"firstname":"jane","surname":"doe"}`)
+
+		if expected, actual := http.StatusOK, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := (importResource{
+			Report:  transfer.Report{Mode: transfer.Merge, Rows: 2, Added: 1, Updated: 1},
+			Version: "def",
+		}), resource; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 2, len(written); expected != actual {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := "jones", written[0].Get("surname"); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockStore := mock_store.NewMockStore(ctrl)
+		mockStore.EXPECT().
+			Read().
+			Return(current, store.Version("abc"), nil)
+
+		recorder, resource := serve(t, mockStore, "/?mode=replace&dry_run=true", "firstname,surname\njane,doe\n")
+
+		if expected, actual := http.StatusOK, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := (transfer.Report{Mode: transfer.Replace, DryRun: true, Rows: 1, Added: 1, Removed: 1}), resource.Report; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("invalid rows", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockStore := mock_store.NewMockStore(ctrl)
+		mockStore.EXPECT().
+			Read().
+			Return(current, store.Version("abc"), nil)
+
+		recorder, resource := serve(t, mockStore, "/", "firstname,surname\njane,doe\njohn,\n")
+
+		if expected, actual := http.StatusUnprocessableEntity, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := []transfer.RowError{
+			{Row: 3, Field: "surname", Rule: schema.RuleRequired, Message: "expected Last name to not be empty"},
+		}, resource.Report.Errors; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestAPIImportCrossSite(t *testing.T) {
+	t.Parallel()
+
+	for _, contentType := range []string{
+		"",
+		"text/plain",
+		"application/x-www-form-urlencoded",
+		"multipart/form-data; boundary=x",
+	} {
+		ctrl := gomock.NewController(t)
+
+		var (
+			mockStore = mock_store.NewMockStore(ctrl)
+			recorder  = httptest.NewRecorder()
+			request   = httptest.NewRequest("POST", "/?mode=replace", strings.NewReader("firstname,surname\n"))
+		)
+		if contentType != "" {
+			request.Header.Set("Content-Type", contentType)
+		}
+		NewAPI(mockStore, testForm, recorder, request).Import()
+
+		if expected, actual := http.StatusForbidden, recorder.Code; expected != actual {
+			t.Errorf("%q: expected: %v, actual: %v", contentType, expected, actual)
+		}
+		ctrl.Finish()
+	}
+}
+
+func TestAPIImportBadRequest(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name, path, body string
+	}{
+		{"unknown mode", "/?mode=append", ""},
+		{"invalid dry run", "/?dry_run=maybe", ""},
+		{"unknown column", "/", "firstname,age\nfred,3\n"},
+	} {
+		ctrl := gomock.NewController(t)
+
+		var (
+			mockStore = mock_store.NewMockStore(ctrl)
+			recorder  = httptest.NewRecorder()
+		)
+		NewAPI(mockStore, testForm, recorder, httptest.NewRequest("POST", testcase.path, strings.NewReader(testcase.body))).Import()
+
+		if expected, actual := http.StatusBadRequest, recorder.Code; expected != actual {
+			t.Errorf("%s: expected: %v, actual: %v", testcase.name, expected, actual)
+		}
+		ctrl.Finish()
+	}
+}
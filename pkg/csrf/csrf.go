@@ -0,0 +1,145 @@
+package csrf
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// FormKey is the name of the form field that holds the token.
+	FormKey = "csrf"
+
+	// DefaultCookieName is the name of the cookie that holds the session, if
+	// no other name is configured.
+	DefaultCookieName = "formed_csrf"
+
+	sessionSize = 32
+)
+
+var (
+	// ErrMissingSession is returned when the request has no session cookie,
+	// either the form wasn't rendered by us or the cookie was never sent.
+	ErrMissingSession = errors.New("missing csrf session")
+
+	// ErrMissingToken is returned when the form was sent without a token.
+	ErrMissingToken = errors.New("missing csrf token")
+
+	// ErrInvalidToken is returned when the token doesn't belong to the
+	// session.
+	ErrInvalidToken = errors.New("invalid csrf token")
+)
+
+// Config describes the cookie that holds the session.
+type Config struct {
+	CookieName string
+	SameSite   http.SameSite
+	Secure     bool
+}
+
+// Protector issues tokens for a session and verifies that forms are sent
+// back with the token of the session. The session is held in a cookie and the
+// token is derived from the session using the key, so nothing has to be
+// stored on the server.
+type Protector struct {
+	key    []byte
+	config Config
+}
+
+// New creates a Protector that signs the tokens with the key.
+func New(key []byte, config Config) *Protector {
+	if config.CookieName == "" {
+		config.CookieName = DefaultCookieName
+	}
+	return &Protector{
+		key:    key,
+		config: config,
+	}
+}
+
+// NewKey returns a random key that can be used to sign the tokens.
+func NewKey() ([]byte, error) {
+	key := make([]byte, sha256.Size)
+	if _, err := rand.Read(key); err != nil {
+		return nil, errors.Wrap(err, "unable to create csrf key")
+	}
+	return key, nil
+}
+
+// Token returns the token for the session of the request. If the request has
+// no session then a new session is started and its cookie is set on the
+// response, so the cookie has to be set before anything is written.
+func (p *Protector) Token(w http.ResponseWriter, r *http.Request) (string, error) {
+	if session, ok := p.session(r); ok {
+		return p.sign(session), nil
+	}
+
+	b := make([]byte, sessionSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "unable to create csrf session")
+	}
+	session := hex.EncodeToString(b)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     p.config.CookieName,
+		Value:    session,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   p.config.Secure,
+		SameSite: p.config.SameSite,
+	})
+	return p.sign(session), nil
+}
+
+// Verify checks that the form of the request holds the token of the session.
+// The form is expected to be parsed already.
+func (p *Protector) Verify(r *http.Request) error {
+	session, ok := p.session(r)
+	if !ok {
+		return ErrMissingSession
+	}
+
+	token := r.Form.Get(FormKey)
+	if token == "" {
+		return ErrMissingToken
+	}
+	if !hmac.Equal([]byte(token), []byte(p.sign(session))) {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+func (p *Protector) session(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(p.config.CookieName)
+	if err != nil || len(cookie.Value) != sessionSize*2 {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
+func (p *Protector) sign(session string) string {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(session))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ParseSameSite returns the SameSite setting of the cookie for the name, one of
+// lax, strict, none or default.
+func ParseSameSite(name string) (http.SameSite, error) {
+	switch strings.ToLower(name) {
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	case "default", "":
+		return http.SameSiteDefaultMode, nil
+	}
+	return http.SameSiteDefaultMode, errors.Errorf("unknown samesite %q, expected one of lax, strict, none or default", name)
+}
@@ -0,0 +1,144 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestToken(t *testing.T) {
+	t.Parallel()
+
+	protector := New([]byte("key"), Config{SameSite: http.SameSiteStrictMode, Secure: true})
+
+	t.Run("starts a session", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		token, err := protector.Token(recorder, httptest.NewRequest("GET", "/", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token == "" {
+			t.Errorf("expected a token")
+		}
+
+		cookies := recorder.Result().Cookies()
+		if expected, actual := 1, len(cookies); expected != actual {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+		cookie := cookies[0]
+		if expected, actual := DefaultCookieName, cookie.Name; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := http.SameSiteStrictMode, cookie.SameSite; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if !cookie.HttpOnly || !cookie.Secure {
+			t.Errorf("expected an http only, secure cookie")
+		}
+	})
+
+	t.Run("keeps the session", func(t *testing.T) {
+		cookie, token := newSession(t, protector)
+
+		request := httptest.NewRequest("GET", "/", nil)
+		request.AddCookie(cookie)
+
+		recorder := httptest.NewRecorder()
+		actual, err := protector.Token(recorder, request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := token; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 0, len(recorder.Result().Cookies()); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("sessions have different tokens", func(t *testing.T) {
+		_, a := newSession(t, protector)
+		_, b := newSession(t, protector)
+		if a == b {
+			t.Errorf("expected different tokens, actual: %v", a)
+		}
+	})
+}
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	var (
+		protector = New([]byte("key"), Config{})
+		other     = New([]byte("other"), Config{})
+	)
+
+	cookie, token := newSession(t, protector)
+	_, otherToken := newSession(t, protector)
+	_, otherKeyToken := newSession(t, other)
+
+	for _, testcase := range []struct {
+		name   string
+		cookie *http.Cookie
+		token  string
+		err    error
+	}{
+		{"valid", cookie, token, nil},
+		{"missing session", nil, token, ErrMissingSession},
+		{"malformed session", &http.Cookie{Name: DefaultCookieName, Value: "abc"}, token, ErrMissingSession},
+		{"missing token", cookie, "", ErrMissingToken},
+		{"token of another session", cookie, otherToken, ErrInvalidToken},
+		{"token of another key", cookie, otherKeyToken, ErrInvalidToken},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			request := httptest.NewRequest("POST", "/", nil)
+			if testcase.cookie != nil {
+				request.AddCookie(testcase.cookie)
+			}
+			request.Form = url.Values{}
+			if testcase.token != "" {
+				request.Form.Set(FormKey, testcase.token)
+			}
+
+			if expected, actual := testcase.err, protector.Verify(request); expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseSameSite(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name     string
+		expected http.SameSite
+		valid    bool
+	}{
+		{"lax", http.SameSiteLaxMode, true},
+		{"Strict", http.SameSiteStrictMode, true},
+		{"none", http.SameSiteNoneMode, true},
+		{"default", http.SameSiteDefaultMode, true},
+		{"sometimes", http.SameSiteDefaultMode, false},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			actual, err := ParseSameSite(testcase.name)
+			if expected, actual := testcase.valid, err == nil; expected != actual {
+				t.Errorf("expected: %v, actual: %v, err: %v", expected, actual, err)
+			}
+			if expected := testcase.expected; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		})
+	}
+}
+
+func newSession(t *testing.T, protector *Protector) (*http.Cookie, string) {
+	recorder := httptest.NewRecorder()
+	token, err := protector.Token(recorder, httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return recorder.Result().Cookies()[0], token
+}
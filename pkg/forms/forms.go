@@ -0,0 +1,108 @@
+package forms
+
+import (
+	"io/ioutil"
+	"regexp"
+
+	"github.com/SimonRichardson/formed/pkg/fs"
+	"github.com/SimonRichardson/formed/pkg/schema"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// validName keeps the names of forms safe to use as a segment of the URL.
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Form describes one of the forms that is served, where it's served from and
+// the schema of its fields.
+type Form struct {
+	Name   string
+	Title  string
+	Path   string
+	Schema schema.Schema
+}
+
+// Config describes all the forms that are served from one process.
+type Config struct {
+	Forms []FormConfig `json:"forms" yaml:"forms"`
+}
+
+// FormConfig describes where a form gets its schema, store, history and
+// views from. Only the name and the store are required, everything else falls
+// back to the defaults.
+type FormConfig struct {
+	Name      string `json:"name" yaml:"name"`
+	Title     string `json:"title,omitempty" yaml:"title,omitempty"`
+	Schema    string `json:"schema,omitempty" yaml:"schema,omitempty"`
+	FileStore string `json:"filestore" yaml:"filestore"`
+	History   string `json:"history,omitempty" yaml:"history,omitempty"`
+	Views     string `json:"views,omitempty" yaml:"views,omitempty"`
+}
+
+// LoadConfig reads the configuration of the forms from the file found at
+// path. The file can either be YAML or JSON.
+func LoadConfig(fsys fs.Filesystem, path string) (Config, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return Config{}, errors.Wrapf(err, "unable to open forms at %q", path)
+	}
+	defer file.Close()
+
+	b, err := ioutil.ReadAll(file)
+	if err != nil {
+		return Config{}, errors.Wrapf(err, "unable to read forms at %q", path)
+	}
+
+	config, err := ParseConfig(b)
+	if err != nil {
+		return Config{}, errors.Wrapf(err, "invalid forms at %q", path)
+	}
+	return config, nil
+}
+
+// ParseConfig reads the configuration of the forms from YAML, or JSON, and
+// checks that every form can be served.
+func ParseConfig(b []byte) (Config, error) {
+	var config Config
+	if err := yaml.UnmarshalStrict(b, &config); err != nil {
+		return Config{}, err
+	}
+	if err := config.Validate(); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// Validate makes sure there is at least one form and that every form has a
+// unique name and a store.
+func (c Config) Validate() error {
+	if len(c.Forms) == 0 {
+		return errors.New("expected at least one form")
+	}
+
+	names := make(map[string]struct{}, len(c.Forms))
+	for k, v := range c.Forms {
+		if !validName.MatchString(v.Name) {
+			return errors.Errorf("forms[%d].name: expected lowercase letters, digits, - or _ in %q", k, v.Name)
+		}
+		if _, ok := names[v.Name]; ok {
+			return errors.Errorf("forms[%d].name: duplicate form %q", k, v.Name)
+		}
+		names[v.Name] = struct{}{}
+
+		if v.FileStore == "" {
+			return errors.Errorf("forms[%d].filestore: expected a store for %q", k, v.Name)
+		}
+	}
+	return nil
+}
+
+// Find returns the configuration of the form for the name.
+func (c Config) Find(name string) (FormConfig, bool) {
+	for _, v := range c.Forms {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return FormConfig{}, false
+}
@@ -0,0 +1,97 @@
+package forms
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SimonRichardson/formed/pkg/fs"
+)
+
+const testConfig = `
+forms:
+  - name: people
+    title: People
+    filestore: ./data/people.csv
+    history: ./data/people.jsonl
+  - name: pets
+    schema: ./data/pets.yaml
+    filestore: sqlite:///var/lib/formed/pets.db
+    views: ./views/pets
+`
+
+func TestParseConfig(t *testing.T) {
+	t.Parallel()
+
+	t.Run("valid", func(t *testing.T) {
+		config, err := ParseConfig([]byte(testConfig))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := Config{
+			Forms: []FormConfig{
+				FormConfig{Name: "people", Title: "People", FileStore: "./data/people.csv", History: "./data/people.jsonl"},
+				FormConfig{Name: "pets", Schema: "./data/pets.yaml", FileStore: "sqlite:///var/lib/formed/pets.db", Views: "./views/pets"},
+			},
+		}
+		if expected, actual := want, config; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	for _, testcase := range []struct {
+		name, config, key string
+	}{
+		{"no forms", `forms: []`, "at least one form"},
+		{"unknown key", "forms:\n  - name: a\n    filestore: a.csv\n    colour: red", "colour"},
+		{"no name", "forms:\n  - filestore: a.csv", "forms[0].name"},
+		{"invalid name", "forms:\n  - name: My Form\n    filestore: a.csv", "forms[0].name"},
+		{"duplicate name", "forms:\n  - name: a\n    filestore: a.csv\n  - name: a\n    filestore: b.csv", "forms[1].name"},
+		{"no store", "forms:\n  - name: a", "forms[0].filestore"},
+	} {
+		_, err := ParseConfig([]byte(testcase.config))
+		if err == nil {
+			t.Errorf("%s: expected: error", testcase.name)
+			continue
+		}
+		if expected, actual := true, strings.Contains(err.Error(), testcase.key); expected != actual {
+			t.Errorf("%s: expected: %q in %q", testcase.name, testcase.key, err.Error())
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "forms.json")
+	if err := ioutil.WriteFile(path, []byte(`{"forms": [{"name": "people", "filestore": "mem://"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfig(fs.New(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	form, ok := config.Find("people")
+	if !ok {
+		t.Fatal("expected: people form")
+	}
+	if expected, actual := "mem://", form.FileStore; expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+
+	if _, ok := config.Find("pets"); ok {
+		t.Errorf("expected: no pets form")
+	}
+}
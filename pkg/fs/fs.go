@@ -2,6 +2,7 @@ package fs
 
 import (
 	"io"
+	"time"
 )
 
 // Filesystem is an abstraction over the native filesystem that allows us to
@@ -12,15 +13,44 @@ type Filesystem interface {
 	// some way.
 	Create(path string) (File, error)
 
+	// CreateTemp creates a new file next to path, with a name that no other
+	// file has, and returns it along with its name. This returns an error if
+	// the file can not be created in some way.
+	CreateTemp(path string) (File, string, error)
+
 	// Open takes a path, opens a potential file and then returns a File if
 	// that file exists, otherwise it returns an error if the file wasn't found.
 	Open(path string) (File, error)
 
+	// Append takes a path, opens or creates the file and then returns a File
+	// where every write is appended to the end of the file. This returns an
+	// error if the file can not be opened in some way.
+	Append(path string) (File, error)
+
 	// Exists takes a path and checks to see if the potential file exists or
 	// not.
 	// Note: If there is an error trying to read that file, it will return false
 	// even if the file already exists.
 	Exists(path string) bool
+
+	// Rename moves the file at oldpath to newpath, replacing newpath if it
+	// already exists. On the same filesystem the rename is atomic, so readers
+	// either see the old file or the new file, never a partial one.
+	Rename(oldpath, newpath string) error
+
+	// SyncDir commits the directory holding path to stable storage, so that
+	// a file created, renamed or removed in it survives a crash.
+	SyncDir(path string) error
+
+	// Remove deletes the file at path, returning an error if it couldn't be
+	// removed.
+	Remove(path string) error
+
+	// Lock takes an advisory lock for the path, waiting up to the timeout for
+	// any conflicting lock held by another process to be released. A shared
+	// lock can be held by many at once, an exclusive lock only by one. A
+	// *LockTimeoutError is returned if the lock couldn't be taken in time.
+	Lock(path string, mode LockMode, timeout time.Duration) (Lock, error)
 }
 
 // File is an abstraction for reading, writing and also closing a file. These
@@ -30,4 +60,12 @@ type File interface {
 	io.Reader
 	io.Writer
 	io.Closer
+	io.Seeker
+
+	// Sync commits the current contents of the file to stable storage.
+	Sync() error
+
+	// Truncate changes the size of the file, it does not change the I/O
+	// offset.
+	Truncate(size int64) error
 }
@@ -0,0 +1,232 @@
+package fs
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// LockMode is how a lock is held.
+type LockMode int
+
+// These are the modes of a lock.
+const (
+	// Shared can be held by many at once, i.e. to read.
+	Shared LockMode = iota
+
+	// Exclusive is only ever held by one, i.e. to write.
+	Exclusive
+)
+
+func (m LockMode) String() string {
+	if m == Exclusive {
+		return "exclusive"
+	}
+	return "shared"
+}
+
+// Lock is an advisory lock on a path, it's held until it's released.
+type Lock interface {
+	// Release releases the lock, it can't be used afterwards.
+	Release() error
+}
+
+// LockTimeoutError is returned when a lock couldn't be taken before the
+// timeout, because another process held on to a lock for the same path.
+type LockTimeoutError struct {
+	Path    string
+	Mode    LockMode
+	Timeout time.Duration
+}
+
+func (e *LockTimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s waiting to take the %s lock on %q, another process is holding on to it", e.Timeout, e.Mode, e.Path)
+}
+
+// ErrLockTimeout returns the *LockTimeoutError held within the error if there
+// is one.
+func ErrLockTimeout(err error) (*LockTimeoutError, bool) {
+	timeout, ok := errors.Cause(err).(*LockTimeoutError)
+	return timeout, ok
+}
+
+// LockPath returns the file that is locked for the path. The path itself
+// isn't locked, as it's replaced by every atomic write.
+func LockPath(path string) string {
+	return path + ".lock"
+}
+
+// fallbackLockPath returns the file that is created to hold a lock when the
+// filesystem doesn't support locking files.
+func fallbackLockPath(path string) string {
+	return path + ".lck"
+}
+
+const (
+	minLockDelay = 5 * time.Millisecond
+	maxLockDelay = 100 * time.Millisecond
+
+	// staleLockAge is how old a fallback lock file has to be before it's
+	// taken to be left behind by a process that crashed. A lock file is
+	// touched every lockRefreshInterval for as long as it's held, so a lock
+	// that is held for a long time never gets this old.
+	staleLockAge        = time.Minute
+	lockRefreshInterval = staleLockAge / 4
+)
+
+// wait calls try until it takes the lock, backing off in between, or until
+// the timeout has passed.
+func wait(path string, mode LockMode, timeout time.Duration, try func() (bool, error)) error {
+	var (
+		deadline = time.Now().Add(timeout)
+		delay    = minLockDelay
+	)
+	for {
+		ok, err := try()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return &LockTimeoutError{
+				Path:    path,
+				Mode:    mode,
+				Timeout: timeout,
+			}
+		}
+		if delay > remaining {
+			delay = remaining
+		}
+		time.Sleep(delay)
+		if delay *= 2; delay > maxLockDelay {
+			delay = maxLockDelay
+		}
+	}
+}
+
+// fileLock is held for as long as the lock file exists, which works on any
+// filesystem but can't be shared, so a shared lock is held exclusively. The
+// lock file is touched in the background until the lock is released.
+type fileLock struct {
+	path  string
+	token string
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// lockFile takes the lock by creating the lock file, only if it doesn't
+// already exist. A lock file that is older than staleLockAge is taken over,
+// so that a process that crashed doesn't hold on to the lock forever.
+func lockFile(path string, mode LockMode, timeout time.Duration) (Lock, error) {
+	return lockFileEvery(path, mode, timeout, lockRefreshInterval)
+}
+
+func lockFileEvery(path string, mode LockMode, timeout, refresh time.Duration) (Lock, error) {
+	var (
+		lockPath = fallbackLockPath(path)
+		token    = lockToken()
+	)
+	err := wait(path, mode, timeout, func() (bool, error) {
+		file, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if err == nil {
+			if _, err := file.WriteString(token); err != nil {
+				file.Close()
+				os.Remove(lockPath)
+				return false, errors.Wrapf(err, "unable to write lock file %q", lockPath)
+			}
+			return true, file.Close()
+		}
+		if !os.IsExist(err) {
+			return false, errors.Wrapf(err, "unable to create lock file %q", lockPath)
+		}
+
+		return false, removeStale(lockPath)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	l := &fileLock{
+		path:  lockPath,
+		token: token,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go l.refresh(refresh)
+	return l, nil
+}
+
+// removeStale removes the lock file if it's stale. The lock file is renamed
+// out of the way first, which only one process can do, and then checked to
+// still be stale. If another process got there first and already created a
+// new lock file, that file is put back where it was.
+func removeStale(lockPath string) error {
+	info, err := os.Stat(lockPath)
+	if err != nil || time.Since(info.ModTime()) <= staleLockAge {
+		return nil
+	}
+
+	stale, err := ioutil.TempFile(filepath.Dir(lockPath), filepath.Base(lockPath)+".stale")
+	if err != nil {
+		return errors.Wrapf(err, "unable to take over lock file %q", lockPath)
+	}
+	stale.Close()
+	defer os.Remove(stale.Name())
+
+	if err := os.Rename(lockPath, stale.Name()); err != nil {
+		// Another process took it over first.
+		return nil
+	}
+	if renamed, err := os.Stat(stale.Name()); err == nil && time.Since(renamed.ModTime()) <= staleLockAge {
+		// Linking fails if the path already exists, so it's never replaced.
+		os.Link(stale.Name(), lockPath)
+	}
+	return nil
+}
+
+// refresh touches the lock file every interval until the lock is released,
+// so it never looks stale to other processes.
+func (l *fileLock) refresh(interval time.Duration) {
+	defer close(l.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			os.Chtimes(l.path, now, now)
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// Release removes the lock file, as long as it's still the lock file that
+// was created when the lock was taken.
+func (l *fileLock) Release() error {
+	close(l.stop)
+	<-l.done
+
+	if b, err := ioutil.ReadFile(l.path); err != nil || string(b) != l.token {
+		return errors.Errorf("lock file %q was taken over by another process", l.path)
+	}
+	return os.Remove(l.path)
+}
+
+// lockToken returns what is written to a lock file, so that the process can
+// tell its own lock file apart from one created by another process.
+func lockToken() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return fmt.Sprintf("%d %x\n", os.Getpid(), b)
+}
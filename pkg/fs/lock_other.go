@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package fs
+
+import (
+	"time"
+)
+
+// lock takes the lock with a lock file, as there's no flock(2).
+func lock(path string, mode LockMode, timeout time.Duration) (Lock, error) {
+	return lockFile(path, mode, timeout)
+}
@@ -0,0 +1,256 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const timeout = 50 * time.Millisecond
+
+	t.Run("shared locks are shared", func(t *testing.T) {
+		var (
+			fsys = New()
+			path = filepath.Join(dir, "shared")
+		)
+
+		first, err := fsys.Lock(path, Shared, timeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer first.Release()
+
+		second, err := fsys.Lock(path, Shared, timeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer second.Release()
+	})
+
+	t.Run("exclusive lock times out", func(t *testing.T) {
+		var (
+			fsys = New()
+			path = filepath.Join(dir, "exclusive")
+		)
+
+		shared, err := fsys.Lock(path, Shared, timeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = fsys.Lock(path, Exclusive, timeout)
+		lockErr, ok := ErrLockTimeout(err)
+		if !ok {
+			t.Fatalf("expected a lock timeout, actual %v", err)
+		}
+		if expected, actual := path, lockErr.Path; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := Exclusive, lockErr.Mode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		// Once released the exclusive lock is taken.
+		if err := shared.Release(); err != nil {
+			t.Fatal(err)
+		}
+		exclusive, err := fsys.Lock(path, Exclusive, timeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer exclusive.Release()
+
+		if _, err := fsys.Lock(path, Shared, timeout); err == nil {
+			t.Errorf("expected an error")
+		}
+	})
+
+	t.Run("lock waits for release", func(t *testing.T) {
+		var (
+			fsys = New()
+			path = filepath.Join(dir, "wait")
+		)
+
+		exclusive, err := fsys.Lock(path, Exclusive, timeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			time.Sleep(timeout / 5)
+			exclusive.Release()
+		}()
+
+		lock, err := fsys.Lock(path, Exclusive, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer lock.Release()
+	})
+}
+
+func TestLockFile(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const timeout = 50 * time.Millisecond
+
+	t.Run("shared locks are exclusive", func(t *testing.T) {
+		path := filepath.Join(dir, "shared")
+
+		first, err := lockFile(path, Shared, timeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := lockFile(path, Shared, timeout); err == nil {
+			t.Errorf("expected an error")
+		}
+
+		if err := first.Release(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(fallbackLockPath(path)); !os.IsNotExist(err) {
+			t.Errorf("expected the lock file to be removed, actual %v", err)
+		}
+
+		second, err := lockFile(path, Shared, timeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer second.Release()
+	})
+
+	t.Run("stale lock file is taken over", func(t *testing.T) {
+		path := filepath.Join(dir, "stale")
+
+		// A process crashed whilst holding the lock.
+		if err := ioutil.WriteFile(fallbackLockPath(path), []byte("1\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		old := time.Now().Add(-2 * staleLockAge)
+		if err := os.Chtimes(fallbackLockPath(path), old, old); err != nil {
+			t.Fatal(err)
+		}
+
+		lock, err := lockFile(path, Exclusive, timeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer lock.Release()
+	})
+
+	t.Run("stale lock file is only taken over once", func(t *testing.T) {
+		path := filepath.Join(dir, "race")
+
+		if err := ioutil.WriteFile(fallbackLockPath(path), []byte("1\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		old := time.Now().Add(-2 * staleLockAge)
+		if err := os.Chtimes(fallbackLockPath(path), old, old); err != nil {
+			t.Fatal(err)
+		}
+
+		// Every process sees the same stale lock file, only one of them takes
+		// the lock.
+		const processes = 8
+		var (
+			wg    sync.WaitGroup
+			mutex sync.Mutex
+			locks []Lock
+		)
+		for i := 0; i < processes; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if lock, err := lockFile(path, Exclusive, timeout); err == nil {
+					mutex.Lock()
+					locks = append(locks, lock)
+					mutex.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		if expected, actual := 1, len(locks); expected != actual {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+		if err := locks[0].Release(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Nothing is left behind by taking it over.
+		files, err := filepath.Glob(fallbackLockPath(path) + "*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := 0, len(files); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("held lock file is refreshed", func(t *testing.T) {
+		path := filepath.Join(dir, "refreshed")
+
+		lock, err := lockFileEvery(path, Exclusive, timeout, 5*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer lock.Release()
+
+		// The lock has been held for longer than a stale lock, but it's still
+		// held so it isn't taken over.
+		old := time.Now().Add(-2 * staleLockAge)
+		if err := os.Chtimes(fallbackLockPath(path), old, old); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(timeout)
+
+		if _, err := lockFile(path, Exclusive, timeout); err == nil {
+			t.Errorf("expected an error")
+		}
+	})
+
+	t.Run("taken over lock file isn't removed", func(t *testing.T) {
+		path := filepath.Join(dir, "takenover")
+
+		first, err := lockFileEvery(path, Exclusive, timeout, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The first process stopped refreshing, so the lock is taken over.
+		old := time.Now().Add(-2 * staleLockAge)
+		if err := os.Chtimes(fallbackLockPath(path), old, old); err != nil {
+			t.Fatal(err)
+		}
+		second, err := lockFile(path, Exclusive, timeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer second.Release()
+
+		if err := first.Release(); err == nil {
+			t.Errorf("expected an error")
+		}
+		if _, err := os.Stat(fallbackLockPath(path)); err != nil {
+			t.Errorf("expected the lock file of the second process, actual %v", err)
+		}
+	})
+}
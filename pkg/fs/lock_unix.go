@@ -0,0 +1,62 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package fs
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// flock is held by a flock(2) on the lock file, the kernel releases it if the
+// process dies, so it's never left behind.
+type flock struct {
+	file *os.File
+}
+
+// lock takes the lock with flock(2), falling back to a lock file if the
+// filesystem doesn't support it, i.e. NFS without a lock manager.
+func lock(path string, mode LockMode, timeout time.Duration) (Lock, error) {
+	lockPath := LockPath(path)
+	file, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open lock file %q", lockPath)
+	}
+
+	how := syscall.LOCK_SH
+	if mode == Exclusive {
+		how = syscall.LOCK_EX
+	}
+
+	err = wait(path, mode, timeout, func() (bool, error) {
+		switch err := syscall.Flock(int(file.Fd()), how|syscall.LOCK_NB); err {
+		case nil:
+			return true, nil
+		case syscall.EWOULDBLOCK, syscall.EINTR:
+			return false, nil
+		default:
+			return false, err
+		}
+	})
+	if err != nil {
+		file.Close()
+
+		if _, ok := ErrLockTimeout(err); ok {
+			return nil, err
+		}
+		if err == syscall.ENOLCK || err == syscall.EOPNOTSUPP || err == syscall.ENOTSUP {
+			return lockFile(path, mode, timeout)
+		}
+		return nil, errors.Wrapf(err, "unable to lock %q", lockPath)
+	}
+	return flock{file: file}, nil
+}
+
+func (l flock) Release() error {
+	// Closing the file releases the lock anyway.
+	syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+	return l.file.Close()
+}
@@ -1,11 +1,12 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: github.com/SimonRichardson/formed/pkg/fs (interfaces: Filesystem,File)
+// Source: github.com/SimonRichardson/formed/pkg/fs (interfaces: Filesystem,File,Lock)
 
 package mock_fs
 
 import (
 	fs "github.com/SimonRichardson/formed/pkg/fs"
 	gomock "github.com/golang/mock/gomock"
+	time "time"
 )
 
 // MockFilesystem is a mock of Filesystem interface
@@ -31,6 +32,19 @@ func (_m *MockFilesystem) EXPECT() *MockFilesystemMockRecorder {
 	return _m.recorder
 }
 
+// Append mocks base method
+func (_m *MockFilesystem) Append(_param0 string) (fs.File, error) {
+	ret := _m.ctrl.Call(_m, "Append", _param0)
+	ret0, _ := ret[0].(fs.File)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Append indicates an expected call of Append
+func (_mr *MockFilesystemMockRecorder) Append(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Append", arg0)
+}
+
 // Create mocks base method
 func (_m *MockFilesystem) Create(_param0 string) (fs.File, error) {
 	ret := _m.ctrl.Call(_m, "Create", _param0)
@@ -44,6 +58,20 @@ func (_mr *MockFilesystemMockRecorder) Create(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Create", arg0)
 }
 
+// CreateTemp mocks base method
+func (_m *MockFilesystem) CreateTemp(_param0 string) (fs.File, string, error) {
+	ret := _m.ctrl.Call(_m, "CreateTemp", _param0)
+	ret0, _ := ret[0].(fs.File)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// CreateTemp indicates an expected call of CreateTemp
+func (_mr *MockFilesystemMockRecorder) CreateTemp(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "CreateTemp", arg0)
+}
+
 // Exists mocks base method
 func (_m *MockFilesystem) Exists(_param0 string) bool {
 	ret := _m.ctrl.Call(_m, "Exists", _param0)
@@ -56,6 +84,19 @@ func (_mr *MockFilesystemMockRecorder) Exists(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Exists", arg0)
 }
 
+// Lock mocks base method
+func (_m *MockFilesystem) Lock(_param0 string, _param1 fs.LockMode, _param2 time.Duration) (fs.Lock, error) {
+	ret := _m.ctrl.Call(_m, "Lock", _param0, _param1, _param2)
+	ret0, _ := ret[0].(fs.Lock)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Lock indicates an expected call of Lock
+func (_mr *MockFilesystemMockRecorder) Lock(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Lock", arg0, arg1, arg2)
+}
+
 // Open mocks base method
 func (_m *MockFilesystem) Open(_param0 string) (fs.File, error) {
 	ret := _m.ctrl.Call(_m, "Open", _param0)
@@ -69,6 +110,42 @@ func (_mr *MockFilesystemMockRecorder) Open(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Open", arg0)
 }
 
+// Remove mocks base method
+func (_m *MockFilesystem) Remove(_param0 string) error {
+	ret := _m.ctrl.Call(_m, "Remove", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Remove indicates an expected call of Remove
+func (_mr *MockFilesystemMockRecorder) Remove(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Remove", arg0)
+}
+
+// Rename mocks base method
+func (_m *MockFilesystem) Rename(_param0 string, _param1 string) error {
+	ret := _m.ctrl.Call(_m, "Rename", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Rename indicates an expected call of Rename
+func (_mr *MockFilesystemMockRecorder) Rename(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Rename", arg0, arg1)
+}
+
+// SyncDir mocks base method
+func (_m *MockFilesystem) SyncDir(_param0 string) error {
+	ret := _m.ctrl.Call(_m, "SyncDir", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SyncDir indicates an expected call of SyncDir
+func (_mr *MockFilesystemMockRecorder) SyncDir(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SyncDir", arg0)
+}
+
 // MockFile is a mock of File interface
 type MockFile struct {
 	ctrl     *gomock.Controller
@@ -117,6 +194,43 @@ func (_mr *MockFileMockRecorder) Read(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Read", arg0)
 }
 
+// Seek mocks base method
+func (_m *MockFile) Seek(_param0 int64, _param1 int) (int64, error) {
+	ret := _m.ctrl.Call(_m, "Seek", _param0, _param1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Seek indicates an expected call of Seek
+func (_mr *MockFileMockRecorder) Seek(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Seek", arg0, arg1)
+}
+
+// Sync mocks base method
+func (_m *MockFile) Sync() error {
+	ret := _m.ctrl.Call(_m, "Sync")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Sync indicates an expected call of Sync
+func (_mr *MockFileMockRecorder) Sync() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Sync")
+}
+
+// Truncate mocks base method
+func (_m *MockFile) Truncate(_param0 int64) error {
+	ret := _m.ctrl.Call(_m, "Truncate", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Truncate indicates an expected call of Truncate
+func (_mr *MockFileMockRecorder) Truncate(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Truncate", arg0)
+}
+
 // Write mocks base method
 func (_m *MockFile) Write(_param0 []byte) (int, error) {
 	ret := _m.ctrl.Call(_m, "Write", _param0)
@@ -129,3 +243,38 @@ func (_m *MockFile) Write(_param0 []byte) (int, error) {
 func (_mr *MockFileMockRecorder) Write(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Write", arg0)
 }
+
+// MockLock is a mock of Lock interface
+type MockLock struct {
+	ctrl     *gomock.Controller
+	recorder *MockLockMockRecorder
+}
+
+// MockLockMockRecorder is the mock recorder for MockLock
+type MockLockMockRecorder struct {
+	mock *MockLock
+}
+
+// NewMockLock creates a new mock instance
+func NewMockLock(ctrl *gomock.Controller) *MockLock {
+	mock := &MockLock{ctrl: ctrl}
+	mock.recorder = &MockLockMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (_m *MockLock) EXPECT() *MockLockMockRecorder {
+	return _m.recorder
+}
+
+// Release mocks base method
+func (_m *MockLock) Release() error {
+	ret := _m.ctrl.Call(_m, "Release")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Release indicates an expected call of Release
+func (_mr *MockLockMockRecorder) Release() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Release")
+}
@@ -2,7 +2,10 @@ package fs
 
 import (
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"time"
 )
 
 type realFilesystem struct{}
@@ -29,6 +32,35 @@ func (realFilesystem) Create(path string) (file File, err error) {
 	}, nil
 }
 
+// CreateTemp creates a new file next to path, with a name that no other
+// file has, and returns it along with its name. The file is given the mode
+// of path, or 0644 if there is no file at path yet, so that renaming it over
+// path doesn't change who can read it. This returns an error if the file can
+// not be created in some way.
+func (realFilesystem) CreateTemp(path string) (file File, name string, err error) {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	var f *os.File
+	f, err = ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return
+	}
+	if err = f.Chmod(mode); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return
+	}
+
+	return realFile{
+		File:   f,
+		Reader: f,
+		Closer: f,
+	}, f.Name(), nil
+}
+
 // Open takes a path, opens a potential file and then returns a File if
 // that file exists, otherwise it returns an error if the file wasn't found.
 func (realFilesystem) Open(path string) (file File, err error) {
@@ -45,6 +77,23 @@ func (realFilesystem) Open(path string) (file File, err error) {
 	}, nil
 }
 
+// Append takes a path, opens or creates the file and then returns a File
+// where every write is appended to the end of the file. This returns an
+// error if the file can not be opened in some way.
+func (realFilesystem) Append(path string) (file File, err error) {
+	var f *os.File
+	f, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return
+	}
+
+	return realFile{
+		File:   f,
+		Reader: f,
+		Closer: f,
+	}, nil
+}
+
 // Exists takes a path and checks to see if the potential file exists or
 // not.
 // Note: If there is an error trying to read that file, it will return false
@@ -54,6 +103,41 @@ func (realFilesystem) Exists(path string) bool {
 	return !os.IsNotExist(err)
 }
 
+// Rename moves the file at oldpath to newpath, replacing newpath if it
+// already exists. On the same filesystem the rename is atomic, so readers
+// either see the old file or the new file, never a partial one.
+func (realFilesystem) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+// SyncDir commits the directory holding path to stable storage, so that
+// a file created, renamed or removed in it survives a crash.
+func (realFilesystem) SyncDir(path string) error {
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	if err := dir.Sync(); err != nil {
+		dir.Close()
+		return err
+	}
+	return dir.Close()
+}
+
+// Remove deletes the file at path, returning an error if it couldn't be
+// removed.
+func (realFilesystem) Remove(path string) error {
+	return os.Remove(path)
+}
+
+// Lock takes an advisory lock for the path, waiting up to the timeout for
+// any conflicting lock held by another process to be released. A shared
+// lock can be held by many at once, an exclusive lock only by one. A
+// *LockTimeoutError is returned if the lock couldn't be taken in time.
+func (realFilesystem) Lock(path string, mode LockMode, timeout time.Duration) (Lock, error) {
+	return lock(path, mode, timeout)
+}
+
 type realFile struct {
 	*os.File
 	io.Reader
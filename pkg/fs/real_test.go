@@ -70,4 +70,144 @@ func TestReal(t *testing.T) {
 			t.Errorf("expected: %v, actual: %v", content, buf)
 		}
 	})
+
+	t.Run("rename", func(t *testing.T) {
+		fsys := New()
+		var (
+			oldpath = filepath.Join(dir, "rename-old")
+			newpath = filepath.Join(dir, "rename-new")
+		)
+		if err := ioutil.WriteFile(oldpath, []byte("new"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(newpath, []byte("old content"), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := fsys.Rename(oldpath, newpath); err != nil {
+			t.Fatal(err)
+		}
+
+		if fsys.Exists(oldpath) {
+			t.Errorf("expected: %q to not exist", oldpath)
+		}
+
+		content, err := ioutil.ReadFile(newpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := "new", string(content); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("create temp keeps the mode", func(t *testing.T) {
+		fsys := New()
+		var (
+			existing = filepath.Join(dir, "mode-existing")
+			missing  = filepath.Join(dir, "mode-missing")
+		)
+		if err := ioutil.WriteFile(existing, []byte("old content"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(existing, 0640); err != nil {
+			t.Fatal(err)
+		}
+
+		for path, mode := range map[string]os.FileMode{
+			existing: 0640,
+			missing:  0644,
+		} {
+			file, name, err := fsys.CreateTemp(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			file.Close()
+
+			info, err := os.Stat(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected, actual := mode, info.Mode().Perm(); expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		fsys := New()
+		path := filepath.Join(dir, "remove")
+		file, err := fsys.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+
+		if err := fsys.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+
+		if fsys.Exists(path) {
+			t.Errorf("expected: %q to not exist", path)
+		}
+	})
+
+	t.Run("truncate and sync", func(t *testing.T) {
+		fsys := New()
+		path := filepath.Join(dir, "truncate")
+		if err := ioutil.WriteFile(path, []byte("hello world"), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		file, err := fsys.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		if err := file.Truncate(0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := file.Write([]byte("bye")); err != nil {
+			t.Fatal(err)
+		}
+		if err := file.Sync(); err != nil {
+			t.Fatal(err)
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := "bye", string(content); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("append", func(t *testing.T) {
+		fsys := New()
+		path := filepath.Join(dir, "append")
+		if err := ioutil.WriteFile(path, []byte("hello"), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		file, err := fsys.Append(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := file.Write([]byte(" world")); err != nil {
+			t.Fatal(err)
+		}
+		if err := file.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := "hello world", string(content); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
 }
@@ -0,0 +1,175 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// These are the paths served by the API.
+const (
+	PathHealth  = "/healthz"
+	PathReady   = "/readyz"
+	PathVersion = "/version"
+)
+
+// DefaultTimeout is how long the checks have to finish, before the process is
+// reported as not ready.
+const DefaultTimeout = 5 * time.Second
+
+// ErrTimeout is reported for a check that didn't finish in time.
+var ErrTimeout = errors.New("timed out")
+
+// Checker reports whether something the process depends on is ready, by
+// returning an error if it isn't.
+type Checker interface {
+	Check() error
+}
+
+// CheckerFunc allows a function to be used as a Checker.
+type CheckerFunc func() error
+
+// Check calls the function.
+func (f CheckerFunc) Check() error {
+	return f()
+}
+
+// Check is a named Checker, the name is reported along with the result.
+type Check struct {
+	Name    string
+	Checker Checker
+}
+
+// Build describes the build of the process.
+type Build struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+}
+
+// API serves whether the process is alive and ready, along with its build,
+// for load balancers and supervisors to probe.
+type API struct {
+	checks  []Check
+	build   Build
+	timeout time.Duration
+	logger  log.Logger
+}
+
+// NewAPI creates an API where the process is only ready once every check
+// passes within the timeout.
+func NewAPI(checks []Check, build Build, timeout time.Duration, logger log.Logger) *API {
+	return &API{
+		checks:  checks,
+		build:   build,
+		timeout: timeout,
+		logger:  logger,
+	}
+}
+
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		render(w, http.StatusMethodNotAllowed, status{Status: "method not allowed"})
+		return
+	}
+
+	// Routing table
+	switch r.URL.Path {
+	case PathHealth:
+		// Being able to answer at all is enough to be alive.
+		render(w, http.StatusOK, status{Status: statusOK})
+	case PathReady:
+		a.ready(w)
+	case PathVersion:
+		render(w, http.StatusOK, a.build)
+	default:
+		render(w, http.StatusNotFound, status{Status: "not found"})
+	}
+}
+
+func (a *API) ready(w http.ResponseWriter) {
+	var (
+		res  = status{Status: statusOK}
+		code = http.StatusOK
+	)
+	for k, err := range a.run() {
+		result := checkResult{
+			Name:   a.checks[k].Name,
+			Status: statusOK,
+		}
+		if err != nil {
+			result.Status, result.Error = statusFailed, err.Error()
+			res.Status, code = statusUnavailable, http.StatusServiceUnavailable
+			level.Warn(a.logger).Log("check", result.Name, "err", err)
+		}
+		res.Checks = append(res.Checks, result)
+	}
+	render(w, code, res)
+}
+
+// run runs every check at the same time, returning the error of each check
+// in the same order as the checks. A check that doesn't finish in time is
+// left to finish on its own.
+func (a *API) run() []error {
+	results := make([]chan error, len(a.checks))
+	for k, v := range a.checks {
+		results[k] = make(chan error, 1)
+		go func(checker Checker, result chan<- error) {
+			result <- checker.Check()
+		}(v.Checker, results[k])
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	defer cancel()
+
+	res := make([]error, len(a.checks))
+	for k, result := range results {
+		// A check that has already finished always counts, even once the
+		// time is up.
+		select {
+		case err := <-result:
+			res[k] = err
+			continue
+		default:
+		}
+
+		select {
+		case err := <-result:
+			res[k] = err
+		case <-ctx.Done():
+			res[k] = ErrTimeout
+		}
+	}
+	return res
+}
+
+const (
+	statusOK          = "ok"
+	statusFailed      = "failed"
+	statusUnavailable = "unavailable"
+)
+
+type status struct {
+	Status string        `json:"status"`
+	Checks []checkResult `json:"checks,omitempty"`
+}
+
+type checkResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+func render(w http.ResponseWriter, code int, data interface{}) {
+	header := w.Header()
+	header.Set("Content-Type", "application/json; charset=utf-8")
+	header.Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+
+	json.NewEncoder(w).Encode(data)
+}
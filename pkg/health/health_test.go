@@ -0,0 +1,98 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+func TestAPI(t *testing.T) {
+	t.Parallel()
+
+	var (
+		passing = CheckerFunc(func() error { return nil })
+		failing = CheckerFunc(func() error { return errors.New("disk full") })
+		block   = make(chan struct{})
+		hanging = CheckerFunc(func() error { <-block; return nil })
+		build   = Build{Version: "1.2.3", GoVersion: "go1.10"}
+	)
+	defer close(block)
+
+	serve := func(method, path string, checks ...Check) (*httptest.ResponseRecorder, status) {
+		recorder := httptest.NewRecorder()
+		NewAPI(checks, build, 10*time.Millisecond, log.NewNopLogger()).
+			ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+
+		var res status
+		json.Unmarshal(recorder.Body.Bytes(), &res)
+		return recorder, res
+	}
+
+	t.Run("healthz", func(t *testing.T) {
+		recorder, res := serve("GET", PathHealth, Check{"store", failing})
+		if expected, actual := http.StatusOK, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := statusOK, res.Status; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("ready", func(t *testing.T) {
+		recorder, res := serve("GET", PathReady, Check{"store", passing}, Check{"templates", passing})
+		if expected, actual := http.StatusOK, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := []checkResult{
+			{Name: "store", Status: statusOK},
+			{Name: "templates", Status: statusOK},
+		}, res.Checks; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("not ready", func(t *testing.T) {
+		recorder, res := serve("GET", PathReady, Check{"store", failing}, Check{"slow", hanging}, Check{"templates", passing})
+		if expected, actual := http.StatusServiceUnavailable, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := statusUnavailable, res.Status; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := []checkResult{
+			{Name: "store", Status: statusFailed, Error: "disk full"},
+			{Name: "slow", Status: statusFailed, Error: ErrTimeout.Error()},
+			{Name: "templates", Status: statusOK},
+		}, res.Checks; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("version", func(t *testing.T) {
+		recorder, _ := serve("GET", PathVersion)
+		if expected, actual := http.StatusOK, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		var actual Build
+		if err := json.Unmarshal(recorder.Body.Bytes(), &actual); err != nil {
+			t.Fatal(err)
+		}
+		if expected := build; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		recorder, _ := serve("POST", PathHealth)
+		if expected, actual := http.StatusMethodNotAllowed, recorder.Code; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package history
+
+import (
+	"github.com/SimonRichardson/formed/pkg/models"
+)
+
+// Diff describes the users that were added, removed or changed between two
+// revisions.
+type Diff struct {
+	Added   []models.User `json:"added,omitempty"`
+	Removed []models.User `json:"removed,omitempty"`
+	Changed []Change      `json:"changed,omitempty"`
+}
+
+// Change describes a user that was changed, the index is the position of the
+// user after the change.
+type Change struct {
+	ID     string      `json:"id,omitempty"`
+	Index  int         `json:"index"`
+	Before models.User `json:"before"`
+	After  models.User `json:"after"`
+}
+
+// Empty returns true if nothing changed.
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Compare works out the differences between the users before and after. The
+// users are compared by their id, unless any of them were written before users
+// had ids, in which case they're compared by their position.
+func Compare(before, after []models.User) Diff {
+	if models.MissingIDs(before) || models.MissingIDs(after) {
+		return compareByPosition(before, after)
+	}
+
+	ids := make(map[string]int, len(before))
+	for k, v := range before {
+		ids[v.ID] = k
+	}
+
+	var diff Diff
+	for k, v := range after {
+		index, ok := ids[v.ID]
+		if !ok {
+			diff.Added = append(diff.Added, v)
+			continue
+		}
+		delete(ids, v.ID)
+
+		if !before[index].Equal(v) {
+			diff.Changed = append(diff.Changed, Change{
+				ID:     v.ID,
+				Index:  k,
+				Before: before[index],
+				After:  v,
+			})
+		}
+	}
+	for k, v := range before {
+		if _, ok := ids[v.ID]; ok {
+			diff.Removed = append(diff.Removed, before[k])
+		}
+	}
+	return diff
+}
+
+func compareByPosition(before, after []models.User) Diff {
+	var diff Diff
+	for i := 0; i < len(before) && i < len(after); i++ {
+		if !before[i].Equal(after[i]) {
+			diff.Changed = append(diff.Changed, Change{
+				Index:  i,
+				Before: before[i],
+				After:  after[i],
+			})
+		}
+	}
+	if len(after) > len(before) {
+		diff.Added = append(diff.Added, after[len(before):]...)
+	}
+	if len(before) > len(after) {
+		diff.Removed = append(diff.Removed, before[len(after):]...)
+	}
+	return diff
+}
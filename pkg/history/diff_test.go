@@ -0,0 +1,59 @@
+package history
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/SimonRichardson/formed/pkg/models"
+)
+
+func TestCompare(t *testing.T) {
+	t.Parallel()
+
+	var (
+		fred = models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}}
+		jane = models.User{ID: "j2", Fields: models.Fields{"firstname": "jane", "surname": "doe"}}
+		joe  = models.User{ID: "j3", Fields: models.Fields{"firstname": "joe", "surname": "bloggs"}}
+
+		married = models.User{ID: "j2", Fields: models.Fields{"firstname": "jane", "surname": "smith"}}
+
+		// Users written before users had ids.
+		legacyFred = models.User{Fields: models.Fields{"firstname": "fred", "surname": "smith"}}
+		legacyJoe  = models.User{Fields: models.Fields{"firstname": "joe", "surname": "bloggs"}}
+	)
+
+	for _, testcase := range []struct {
+		name          string
+		before, after []models.User
+		diff          Diff
+	}{
+		{"nothing", nil, nil, Diff{}},
+		{"same", []models.User{fred}, []models.User{fred}, Diff{}},
+		{"added", []models.User{fred}, []models.User{fred, jane}, Diff{
+			Added: []models.User{jane},
+		}},
+		{"removed", []models.User{fred, jane}, []models.User{fred}, Diff{
+			Removed: []models.User{jane},
+		}},
+		{"replaced", []models.User{fred, jane}, []models.User{fred, joe}, Diff{
+			Added:   []models.User{joe},
+			Removed: []models.User{jane},
+		}},
+		{"changed", []models.User{fred, jane}, []models.User{married, fred}, Diff{
+			Changed: []Change{Change{ID: "j2", Index: 0, Before: jane, After: married}},
+		}},
+		{"moved", []models.User{fred, jane, joe}, []models.User{joe, fred, jane}, Diff{}},
+		{"without ids", []models.User{legacyFred}, []models.User{legacyJoe}, Diff{
+			Changed: []Change{Change{Index: 0, Before: legacyFred, After: legacyJoe}},
+		}},
+	} {
+		diff := Compare(testcase.before, testcase.after)
+
+		if expected, actual := testcase.diff, diff; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("%s: expected: %v, actual: %v", testcase.name, expected, actual)
+		}
+		if expected, actual := reflect.DeepEqual(testcase.diff, Diff{}), diff.Empty(); expected != actual {
+			t.Errorf("%s: expected: %v, actual: %v", testcase.name, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,414 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SimonRichardson/formed/pkg/fs"
+	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/SimonRichardson/formed/pkg/store"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// Revision describes a single write to the store, who made it and what
+// changed.
+type Revision struct {
+	ID         int           `json:"id"`
+	Time       time.Time     `json:"time"`
+	RemoteAddr string        `json:"remote_addr"`
+	Version    store.Version `json:"version"`
+	Diff       Diff          `json:"diff"`
+	Users      []models.User `json:"users,omitempty"`
+}
+
+// entry is a revision along with the offset of its line in the file. The users
+// of the revision are only held in memory when there is no file, otherwise
+// they're read back from the file when they're asked for.
+type entry struct {
+	Revision
+	offset int64
+}
+
+// History records a revision for every write made to the store that it
+// wraps, so that any previous revision can be restored.
+// The file can be shared by more than one process, i.e. a server and the CLI.
+// Every write happens under an exclusive lock of the file, catching up on the
+// revisions appended by other processes first, so the ids of the revisions
+// are always given out in order without any duplicates.
+type History struct {
+	mutex       sync.Mutex
+	store       store.Store
+	fsys        fs.Filesystem
+	path        string
+	lockTimeout time.Duration
+	logger      log.Logger
+	revisions   []entry
+	size        int64
+	lines       int
+	closed      bool
+	now         func() time.Time
+}
+
+// ErrClosed is returned when writing to a history that has been closed.
+var ErrClosed = errors.New("history is closed")
+
+// New creates a History for the store, where the revisions are appended to
+// the file at path. If the path is empty then the revisions are only kept in
+// memory. The file is locked with the same timeout as the store, so a write
+// waits as long for one as for the other.
+func New(s store.Store, fsys fs.Filesystem, path string, lockTimeout time.Duration, logger log.Logger) (*History, error) {
+	h := &History{
+		store:       s,
+		fsys:        fsys,
+		path:        path,
+		lockTimeout: lockTimeout,
+		logger:      logger,
+		now:         time.Now,
+	}
+	if err := h.refreshShared(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Store returns a store.Store that records every write as a revision made by
+// the remote address.
+func (h *History) Store(remoteAddr string) store.Store {
+	return recorder{
+		history:    h,
+		remoteAddr: remoteAddr,
+	}
+}
+
+// Revisions returns all the revisions, newest first, including the revisions
+// made by other processes. The users of each revision are omitted.
+func (h *History) Revisions() ([]Revision, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if err := h.refreshShared(); err != nil {
+		return nil, err
+	}
+
+	res := make([]Revision, len(h.revisions))
+	for k, v := range h.revisions {
+		v.Users = nil
+		res[len(res)-1-k] = v.Revision
+	}
+	return res, nil
+}
+
+// Revision returns the revision for the id, including the users as they were
+// after the revision was made. If there is no revision for the id then false
+// is returned.
+func (h *History) Revision(id int) (Revision, bool, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	unlock, err := h.lock(fs.Shared)
+	if err != nil {
+		return Revision{}, false, err
+	}
+	defer unlock()
+
+	entry, ok := h.revision(id)
+	if !ok {
+		return Revision{}, false, nil
+	}
+	revision, err := h.load(entry)
+	return revision, err == nil, err
+}
+
+// Restore writes the users of the revision back to the store, as long as the
+// store is still at the version supplied. The restore itself is recorded as a
+// new revision.
+func (h *History) Restore(id int, version store.Version, remoteAddr string) (store.Version, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.closed {
+		return store.AnyVersion, ErrClosed
+	}
+
+	unlock, err := h.lock(fs.Exclusive)
+	if err != nil {
+		return store.AnyVersion, err
+	}
+	defer unlock()
+
+	entry, ok := h.revision(id)
+	if !ok {
+		return store.AnyVersion, errors.Errorf("no revision found for %d", id)
+	}
+	revision, err := h.load(entry)
+	if err != nil {
+		return store.AnyVersion, err
+	}
+
+	return h.write(revision.Users, version, remoteAddr)
+}
+
+// Close waits for any write in progress to finish and then closes the store,
+// so that nothing is left half written. Every write afterwards fails with
+// ErrClosed.
+func (h *History) Close() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.closed {
+		return nil
+	}
+	h.closed = true
+	return store.Close(h.store)
+}
+
+// Check makes sure the store can still be read from and written to, see
+// store.Check. Nothing is written, so there is no revision for it.
+func (h *History) Check() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.closed {
+		return ErrClosed
+	}
+	return store.Check(h.store)
+}
+
+// revision finds the revision by its id. The revisions are held in the order
+// of their ids, but there may be gaps, i.e. from a file written by more than
+// one process before the file was locked.
+func (h *History) revision(id int) (entry, bool) {
+	index := sort.Search(len(h.revisions), func(i int) bool {
+		return h.revisions[i].ID >= id
+	})
+	if index == len(h.revisions) || h.revisions[index].ID != id {
+		return entry{}, false
+	}
+	return h.revisions[index], true
+}
+
+// load returns the revision of the entry along with its users, reading them
+// back from the file if there is one. It expects the file to be locked.
+func (h *History) load(e entry) (Revision, error) {
+	if h.path == "" {
+		return e.Revision, nil
+	}
+
+	file, err := h.fsys.Open(h.path)
+	if err != nil {
+		return Revision{}, errors.Wrapf(err, "unable to open history at %q", h.path)
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(e.offset, io.SeekStart); err != nil {
+		return Revision{}, errors.Wrapf(err, "unable to seek history at %q to %d", h.path, e.offset)
+	}
+
+	b, err := bufio.NewReaderSize(file, 64*1024).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return Revision{}, errors.Wrapf(err, "unable to read history at %q", h.path)
+	}
+	var revision Revision
+	if err := json.Unmarshal(b, &revision); err != nil {
+		return Revision{}, errors.Wrapf(err, "unable to parse revision %d of history at %q", e.ID, h.path)
+	}
+	if revision.ID != e.ID {
+		return Revision{}, errors.Errorf("expected revision %d at offset %d of history at %q, actual %d", e.ID, e.offset, h.path, revision.ID)
+	}
+	return revision, nil
+}
+
+// lock takes the lock of the file, if there is one, and catches up on the
+// revisions appended by other processes. The function returned releases the
+// lock.
+func (h *History) lock(mode fs.LockMode) (func(), error) {
+	if h.path == "" {
+		return func() {}, nil
+	}
+
+	lock, err := h.fsys.Lock(h.path, mode, h.lockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.refresh(); err != nil {
+		lock.Release()
+		return nil, err
+	}
+	return func() { lock.Release() }, nil
+}
+
+// refreshShared catches up on the revisions appended by other processes under
+// a shared lock.
+func (h *History) refreshShared() error {
+	unlock, err := h.lock(fs.Shared)
+	if err != nil {
+		return err
+	}
+	unlock()
+	return nil
+}
+
+// nextID returns the id of the next revision, it expects the file to be
+// locked and caught up with.
+func (h *History) nextID() int {
+	if len(h.revisions) == 0 {
+		return 1
+	}
+	return h.revisions[len(h.revisions)-1].ID + 1
+}
+
+// write reads the current users before writing, so that the changes can be
+// worked out. It expects the mutex and the exclusive lock of the file to be
+// held, so that no other write can happen between the read and the write.
+// Once the store has been written to the write has succeeded, so if the
+// revision can't be appended to the file afterwards it's only logged.
+func (h *History) write(users []models.User, version store.Version, remoteAddr string) (store.Version, error) {
+	before, _, err := h.store.Read()
+	if err != nil {
+		return store.AnyVersion, errors.Wrap(err, "unable to read the users before writing")
+	}
+
+	// Give out the ids before writing, so the revision holds the same users
+	// as the store.
+	users = models.EnsureIDs(users)
+
+	newVersion, err := h.store.Write(users, version)
+	if err != nil {
+		return store.AnyVersion, err
+	}
+
+	revision := Revision{
+		ID:         h.nextID(),
+		Time:       h.now().UTC(),
+		RemoteAddr: remoteAddr,
+		Version:    newVersion,
+		Diff:       Compare(before, users),
+		Users:      users,
+	}
+	if err := h.append(revision); err != nil {
+		level.Error(h.logger).Log("revision", revision.ID, "version", newVersion, "err", err)
+	}
+
+	return newVersion, nil
+}
+
+func (h *History) append(revision Revision) error {
+	e := entry{
+		Revision: revision,
+		offset:   h.size,
+	}
+	if h.path != "" {
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(revision); err != nil {
+			return errors.Wrapf(err, "unable to encode history at %q", h.path)
+		}
+
+		file, err := h.fsys.Append(h.path)
+		if err != nil {
+			return errors.Wrapf(err, "unable to open history at %q", h.path)
+		}
+		defer file.Close()
+
+		// Anything after the lines that have been read is a line left torn by
+		// a process that crashed part way through appending it. The file is
+		// locked, so it's cut off rather than merged with the next line.
+		if err := file.Truncate(h.size); err != nil {
+			return errors.Wrapf(err, "unable to truncate history at %q", h.path)
+		}
+
+		if _, err := file.Write(buf.Bytes()); err != nil {
+			return errors.Wrapf(err, "unable to write history at %q", h.path)
+		}
+		if err := file.Sync(); err != nil {
+			return errors.Wrapf(err, "unable to sync history at %q", h.path)
+		}
+		h.size += int64(buf.Len())
+		h.lines++
+		e.Users = nil
+	}
+
+	h.revisions = append(h.revisions, e)
+	return nil
+}
+
+// refresh reads the revisions appended to the file since it was last read,
+// it expects the file to be locked. A line that hasn't been finished yet is
+// left to be read the next time.
+func (h *History) refresh() error {
+	if h.path == "" || !h.fsys.Exists(h.path) {
+		return nil
+	}
+
+	file, err := h.fsys.Open(h.path)
+	if err != nil {
+		return errors.Wrapf(err, "unable to open history at %q", h.path)
+	}
+	defer file.Close()
+
+	// Skip over everything that has already been read.
+	if _, err := file.Seek(h.size, io.SeekStart); err != nil {
+		return errors.Wrapf(err, "unable to seek history at %q to %d", h.path, h.size)
+	}
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	for {
+		b, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "unable to read history at %q", h.path)
+		}
+		if len(bytes.TrimSpace(b)) > 0 {
+			var revision Revision
+			if err := json.Unmarshal(b, &revision); err != nil {
+				return errors.Wrapf(err, "unable to parse history at %q on line %d", h.path, h.lines+1)
+			}
+			revision.Users = nil
+			h.revisions = append(h.revisions, entry{
+				Revision: revision,
+				offset:   h.size,
+			})
+		}
+		h.size += int64(len(b))
+		h.lines++
+	}
+}
+
+// recorder is a store.Store that writes through the history.
+type recorder struct {
+	history    *History
+	remoteAddr string
+}
+
+func (r recorder) Read() ([]models.User, store.Version, error) {
+	return r.history.store.Read()
+}
+
+func (r recorder) Scan(fn func(models.User) error) (store.Version, error) {
+	return r.history.store.Scan(fn)
+}
+
+func (r recorder) Write(users []models.User, version store.Version) (store.Version, error) {
+	r.history.mutex.Lock()
+	defer r.history.mutex.Unlock()
+
+	if r.history.closed {
+		return store.AnyVersion, ErrClosed
+	}
+
+	unlock, err := r.history.lock(fs.Exclusive)
+	if err != nil {
+		return store.AnyVersion, err
+	}
+	defer unlock()
+
+	return r.history.write(users, version, r.remoteAddr)
+}
@@ -0,0 +1,484 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/SimonRichardson/formed/pkg/fs"
+	"github.com/SimonRichardson/formed/pkg/fs/mock_fs"
+	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/SimonRichardson/formed/pkg/store"
+	"github.com/SimonRichardson/formed/pkg/store/mock_store"
+	"github.com/go-kit/kit/log"
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+)
+
+func TestHistory(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		fred = models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}}
+		jane = models.User{ID: "j2", Fields: models.Fields{"firstname": "jane", "surname": "doe"}}
+		joe  = models.User{ID: "j3", Fields: models.Fields{"firstname": "joe", "surname": "bloggs"}}
+	)
+
+	t.Run("records revisions", func(t *testing.T) {
+		h, err := New(store.NewMemory(), fs.New(), "", store.DefaultLockTimeout, log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		write(t, h.Store("10.0.0.1:1234"), []models.User{fred, jane})
+		write(t, h.Store("10.0.0.2:1234"), []models.User{joe, jane})
+
+		revisions := listRevisions(t, h)
+		if expected, actual := 2, len(revisions); expected != actual {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+
+		// Newest first.
+		latest := revisions[0]
+		if expected, actual := 2, latest.ID; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := "10.0.0.2:1234", latest.RemoteAddr; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		want := Diff{
+			Added:   []models.User{joe},
+			Removed: []models.User{fred},
+		}
+		if expected, actual := want, latest.Diff; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 0, len(latest.Users); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		revision, ok := getRevision(t, h, 1)
+		if !ok {
+			t.Fatal("expected: revision 1 to be found")
+		}
+		if expected, actual := []models.User{fred, jane}, revision.Users; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("failed writes are not recorded", func(t *testing.T) {
+		h, err := New(store.NewMemory(), fs.New(), "", store.DefaultLockTimeout, log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = h.Store("").Write([]models.User{fred}, store.Version("stale"))
+		if _, ok := store.ErrConflict(err); !ok {
+			t.Fatalf("expected: conflict error, actual: %v", err)
+		}
+
+		if expected, actual := 0, len(listRevisions(t, h)); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		var (
+			s      = store.NewMemory()
+			h, err = New(s, fs.New(), "", store.DefaultLockTimeout, log.NewNopLogger())
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		write(t, h.Store(""), []models.User{fred, jane})
+		version := write(t, h.Store(""), []models.User{joe})
+
+		if _, err := h.Restore(1, version, "cli"); err != nil {
+			t.Fatal(err)
+		}
+
+		users, _, err := s.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := []models.User{fred, jane}, users; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		latest := listRevisions(t, h)[0]
+		if expected, actual := 3, latest.ID; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := "cli", latest.RemoteAddr; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("restore missing revision", func(t *testing.T) {
+		h, err := New(store.NewMemory(), fs.New(), "", store.DefaultLockTimeout, log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = h.Restore(1, store.AnyVersion, "")
+
+		if expected, actual := false, err == nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("persisted revisions", func(t *testing.T) {
+		var (
+			path = filepath.Join(dir, "history.jsonl")
+			s    = store.NewMemory()
+			now  = time.Date(2017, 6, 28, 20, 0, 0, 0, time.UTC)
+		)
+
+		h, err := New(s, fs.New(), path, store.DefaultLockTimeout, log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.now = func() time.Time { return now }
+
+		write(t, h.Store("10.0.0.1:1234"), []models.User{fred})
+		write(t, h.Store("10.0.0.1:1234"), []models.User{fred, jane})
+
+		reloaded, err := New(s, fs.New(), path, store.DefaultLockTimeout, log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := listRevisions(t, h), listRevisions(t, reloaded); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		revision, ok := getRevision(t, reloaded, 2)
+		if !ok {
+			t.Fatal("expected: revision 2 to be found")
+		}
+		if expected, actual := []models.User{fred, jane}, revision.Users; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("users are read back from the file", func(t *testing.T) {
+		var (
+			path = filepath.Join(dir, "offsets.jsonl")
+			s    = store.NewMemory()
+		)
+
+		h, err := New(s, fs.New(), path, store.DefaultLockTimeout, log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		write(t, h.Store(""), []models.User{fred})
+		write(t, h.Store(""), []models.User{fred, jane, joe})
+
+		// Only the file holds the users of each revision.
+		for _, v := range h.revisions {
+			if expected, actual := 0, len(v.Users); expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		}
+
+		for id, users := range map[int][]models.User{
+			1: []models.User{fred},
+			2: []models.User{fred, jane, joe},
+		} {
+			revision, ok := getRevision(t, h, id)
+			if !ok {
+				t.Fatalf("expected: revision %d to be found", id)
+			}
+			if expected, actual := users, revision.Users; !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		}
+	})
+
+	t.Run("unable to read before writing", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockStore := mock_store.NewMockStore(ctrl)
+		mockStore.EXPECT().
+			Read().
+			Return(nil, store.AnyVersion, errors.New("bad"))
+
+		h, err := New(mockStore, fs.New(), "", store.DefaultLockTimeout, log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Without the users from before there is nothing to compare against,
+		// so nothing is written.
+		if _, err := h.Store("").Write([]models.User{fred}, store.AnyVersion); err == nil {
+			t.Errorf("expected: error")
+		}
+		if expected, actual := 0, len(listRevisions(t, h)); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("unable to append after writing", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			path     = filepath.Join(dir, "missing.jsonl")
+			s        = store.NewMemory()
+			mockFS   = mock_fs.NewMockFilesystem(ctrl)
+			mockLock = mock_fs.NewMockLock(ctrl)
+			logged   []interface{}
+			logger   = log.LoggerFunc(func(keyvals ...interface{}) error {
+				logged = append(logged, keyvals...)
+				return nil
+			})
+		)
+
+		mockFS.EXPECT().Lock(path, gomock.Any(), gomock.Any()).Return(mockLock, nil).AnyTimes()
+		mockLock.EXPECT().Release().Return(nil).AnyTimes()
+		mockFS.EXPECT().Exists(path).Return(false).AnyTimes()
+		mockFS.EXPECT().Append(path).Return(nil, errors.New("bad"))
+
+		h, err := New(s, mockFS, path, store.DefaultLockTimeout, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The store was written to, so the write has succeeded even though
+		// there is no revision for it.
+		version := write(t, h.Store(""), []models.User{fred})
+
+		users, current, err := s.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := []models.User{fred}, users; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := current, version; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if len(logged) == 0 {
+			t.Errorf("expected: the failure to be logged")
+		}
+	})
+
+	t.Run("locks with the timeout of the store", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			path     = filepath.Join(dir, "timeout.jsonl")
+			mockFS   = mock_fs.NewMockFilesystem(ctrl)
+			mockLock = mock_fs.NewMockLock(ctrl)
+		)
+
+		mockFS.EXPECT().Lock(path, fs.Shared, 30*time.Second).Return(mockLock, nil)
+		mockLock.EXPECT().Release().Return(nil)
+		mockFS.EXPECT().Exists(path).Return(false)
+
+		if _, err := New(store.NewMemory(), mockFS, path, 30*time.Second, log.NewNopLogger()); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("shared file", func(t *testing.T) {
+		var (
+			path = filepath.Join(dir, "shared.jsonl")
+			s    = store.NewMemory()
+		)
+
+		// A server and the CLI write to the same store and the same file.
+		server, err := New(s, fs.New(), path, store.DefaultLockTimeout, log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		cli, err := New(s, fs.New(), path, store.DefaultLockTimeout, log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		write(t, server.Store("10.0.0.1:1234"), []models.User{fred})
+		write(t, cli.Store("cli"), []models.User{fred, jane})
+		version := write(t, server.Store("10.0.0.1:1234"), []models.User{joe})
+
+		for _, h := range []*History{server, cli} {
+			var ids []int
+			for _, v := range listRevisions(t, h) {
+				ids = append(ids, v.ID)
+			}
+			if expected, actual := []int{3, 2, 1}, ids; !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		}
+
+		// The revision made by the cli is restored, not the revision found at
+		// the same position in the revisions of the server.
+		if _, err := server.Restore(2, version, "10.0.0.1:1234"); err != nil {
+			t.Fatal(err)
+		}
+		users, _, err := s.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := []models.User{fred, jane}, users; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		latest := listRevisions(t, cli)[0]
+		if expected, actual := 4, latest.ID; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("revisions with gaps", func(t *testing.T) {
+		path := filepath.Join(dir, "gaps.jsonl")
+		if err := ioutil.WriteFile(path, []byte(`{"id":1}`+"\n"+`{"id":3,"remote_addr":"cli"}`+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		h, err := New(store.NewMemory(), fs.New(), path, store.DefaultLockTimeout, log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := getRevision(t, h, 2); ok {
+			t.Errorf("expected: no revision 2")
+		}
+		revision, ok := getRevision(t, h, 3)
+		if !ok {
+			t.Fatal("expected: revision 3 to be found")
+		}
+		if expected, actual := "cli", revision.RemoteAddr; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		write(t, h.Store(""), []models.User{fred})
+		if expected, actual := 4, listRevisions(t, h)[0].ID; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("torn line is cut off", func(t *testing.T) {
+		var (
+			path = filepath.Join(dir, "torn.jsonl")
+			s    = store.NewMemory()
+		)
+
+		h, err := New(s, fs.New(), path, store.DefaultLockTimeout, log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		write(t, h.Store(""), []models.User{fred})
+
+		// Another process crashed part way through appending a revision.
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := file.WriteString(`{"id":2,"remote_addr":"cr`); err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+
+		write(t, h.Store("10.0.0.1:1234"), []models.User{fred, jane})
+
+		reloaded, err := New(s, fs.New(), path, store.DefaultLockTimeout, log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		revision, ok := getRevision(t, reloaded, 2)
+		if !ok {
+			t.Fatal("expected: revision 2 to be found")
+		}
+		if expected, actual := "10.0.0.1:1234", revision.RemoteAddr; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := []models.User{fred, jane}, revision.Users; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("check", func(t *testing.T) {
+		h, err := New(store.NewMemory(), fs.New(), "", store.DefaultLockTimeout, log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		write(t, h.Store("10.0.0.1:1234"), []models.User{fred})
+		if err := h.Check(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Checking isn't a change, so there is no revision for it.
+		if expected, actual := 1, len(listRevisions(t, h)); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		h, err := New(store.NewMemory(), fs.New(), "", store.DefaultLockTimeout, log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		write(t, h.Store("10.0.0.1:1234"), []models.User{fred})
+		if err := h.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := h.Store("10.0.0.1:1234").Write([]models.User{jane}, store.AnyVersion); err != ErrClosed {
+			t.Errorf("expected: %v, actual: %v", ErrClosed, err)
+		}
+		if _, err := h.Restore(1, store.AnyVersion, "10.0.0.1:1234"); err != ErrClosed {
+			t.Errorf("expected: %v, actual: %v", ErrClosed, err)
+		}
+		if err := h.Check(); err != ErrClosed {
+			t.Errorf("expected: %v, actual: %v", ErrClosed, err)
+		}
+		if expected, actual := 1, len(listRevisions(t, h)); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		// Closing again does nothing.
+		if err := h.Close(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func write(t *testing.T, s store.Store, users []models.User) store.Version {
+	version, err := s.Write(users, store.AnyVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
+
+func listRevisions(t *testing.T, h *History) []Revision {
+	res, err := h.Revisions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func getRevision(t *testing.T, h *History, id int) (Revision, bool) {
+	res, ok, err := h.Revision(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res, ok
+}
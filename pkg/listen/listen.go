@@ -0,0 +1,178 @@
+package listen
+
+import (
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Unix listens on a unix domain socket at path. A socket left behind by a
+// process that is no longer listening is removed first. The socket is given
+// the mode and, if it isn't empty, the group (a name or an id), so that only
+// the right processes (i.e. nginx) can connect.
+func Unix(path string, mode os.FileMode, group string) (net.Listener, error) {
+	if err := removeStale(path); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, errors.Wrapf(err, "unable to change the mode of %q", path)
+	}
+	if group != "" {
+		gid, err := lookupGroup(group)
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+		if err := os.Chown(path, -1, gid); err != nil {
+			listener.Close()
+			return nil, errors.Wrapf(err, "unable to change the group of %q", path)
+		}
+	}
+	return listener, nil
+}
+
+// removeStale removes the socket at path if nothing is listening on it.
+func removeStale(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return errors.Errorf("%q already exists and isn't a socket", path)
+	}
+
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return errors.Errorf("%q is already being listened on", path)
+	}
+	return os.Remove(path)
+}
+
+func lookupGroup(group string) (int, error) {
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return 0, errors.Wrapf(err, "unknown group %q", group)
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// ParseMode parses the mode of a socket, written in octal (i.e. 0660).
+func ParseMode(value string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, errors.Errorf("invalid mode %q, expected octal permissions i.e. 0660", value)
+	}
+	return os.FileMode(mode), nil
+}
+
+// The first file descriptor passed by systemd, after stdin, stdout and
+// stderr.
+const listenFDsStart = 3
+
+// activated holds the listeners passed by systemd, they're only read once as
+// the environment is cleared afterwards.
+var activated struct {
+	once      sync.Once
+	listeners []activatedListener
+	err       error
+}
+
+type activatedListener struct {
+	name     string
+	listener net.Listener
+	taken    bool
+}
+
+// Systemd returns a listener passed by systemd socket activation, found by
+// the name of the socket (FileDescriptorName= in the socket unit). An empty
+// name returns the first listener that hasn't been returned yet. Every
+// listener is only returned once.
+func Systemd(name string) (net.Listener, error) {
+	activated.once.Do(func() {
+		activated.listeners, activated.err = fromEnv(os.Getenv, listenFDsStart)
+
+		// The descriptors aren't meant for any child processes.
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	})
+	if activated.err != nil {
+		return nil, activated.err
+	}
+	return take(activated.listeners, name)
+}
+
+func take(listeners []activatedListener, name string) (net.Listener, error) {
+	if len(listeners) == 0 {
+		return nil, errors.New("no sockets were passed by systemd, expected LISTEN_FDS")
+	}
+	for k, v := range listeners {
+		if v.taken || (name != "" && v.name != name) {
+			continue
+		}
+		listeners[k].taken = true
+		return v.listener, nil
+	}
+	if name == "" {
+		return nil, errors.New("every socket passed by systemd is already in use")
+	}
+	return nil, errors.Errorf("no socket named %q was passed by systemd", name)
+}
+
+// fromEnv creates a listener for every file descriptor passed by systemd, as
+// described by the LISTEN_PID, LISTEN_FDS and LISTEN_FDNAMES variables.
+func fromEnv(getenv func(string) string, start int) ([]activatedListener, error) {
+	if pid, err := strconv.Atoi(getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, nil
+	}
+
+	var names []string
+	if value := getenv("LISTEN_FDNAMES"); value != "" {
+		names = strings.Split(value, ":")
+	}
+
+	res := make([]activatedListener, count)
+	for k := range res {
+		name := "LISTEN_FD_" + strconv.Itoa(start+k)
+		if k < len(names) {
+			name = names[k]
+		}
+
+		// The listener holds its own copy of the descriptor.
+		file := os.NewFile(uintptr(start+k), name)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			for _, v := range res[:k] {
+				v.listener.Close()
+			}
+			return nil, errors.Wrapf(err, "unable to listen on the socket %q passed by systemd", name)
+		}
+		res[k] = activatedListener{
+			name:     name,
+			listener: listener,
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,198 @@
+package listen
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestUnix(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Run("mode", func(t *testing.T) {
+		path := filepath.Join(dir, "mode.sock")
+		listener, err := Unix(path, 0600, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := os.FileMode(0600), info.Mode().Perm(); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+	})
+
+	t.Run("group", func(t *testing.T) {
+		path := filepath.Join(dir, "group.sock")
+		listener, err := Unix(path, 0660, strconv.Itoa(os.Getgid()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		listener.Close()
+	})
+
+	t.Run("stale socket", func(t *testing.T) {
+		path := filepath.Join(dir, "stale.sock")
+		listener, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		listener.(*net.UnixListener).SetUnlinkOnClose(false)
+		listener.Close()
+
+		listener, err = Unix(path, 0660, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listener.Close()
+	})
+
+	t.Run("socket in use", func(t *testing.T) {
+		path := filepath.Join(dir, "used.sock")
+		listener, err := Unix(path, 0660, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+
+		if _, err := Unix(path, 0660, ""); err == nil {
+			t.Errorf("expected an error")
+		}
+	})
+
+	t.Run("not a socket", func(t *testing.T) {
+		path := filepath.Join(dir, "file.sock")
+		if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := Unix(path, 0660, ""); err == nil {
+			t.Errorf("expected an error")
+		}
+	})
+}
+
+func TestParseMode(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		value    string
+		expected os.FileMode
+		valid    bool
+	}{
+		{"0660", 0660, true},
+		{"600", 0600, true},
+		{"0999", 0, false},
+		{"01777", 0, false},
+		{"rw", 0, false},
+	} {
+		actual, err := ParseMode(testcase.value)
+		if expected, actual := testcase.valid, err == nil; expected != actual {
+			t.Errorf("%q: expected: %v, actual: %v", testcase.value, expected, actual)
+		}
+		if expected := testcase.expected; expected != actual {
+			t.Errorf("%q: expected: %v, actual: %v", testcase.value, expected, actual)
+		}
+	}
+}
+
+func TestSystemd(t *testing.T) {
+	t.Parallel()
+
+	newFile := func(t *testing.T) *os.File {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+
+		file, err := listener.(*net.TCPListener).File()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+
+	t.Run("not for this process", func(t *testing.T) {
+		listeners, err := fromEnv(env(map[string]string{
+			"LISTEN_PID": "1",
+			"LISTEN_FDS": "1",
+		}), 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := 0, len(listeners); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if _, err := take(listeners, ""); err == nil {
+			t.Errorf("expected an error")
+		}
+	})
+
+	t.Run("named", func(t *testing.T) {
+		// The descriptors are expected to follow on from each other, so only
+		// a single one is passed.
+		file := newFile(t)
+		defer file.Close()
+
+		// The descriptor is closed once it's been listened on, so pass a copy.
+		fd, err := syscall.Dup(int(file.Fd()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		listeners, err := fromEnv(env(map[string]string{
+			"LISTEN_PID":     strconv.Itoa(os.Getpid()),
+			"LISTEN_FDS":     "1",
+			"LISTEN_FDNAMES": "api",
+		}), fd)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := take(listeners, "metrics"); err == nil {
+			t.Errorf("expected an error")
+		}
+		listener, err := take(listeners, "api")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+
+		if _, err := take(listeners, ""); err == nil {
+			t.Errorf("expected an error as the listener is taken")
+		}
+	})
+}
+
+func env(values map[string]string) func(string) string {
+	return func(key string) string {
+		return values[key]
+	}
+}
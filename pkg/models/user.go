@@ -1,33 +1,229 @@
 package models
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/pkg/errors"
 )
 
-// User describes a type of data that is normalized for the query API
+// Fields holds the values of a user, keyed by the name of the field declared
+// in the form schema.
+type Fields map[string]string
+
+// IDField is the name used for the id of a user wherever it's held alongside
+// the fields, i.e. as a csv column, a JSON key or a form key.
+const IDField = "id"
+
+// User describes a type of data that is normalized for the query API. The ID
+// is stable for the lifetime of the user, so a user can be addressed even as
+// other users are added, removed or moved around.
 type User struct {
-	FirstName, Surname string
+	ID     string
+	Fields Fields
+
+	// Extra holds the values of columns found in a store that aren't part of
+	// the schema. They're never validated, shown or sent anywhere, they're
+	// only kept so that the store can write them back.
+	Extra Fields
 }
 
-// Unmarshal converts a slice of strings to a user model
-func (u *User) Unmarshal(s []string) error {
-	if len(s) != 2 {
-		return errors.New("expected records length of 2")
+// NewID returns a new random id for a user. It panics if the system is unable
+// to provide any randomness, as nothing can be created safely without it.
+func NewID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(errors.Wrap(err, "unable to generate id"))
 	}
+	return hex.EncodeToString(b)
+}
 
-	u.FirstName = s[0]
-	u.Surname = s[1]
+// EnsureIDs returns a copy of the users where every user without an id has
+// been given a new one.
+func EnsureIDs(users []User) []User {
+	res := make([]User, len(users))
+	for k, v := range users {
+		res[k] = v.Copy()
+		if res[k].ID == "" {
+			res[k].ID = NewID()
+		}
+	}
+	return res
+}
+
+// MissingIDs returns true if any of the users don't have an id.
+func MissingIDs(users []User) bool {
+	for _, v := range users {
+		if v.ID == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns the value of the field for the name, or an empty string if the
+// user has no value for it.
+func (u User) Get(name string) string {
+	return u.Fields[name]
+}
+
+// Set sets the value of the field for the name.
+func (u *User) Set(name, value string) {
+	if u.Fields == nil {
+		u.Fields = make(Fields)
+	}
+	u.Fields[name] = value
+}
+
+// Unmarshal converts a slice of strings to a user model, each value is named
+// by the column found at the same position. A column named IDField holds the
+// id of the user.
+func (u *User) Unmarshal(columns, s []string) error {
+	if len(s) != len(columns) {
+		return errors.Errorf("expected records length of %d", len(columns))
+	}
+
+	u.Fields = make(Fields, len(columns))
+	for k, v := range columns {
+		if v == IDField {
+			u.ID = s[k]
+			continue
+		}
+		u.Fields[v] = s[k]
+	}
 
 	return nil
 }
 
-// Marshal converts a user model to a slice of strings
-func (u User) Marshal() ([]string, error) {
-	return []string{u.FirstName, u.Surname}, nil
+// Marshal converts a user model to a slice of strings, in the order of the
+// columns. A column named IDField holds the id of the user.
+func (u User) Marshal(columns []string) ([]string, error) {
+	res := make([]string, len(columns))
+	for k, v := range columns {
+		if v == IDField {
+			res[k] = u.ID
+			continue
+		}
+		res[k] = u.Fields[v]
+	}
+	return res, nil
+}
+
+// Copy returns a user that doesn't share any fields with the original.
+func (u User) Copy() User {
+	return User{
+		ID:     u.ID,
+		Fields: u.Fields.Copy(),
+		Extra:  u.Extra.Copy(),
+	}
+}
+
+// Copy returns fields that aren't shared with the original.
+func (f Fields) Copy() Fields {
+	if f == nil {
+		return nil
+	}
+
+	res := make(Fields, len(f))
+	for k, v := range f {
+		res[k] = v
+	}
+	return res
+}
+
+// Equal returns true if both users have the same id and hold the same values
+// for the same fields. Extra values aren't compared, as they're not part of
+// the schema.
+func (u User) Equal(other User) bool {
+	if u.ID != other.ID || len(u.Fields) != len(other.Fields) {
+		return false
+	}
+	for k, v := range u.Fields {
+		if value, ok := other.Fields[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalJSON writes the user as a flat JSON object of its fields, along with
+// the id if the user has one. Extra values are left out.
+func (u User) MarshalJSON() ([]byte, error) {
+	values := make(map[string]string, len(u.Fields)+1)
+	for k, v := range u.Fields {
+		values[k] = v
+	}
+	if u.ID != "" {
+		values[IDField] = u.ID
+	}
+	return json.Marshal(values)
+}
+
+// UnmarshalJSON reads the user from a flat JSON object, the id is read from
+// IDField. Fields already held by the user are kept, unless they're present in
+// the JSON, which makes it possible to decode over the top of an existing
+// user. Numbers and booleans are kept as their literal text.
+func (u *User) UnmarshalJSON(b []byte) error {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(b, &values); err != nil {
+		return err
+	}
+	if values == nil {
+		return errors.New("expected a user object")
+	}
+
+	for k, v := range values {
+		value, err := unmarshalValue(v)
+		if err != nil {
+			return errors.Wrapf(err, "invalid value for %q", k)
+		}
+		if k == IDField {
+			u.ID = value
+			continue
+		}
+		u.Set(k, value)
+	}
+	return nil
 }
 
 func (u User) String() string {
-	return fmt.Sprintf("%s,%s", u.FirstName, u.Surname)
+	names := make([]string, 0, len(u.Fields))
+	for k := range u.Fields {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	values := make([]string, 0, len(names)+1)
+	if u.ID != "" {
+		values = append(values, fmt.Sprintf("%s=%s", IDField, u.ID))
+	}
+	for _, v := range names {
+		values = append(values, fmt.Sprintf("%s=%s", v, u.Fields[v]))
+	}
+	return strings.Join(values, ",")
+}
+
+func unmarshalValue(raw json.RawMessage) (string, error) {
+	raw = bytes.TrimSpace(raw)
+	switch {
+	case bytes.Equal(raw, []byte("null")):
+		return "", nil
+	case len(raw) > 0 && raw[0] == '"':
+		var value string
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	case bytes.Equal(raw, []byte("true")), bytes.Equal(raw, []byte("false")):
+		return string(raw), nil
+	default:
+		var value json.Number
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return "", errors.New("expected a string, number or boolean")
+		}
+		return value.String(), nil
+	}
 }
@@ -1,27 +1,43 @@
 package models
 
 import (
+	"encoding/json"
 	"reflect"
 	"testing"
 )
 
+var columns = []string{"firstname", "surname"}
+
 func TestUserUnmarshal(t *testing.T) {
 	t.Parallel()
 
 	t.Run("valid", func(t *testing.T) {
 		user := &User{}
-		if err := user.Unmarshal([]string{"fred", "smith"}); err != nil {
+		if err := user.Unmarshal(columns, []string{"fred", "smith"}); err != nil {
+			t.Fatal(err)
+		}
+
+		want := User{Fields: Fields{"firstname": "fred", "surname": "smith"}}
+		if expected, actual := want, *user; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("with id", func(t *testing.T) {
+		user := &User{}
+		if err := user.Unmarshal(append([]string{IDField}, columns...), []string{"abc", "fred", "smith"}); err != nil {
 			t.Fatal(err)
 		}
 
-		if expected, actual := (User{"fred", "smith"}), *user; !reflect.DeepEqual(expected, actual) {
+		want := User{ID: "abc", Fields: Fields{"firstname": "fred", "surname": "smith"}}
+		if expected, actual := want, *user; !reflect.DeepEqual(expected, actual) {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
 		}
 	})
 
 	t.Run("incomplete slice", func(t *testing.T) {
 		user := &User{}
-		err := user.Unmarshal([]string{"fred"})
+		err := user.Unmarshal(columns, []string{"fred"})
 
 		if expected, actual := true, err != nil; expected != actual {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
@@ -30,7 +46,7 @@ func TestUserUnmarshal(t *testing.T) {
 
 	t.Run("nil slice", func(t *testing.T) {
 		user := &User{}
-		err := user.Unmarshal(nil)
+		err := user.Unmarshal(columns, nil)
 
 		if expected, actual := true, err != nil; expected != actual {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
@@ -42,8 +58,8 @@ func TestUserMarshal(t *testing.T) {
 	t.Parallel()
 
 	t.Run("valid", func(t *testing.T) {
-		user := User{"fred", "smith"}
-		slice, err := user.Marshal()
+		user := User{Fields: Fields{"firstname": "fred", "surname": "smith"}}
+		slice, err := user.Marshal(columns)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -53,9 +69,21 @@ func TestUserMarshal(t *testing.T) {
 		}
 	})
 
+	t.Run("with id", func(t *testing.T) {
+		user := User{ID: "abc", Fields: Fields{"firstname": "fred", "surname": "smith"}}
+		slice, err := user.Marshal(append([]string{IDField}, columns...))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := []string{"abc", "fred", "smith"}, slice; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
 	t.Run("empty values", func(t *testing.T) {
-		user := User{"", ""}
-		slice, err := user.Marshal()
+		user := User{}
+		slice, err := user.Marshal(columns)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -65,3 +93,140 @@ func TestUserMarshal(t *testing.T) {
 		}
 	})
 }
+
+func TestUserJSON(t *testing.T) {
+	t.Parallel()
+
+	t.Run("marshal", func(t *testing.T) {
+		user := User{Fields: Fields{"firstname": "fred", "surname": "smith"}}
+		b, err := json.Marshal(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := `{"firstname":"fred","surname":"smith"}`, string(b); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("marshal with id", func(t *testing.T) {
+		user := User{ID: "abc", Fields: Fields{"firstname": "fred"}}
+		b, err := json.Marshal(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := `{"firstname":"fred","id":"abc"}`, string(b); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("unmarshal with id", func(t *testing.T) {
+		var user User
+		if err := json.Unmarshal([]byte(`{"id":"abc","firstname":"fred"}`), &user); err != nil {
+			t.Fatal(err)
+		}
+
+		want := User{ID: "abc", Fields: Fields{"firstname": "fred"}}
+		if expected, actual := want, user; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("unmarshal literals", func(t *testing.T) {
+		var user User
+		if err := json.Unmarshal([]byte(`{"name":"fred","age":42,"admin":true,"notes":null}`), &user); err != nil {
+			t.Fatal(err)
+		}
+
+		want := User{Fields: Fields{"name": "fred", "age": "42", "admin": "true", "notes": ""}}
+		if expected, actual := want, user; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("unmarshal over existing", func(t *testing.T) {
+		user := User{Fields: Fields{"firstname": "fred", "surname": "smith"}}
+		if err := json.Unmarshal([]byte(`{"surname":"bloggs"}`), &user); err != nil {
+			t.Fatal(err)
+		}
+
+		want := User{Fields: Fields{"firstname": "fred", "surname": "bloggs"}}
+		if expected, actual := want, user; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("unmarshal nested", func(t *testing.T) {
+		var user User
+		err := json.Unmarshal([]byte(`{"name":{"first":"fred"}}`), &user)
+
+		if expected, actual := true, err != nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestUserEqual(t *testing.T) {
+	t.Parallel()
+
+	fred := User{Fields: Fields{"firstname": "fred", "surname": "smith"}}
+
+	for _, testcase := range []struct {
+		name  string
+		other User
+		equal bool
+	}{
+		{"same", fred.Copy(), true},
+		{"different value", User{Fields: Fields{"firstname": "fred", "surname": "bloggs"}}, false},
+		{"missing field", User{Fields: Fields{"firstname": "fred"}}, false},
+		{"different id", User{ID: "abc", Fields: Fields{"firstname": "fred", "surname": "smith"}}, false},
+		{"empty", User{}, false},
+	} {
+		if expected, actual := testcase.equal, fred.Equal(testcase.other); expected != actual {
+			t.Errorf("%s: expected: %v, actual: %v", testcase.name, expected, actual)
+		}
+	}
+}
+
+func TestUserCopy(t *testing.T) {
+	t.Parallel()
+
+	var (
+		user = User{Fields: Fields{"firstname": "fred"}}
+		copy = user.Copy()
+	)
+	copy.Set("firstname", "changed")
+
+	if expected, actual := "fred", user.Get("firstname"); expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+}
+
+func TestEnsureIDs(t *testing.T) {
+	t.Parallel()
+
+	users := []User{
+		User{ID: "abc", Fields: Fields{"firstname": "fred"}},
+		User{Fields: Fields{"firstname": "jane"}},
+	}
+	if expected, actual := true, MissingIDs(users); expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+
+	res := EnsureIDs(users)
+	if expected, actual := false, MissingIDs(res); expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+	if expected, actual := "abc", res[0].ID; expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+	if expected, actual := 16, len(res[1].ID); expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+
+	// The original users are left untouched.
+	if expected, actual := "", users[1].ID; expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+}
@@ -0,0 +1,54 @@
+package query
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	mimeHTML = "text/html"
+	mimeJSON = "application/json"
+)
+
+// acceptsJSON checks the Accept header of the request to see if the client
+// prefers JSON over HTML. Browsers send a wildcard, which is treated as
+// preferring HTML, so only clients that explicitly ask for JSON get it.
+func acceptsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return false
+	}
+
+	var html, json float64
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+
+		switch mediaType {
+		case mimeJSON:
+			json = maxQuality(json, quality)
+		case mimeHTML, "text/*", "*/*":
+			html = maxQuality(html, quality)
+		}
+	}
+
+	return json > html
+}
+
+func maxQuality(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,32 @@
+package query
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAcceptsJSON(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		accept string
+		json   bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", false},
+		{"application/json", true},
+		{"application/json, */*;q=0.1", true},
+		{"text/html;q=0.5, application/json", true},
+		{"text/html, application/json", false},
+		{"application/json;q=0.1, text/html;q=0.9", false},
+		{"invalid;;", false},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", testcase.accept)
+
+		if expected, actual := testcase.json, acceptsJSON(req); expected != actual {
+			t.Errorf("%q: expected: %v, actual: %v", testcase.accept, expected, actual)
+		}
+	}
+}
@@ -2,16 +2,25 @@ package query
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/SimonRichardson/formed/pkg/controllers"
-	"github.com/SimonRichardson/formed/pkg/store"
+	"github.com/SimonRichardson/formed/pkg/csrf"
+	"github.com/SimonRichardson/formed/pkg/forms"
+	"github.com/SimonRichardson/formed/pkg/history"
 	"github.com/SimonRichardson/formed/pkg/templates"
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 )
 
 // These are the the query API URL paths
 const (
-	APIPathQuery = "/"
+	APIPathQuery     = "/"
+	APIPathHistory   = "/history"
+	APIPathUsers     = "/api/v1/users"
+	APIPathRevisions = "/api/v1/history"
+	APIPathImport    = "/api/v1/import"
+	APIPathExport    = "/api/v1/export"
 )
 
 // API serves the query API
@@ -29,14 +38,54 @@ func NewAPI(injector *Injector, logger log.Logger) *API {
 }
 
 func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	iw := &interceptingWriter{http.StatusOK, w}
-	w = iw
+	// Anything under the api path is always JSON.
+	method, path := r.Method, r.URL.Path
+	if parts, ok := pathParts(path, APIPathUsers); ok {
+		a.setRoute(r, usersRoute(parts))
+		a.serveUsers(a.injector.NewAPIController(w, r), method, parts)
+		return
+	}
+	if path == APIPathImport || path == APIPathExport {
+		a.serveTransfer(a.injector.NewAPIController(w, r), r, method, path)
+		return
+	}
+	if parts, ok := pathParts(path, APIPathRevisions); ok {
+		a.setRoute(r, historyRoute(parts))
+		a.serveHistory(a.injector.NewHistoryAPIController(w, r), method, parts)
+		return
+	}
+
+	if parts, ok := pathParts(path, APIPathHistory); ok {
+		a.setRoute(r, historyRoute(parts))
+		if acceptsJSON(r) {
+			a.serveHistory(a.injector.NewHistoryAPIController(w, r), method, parts)
+			return
+		}
+		a.serveHistory(a.injector.NewHistoryController(w, r), method, parts)
+		return
+	}
+
+	if path == APIPathQuery {
+		a.setRoute(r, routeForm)
+	} else {
+		a.setRoute(r, routeUnknown)
+	}
 
 	// Create a new controller to handle the various routes
+	if acceptsJSON(r) {
+		ctrl := a.injector.NewAPIController(w, r)
+		switch {
+		case method == "GET" && path == APIPathQuery:
+			ctrl.List()
+		default:
+			ctrl.NotFound()
+		}
+		return
+	}
+
 	ctrl := a.injector.NewController(w, r)
 
 	// Routing table
-	method, path := r.Method, r.URL.Path
 	switch {
 	case method == "GET" && path == APIPathQuery:
 		ctrl.Get()
@@ -47,33 +96,144 @@ func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (a *API) serveUsers(ctrl controllers.APIController, method string, parts []string) {
+	// Routing table
+	switch {
+	case len(parts) > 1:
+		ctrl.NotFound()
+	case len(parts) == 0 && method == "GET":
+		ctrl.List()
+	case len(parts) == 0 && method == "POST":
+		ctrl.Create()
+	case len(parts) == 0:
+		ctrl.MethodNotAllowed()
+	case method == "GET":
+		ctrl.Get(parts[0])
+	case method == "PUT":
+		ctrl.Replace(parts[0])
+	case method == "PATCH":
+		ctrl.Patch(parts[0])
+	case method == "DELETE":
+		ctrl.Delete(parts[0])
+	default:
+		ctrl.MethodNotAllowed()
+	}
+}
+
+func (a *API) serveTransfer(ctrl controllers.APIController, r *http.Request, method, path string) {
+	// Routing table
+	switch {
+	case path == APIPathExport && method == "GET":
+		a.setRoute(r, routeExport)
+		ctrl.Export()
+	case path == APIPathImport && method == "POST":
+		a.setRoute(r, routeImport)
+		ctrl.Import()
+	default:
+		a.setRoute(r, routeUnknown)
+		ctrl.MethodNotAllowed()
+	}
+}
+
+func (a *API) serveHistory(ctrl controllers.HistoryController, method string, parts []string) {
+	// Routing table
+	switch {
+	case len(parts) == 0 && method == "GET":
+		ctrl.List()
+	case len(parts) == 1 && method == "GET":
+		ctrl.Get(parts[0])
+	case len(parts) == 2 && parts[1] == "restore" && method == "POST":
+		ctrl.Restore(parts[0])
+	default:
+		ctrl.NotFound()
+	}
+}
+
+// setRoute records the route for the access log and the metrics, which is
+// also logged along with the request id when debugging.
+func (a *API) setRoute(r *http.Request, name string) {
+	setRoute(r, a.injector.form.Name, name)
+	level.Debug(a.logger).Log("route", name, "request_id", r.Header.Get(RequestIDHeader))
+}
+
+func usersRoute(parts []string) string {
+	switch len(parts) {
+	case 0:
+		return routeUsers
+	case 1:
+		return routeUser
+	}
+	return routeUnknown
+}
+
+func historyRoute(parts []string) string {
+	switch {
+	case len(parts) == 0:
+		return routeRevisions
+	case len(parts) == 1:
+		return routeRevision
+	case len(parts) == 2 && parts[1] == "restore":
+		return routeRestore
+	}
+	return routeUnknown
+}
+
+// pathParts splits the path found after the prefix in to parts, it returns
+// false if the path isn't found under the prefix.
+func pathParts(path, prefix string) ([]string, bool) {
+	if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+		return nil, false
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(path, prefix), "/")
+	if rest == "" {
+		return nil, true
+	}
+	return strings.Split(rest, "/"), true
+}
+
 // Injector abstracts away some dependencies that are required for creating
 // certain components.
 type Injector struct {
-	store     store.Store
-	templates *templates.Templates
+	history          *history.History
+	form             forms.Form
+	protector        *csrf.Protector
+	templates        *templates.Templates
+	historyTemplates *templates.Templates
 }
 
-// NewInjector creates a new injector with the correct dependencies
-func NewInjector(store store.Store, templates *templates.Templates) *Injector {
+// NewInjector creates a new injector with the correct dependencies for the
+// form. The protector guards every form that is posted.
+func NewInjector(form forms.Form, history *history.History, protector *csrf.Protector, templates, historyTemplates *templates.Templates) *Injector {
 	return &Injector{
-		store:     store,
-		templates: templates,
+		history:          history,
+		form:             form,
+		protector:        protector,
+		templates:        templates,
+		historyTemplates: historyTemplates,
 	}
 }
 
 // NewController creates a controller from the http.ResponseWriter and the
 // http.Request.
 func (f *Injector) NewController(w http.ResponseWriter, r *http.Request) controllers.Controller {
-	return controllers.New(f.store, f.templates, w, r)
+	return controllers.New(f.history.Store(r.RemoteAddr), f.form, f.protector, f.templates, w, r)
+}
+
+// NewAPIController creates a JSON controller from the http.ResponseWriter and
+// the http.Request.
+func (f *Injector) NewAPIController(w http.ResponseWriter, r *http.Request) controllers.APIController {
+	return controllers.NewAPI(f.history.Store(r.RemoteAddr), f.form, w, r)
 }
 
-type interceptingWriter struct {
-	code int
-	http.ResponseWriter
+// NewHistoryController creates a history controller from the
+// http.ResponseWriter and the http.Request.
+func (f *Injector) NewHistoryController(w http.ResponseWriter, r *http.Request) controllers.HistoryController {
+	return controllers.NewHistory(f.history, f.history.Store(r.RemoteAddr), f.form, f.protector, f.historyTemplates, w, r)
 }
 
-func (iw *interceptingWriter) WriteHeader(code int) {
-	iw.code = code
-	iw.ResponseWriter.WriteHeader(code)
+// NewHistoryAPIController creates a JSON history controller from the
+// http.ResponseWriter and the http.Request.
+func (f *Injector) NewHistoryAPIController(w http.ResponseWriter, r *http.Request) controllers.HistoryController {
+	return controllers.NewHistoryAPI(f.history, w, r)
 }
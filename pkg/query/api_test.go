@@ -10,16 +10,32 @@ import (
 
 	"bytes"
 
+	"github.com/SimonRichardson/formed/pkg/csrf"
+	"github.com/SimonRichardson/formed/pkg/forms"
+	"github.com/SimonRichardson/formed/pkg/fs"
+	"github.com/SimonRichardson/formed/pkg/history"
 	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/SimonRichardson/formed/pkg/schema"
+	"github.com/SimonRichardson/formed/pkg/store"
 	"github.com/SimonRichardson/formed/pkg/store/mock_store"
 	"github.com/SimonRichardson/formed/pkg/templates"
 	"github.com/go-kit/kit/log"
 	"github.com/golang/mock/gomock"
 )
 
+var testForm = forms.Form{
+	Name:   "people",
+	Title:  "People",
+	Path:   "/query/people",
+	Schema: schema.Default(),
+}
+
+var testProtector = csrf.New([]byte("key"), csrf.Config{})
+
 const (
-	formKeyFirstName = "people[][firstname]"
-	formKeySurname   = "people[][surname]"
+	formKeyID        = "people[0][id]"
+	formKeyFirstName = "people[0][firstname]"
+	formKeySurname   = "people[0][surname]"
 )
 
 func TestAPIGet(t *testing.T) {
@@ -36,18 +52,20 @@ func TestAPIGet(t *testing.T) {
 		defer ctrl.Finish()
 
 		var (
-			store    = mock_store.NewMockStore(ctrl)
-			injector = NewInjector(store, templates)
-			api      = NewAPI(injector, log.NewNopLogger())
-			server   = httptest.NewServer(api)
+			mockStore = mock_store.NewMockStore(ctrl)
+			injector  = NewInjector(testForm, newHistory(t, mockStore), testProtector, templates, templates)
+			api       = NewAPI(injector, log.NewNopLogger())
+			server    = httptest.NewServer(api)
 
 			u = fmt.Sprintf("%s/", server.URL)
 		)
 		defer server.Close()
 
-		store.EXPECT().
-			Read().
-			Return([]models.User{models.User{"fred", "smith"}}, nil)
+		mockStore.EXPECT().
+			Scan(gomock.Any()).
+			DoAndReturn(func(fn func(models.User) error) (store.Version, error) {
+				return store.Version("abc"), fn(models.User{Fields: models.Fields{"firstname": "fred", "surname": "smith"}})
+			})
 
 		res, err := request("GET", u, nil)
 		if err != nil {
@@ -74,27 +92,34 @@ func TestAPIPost(t *testing.T) {
 		defer ctrl.Finish()
 
 		var (
-			store    = mock_store.NewMockStore(ctrl)
-			injector = NewInjector(store, templates)
-			api      = NewAPI(injector, log.NewNopLogger())
-			server   = httptest.NewServer(api)
+			mockStore = mock_store.NewMockStore(ctrl)
+			injector  = NewInjector(testForm, newHistory(t, mockStore), testProtector, templates, templates)
+			api       = NewAPI(injector, log.NewNopLogger())
+			server    = httptest.NewServer(api)
 
 			u = fmt.Sprintf("%s/", server.URL)
 		)
 		defer server.Close()
 
-		store.EXPECT().
+		mockStore.EXPECT().
+			Read().
+			Return([]models.User{}, store.Version("abc"), nil)
+		mockStore.EXPECT().
 			Write([]models.User{
-				models.User{"fred", "bloggs"},
-			}).
-			Return(nil)
+				models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "bloggs"}},
+			}, store.AnyVersion).
+			Return(store.Version("abc"), nil)
 
 		formData := map[string][]string{
+			formKeyID:        []string{"f1"},
 			formKeyFirstName: []string{"fred"},
 			formKeySurname:   []string{"bloggs"},
 		}
 
-		res, err := request("POST", u, formData)
+		cookie, token := newSession(t)
+		formData[csrf.FormKey] = []string{token}
+
+		res, err := request("POST", u, formData, cookie)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -109,10 +134,10 @@ func TestAPIPost(t *testing.T) {
 		defer ctrl.Finish()
 
 		var (
-			store    = mock_store.NewMockStore(ctrl)
-			injector = NewInjector(store, templates)
-			api      = NewAPI(injector, log.NewNopLogger())
-			server   = httptest.NewServer(api)
+			mockStore = mock_store.NewMockStore(ctrl)
+			injector  = NewInjector(testForm, newHistory(t, mockStore), testProtector, templates, templates)
+			api       = NewAPI(injector, log.NewNopLogger())
+			server    = httptest.NewServer(api)
 
 			u = fmt.Sprintf("%s/", server.URL)
 		)
@@ -123,12 +148,15 @@ func TestAPIPost(t *testing.T) {
 			formKeySurname:   []string{""},
 		}
 
-		res, err := request("POST", u, formData)
+		cookie, token := newSession(t)
+		formData[csrf.FormKey] = []string{token}
+
+		res, err := request("POST", u, formData, cookie)
 		if err != nil {
 			t.Fatal(err)
 		}
 
-		if expected, actual := http.StatusBadRequest, res.StatusCode; expected != actual {
+		if expected, actual := http.StatusUnprocessableEntity, res.StatusCode; expected != actual {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
 		}
 	})
@@ -138,16 +166,21 @@ func TestAPIPost(t *testing.T) {
 		defer ctrl.Finish()
 
 		var (
-			store    = mock_store.NewMockStore(ctrl)
-			injector = NewInjector(store, templates)
-			api      = NewAPI(injector, log.NewNopLogger())
-			server   = httptest.NewServer(api)
+			mockStore = mock_store.NewMockStore(ctrl)
+			injector  = NewInjector(testForm, newHistory(t, mockStore), testProtector, templates, templates)
+			api       = NewAPI(injector, log.NewNopLogger())
+			server    = httptest.NewServer(api)
 
 			u = fmt.Sprintf("%s/", server.URL)
 		)
 		defer server.Close()
 
-		res, err := request("POST", u, nil)
+		cookie, token := newSession(t)
+		formData := map[string][]string{
+			csrf.FormKey: []string{token},
+		}
+
+		res, err := request("POST", u, formData, cookie)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -156,6 +189,36 @@ func TestAPIPost(t *testing.T) {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
 		}
 	})
+
+	t.Run("missing token", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore = mock_store.NewMockStore(ctrl)
+			injector  = NewInjector(testForm, newHistory(t, mockStore), testProtector, templates, templates)
+			api       = NewAPI(injector, log.NewNopLogger())
+			server    = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/", server.URL)
+		)
+		defer server.Close()
+
+		formData := map[string][]string{
+			formKeyID:        []string{"f1"},
+			formKeyFirstName: []string{"fred"},
+			formKeySurname:   []string{"bloggs"},
+		}
+
+		res, err := request("POST", u, formData)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusForbidden, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
 }
 
 func TestAPINotFound(t *testing.T) {
@@ -172,10 +235,10 @@ func TestAPINotFound(t *testing.T) {
 		defer ctrl.Finish()
 
 		var (
-			store    = mock_store.NewMockStore(ctrl)
-			injector = NewInjector(store, templates)
-			api      = NewAPI(injector, log.NewNopLogger())
-			server   = httptest.NewServer(api)
+			mockStore = mock_store.NewMockStore(ctrl)
+			injector  = NewInjector(testForm, newHistory(t, mockStore), testProtector, templates, templates)
+			api       = NewAPI(injector, log.NewNopLogger())
+			server    = httptest.NewServer(api)
 
 			u = fmt.Sprintf("%s/bad", server.URL)
 		)
@@ -192,7 +255,93 @@ func TestAPINotFound(t *testing.T) {
 	})
 }
 
-func request(method, url string, formData map[string][]string) (*http.Response, error) {
+func TestAPIJSON(t *testing.T) {
+	t.Parallel()
+
+	fallback, err := templates.NewErrorTemplate(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates := templates.NewTemplates(fallback)
+
+	for _, testcase := range []struct {
+		name, method, path, accept string
+		read                       bool
+		code                       int
+	}{
+		{"negotiated list", "GET", "/", "application/json", true, http.StatusOK},
+		{"negotiated not found", "GET", "/bad", "application/json", false, http.StatusNotFound},
+		{"list", "GET", "/api/v1/users", "", true, http.StatusOK},
+		{"get", "GET", "/api/v1/users/f1", "", true, http.StatusOK},
+		{"get missing", "GET", "/api/v1/users/j2", "", true, http.StatusNotFound},
+		{"nested path", "GET", "/api/v1/users/f1/bad", "", false, http.StatusNotFound},
+		{"collection method not allowed", "DELETE", "/api/v1/users", "", false, http.StatusMethodNotAllowed},
+		{"user method not allowed", "POST", "/api/v1/users/f1", "", false, http.StatusMethodNotAllowed},
+		{"export", "GET", "/api/v1/export?format=json", "", true, http.StatusOK},
+		{"import method not allowed", "GET", "/api/v1/import", "", false, http.StatusMethodNotAllowed},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var (
+				mockStore = mock_store.NewMockStore(ctrl)
+				injector  = NewInjector(testForm, newHistory(t, mockStore), testProtector, templates, templates)
+				api       = NewAPI(injector, log.NewNopLogger())
+				server    = httptest.NewServer(api)
+			)
+			defer server.Close()
+
+			if testcase.read {
+				mockStore.EXPECT().
+					Read().
+					Return([]models.User{models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}}}, store.Version("abc"), nil)
+			}
+
+			req, err := http.NewRequest(testcase.method, server.URL+testcase.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if testcase.accept != "" {
+				req.Header.Set("Accept", testcase.accept)
+			}
+
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if expected, actual := testcase.code, res.StatusCode; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+			if expected, actual := "application/json; charset=utf-8", res.Header.Get("Content-Type"); expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		})
+	}
+}
+
+func newHistory(t *testing.T, s store.Store) *history.History {
+	h, err := history.New(s, fs.New(), "", store.DefaultLockTimeout, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// newSession starts a session, returning the cookie of the session along with
+// its token.
+func newSession(t *testing.T) (*http.Cookie, string) {
+	recorder := httptest.NewRecorder()
+	token, err := testProtector.Token(recorder, httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return recorder.Result().Cookies()[0], token
+}
+
+func request(method, url string, formData map[string][]string, cookies ...*http.Cookie) (*http.Response, error) {
 	var body io.Reader
 	if formData != nil {
 		values := []string{}
@@ -211,6 +360,9 @@ func request(method, url string, formData map[string][]string) (*http.Response,
 	if formData != nil {
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
 
 	client := &http.Client{}
 	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
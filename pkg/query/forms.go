@@ -0,0 +1,88 @@
+package query
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/SimonRichardson/formed/pkg/controllers"
+	"github.com/SimonRichardson/formed/pkg/forms"
+	"github.com/SimonRichardson/formed/pkg/templates"
+)
+
+// Forms serves an index of all the forms, along with the API of each form
+// under the name of the form, i.e. /people/api/v1/users.
+type Forms struct {
+	forms     []forms.Form
+	apis      map[string]formAPI
+	templates *templates.Templates
+}
+
+type formAPI struct {
+	form    forms.Form
+	handler http.Handler
+}
+
+// NewForms creates a Forms with no forms, the templates are used to render
+// the index.
+func NewForms(templates *templates.Templates) *Forms {
+	return &Forms{
+		apis:      make(map[string]formAPI),
+		templates: templates,
+	}
+}
+
+// Add serves the API for the form, under the name of the form.
+func (f *Forms) Add(form forms.Form, api http.Handler) {
+	f.forms = append(f.forms, form)
+	sort.Slice(f.forms, func(i, j int) bool {
+		return f.forms[i].Name < f.forms[j].Name
+	})
+	f.apis[form.Name] = formAPI{
+		form:    form,
+		handler: http.StripPrefix("/"+form.Name, api),
+	}
+}
+
+func (f *Forms) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+
+	name, rest := path, ""
+	if index := strings.Index(path, "/"); index >= 0 {
+		name, rest = path[:index], path[index:]
+	}
+
+	ctrl := f.newController(w, r)
+	if name == "" {
+		setRoute(r, "", routeIndex)
+		switch r.Method {
+		case "GET":
+			ctrl.List()
+		default:
+			ctrl.NotFound()
+		}
+		return
+	}
+
+	api, ok := f.apis[name]
+	if !ok {
+		ctrl.NotFound()
+		return
+	}
+
+	// The form itself is always found under a trailing slash.
+	if rest == "" {
+		setRoute(r, api.form.Name, routeForm)
+		http.Redirect(w, r, api.form.Path+"/", http.StatusMovedPermanently)
+		return
+	}
+
+	api.handler.ServeHTTP(w, r)
+}
+
+func (f *Forms) newController(w http.ResponseWriter, r *http.Request) controllers.IndexController {
+	if acceptsJSON(r) {
+		return controllers.NewIndexAPI(f.forms, w, r)
+	}
+	return controllers.NewIndex(f.forms, f.templates, w, r)
+}
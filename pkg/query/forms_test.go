@@ -0,0 +1,91 @@
+package query
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/SimonRichardson/formed/pkg/forms"
+	"github.com/SimonRichardson/formed/pkg/templates"
+)
+
+func TestForms(t *testing.T) {
+	t.Parallel()
+
+	fallback, err := templates.NewErrorTemplate(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := templates.NewIndexTemplate(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates := templates.NewTemplates(fallback)
+	templates.Set(http.StatusOK, index)
+
+	// Each form echoes the path it was asked for, so the routing can be seen.
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s:%s", name, r.URL.Path)
+		})
+	}
+
+	f := NewForms(templates)
+	f.Add(forms.Form{Name: "people", Title: "People", Path: "/query/people"}, handler("people"))
+	f.Add(forms.Form{Name: "pets", Title: "Pets", Path: "/query/pets"}, handler("pets"))
+
+	server := httptest.NewServer(http.StripPrefix("/query", f))
+	defer server.Close()
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	for _, testcase := range []struct {
+		name, path, accept string
+		code               int
+		body               string
+	}{
+		{"index", "/query/", "", http.StatusOK, `href="/query/pets/"`},
+		{"index as json", "/query/", mimeJSON, http.StatusOK, `"name":"people"`},
+		{"form", "/query/people/", "", http.StatusOK, "people:/"},
+		{"form api", "/query/pets/api/v1/users/1", "", http.StatusOK, "pets:/api/v1/users/1"},
+		{"missing trailing slash", "/query/pets", "", http.StatusMovedPermanently, ""},
+		{"unknown form", "/query/cars/", "", http.StatusNotFound, ""},
+	} {
+		req, err := http.NewRequest("GET", server.URL+testcase.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if testcase.accept != "" {
+			req.Header.Set("Accept", testcase.accept)
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := testcase.code, res.StatusCode; expected != actual {
+			t.Errorf("%s: expected: %v, actual: %v", testcase.name, expected, actual)
+		}
+		if expected, actual := true, strings.Contains(string(body), testcase.body); expected != actual {
+			t.Errorf("%s: expected: %q in %q", testcase.name, testcase.body, body)
+		}
+		if testcase.code == http.StatusMovedPermanently {
+			if expected, actual := "/query/pets/", res.Header.Get("Location"); expected != actual {
+				t.Errorf("%s: expected: %v, actual: %v", testcase.name, expected, actual)
+			}
+		}
+	}
+}
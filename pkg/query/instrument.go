@@ -0,0 +1,159 @@
+package query
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/go-kit/kit/metrics"
+)
+
+// RequestIDHeader holds the id of a request, an id sent by the client (i.e.
+// a reverse proxy) is kept, otherwise a new one is made. Either way it's sent
+// back in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength stops a client from filling the logs with a huge id.
+const maxRequestIDLength = 64
+
+// Routes are used to label requests, rather than the paths, so that the ids
+// within the paths don't create a new label every time.
+const (
+	routeUnknown   = "unknown"
+	routeIndex     = "index"
+	routeForm      = "form"
+	routeUsers     = "users"
+	routeUser      = "user"
+	routeRevisions = "revisions"
+	routeRevision  = "revision"
+	routeRestore   = "restore"
+	routeImport    = "import"
+	routeExport    = "export"
+)
+
+// Metrics are recorded for every request that is served. Both are labelled by
+// the form, the route, the method and the status code of the response.
+type Metrics struct {
+	// Requests counts every request.
+	Requests metrics.Counter
+
+	// Duration observes how long every request took, in seconds.
+	Duration metrics.Histogram
+}
+
+// Instrument logs every request served by next, along with recording the
+// metrics for it.
+func Instrument(next http.Handler, m Metrics, logger log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		begin := time.Now()
+
+		// The id is passed on to the handlers and sent back to the client.
+		id := requestID(r.Header.Get(RequestIDHeader))
+		r.Header.Set(RequestIDHeader, id)
+		w.Header().Set(RequestIDHeader, id)
+
+		// The route is filled in as the request is routed.
+		route := &requestRoute{name: routeUnknown}
+		r = r.WithContext(context.WithValue(r.Context(), routeKey{}, route))
+
+		// The path is taken up front, as it's stripped as the request is
+		// routed.
+		method, path := r.Method, r.URL.Path
+
+		iw := &interceptingWriter{code: http.StatusOK, ResponseWriter: w}
+		next.ServeHTTP(iw, r)
+
+		duration := time.Since(begin)
+		level.Info(logger).Log(
+			"method", method,
+			"path", path,
+			"status", iw.code,
+			"bytes", iw.written,
+			"duration", duration,
+			"remote_addr", r.RemoteAddr,
+			"request_id", id,
+		)
+
+		labels := []string{
+			"form", route.form,
+			"route", route.name,
+			"method", methodLabel(method),
+			"code", strconv.Itoa(iw.code),
+		}
+		m.Requests.With(labels...).Add(1)
+		m.Duration.With(labels...).Observe(duration.Seconds())
+	})
+}
+
+type routeKey struct{}
+
+type requestRoute struct {
+	form, name string
+}
+
+// setRoute records the form and the route that the request was routed to.
+func setRoute(r *http.Request, form, name string) {
+	if route, ok := r.Context().Value(routeKey{}).(*requestRoute); ok {
+		route.form, route.name = form, name
+	}
+}
+
+// requestID returns the id sent by the client if it's safe to log, otherwise
+// a new one.
+func requestID(id string) string {
+	if id != "" && len(id) <= maxRequestIDLength && validRequestID(id) {
+		return id
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "-"
+	}
+	return hex.EncodeToString(b)
+}
+
+func validRequestID(id string) bool {
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// methodLabel stops a client from creating a new label for every made up
+// method.
+func methodLabel(method string) string {
+	switch method {
+	case "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS":
+		return method
+	}
+	return "other"
+}
+
+// interceptingWriter holds on to the status code and the number of bytes
+// written, so that they can be logged once the request has been served.
+type interceptingWriter struct {
+	code    int
+	written int
+	http.ResponseWriter
+}
+
+func (iw *interceptingWriter) WriteHeader(code int) {
+	iw.code = code
+	iw.ResponseWriter.WriteHeader(code)
+}
+
+func (iw *interceptingWriter) Write(b []byte) (int, error) {
+	n, err := iw.ResponseWriter.Write(b)
+	iw.written += n
+	return n, err
+}
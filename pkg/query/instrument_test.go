@@ -0,0 +1,152 @@
+package query
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/SimonRichardson/formed/pkg/store"
+	"github.com/SimonRichardson/formed/pkg/templates"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+)
+
+func TestInstrument(t *testing.T) {
+	t.Parallel()
+
+	fallback, err := templates.NewErrorTemplate(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates := templates.NewTemplates(fallback)
+
+	var (
+		buf      bytes.Buffer
+		requests = &recorded{}
+		injector = NewInjector(testForm, newHistory(t, store.NewMemory()), testProtector, templates, templates)
+		index    = NewForms(templates)
+	)
+	index.Add(testForm, NewAPI(injector, log.NewNopLogger()))
+
+	handler := Instrument(http.StripPrefix("/query", index), Metrics{
+		Requests: requests,
+		Duration: discard.NewHistogram(),
+	}, log.NewLogfmtLogger(&buf))
+
+	for _, testcase := range []struct {
+		name, method, path, requestID string
+		labels                        string
+	}{
+		{"index", "GET", "/query/", "", "form=,route=index,method=GET,code=200"},
+		{"redirect", "GET", "/query/people", "", "form=people,route=form,method=GET,code=301"},
+		{"users", "GET", "/query/people/api/v1/users", "abc-123", "form=people,route=users,method=GET,code=200"},
+		{"user", "DELETE", "/query/people/api/v1/users/1", "", "form=people,route=user,method=DELETE,code=404"},
+		{"restore", "POST", "/query/people/api/v1/history/1/restore", "", "form=people,route=restore,method=POST,code=404"},
+		{"unknown", "BREW", "/query/people/coffee", "", "form=people,route=unknown,method=other,code=404"},
+	} {
+		buf.Reset()
+
+		req := httptest.NewRequest(testcase.method, testcase.path, nil)
+		req.Header.Set("Accept", mimeJSON)
+		req.Header.Set("X-Requested-With", "XMLHttpRequest")
+		if testcase.requestID != "" {
+			req.Header.Set(RequestIDHeader, testcase.requestID)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		id := recorder.Header().Get(RequestIDHeader)
+		if testcase.requestID != "" {
+			if expected, actual := testcase.requestID, id; expected != actual {
+				t.Errorf("%s: expected: %v, actual: %v", testcase.name, expected, actual)
+			}
+		} else if id == "" {
+			t.Errorf("%s: expected a request id", testcase.name)
+		}
+
+		if expected, actual := testcase.labels, requests.last(); expected != actual {
+			t.Errorf("%s: expected: %v, actual: %v", testcase.name, expected, actual)
+		}
+
+		line := buf.String()
+		for _, field := range []string{
+			"method=" + testcase.method,
+			"path=" + testcase.path,
+			"request_id=" + id,
+			"bytes=",
+			"duration=",
+		} {
+			if !strings.Contains(line, field) {
+				t.Errorf("%s: expected: %q in %q", testcase.name, field, line)
+			}
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		id   string
+		kept bool
+	}{
+		{"abc-123", true},
+		{"9f1c:2.a_b", true},
+		{"", false},
+		{"has space", false},
+		{"new\nline", false},
+		{strings.Repeat("a", maxRequestIDLength+1), false},
+	} {
+		if expected, actual := testcase.kept, requestID(testcase.id) == testcase.id; expected != actual {
+			t.Errorf("%q: expected: %v, actual: %v", testcase.id, expected, actual)
+		}
+	}
+}
+
+// recorded remembers the labels of every count that was added.
+type recorded struct {
+	mutex  sync.Mutex
+	values []string
+}
+
+func (r *recorded) With(labelValues ...string) metrics.Counter {
+	return labelled{r, labelValues}
+}
+
+func (r *recorded) Add(float64) { r.record(nil) }
+
+func (r *recorded) record(labelValues []string) {
+	var pairs []string
+	for i := 0; i+1 < len(labelValues); i += 2 {
+		pairs = append(pairs, labelValues[i]+"="+labelValues[i+1])
+	}
+
+	r.mutex.Lock()
+	r.values = append(r.values, strings.Join(pairs, ","))
+	r.mutex.Unlock()
+}
+
+func (r *recorded) last() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(r.values) == 0 {
+		return ""
+	}
+	return r.values[len(r.values)-1]
+}
+
+type labelled struct {
+	recorded    *recorded
+	labelValues []string
+}
+
+func (l labelled) With(labelValues ...string) metrics.Counter {
+	return labelled{l.recorded, append(append([]string(nil), l.labelValues...), labelValues...)}
+}
+
+func (l labelled) Add(float64) { l.recorded.record(l.labelValues) }
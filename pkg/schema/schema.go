@@ -0,0 +1,401 @@
+package schema
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/SimonRichardson/formed/pkg/fs"
+	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Type describes the kind of value a field holds, which also decides how the
+// field is rendered in the form.
+type Type string
+
+// The types of field that a schema can declare.
+const (
+	Text     Type = "text"
+	Email    Type = "email"
+	Number   Type = "number"
+	Date     Type = "date"
+	Select   Type = "select"
+	Checkbox Type = "checkbox"
+)
+
+// DateLayout is the layout dates are expected in, which is the same layout
+// that browsers submit for a date input.
+const DateLayout = "2006-01-02"
+
+// validName keeps the names of fields safe to use as form keys and csv
+// columns.
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Schema describes the fields of the form, from which the columns of the
+// store, the decoding of the form and the validation of users are derived.
+type Schema struct {
+	Name   string  `json:"name" yaml:"name"`
+	Fields []Field `json:"fields" yaml:"fields"`
+}
+
+// Field describes a single value held by every user.
+// Min and Max bound the value of number and date fields, for text and email
+// fields they bound the length of the value.
+type Field struct {
+	Name     string   `json:"name" yaml:"name"`
+	Label    string   `json:"label,omitempty" yaml:"label,omitempty"`
+	Type     Type     `json:"type,omitempty" yaml:"type,omitempty"`
+	Required bool     `json:"required,omitempty" yaml:"required,omitempty"`
+	Regex    string   `json:"regex,omitempty" yaml:"regex,omitempty"`
+	Min      string   `json:"min,omitempty" yaml:"min,omitempty"`
+	Max      string   `json:"max,omitempty" yaml:"max,omitempty"`
+	Options  []string `json:"options,omitempty" yaml:"options,omitempty"`
+
+	regex *regexp.Regexp
+}
+
+// Default returns the schema used when none is supplied, a required first
+// name and surname.
+func Default() Schema {
+	return Schema{
+		Name: "people",
+		Fields: []Field{
+			Field{Name: "firstname", Label: "First name", Type: Text, Required: true},
+			Field{Name: "surname", Label: "Last name", Type: Text, Required: true},
+		},
+	}
+}
+
+// Load reads the schema from the file found at path. The file can either be
+// YAML or JSON.
+func Load(fsys fs.Filesystem, path string) (Schema, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return Schema{}, errors.Wrapf(err, "unable to open schema at %q", path)
+	}
+	defer file.Close()
+
+	b, err := ioutil.ReadAll(file)
+	if err != nil {
+		return Schema{}, errors.Wrapf(err, "unable to read schema at %q", path)
+	}
+
+	s, err := Parse(b)
+	if err != nil {
+		return Schema{}, errors.Wrapf(err, "invalid schema at %q", path)
+	}
+	return s, nil
+}
+
+// Parse reads the schema from YAML, or JSON as it's a subset of YAML, and
+// checks that the schema itself is valid.
+func Parse(b []byte) (Schema, error) {
+	var s Schema
+	if err := yaml.UnmarshalStrict(b, &s); err != nil {
+		return Schema{}, err
+	}
+	if err := s.compile(); err != nil {
+		return Schema{}, err
+	}
+	return s, nil
+}
+
+// Columns returns the names of all the fields, in the order they were
+// declared.
+func (s Schema) Columns() []string {
+	res := make([]string, len(s.Fields))
+	for k, v := range s.Fields {
+		res[k] = v.Name
+	}
+	return res
+}
+
+// Field returns the field for the name.
+func (s Schema) Field(name string) (Field, bool) {
+	for _, v := range s.Fields {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return Field{}, false
+}
+
+// New returns a user with an empty value for every field.
+func (s Schema) New() models.User {
+	user := models.User{Fields: make(models.Fields, len(s.Fields))}
+	for _, v := range s.Fields {
+		user.Fields[v.Name] = ""
+	}
+	return user
+}
+
+// Check checks the user found at row against every field of the schema,
+// returning a violation for every field that isn't valid. Values for fields
+// that aren't in the schema are also a violation.
+func (s Schema) Check(row int, user models.User) []Violation {
+	var violations []Violation
+
+	unexpected := make([]string, 0)
+	for name := range user.Fields {
+		if _, ok := s.Field(name); !ok {
+			unexpected = append(unexpected, name)
+		}
+	}
+	sort.Strings(unexpected)
+	for _, name := range unexpected {
+		violations = append(violations, Violation{
+			Row:     row,
+			Field:   name,
+			Rule:    RuleUnexpected,
+			Message: fmt.Sprintf("unexpected field %q", name),
+		})
+	}
+
+	for _, v := range s.Fields {
+		if violation, ok := v.Check(user.Get(v.Name)); !ok {
+			violation.Row = row
+			violations = append(violations, violation)
+		}
+	}
+	return violations
+}
+
+// ValidateRow checks the user found at row against the schema, returning a
+// ValidationError holding every violation if the user isn't valid.
+func (s Schema) ValidateRow(row int, user models.User) error {
+	if violations := s.Check(row, user); len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+// Validate checks all the users against the schema, the row of each violation
+// is the index of the user. A ValidationError holding every violation is
+// returned if any of the users aren't valid.
+func (s Schema) Validate(users ...models.User) error {
+	var violations []Violation
+	for k, v := range users {
+		violations = append(violations, s.Check(k, v)...)
+	}
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+// Check checks the value against the constraints of the field. If the value
+// isn't valid then the violation is returned along with false, the row of the
+// violation is left for the caller to fill in.
+func (f Field) Check(value string) (Violation, bool) {
+	violation := func(rule, format string, args ...interface{}) (Violation, bool) {
+		return Violation{
+			Field:   f.Name,
+			Rule:    rule,
+			Message: fmt.Sprintf(format, args...),
+		}, false
+	}
+
+	if value == "" {
+		if f.Required && f.Type == Checkbox {
+			return violation(RuleRequired, "expected %s to be checked", f.Label)
+		}
+		if f.Required {
+			return violation(RuleRequired, "expected %s to not be empty", f.Label)
+		}
+		return Violation{}, true
+	}
+
+	switch f.Type {
+	case Email:
+		if address, err := mail.ParseAddress(value); err != nil || address.Address != value {
+			return violation(RuleType, "expected %s to be an email address", f.Label)
+		}
+	case Number:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return violation(RuleType, "expected %s to be a number", f.Label)
+		}
+	case Date:
+		if _, err := time.Parse(DateLayout, value); err != nil {
+			return violation(RuleType, "expected %s to be a date (%s)", f.Label, DateLayout)
+		}
+	case Select:
+		if !contains(f.Options, value) {
+			return violation(RuleOptions, "expected %s to be one of %q", f.Label, f.Options)
+		}
+	case Checkbox:
+		if value != "true" && value != "false" {
+			return violation(RuleType, "expected %s to be true or false", f.Label)
+		}
+		if f.Required && value != "true" {
+			return violation(RuleRequired, "expected %s to be checked", f.Label)
+		}
+	}
+
+	if f.Regex != "" {
+		regex, err := f.compileRegex()
+		if err != nil {
+			return violation(RuleRegex, "%s", err.Error())
+		}
+		if !regex.MatchString(value) {
+			return violation(RuleRegex, "expected %s to match %q", f.Label, f.Regex)
+		}
+	}
+
+	if f.Min != "" {
+		if cmp, err := f.compare(value, f.Min); err != nil {
+			return violation(RuleMin, "%s", err.Error())
+		} else if cmp < 0 {
+			return violation(RuleMin, "expected %s to be at least %s", f.Label, f.Min)
+		}
+	}
+	if f.Max != "" {
+		if cmp, err := f.compare(value, f.Max); err != nil {
+			return violation(RuleMax, "%s", err.Error())
+		} else if cmp > 0 {
+			return violation(RuleMax, "expected %s to be at most %s", f.Label, f.Max)
+		}
+	}
+
+	return Violation{}, true
+}
+
+// Validate checks the value against the constraints of the field.
+func (f Field) Validate(value string) error {
+	if violation, ok := f.Check(value); !ok {
+		return &ValidationError{Violations: []Violation{violation}}
+	}
+	return nil
+}
+
+// compare compares the value with the limit, numbers and dates are compared by
+// their value, anything else is compared by the length of the value.
+func (f Field) compare(value, limit string) (int, error) {
+	switch f.Type {
+	case Number:
+		a, _ := strconv.ParseFloat(value, 64)
+		b, err := strconv.ParseFloat(limit, 64)
+		if err != nil {
+			return 0, errors.Errorf("invalid limit %q for %s", limit, f.Name)
+		}
+		return compareFloat(a, b), nil
+	case Date:
+		a, _ := time.Parse(DateLayout, value)
+		b, err := time.Parse(DateLayout, limit)
+		if err != nil {
+			return 0, errors.Errorf("invalid limit %q for %s", limit, f.Name)
+		}
+		return compareFloat(float64(a.Unix()), float64(b.Unix())), nil
+	default:
+		b, err := strconv.Atoi(limit)
+		if err != nil {
+			return 0, errors.Errorf("invalid limit %q for %s", limit, f.Name)
+		}
+		return compareFloat(float64(utf8.RuneCountInString(value)), float64(b)), nil
+	}
+}
+
+func (f Field) compileRegex() (*regexp.Regexp, error) {
+	if f.regex != nil {
+		return f.regex, nil
+	}
+	regex, err := regexp.Compile(f.Regex)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid regex for %s", f.Name)
+	}
+	return regex, nil
+}
+
+// compile fills in the defaults of every field and makes sure the fields are
+// valid, so that a mistake in the schema is found when it's loaded rather than
+// when a user is validated.
+func (s *Schema) compile() error {
+	if len(s.Fields) == 0 {
+		return errors.New("expected at least one field")
+	}
+
+	names := make(map[string]struct{}, len(s.Fields))
+	for k := range s.Fields {
+		f := &s.Fields[k]
+
+		if f.Name == "" {
+			return errors.Errorf("fields[%d].name: expected a name", k)
+		}
+		if !validName.MatchString(f.Name) {
+			return errors.Errorf("fields[%d].name: expected only letters, digits, - or _ in %q", k, f.Name)
+		}
+		if f.Name == "id" {
+			return errors.Errorf("fields[%d].name: %q is reserved", k, f.Name)
+		}
+		if _, ok := names[f.Name]; ok {
+			return errors.Errorf("fields[%d].name: duplicate field %q", k, f.Name)
+		}
+		names[f.Name] = struct{}{}
+
+		if f.Label == "" {
+			f.Label = f.Name
+		}
+		if f.Type == "" {
+			f.Type = Text
+		}
+
+		switch f.Type {
+		case Text, Email, Number, Date:
+		case Select:
+			if len(f.Options) == 0 {
+				return errors.Errorf("fields[%d].options: expected options for select %q", k, f.Name)
+			}
+		case Checkbox:
+			if f.Min != "" || f.Max != "" {
+				return errors.Errorf("fields[%d]: min and max are not supported for checkbox %q", k, f.Name)
+			}
+		default:
+			return errors.Errorf("fields[%d].type: unknown type %q", k, f.Type)
+		}
+
+		if f.Regex != "" {
+			regex, err := regexp.Compile(f.Regex)
+			if err != nil {
+				return errors.Wrapf(err, "fields[%d].regex", k)
+			}
+			f.regex = regex
+		}
+		for _, limit := range []struct{ key, value string }{
+			{"min", f.Min},
+			{"max", f.Max},
+		} {
+			if limit.value == "" {
+				continue
+			}
+			if _, err := f.compare("", limit.value); err != nil {
+				return errors.Errorf("fields[%d].%s: invalid limit %q for %s", k, limit.key, limit.value, f.Type)
+			}
+		}
+	}
+	return nil
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,258 @@
+package schema
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SimonRichardson/formed/pkg/fs"
+	"github.com/SimonRichardson/formed/pkg/models"
+)
+
+const testSchema = `
+name: signups
+fields:
+  - name: name
+    label: Name
+    required: true
+    max: 10
+  - name: email
+    type: email
+  - name: age
+    type: number
+    min: 18
+    max: 120
+  - name: born
+    type: date
+    min: 1900-01-01
+  - name: size
+    type: select
+    options: [small, medium, large]
+  - name: subscribed
+    type: checkbox
+  - name: code
+    regex: ^[A-Z]{3}$
+`
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	t.Run("yaml", func(t *testing.T) {
+		s, err := Parse([]byte(testSchema))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := "signups", s.Name; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		want := []string{"name", "email", "age", "born", "size", "subscribed", "code"}
+		if expected, actual := want, s.Columns(); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		// Defaults are filled in for anything that's missing.
+		field, ok := s.Field("code")
+		if !ok {
+			t.Fatal("expected: code field")
+		}
+		if expected, actual := Text, field.Type; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := "code", field.Label; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		s, err := Parse([]byte(`{"fields": [{"name": "age", "type": "number", "min": 18}]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := Field{Name: "age", Label: "age", Type: Number, Min: "18"}
+		if expected, actual := want, s.Fields[0]; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	for _, testcase := range []struct {
+		name, schema, key string
+	}{
+		{"no fields", `name: empty`, "at least one field"},
+		{"unknown key", "fields:\n  - name: a\n    colour: red", "colour"},
+		{"no name", "fields:\n  - label: A", "fields[0].name"},
+		{"invalid name", "fields:\n  - name: a b", "fields[0].name"},
+		{"reserved name", "fields:\n  - name: id", "fields[0].name"},
+		{"duplicate name", "fields:\n  - name: a\n  - name: a", "fields[1].name"},
+		{"unknown type", "fields:\n  - name: a\n    type: colour", "fields[0].type"},
+		{"select without options", "fields:\n  - name: a\n    type: select", "fields[0].options"},
+		{"invalid regex", "fields:\n  - name: a\n    regex: '['", "fields[0].regex"},
+		{"invalid min", "fields:\n  - name: a\n    type: number\n    min: lots", "fields[0].min"},
+		{"invalid max", "fields:\n  - name: a\n    type: date\n    max: tomorrow", "fields[0].max"},
+	} {
+		_, err := Parse([]byte(testcase.schema))
+		if err == nil {
+			t.Errorf("%s: expected: error", testcase.name)
+			continue
+		}
+		if expected, actual := true, strings.Contains(err.Error(), testcase.key); expected != actual {
+			t.Errorf("%s: expected: %q in %q", testcase.name, testcase.key, err.Error())
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "schema.yaml")
+	if err := ioutil.WriteFile(path, []byte(testSchema), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Load(fs.New(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 7, len(s.Fields); expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+
+	_, err = Load(fs.New(), filepath.Join(dir, "missing.yaml"))
+	if expected, actual := true, err != nil; expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	s, err := Parse([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := func() models.User {
+		user := s.New()
+		user.Set("name", "fred")
+		return user
+	}
+
+	for _, testcase := range []struct {
+		name, field, value string
+		valid              bool
+	}{
+		{"valid", "name", "fred", true},
+		{"required", "name", "", false},
+		{"too long", "name", "frederick the great", false},
+		{"email", "email", "fred@example.com", true},
+		{"not an email", "email", "fred", false},
+		{"email with a name", "email", "Fred <fred@example.com>", false},
+		{"number", "age", "42", true},
+		{"not a number", "age", "forty two", false},
+		{"too young", "age", "17", false},
+		{"too old", "age", "121", false},
+		{"date", "born", "1980-06-28", true},
+		{"not a date", "born", "28/06/1980", false},
+		{"too early", "born", "1899-12-31", false},
+		{"option", "size", "medium", true},
+		{"not an option", "size", "huge", false},
+		{"checked", "subscribed", "true", true},
+		{"unchecked", "subscribed", "false", true},
+		{"not a checkbox", "subscribed", "yes", false},
+		{"matches", "code", "ABC", true},
+		{"doesn't match", "code", "abc", false},
+		{"unexpected field", "colour", "red", false},
+	} {
+		user := valid()
+		user.Set(testcase.field, testcase.value)
+
+		err := s.Validate(user)
+		if expected, actual := testcase.valid, err == nil; expected != actual {
+			t.Errorf("%s: expected: %v, actual: %v (%v)", testcase.name, expected, actual, err)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	s, err := Parse([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := s.New()
+	user.Set("email", "fred")
+	user.Set("age", "17")
+	user.Set("colour", "red")
+
+	want := []Violation{
+		Violation{Row: 3, Field: "colour", Rule: RuleUnexpected, Message: `unexpected field "colour"`},
+		Violation{Row: 3, Field: "name", Rule: RuleRequired, Message: "expected Name to not be empty"},
+		Violation{Row: 3, Field: "email", Rule: RuleType, Message: "expected email to be an email address"},
+		Violation{Row: 3, Field: "age", Rule: RuleMin, Message: "expected age to be at least 18"},
+	}
+	if expected, actual := want, s.Check(3, user); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+
+	t.Run("validate numbers the rows", func(t *testing.T) {
+		valid := s.New()
+		valid.Set("name", "fred")
+
+		invalid := s.New()
+		invalid.Set("size", "huge")
+
+		validation, ok := ErrValidation(s.Validate(valid, invalid))
+		if !ok {
+			t.Fatal("expected: validation error")
+		}
+		want := []Violation{
+			Violation{Row: 1, Field: "name", Rule: RuleRequired, Message: "expected Name to not be empty"},
+			Violation{Row: 1, Field: "size", Rule: RuleOptions, Message: `expected size to be one of ["small" "medium" "large"]`},
+		}
+		if expected, actual := want, validation.Violations; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		violation, ok := validation.Find(1, "size")
+		if expected, actual := true, ok; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := RuleOptions, violation.Rule; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestDefault(t *testing.T) {
+	t.Parallel()
+
+	s := Default()
+
+	for _, testcase := range []struct {
+		name  string
+		user  models.User
+		valid bool
+	}{
+		{"valid", models.User{Fields: models.Fields{"firstname": "fred", "surname": "smith"}}, true},
+		{"empty firstname", models.User{Fields: models.Fields{"firstname": "", "surname": "smith"}}, false},
+		{"empty surname", models.User{Fields: models.Fields{"firstname": "fred", "surname": ""}}, false},
+		{"empty", s.New(), false},
+	} {
+		err := s.Validate(testcase.user)
+		if expected, actual := testcase.valid, err == nil; expected != actual {
+			t.Errorf("%s: expected: %v, actual: %v", testcase.name, expected, actual)
+		}
+	}
+}
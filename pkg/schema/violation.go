@@ -0,0 +1,64 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The rules that a value can break, so that clients can tell violations apart
+// without having to parse the message.
+const (
+	RuleRequired   = "required"
+	RuleType       = "type"
+	RuleOptions    = "options"
+	RuleRegex      = "regex"
+	RuleMin        = "min"
+	RuleMax        = "max"
+	RuleUnexpected = "unexpected"
+)
+
+// Violation describes a single field of a user that isn't valid. The row is the
+// index of the user that holds the field.
+type Violation struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("row %d: %s: %s", v.Row, v.Field, v.Message)
+}
+
+// ValidationError is returned when users are validated against a schema,
+// holding every violation that was found.
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for k, v := range e.Violations {
+		messages[k] = v.String()
+	}
+	return fmt.Sprintf("invalid users: %s", strings.Join(messages, ", "))
+}
+
+// Find returns the violation for the field at row.
+func (e *ValidationError) Find(row int, field string) (Violation, bool) {
+	for _, v := range e.Violations {
+		if v.Row == row && v.Field == field {
+			return v, true
+		}
+	}
+	return Violation{}, false
+}
+
+// ErrValidation returns the *ValidationError held within the error if there is
+// one.
+func ErrValidation(err error) (*ValidationError, bool) {
+	validation, ok := errors.Cause(err).(*ValidationError)
+	return validation, ok
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/SimonRichardson/formed/pkg/fs"
+	"github.com/SimonRichardson/formed/pkg/models"
+)
+
+var benchmarkSizes = []int{1000, 10000, 100000}
+
+// BenchmarkRead reads every user in to memory, so the heap grows with the
+// number of users held by the store.
+func BenchmarkRead(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("users=%d", size), func(b *testing.B) {
+			s := benchmarkStore(b, size)
+
+			heap := retainedHeap(func() interface{} {
+				users, _, err := s.Read()
+				if err != nil {
+					b.Fatal(err)
+				}
+				return users
+			})
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := s.Read(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(heap, "heap-B")
+		})
+	}
+}
+
+// BenchmarkReadPage reads a page from the middle of the store, the heap stays
+// the same however many users are held by the store.
+func BenchmarkReadPage(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("users=%d", size), func(b *testing.B) {
+			var (
+				s      = benchmarkStore(b, size)
+				window = Window{Offset: size / 2, Limit: 50}
+			)
+
+			heap := retainedHeap(func() interface{} {
+				page, err := ReadPage(s, window)
+				if err != nil {
+					b.Fatal(err)
+				}
+				return page
+			})
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := ReadPage(s, window); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(heap, "heap-B")
+		})
+	}
+}
+
+// benchmarkStore creates a csv store holding size users.
+func benchmarkStore(b *testing.B, size int) Store {
+	dir, err := ioutil.TempDir("", "benchmark")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { os.RemoveAll(dir) })
+
+	users := make([]models.User, size)
+	for k := range users {
+		users[k] = models.User{
+			ID: models.NewID(),
+			Fields: models.Fields{
+				"firstname": "fred" + strconv.Itoa(k),
+				"surname":   "smith",
+			},
+		}
+	}
+
+	s := New(fs.New(), filepath.Join(dir, "store.csv"), columns)
+	if _, err := s.Write(users, AnyVersion); err != nil {
+		b.Fatal(err)
+	}
+	return s
+}
+
+// retainedHeap returns how many bytes of the heap are held on to by what fn
+// returns.
+func retainedHeap(fn func() interface{}) float64 {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	res := fn()
+
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	runtime.KeepAlive(res)
+
+	return float64(int64(after.HeapAlloc) - int64(before.HeapAlloc))
+}
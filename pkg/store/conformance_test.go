@@ -0,0 +1,51 @@
+package store_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SimonRichardson/formed/pkg/fs"
+	"github.com/SimonRichardson/formed/pkg/schema"
+	"github.com/SimonRichardson/formed/pkg/store"
+	"github.com/SimonRichardson/formed/pkg/store/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, scheme := range []string{"csv", "json", "jsonl", "sqlite", "wal"} {
+		scheme := scheme
+		t.Run(scheme, func(t *testing.T) {
+			var count int
+			storetest.Test(t, func(t *testing.T) store.Store {
+				count++
+				path := filepath.Join(dir, fmt.Sprintf("%s-%d.%s", scheme, count, scheme))
+
+				s, err := store.Open(fs.New(), fmt.Sprintf("%s://%s", scheme, path), schema.Default().Columns())
+				if err != nil {
+					t.Fatal(err)
+				}
+				return s
+			})
+		})
+	}
+
+	t.Run("mem", func(t *testing.T) {
+		storetest.Test(t, func(t *testing.T) store.Store {
+			s, err := store.Open(fs.New(), "mem://", schema.Default().Columns())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		})
+	})
+}
@@ -0,0 +1,259 @@
+package store
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/pkg/errors"
+)
+
+// csvFormat is the version of the format written by the csv store, it's
+// recorded on the first line of the file so that files written in an older
+// format can be migrated when they're read.
+//
+//	0: a record of the values of the columns for each user, by position.
+//	1: as 0, but the id of the user comes first.
+//	2: a header row names the columns, which can be in any order.
+const csvFormat = 2
+
+// csvFormatPrefix starts the line recording the format of the file, i.e.
+// "#formed-csv:2".
+const csvFormatPrefix = "#formed-csv:"
+
+// csvCodec encodes the users as csv records, under a header row naming the
+// column of every value. The id of the user comes first, followed by the
+// columns of the schema.
+type csvCodec struct {
+	columns []string
+}
+
+// Decode reads the users one at a time, mapping the values to the columns by
+// the names in the header. Columns that aren't part of the schema are held as
+// the extra values of each user, so they're written back rather than lost.
+// Files written in an older format are read by position and reported as
+// outdated.
+func (c csvCodec) Decode(reader io.Reader, fn func(models.User) error) (bool, error) {
+	r := csv.NewReader(reader)
+	// The format line holds a single value, so the number of values in each
+	// record is checked against the header instead.
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+
+	record, err := r.Read()
+	if err == io.EOF {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	// A file saved by a spreadsheet can start with a byte order mark.
+	record[0] = strings.TrimPrefix(record[0], "\ufeff")
+
+	var header []string
+	if format, ok := parseCSVFormat(record); ok {
+		if format > csvFormat {
+			return false, errors.Errorf("unable to read format %d, expected format %d or older", format, csvFormat)
+		}
+		if record, err = r.Read(); err == io.EOF {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		header, record = copyRecord(record), nil
+	} else if c.isHeader(record) {
+		// A header without a format line was written by hand, or exported.
+		header, record = copyRecord(record), nil
+	}
+	if header != nil {
+		if err := checkHeader(header); err != nil {
+			return false, err
+		}
+	}
+
+	for index := 0; ; index++ {
+		if record == nil {
+			if record, err = r.Read(); err == io.EOF {
+				break
+			} else if err != nil {
+				return false, err
+			}
+		}
+
+		user, err := c.decode(header, record)
+		if err != nil {
+			return false, errors.Wrapf(err, "unable to parse user for index %d", index)
+		}
+		if err := fn(user); err != nil {
+			return false, err
+		}
+		record = nil
+	}
+
+	return header == nil, nil
+}
+
+func (c csvCodec) decode(header, record []string) (models.User, error) {
+	var user models.User
+	if header == nil {
+		// Files written before users had ids only hold the columns.
+		columns := c.withID()
+		if len(record) == len(c.columns) {
+			columns = c.columns
+		}
+		err := user.Unmarshal(columns, record)
+		return user, err
+	}
+
+	if len(record) != len(header) {
+		return user, errors.Errorf("expected %d values, actual %d", len(header), len(record))
+	}
+
+	// Every user holds every column of the schema, even those missing from
+	// the header.
+	user.Fields = make(models.Fields, len(c.columns))
+	for _, v := range c.columns {
+		user.Fields[v] = ""
+	}
+	for k, v := range header {
+		switch {
+		case v == models.IDField:
+			user.ID = record[k]
+		case c.known(v):
+			user.Fields[v] = record[k]
+		default:
+			if user.Extra == nil {
+				user.Extra = make(models.Fields)
+			}
+			user.Extra[v] = record[k]
+		}
+	}
+	return user, nil
+}
+
+// Encode writes the format line and the header, followed by a record for
+// every user. The columns of any extra values follow the columns of the
+// schema, in the order of their names.
+func (c csvCodec) Encode(writer io.Writer, users []models.User) error {
+	var (
+		extra  = c.extraColumns(users)
+		header = append(c.withID(), extra...)
+	)
+
+	w := csv.NewWriter(writer)
+	if err := w.Write([]string{csvFormatPrefix + strconv.Itoa(csvFormat)}); err != nil {
+		return err
+	}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	for k, v := range users {
+		fields, err := v.Marshal(header[:len(header)-len(extra)])
+		if err != nil {
+			return errors.Wrapf(err, "unable to marshal user at index %d", k)
+		}
+		for _, name := range extra {
+			fields = append(fields, v.Extra[name])
+		}
+		if err := w.Write(fields); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
+
+// isHeader returns true if the record names the id, or every column of the
+// schema, rather than holding the values of a user.
+func (c csvCodec) isHeader(record []string) bool {
+	names := make(map[string]struct{}, len(record))
+	for _, v := range record {
+		names[v] = struct{}{}
+	}
+	if _, ok := names[models.IDField]; ok {
+		return true
+	}
+	for _, v := range c.columns {
+		if _, ok := names[v]; !ok {
+			return false
+		}
+	}
+	return len(c.columns) > 0
+}
+
+// extraColumns returns the names of the extra values held by any of the
+// users, that aren't already columns of the schema.
+func (c csvCodec) extraColumns(users []models.User) []string {
+	seen := make(map[string]struct{})
+	for _, user := range users {
+		for name := range user.Extra {
+			if name != models.IDField && !c.known(name) {
+				seen[name] = struct{}{}
+			}
+		}
+	}
+
+	res := make([]string, 0, len(seen))
+	for name := range seen {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func (c csvCodec) known(name string) bool {
+	for _, v := range c.columns {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (c csvCodec) withID() []string {
+	return append([]string{models.IDField}, c.columns...)
+}
+
+// parseCSVFormat returns the format recorded by the record, if the record is
+// a format line. Any empty values after it are ignored, as a spreadsheet pads
+// every row to the same length.
+func parseCSVFormat(record []string) (int, bool) {
+	if len(record) == 0 || !strings.HasPrefix(record[0], csvFormatPrefix) {
+		return 0, false
+	}
+	for _, v := range record[1:] {
+		if v != "" {
+			return 0, false
+		}
+	}
+	format, err := strconv.Atoi(strings.TrimPrefix(record[0], csvFormatPrefix))
+	if err != nil || format < 0 {
+		return 0, false
+	}
+	return format, true
+}
+
+// copyRecord copies the record, as the reader reuses the same record for
+// every line.
+func copyRecord(record []string) []string {
+	return append([]string(nil), record...)
+}
+
+// checkHeader makes sure every column in the header has a name that isn't
+// used by any other column.
+func checkHeader(header []string) error {
+	seen := make(map[string]struct{}, len(header))
+	for k, v := range header {
+		if v == "" {
+			return errors.Errorf("expected a name for column %d of the header", k+1)
+		}
+		if _, ok := seen[v]; ok {
+			return errors.Errorf("duplicate column %q in the header", v)
+		}
+		seen[v] = struct{}{}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SimonRichardson/formed/pkg/models"
+)
+
+func TestCSVCodecDecode(t *testing.T) {
+	t.Parallel()
+
+	codec := csvCodec{columns: columns}
+
+	for _, testcase := range []struct {
+		name     string
+		input    string
+		users    []models.User
+		outdated bool
+	}{
+		{
+			name:  "empty",
+			input: "",
+			users: []models.User{},
+		},
+		{
+			name:  "header only",
+			input: csvHeader,
+			users: []models.User{},
+		},
+		{
+			name:  "current format",
+			input: csvHeader + "f1,fred,smith\n",
+			users: []models.User{
+				{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+			},
+		},
+		{
+			name:  "columns by name",
+			input: "#formed-csv:2\nsurname,id,firstname\nsmith,f1,fred\n",
+			users: []models.User{
+				{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+			},
+		},
+		{
+			name:  "unknown columns are kept",
+			input: "#formed-csv:2\nid,firstname,surname,age\nf1,fred,smith,42\nj2,jane,doe,\n",
+			users: []models.User{
+				{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}, Extra: models.Fields{"age": "42"}},
+				{ID: "j2", Fields: models.Fields{"firstname": "jane", "surname": "doe"}, Extra: models.Fields{"age": ""}},
+			},
+		},
+		{
+			name:  "missing columns are empty",
+			input: "#formed-csv:2\nid,firstname\nf1,fred\n",
+			users: []models.User{
+				{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": ""}},
+			},
+		},
+		{
+			name:  "format line padded by a spreadsheet",
+			input: "#formed-csv:2,,\nid,firstname,surname\nf1,fred,smith\n",
+			users: []models.User{
+				{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+			},
+		},
+		{
+			name:  "header without a format line",
+			input: "firstname,surname\nfred,smith\n",
+			users: []models.User{
+				{Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+			},
+		},
+		{
+			name:  "byte order mark",
+			input: "\ufeffid,firstname,surname\nf1,fred,smith\n",
+			users: []models.User{
+				{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+			},
+		},
+		{
+			name:  "format 1",
+			input: "f1,fred,smith\n",
+			users: []models.User{
+				{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+			},
+			outdated: true,
+		},
+		{
+			name:  "format 0",
+			input: "fred,smith\n",
+			users: []models.User{
+				{Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+			},
+			outdated: true,
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			users, outdated, err := decodeAll(codec, strings.NewReader(testcase.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected, actual := testcase.users, users; !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+			if expected, actual := testcase.outdated, outdated; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		})
+	}
+}
+
+func TestCSVCodecDecodeErrors(t *testing.T) {
+	t.Parallel()
+
+	codec := csvCodec{columns: columns}
+
+	for name, input := range map[string]string{
+		"newer format":     "#formed-csv:3\nid,firstname,surname\n",
+		"duplicate column": "#formed-csv:2\nid,firstname,firstname\n",
+		"empty column":     "#formed-csv:2\nid,,surname\n",
+		"too many values":  csvHeader + "f1,fred,smith,42\n",
+		"too few values":   csvHeader + "f1,fred\n",
+	} {
+		if _, _, err := decodeAll(codec, strings.NewReader(input)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestCSVCodecEncode(t *testing.T) {
+	t.Parallel()
+
+	var (
+		codec = csvCodec{columns: columns}
+		users = []models.User{
+			{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+			{ID: "j2", Fields: models.Fields{"firstname": "jane, jr", "surname": "doe"}, Extra: models.Fields{"nickname": "jj", "age": ""}},
+		}
+	)
+
+	var buf bytes.Buffer
+	if err := codec.Encode(&buf, users); err != nil {
+		t.Fatal(err)
+	}
+
+	// Extra values follow the columns of the schema, users without them are
+	// left empty.
+	want := "#formed-csv:2\nid,firstname,surname,age,nickname\nf1,fred,smith,,\nj2,\"jane, jr\",doe,,jj\n"
+	if expected, actual := want, buf.String(); expected != actual {
+		t.Errorf("expected: %q, actual: %q", expected, actual)
+	}
+
+	// The users read back as they were written, every user holds a value for
+	// every extra column.
+	decoded, outdated, err := decodeAll(codec, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users[0].Extra = models.Fields{"nickname": "", "age": ""}
+	if expected, actual := users, decoded; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+	if outdated {
+		t.Errorf("expected: current format")
+	}
+}
+
+// decodeAll decodes every user held by the reader.
+func decodeAll(c codec, reader io.Reader) ([]models.User, bool, error) {
+	users := make([]models.User, 0)
+	outdated, err := c.Decode(reader, func(user models.User) error {
+		users = append(users, user)
+		return nil
+	})
+	return users, outdated, err
+}
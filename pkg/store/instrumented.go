@@ -0,0 +1,101 @@
+package store
+
+import (
+	"time"
+
+	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/go-kit/kit/metrics"
+)
+
+// Metrics are recorded for every read, write and scan of an instrumented
+// store. Both are labelled by the operation ("read", "write" or "scan"), the
+// errors are also labelled by the kind of error ("conflict" or "failed").
+type Metrics struct {
+	// Duration observes how long every read, write and scan took, in seconds.
+	Duration metrics.Histogram
+
+	// Errors counts every read, write and scan that returned an error.
+	Errors metrics.Counter
+}
+
+type instrumentedStore struct {
+	store   Store
+	metrics Metrics
+	now     func() time.Time
+}
+
+// NewInstrumented creates a store that records the metrics for every read and
+// write of the store that it wraps.
+func NewInstrumented(s Store, m Metrics) Store {
+	return &instrumentedStore{
+		store:   s,
+		metrics: m,
+		now:     time.Now,
+	}
+}
+
+// Read reads all the user models from the storage along with the version
+// of what was read, or it returns an error if there issue.
+func (s *instrumentedStore) Read() ([]models.User, Version, error) {
+	defer s.observe("read", s.now())
+
+	users, version, err := s.store.Read()
+	if err != nil {
+		s.failed("read", err)
+	}
+	return users, version, err
+}
+
+// Write, writes users to the underlying storage, as long as the storage is
+// still at the version supplied. If the users have changed underneath then
+// nothing is written and a *ConflictError is returned. Passing AnyVersion
+// writes the users unconditionally. The new version is returned.
+func (s *instrumentedStore) Write(users []models.User, version Version) (Version, error) {
+	defer s.observe("write", s.now())
+
+	version, err := s.store.Write(users, version)
+	if err != nil {
+		s.failed("write", err)
+	}
+	return version, err
+}
+
+// Scan calls fn with every user held by the storage in order. If fn returns
+// an error the scan stops and the error is returned as it is. The version of
+// the users that were scanned is returned. An error from fn isn't counted as
+// an error of the store.
+func (s *instrumentedStore) Scan(fn func(models.User) error) (Version, error) {
+	defer s.observe("scan", s.now())
+
+	var fnErr error
+	version, err := s.store.Scan(func(user models.User) error {
+		fnErr = fn(user)
+		return fnErr
+	})
+	if err != nil && err != fnErr {
+		s.failed("scan", err)
+	}
+	return version, err
+}
+
+// Check checks the store that is wrapped, see Check.
+func (s *instrumentedStore) Check() error {
+	return Check(s.store)
+}
+
+// Close closes the store that is wrapped.
+func (s *instrumentedStore) Close() error {
+	return Close(s.store)
+}
+
+func (s *instrumentedStore) observe(op string, begin time.Time) {
+	s.metrics.Duration.With("op", op).Observe(s.now().Sub(begin).Seconds())
+}
+
+func (s *instrumentedStore) failed(op string, err error) {
+	kind := "failed"
+	if _, ok := ErrConflict(err); ok {
+		kind = "conflict"
+	}
+	s.metrics.Errors.With("op", op, "error", kind).Add(1)
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/go-kit/kit/metrics"
+)
+
+func TestInstrumented(t *testing.T) {
+	t.Parallel()
+
+	var (
+		durations = newRecorder()
+		errors    = newRecorder()
+		store     = NewInstrumented(NewMemory(), Metrics{
+			Duration: durations.histogram(),
+			Errors:   errors.counter(),
+		})
+	)
+
+	_, version, err := store.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Write([]models.User{
+		models.User{Fields: models.Fields{"firstname": "fred"}},
+	}, version); err != nil {
+		t.Fatal(err)
+	}
+
+	// The version is no longer current, so the write conflicts.
+	if _, err := store.Write(nil, version); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	for _, testcase := range []struct {
+		recorder *recorder
+		labels   string
+		expected int
+	}{
+		{durations, "op=read", 1},
+		{durations, "op=write", 2},
+		{errors, "op=read", 0},
+		{errors, "op=write,error=conflict", 1},
+		{errors, "op=write,error=failed", 0},
+	} {
+		if expected, actual := testcase.expected, testcase.recorder.count(testcase.labels); expected != actual {
+			t.Errorf("%s: expected: %v, actual: %v", testcase.labels, expected, actual)
+		}
+	}
+}
+
+// recorder counts how many times a metric is added to or observed for each
+// set of labels.
+type recorder struct {
+	mutex  sync.Mutex
+	counts map[string]int
+}
+
+func newRecorder() *recorder {
+	return &recorder{counts: make(map[string]int)}
+}
+
+func (r *recorder) counter() metrics.Counter     { return recordedCounter{recorded{recorder: r}} }
+func (r *recorder) histogram() metrics.Histogram { return recordedHistogram{recorded{recorder: r}} }
+
+func (r *recorder) count(labels string) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.counts[labels]
+}
+
+type recorded struct {
+	recorder *recorder
+	labels   []string
+}
+
+func (r recorded) with(labelValues []string) recorded {
+	return recorded{
+		recorder: r.recorder,
+		labels:   append(append([]string(nil), r.labels...), labelValues...),
+	}
+}
+
+func (r recorded) record() {
+	var pairs []string
+	for i := 0; i+1 < len(r.labels); i += 2 {
+		pairs = append(pairs, r.labels[i]+"="+r.labels[i+1])
+	}
+
+	r.recorder.mutex.Lock()
+	r.recorder.counts[strings.Join(pairs, ",")]++
+	r.recorder.mutex.Unlock()
+}
+
+type recordedCounter struct{ recorded }
+
+func (r recordedCounter) With(labelValues ...string) metrics.Counter {
+	return recordedCounter{r.with(labelValues)}
+}
+
+func (r recordedCounter) Add(float64) { r.record() }
+
+type recordedHistogram struct{ recorded }
+
+func (r recordedHistogram) With(labelValues ...string) metrics.Histogram {
+	return recordedHistogram{r.with(labelValues)}
+}
+
+func (r recordedHistogram) Observe(float64) { r.record() }
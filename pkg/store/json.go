@@ -0,0 +1,122 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/url"
+
+	"github.com/SimonRichardson/formed/pkg/fs"
+	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	Register("json", func(fsys fs.Filesystem, u *url.URL, _ []string) (Store, error) {
+		path, err := locationPath(u)
+		if err != nil {
+			return nil, err
+		}
+		timeout, err := lockTimeout(u)
+		if err != nil {
+			return nil, err
+		}
+		return newFileStore(fsys, path, jsonCodec{}, timeout), nil
+	})
+	Register("jsonl", func(fsys fs.Filesystem, u *url.URL, _ []string) (Store, error) {
+		path, err := locationPath(u)
+		if err != nil {
+			return nil, err
+		}
+		timeout, err := lockTimeout(u)
+		if err != nil {
+			return nil, err
+		}
+		return newFileStore(fsys, path, jsonlCodec{}, timeout), nil
+	})
+}
+
+// NewJSON creates a store where the users are stored as a JSON array in the
+// file found at path.
+func NewJSON(fsys fs.Filesystem, path string) Store {
+	return newFileStore(fsys, path, jsonCodec{}, DefaultLockTimeout)
+}
+
+// NewJSONL creates a store where the users are stored as JSON lines, one user
+// per line, in the file found at path.
+func NewJSONL(fsys fs.Filesystem, path string) Store {
+	return newFileStore(fsys, path, jsonlCodec{}, DefaultLockTimeout)
+}
+
+// jsonCodec encodes all the users as one JSON array.
+type jsonCodec struct{}
+
+// Decode reads the elements of the array one at a time, so the users are
+// never all held in memory.
+func (jsonCodec) Decode(reader io.Reader, fn func(models.User) error) (bool, error) {
+	decoder := json.NewDecoder(reader)
+	token, err := decoder.Token()
+	if err == io.EOF || (err == nil && token == nil) {
+		// An empty file, or null, holds no users.
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return false, errors.Errorf("expected an array of users, actual %v", token)
+	}
+
+	for index := 0; decoder.More(); index++ {
+		var user models.User
+		if err := decoder.Decode(&user); err != nil {
+			return false, errors.Wrapf(err, "unable to parse user for index %d", index)
+		}
+		if err := fn(user); err != nil {
+			return false, err
+		}
+	}
+
+	// Read the end of the array, so a truncated file is an error.
+	_, err = decoder.Token()
+	return false, err
+}
+
+func (jsonCodec) Encode(writer io.Writer, users []models.User) error {
+	if users == nil {
+		users = make([]models.User, 0)
+	}
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(users)
+}
+
+// jsonlCodec encodes each user as a JSON object on a line of its own.
+type jsonlCodec struct{}
+
+func (jsonlCodec) Decode(reader io.Reader, fn func(models.User) error) (bool, error) {
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var user models.User
+		if err := json.Unmarshal(scanner.Bytes(), &user); err != nil {
+			return false, errors.Wrapf(err, "unable to parse user on line %d", line)
+		}
+		if err := fn(user); err != nil {
+			return false, err
+		}
+	}
+	return false, scanner.Err()
+}
+
+func (jsonlCodec) Encode(writer io.Writer, users []models.User) error {
+	encoder := json.NewEncoder(writer)
+	for k, v := range users {
+		if err := encoder.Encode(v); err != nil {
+			return errors.Wrapf(err, "unable to marshal user at index %d", k)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"net/url"
+	"sync"
+
+	"github.com/SimonRichardson/formed/pkg/fs"
+	"github.com/SimonRichardson/formed/pkg/models"
+)
+
+func init() {
+	Register("mem", func(fs.Filesystem, *url.URL, []string) (Store, error) {
+		return NewMemory(), nil
+	})
+}
+
+type memStore struct {
+	mutex sync.RWMutex
+	users []models.User
+}
+
+// NewMemory creates a store that only keeps the users in memory, so nothing
+// survives a restart. It's useful for development and for testing.
+func NewMemory() Store {
+	return &memStore{
+		users: make([]models.User, 0),
+	}
+}
+
+// Read reads all the user models from the storage along with the version
+// of what was read, or it returns an error if there issue.
+func (m *memStore) Read() ([]models.User, Version, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	version, err := versionOf(m.users)
+	if err != nil {
+		return nil, AnyVersion, err
+	}
+
+	return copyUsers(m.users), version, nil
+}
+
+// Scan calls fn with every user held by the storage in order. If fn returns
+// an error the scan stops and the error is returned as it is. The version of
+// the users that were scanned is returned.
+func (m *memStore) Scan(fn func(models.User) error) (Version, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return scanUsers(m.users, fn)
+}
+
+// Write, writes users to the underlying storage, as long as the storage is
+// still at the version supplied. If the users have changed underneath then
+// nothing is written and a *ConflictError is returned. Passing AnyVersion
+// writes the users unconditionally. The new version is returned.
+// Any user without an id is given one.
+func (m *memStore) Write(users []models.User, version Version) (Version, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := checkVersion(copyUsers(m.users), version); err != nil {
+		return AnyVersion, err
+	}
+
+	users, err := withIDs(users)
+	if err != nil {
+		return AnyVersion, err
+	}
+	m.users = users
+
+	return versionOf(m.users)
+}
+
+// copyUsers prevents callers from mutating the users held by the store.
+func copyUsers(users []models.User) []models.User {
+	res := make([]models.User, len(users))
+	for k, v := range users {
+		res[k] = v.Copy()
+	}
+	return res
+}
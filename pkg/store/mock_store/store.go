@@ -5,6 +5,7 @@ package mock_store
 
 import (
 	models "github.com/SimonRichardson/formed/pkg/models"
+	store "github.com/SimonRichardson/formed/pkg/store"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -32,11 +33,12 @@ func (_m *MockStore) EXPECT() *MockStoreMockRecorder {
 }
 
 // Read mocks base method
-func (_m *MockStore) Read() ([]models.User, error) {
+func (_m *MockStore) Read() ([]models.User, store.Version, error) {
 	ret := _m.ctrl.Call(_m, "Read")
 	ret0, _ := ret[0].([]models.User)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	ret1, _ := ret[1].(store.Version)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
 }
 
 // Read indicates an expected call of Read
@@ -44,14 +46,28 @@ func (_mr *MockStoreMockRecorder) Read() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Read")
 }
 
+// Scan mocks base method
+func (_m *MockStore) Scan(_param0 func(models.User) error) (store.Version, error) {
+	ret := _m.ctrl.Call(_m, "Scan", _param0)
+	ret0, _ := ret[0].(store.Version)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Scan indicates an expected call of Scan
+func (_mr *MockStoreMockRecorder) Scan(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Scan", arg0)
+}
+
 // Write mocks base method
-func (_m *MockStore) Write(_param0 []models.User) error {
-	ret := _m.ctrl.Call(_m, "Write", _param0)
-	ret0, _ := ret[0].(error)
-	return ret0
+func (_m *MockStore) Write(_param0 []models.User, _param1 store.Version) (store.Version, error) {
+	ret := _m.ctrl.Call(_m, "Write", _param0, _param1)
+	ret0, _ := ret[0].(store.Version)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // Write indicates an expected call of Write
-func (_mr *MockStoreMockRecorder) Write(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Write", arg0)
+func (_mr *MockStoreMockRecorder) Write(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Write", arg0, arg1)
 }
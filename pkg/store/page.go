@@ -0,0 +1,102 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/pkg/errors"
+)
+
+// Window describes which users are held by a page: no more than Limit users,
+// starting at the user found at Offset, or straight after the user with the
+// id After when it's set.
+type Window struct {
+	Offset int
+	Limit  int
+	After  string
+}
+
+// Page is a window on to the users held by a store.
+type Page struct {
+	Users []models.User
+
+	// Offset is the index of the first user of the page.
+	Offset int
+
+	// Total is the number of users held by the store.
+	Total int
+
+	// Next is the id of the last user of the page, which can be used as
+	// Window.After to read the page that follows. It's empty for the last
+	// page.
+	Next string
+
+	// Version is the version of all the users held by the store, not just
+	// the users of the page.
+	Version Version
+}
+
+// ReadPage reads the users of the window from the store. The users are scanned
+// so that no more than the users of the page are ever held in memory, however
+// many users the store holds.
+func ReadPage(s Store, window Window) (Page, error) {
+	if window.Limit <= 0 {
+		return Page{}, errors.Errorf("expected a limit greater than 0, actual %d", window.Limit)
+	}
+	if window.Offset < 0 {
+		return Page{}, errors.Errorf("expected an offset of 0 or more, actual %d", window.Offset)
+	}
+
+	var (
+		page = Page{
+			Users:  make([]models.User, 0),
+			Offset: window.Offset,
+		}
+		found = window.After == ""
+		index int
+	)
+	version, err := s.Scan(func(user models.User) error {
+		defer func() { index++ }()
+
+		if !found {
+			if user.ID == window.After {
+				found = true
+				page.Offset = index + 1
+			}
+			return nil
+		}
+		if index >= page.Offset && len(page.Users) < window.Limit {
+			page.Users = append(page.Users, user)
+		}
+		return nil
+	})
+	if err != nil {
+		return Page{}, err
+	}
+	if !found {
+		return Page{}, &CursorError{After: window.After}
+	}
+
+	page.Total = index
+	page.Version = version
+	if n := len(page.Users); n > 0 && page.Offset+n < page.Total {
+		page.Next = page.Users[n-1].ID
+	}
+	return page, nil
+}
+
+// CursorError is returned when a page is asked for after a user that the store
+// doesn't hold, i.e. the user was removed since the page was read.
+type CursorError struct {
+	After string
+}
+
+func (e *CursorError) Error() string {
+	return fmt.Sprintf("no user found for %q to read the page after", e.After)
+}
+
+// ErrCursor returns the *CursorError held within the error if there is one.
+func ErrCursor(err error) (*CursorError, bool) {
+	cursor, ok := errors.Cause(err).(*CursorError)
+	return cursor, ok
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/SimonRichardson/formed/pkg/models"
+)
+
+func TestReadPage(t *testing.T) {
+	t.Parallel()
+
+	s := NewMemory()
+	users := make([]models.User, 5)
+	for k := range users {
+		users[k] = models.User{ID: strconv.Itoa(k), Fields: models.Fields{"firstname": "fred"}}
+	}
+	version, err := s.Write(users, AnyVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testcase := range []struct {
+		name   string
+		window Window
+		ids    []string
+		offset int
+		next   string
+	}{
+		{"first page", Window{Limit: 2}, []string{"0", "1"}, 0, "1"},
+		{"offset", Window{Offset: 2, Limit: 2}, []string{"2", "3"}, 2, "3"},
+		{"last page", Window{Offset: 4, Limit: 2}, []string{"4"}, 4, ""},
+		{"exactly the last page", Window{Offset: 3, Limit: 2}, []string{"3", "4"}, 3, ""},
+		{"past the end", Window{Offset: 10, Limit: 2}, []string{}, 10, ""},
+		{"after", Window{After: "1", Limit: 2}, []string{"2", "3"}, 2, "3"},
+		{"after the last user", Window{After: "4", Limit: 2}, []string{}, 5, ""},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			page, err := ReadPage(s, testcase.window)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ids := make([]string, len(page.Users))
+			for k, v := range page.Users {
+				ids[k] = v.ID
+			}
+			if expected, actual := testcase.ids, ids; !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+			if expected, actual := testcase.offset, page.Offset; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+			if expected, actual := testcase.next, page.Next; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+			if expected, actual := 5, page.Total; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+			if expected, actual := version, page.Version; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		})
+	}
+
+	t.Run("unknown cursor", func(t *testing.T) {
+		_, err := ReadPage(s, Window{After: "removed", Limit: 2})
+		if _, ok := ErrCursor(err); !ok {
+			t.Errorf("expected a cursor error, actual %v", err)
+		}
+	})
+
+	t.Run("invalid window", func(t *testing.T) {
+		for _, window := range []Window{
+			{Limit: 0},
+			{Offset: -1, Limit: 2},
+		} {
+			if _, err := ReadPage(s, window); err == nil {
+				t.Errorf("%v: expected an error", window)
+			}
+		}
+	})
+}
@@ -1,94 +1,437 @@
 package store
 
 import (
-	"encoding/csv"
+	"io"
+	"net/url"
+	"sync"
+	"time"
 
 	"github.com/SimonRichardson/formed/pkg/fs"
 	"github.com/SimonRichardson/formed/pkg/models"
 	"github.com/pkg/errors"
 )
 
+func init() {
+	Register("csv", func(fsys fs.Filesystem, u *url.URL, columns []string) (Store, error) {
+		path, err := locationPath(u)
+		if err != nil {
+			return nil, err
+		}
+		timeout, err := lockTimeout(u)
+		if err != nil {
+			return nil, err
+		}
+		return newFileStore(fsys, path, csvCodec{columns: columns}, timeout), nil
+	})
+}
+
+// DefaultLockTimeout is how long a file store waits for another process to
+// release its lock on the file before giving up.
+const DefaultLockTimeout = 10 * time.Second
+
+// lockTimeout gets the lock timeout from the "lock_timeout" query of the URL,
+// i.e. "csv:./data/store.csv?lock_timeout=30s".
+func lockTimeout(u *url.URL) (time.Duration, error) {
+	value := u.Query().Get("lock_timeout")
+	if value == "" {
+		return DefaultLockTimeout, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, errors.Errorf("expected lock_timeout to be a duration, i.e. 5s, actual %q", value)
+	}
+	return timeout, nil
+}
+
+// codec describes how users are encoded to and decoded from a file, allowing
+// the same file handling to be used for different file formats.
+type codec interface {
+	// Decode reads the users from the reader one at a time, calling fn with
+	// each of them, an error from fn is returned as it is. It returns whether
+	// the users were written in an older format and should be written again.
+	Decode(reader io.Reader, fn func(models.User) error) (bool, error)
+
+	// Encode writes all the users to the writer.
+	Encode(io.Writer, []models.User) error
+}
+
 type realStore struct {
-	fsys fs.Filesystem
-	path string
+	mutex       sync.Mutex
+	fsys        fs.Filesystem
+	path        string
+	codec       codec
+	lockTimeout time.Duration
+}
+
+// New creates a default store with the correct dependencies, the users are
+// stored as csv records in the file found at path, with the id of the user
+// followed by a value for each of the columns.
+func New(fsys fs.Filesystem, path string, columns []string) Store {
+	return newFileStore(fsys, path, csvCodec{columns: columns}, DefaultLockTimeout)
 }
 
-// New creates a default store with the correct dependencies.
-func New(fsys fs.Filesystem, path string) Store {
+func newFileStore(fsys fs.Filesystem, path string, codec codec, lockTimeout time.Duration) Store {
 	return &realStore{
-		fsys: fsys,
-		path: path,
+		fsys:        fsys,
+		path:        path,
+		codec:       codec,
+		lockTimeout: lockTimeout,
 	}
 }
 
-// Read reads all the user models from the storage, or it returns an error
-// if there issue.
-func (r *realStore) Read() ([]models.User, error) {
+// Read reads all the user models from the storage along with the version
+// of what was read, or it returns an error if there issue.
+// The file is read under a shared lock, so other processes can read it at the
+// same time but not write it.
+// Files written before users had ids, or in an older format, are migrated.
+// Every user is given an id and the file is written back straight away, so
+// that the ids stay the same.
+func (r *realStore) Read() ([]models.User, Version, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
 	if !r.fsys.Exists(r.path) {
-		return nil, errors.Errorf("no file found at %q", r.path)
+		return nil, AnyVersion, errors.Errorf("no file found at %q", r.path)
 	}
 
-	file, err := r.fsys.Open(r.path)
+	users, outdated, err := r.readShared()
 	if err != nil {
-		return nil, errors.Wrapf(err, "unable to open file at %q", r.path)
+		return nil, AnyVersion, err
+	}
+
+	if outdated || models.MissingIDs(users) {
+		if users, err = r.migrate(); err != nil {
+			return nil, AnyVersion, errors.Wrapf(err, "unable to migrate file at %q", r.path)
+		}
+	}
+
+	version, err := versionOf(users)
+	if err != nil {
+		return nil, AnyVersion, err
+	}
+
+	return users, version, nil
+}
+
+// Scan calls fn with every user held by the storage in order, decoding one
+// user at a time so that the users are never all held in memory. If fn
+// returns an error the scan stops and the error is returned as it is. The
+// version of the users that were scanned is returned.
+// The file is read under a shared lock, as with Read. Files written before
+// users had ids are migrated first, fn is still only called once per user.
+func (r *realStore) Scan(fn func(models.User) error) (Version, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.fsys.Exists(r.path) {
+		return AnyVersion, errors.Errorf("no file found at %q", r.path)
 	}
-	defer file.Close()
 
-	// Create a reader to read all the lines of the file.
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	var scanned int
+	version, err := r.scanShared(func(user models.User) error {
+		if user.ID == "" {
+			return errMissingID
+		}
+		scanned++
+		return fn(user)
+	})
+	if err != errMissingID {
+		return version, err
+	}
+
+	// The users before the first user without an id have already been
+	// scanned, migrating doesn't change them or their order.
+	if _, err := r.migrate(); err != nil {
+		return AnyVersion, errors.Wrapf(err, "unable to migrate file at %q", r.path)
+	}
+	return r.scanShared(func(user models.User) error {
+		if scanned > 0 {
+			scanned--
+			return nil
+		}
+		return fn(user)
+	})
+}
+
+// Write, writes users to the underlying storage, as long as the storage is
+// still at the version supplied. If the users have changed underneath then
+// nothing is written and a *ConflictError is returned. Passing AnyVersion
+// writes the users unconditionally. The new version is returned.
+// The users are staged to a temporary file first, which is synced and then
+// renamed over the original. This means a crash part way through a write
+// never leaves a corrupt or partially written file behind.
+// The version is checked and the users are written under an exclusive lock,
+// so no other process can read or write the file in between.
+// Any user without an id is given one. A user without extra values keeps the
+// extra values held in the file for the same id, see scanCurrent.
+func (r *realStore) Write(users []models.User, version Version) (Version, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	users, err := withIDs(users)
 	if err != nil {
-		return nil, errors.Wrapf(err, "unable to read file at %q", r.path)
+		return AnyVersion, err
 	}
 
-	// Parse the records to a user model
-	users := make([]models.User, len(records))
-	for k, v := range records {
-		user := &models.User{}
-		if err := user.Unmarshal(v); err != nil {
-			return nil, errors.Wrapf(err, "unable to parse user at %q for index %d", r.path, k)
+	lock, err := r.lock(fs.Exclusive)
+	if err != nil {
+		return AnyVersion, err
+	}
+	defer lock.Release()
+
+	current, err := r.scanCurrent(users)
+	if err != nil {
+		return AnyVersion, err
+	}
+	if version != AnyVersion && version != current {
+		// Only a conflict reads the users in full, to go with the error.
+		var existing []models.User
+		if r.fsys.Exists(r.path) {
+			if existing, _, err = r.read(); err != nil {
+				return AnyVersion, err
+			}
+		}
+		return AnyVersion, &ConflictError{
+			Expected: version,
+			Actual:   current,
+			Users:    existing,
 		}
+	}
+
+	// Write the users to the file
+	if err := r.write(users); err != nil {
+		return AnyVersion, err
+	}
+
+	return versionOf(users)
+}
+
+// Check makes sure the file can be opened for reading and that a file can be
+// created next to it, under a shared lock. None of the users are read or
+// written, so checking doesn't hold up other readers or writers for long.
+func (r *realStore) Check() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.fsys.Exists(r.path) {
+		return errors.Errorf("no file found at %q", r.path)
+	}
+
+	lock, err := r.lock(fs.Shared)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	file, err := r.fsys.Open(r.path)
+	if err != nil {
+		return errors.Wrapf(err, "unable to open file at %q", r.path)
+	}
+	file.Close()
+
+	return checkWritable(r.fsys, r.path)
+}
+
+// readShared reads the users under a shared lock.
+func (r *realStore) readShared() ([]models.User, bool, error) {
+	lock, err := r.lock(fs.Shared)
+	if err != nil {
+		return nil, false, err
+	}
+	defer lock.Release()
 
-		users[k] = *user
+	return r.read()
+}
+
+// migrate gives every user an id and writes them back in the current format
+// under an exclusive lock. The users are read again once the lock is held, as
+// another process may have already migrated them.
+func (r *realStore) migrate() ([]models.User, error) {
+	lock, err := r.lock(fs.Exclusive)
+	if err != nil {
+		return nil, err
 	}
+	defer lock.Release()
 
+	users, outdated, err := r.read()
+	if err != nil {
+		return nil, err
+	}
+	if outdated || models.MissingIDs(users) {
+		users = models.EnsureIDs(users)
+		if err := r.write(users); err != nil {
+			return nil, err
+		}
+	}
 	return users, nil
 }
 
-// Write, writes users to the underlying storage.
-func (r *realStore) Write(users []models.User) error {
-	var (
-		file fs.File
-		err  error
-	)
+// scanCurrent works out the version of the file, scanning it one user at a
+// time so the users held in the file are never all in memory. A file that
+// doesn't exist yet has the version of no users. Along the way every user
+// without extra values is given the extra values held in the file for the
+// same id. The users written back by the form or the API only hold the fields
+// of the schema, so this keeps the columns that aren't part of the schema
+// from being dropped. It expects the file to be locked.
+func (r *realStore) scanCurrent(users []models.User) (Version, error) {
+	missing := make(map[string]int, len(users))
+	for k, v := range users {
+		if v.Extra == nil {
+			missing[v.ID] = k
+		}
+	}
+
+	hash := newVersionHash()
 	if !r.fsys.Exists(r.path) {
-		file, err = r.fsys.Create(r.path)
-		if err != nil {
-			return errors.Wrapf(err, "unable to create file at %q", r.path)
+		return hash.version(), nil
+	}
+
+	if _, err := r.scan(func(user models.User) error {
+		if k, ok := missing[user.ID]; ok && user.Extra != nil {
+			users[k].Extra = user.Extra
 		}
-	} else {
-		file, err = r.fsys.Open(r.path)
-		if err != nil {
-			return errors.Wrapf(err, "unable to open file at %q", r.path)
+		return hash.add(user)
+	}); err != nil {
+		return AnyVersion, err
+	}
+	return hash.version(), nil
+}
+
+func (r *realStore) lock(mode fs.LockMode) (fs.Lock, error) {
+	return r.fsys.Lock(r.path, mode, r.lockTimeout)
+}
+
+func (r *realStore) write(users []models.User) error {
+	return writeAtomic(r.fsys, r.path, func(w io.Writer) error {
+		return r.codec.Encode(w, users)
+	})
+}
+
+func (r *realStore) read() ([]models.User, bool, error) {
+	users := make([]models.User, 0)
+	outdated, err := r.scan(func(user models.User) error {
+		users = append(users, user)
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return users, outdated, nil
+}
+
+// errMissingID stops a scan at the first user without an id.
+var errMissingID = errors.New("missing id")
+
+// scanShared scans the users under a shared lock, working out the version as
+// it goes.
+func (r *realStore) scanShared(fn func(models.User) error) (Version, error) {
+	lock, err := r.lock(fs.Shared)
+	if err != nil {
+		return AnyVersion, err
+	}
+	defer lock.Release()
+
+	hash := newVersionHash()
+	if _, err := r.scan(func(user models.User) error {
+		if err := hash.add(user); err != nil {
+			return err
 		}
+		return fn(user)
+	}); err != nil {
+		return AnyVersion, err
+	}
+	return hash.version(), nil
+}
+
+// scan decodes the file, calling fn with every user. An error from fn is
+// returned as it is.
+func (r *realStore) scan(fn func(models.User) error) (bool, error) {
+	file, err := r.fsys.Open(r.path)
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to open file at %q", r.path)
 	}
 	defer file.Close()
 
-	// Marshal all the users to records
-	records := make([][]string, len(users))
-	for k, v := range users {
-		fields, err := v.Marshal()
-		if err != nil {
-			return errors.Wrapf(err, "unable to marshal user at index %d", k)
+	var fnErr error
+	outdated, err := r.codec.Decode(file, func(user models.User) error {
+		fnErr = fn(user)
+		return fnErr
+	})
+	if fnErr != nil {
+		return false, fnErr
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to read file at %q", r.path)
+	}
+	return outdated, nil
+}
+
+// checkWritable makes sure a file can be created, synced and removed next to
+// path, which is what every write of path has to do. The file is given a name
+// of its own, so checks running at the same time don't get in each other's
+// way.
+func checkWritable(fsys fs.Filesystem, path string) error {
+	file, check, err := fsys.CreateTemp(path)
+	if err != nil {
+		return errors.Wrapf(err, "unable to create file next to %q", path)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		fsys.Remove(check)
+		return errors.Wrapf(err, "unable to sync file at %q", check)
+	}
+	if err := file.Close(); err != nil {
+		fsys.Remove(check)
+		return errors.Wrapf(err, "unable to close file at %q", check)
+	}
+	if err := fsys.Remove(check); err != nil {
+		return errors.Wrapf(err, "unable to remove file at %q", check)
+	}
+	return nil
+}
+
+// writeAtomic stages the output of fn in a temporary file next to path, syncs
+// it to stable storage and then renames it over path. The directory is synced
+// once renamed, so the rename itself survives a crash. If anything fails the
+// temporary file is removed and path is left untouched. Every write is staged
+// in a file of its own, so writers never write into each other's file.
+func writeAtomic(fsys fs.Filesystem, path string, fn func(io.Writer) error) (err error) {
+	file, tmp, err := fsys.CreateTemp(path)
+	if err != nil {
+		return errors.Wrapf(err, "unable to create file next to %q", path)
+	}
+
+	closed, renamed := false, false
+	defer func() {
+		if err == nil || renamed {
+			return
 		}
-		records[k] = fields
+		if !closed {
+			file.Close()
+		}
+		fsys.Remove(tmp)
+	}()
+
+	if err = fn(file); err != nil {
+		return errors.Wrapf(err, "unable to write file at %q", tmp)
+	}
+	if err = file.Sync(); err != nil {
+		return errors.Wrapf(err, "unable to sync file at %q", tmp)
 	}
 
-	// Write the csv to the file
-	writer := csv.NewWriter(file)
-	if err := writer.WriteAll(records); err != nil {
-		return errors.Wrapf(err, "unable to write file at %q", r.path)
+	closed = true
+	if err = file.Close(); err != nil {
+		return errors.Wrapf(err, "unable to close file at %q", tmp)
+	}
+	if err = fsys.Rename(tmp, path); err != nil {
+		return errors.Wrapf(err, "unable to rename %q to %q", tmp, path)
 	}
 
+	// The file is already in place, so there is nothing to remove if the
+	// directory can't be synced.
+	renamed = true
+	if err = fsys.SyncDir(path); err != nil {
+		return errors.Wrapf(err, "unable to sync the directory of %q", path)
+	}
 	return nil
 }
@@ -2,17 +2,28 @@ package store
 
 import (
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 
 	"io"
 
 	"reflect"
 
+	"github.com/SimonRichardson/formed/pkg/fs"
 	"github.com/SimonRichardson/formed/pkg/fs/mock_fs"
 	"github.com/SimonRichardson/formed/pkg/models"
 	"github.com/golang/mock/gomock"
 )
 
+var columns = []string{"firstname", "surname"}
+
+// csvHeader is the start of every csv file written for the columns.
+const csvHeader = "#formed-csv:2\nid,firstname,surname\n"
+
 func TestRealRead(t *testing.T) {
 	t.Parallel()
 
@@ -22,13 +33,22 @@ func TestRealRead(t *testing.T) {
 
 		var (
 			mockStore = mock_fs.NewMockFilesystem(ctrl)
+			mockLock  = mock_fs.NewMockLock(ctrl)
 			mockFile  = mock_fs.NewMockFile(ctrl)
 
 			path  = "path/to/file"
-			store = New(mockStore, path)
+			store = New(mockStore, path, columns)
 		)
 
 		// Create some mocking expectations
+		mockStore.EXPECT().
+			Lock(path, fs.Shared, DefaultLockTimeout).
+			Return(mockLock, nil)
+
+		mockLock.EXPECT().
+			Release().
+			Return(nil)
+
 		mockStore.EXPECT().
 			Exists(path).
 			Return(true)
@@ -45,7 +65,7 @@ func TestRealRead(t *testing.T) {
 			Close().
 			Return(nil)
 
-		users, err := store.Read()
+		users, _, err := store.Read()
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -60,17 +80,26 @@ func TestRealRead(t *testing.T) {
 		defer ctrl.Finish()
 
 		var (
-			want      = models.User{"fred", "smith"}
+			want      = models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}}
 			mockStore = mock_fs.NewMockFilesystem(ctrl)
+			mockLock  = mock_fs.NewMockLock(ctrl)
 			stubFile  = &stubFile{
-				bytes: []byte(want.String()),
+				bytes: []byte(csvHeader + "f1,fred,smith\n"),
 			}
 
 			path  = "path/to/file"
-			store = New(mockStore, path)
+			store = New(mockStore, path, columns)
 		)
 
 		// Create some mocking expectations
+		mockStore.EXPECT().
+			Lock(path, fs.Shared, DefaultLockTimeout).
+			Return(mockLock, nil)
+
+		mockLock.EXPECT().
+			Release().
+			Return(nil)
+
 		mockStore.EXPECT().
 			Exists(path).
 			Return(true)
@@ -79,7 +108,7 @@ func TestRealRead(t *testing.T) {
 			Open(path).
 			Return(stubFile, nil)
 
-		users, err := store.Read()
+		users, _, err := store.Read()
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -100,7 +129,7 @@ func TestRealRead(t *testing.T) {
 			mockStore = mock_fs.NewMockFilesystem(ctrl)
 
 			path  = "path/to/file"
-			store = New(mockStore, path)
+			store = New(mockStore, path, columns)
 		)
 
 		// Create some mocking expectations
@@ -108,7 +137,7 @@ func TestRealRead(t *testing.T) {
 			Exists(path).
 			Return(false)
 
-		_, err := store.Read()
+		_, _, err := store.Read()
 
 		if expected, actual := false, err == nil; expected != actual {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
@@ -121,12 +150,21 @@ func TestRealRead(t *testing.T) {
 
 		var (
 			mockStore = mock_fs.NewMockFilesystem(ctrl)
+			mockLock  = mock_fs.NewMockLock(ctrl)
 
 			path  = "path/to/file"
-			store = New(mockStore, path)
+			store = New(mockStore, path, columns)
 		)
 
 		// Create some mocking expectations
+		mockStore.EXPECT().
+			Lock(path, fs.Shared, DefaultLockTimeout).
+			Return(mockLock, nil)
+
+		mockLock.EXPECT().
+			Release().
+			Return(nil)
+
 		mockStore.EXPECT().
 			Exists(path).
 			Return(true)
@@ -135,7 +173,7 @@ func TestRealRead(t *testing.T) {
 			Open(path).
 			Return(nil, errors.New("permissions"))
 
-		_, err := store.Read()
+		_, _, err := store.Read()
 
 		if expected, actual := false, err == nil; expected != actual {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
@@ -148,13 +186,22 @@ func TestRealRead(t *testing.T) {
 
 		var (
 			mockStore = mock_fs.NewMockFilesystem(ctrl)
+			mockLock  = mock_fs.NewMockLock(ctrl)
 			mockFile  = mock_fs.NewMockFile(ctrl)
 
 			path  = "path/to/file"
-			store = New(mockStore, path)
+			store = New(mockStore, path, columns)
 		)
 
 		// Create some mocking expectations
+		mockStore.EXPECT().
+			Lock(path, fs.Shared, DefaultLockTimeout).
+			Return(mockLock, nil)
+
+		mockLock.EXPECT().
+			Release().
+			Return(nil)
+
 		mockStore.EXPECT().
 			Exists(path).
 			Return(true)
@@ -171,43 +218,156 @@ func TestRealRead(t *testing.T) {
 			Close().
 			Return(nil)
 
-		_, err := store.Read()
+		_, _, err := store.Read()
 
 		if expected, actual := false, err == nil; expected != actual {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
 		}
 	})
+
+	t.Run("lock times out", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore = mock_fs.NewMockFilesystem(ctrl)
+
+			path  = "path/to/file"
+			store = New(mockStore, path, columns)
+		)
+
+		// Create some mocking expectations, notice that the file is never opened.
+		mockStore.EXPECT().
+			Exists(path).
+			Return(true)
+
+		mockStore.EXPECT().
+			Lock(path, fs.Shared, DefaultLockTimeout).
+			Return(nil, &fs.LockTimeoutError{Path: path, Mode: fs.Shared, Timeout: DefaultLockTimeout})
+
+		_, _, err := store.Read()
+
+		if _, ok := fs.ErrLockTimeout(err); !ok {
+			t.Errorf("expected a lock timeout, actual %v", err)
+		}
+	})
 }
 
 func TestRealWrite(t *testing.T) {
 	t.Parallel()
 
-	t.Run("write nothing for no users", func(t *testing.T) {
+	t.Run("write only the header for no users", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		defer ctrl.Finish()
 
 		var (
 			mockStore = mock_fs.NewMockFilesystem(ctrl)
+			mockLock  = mock_fs.NewMockLock(ctrl)
 			mockFile  = mock_fs.NewMockFile(ctrl)
 
 			path  = "path/to/file"
-			store = New(mockStore, path)
+			tmp   = "path/to/file.tmp123"
+			store = New(mockStore, path, columns)
 		)
 
 		// Create some mocking expectations
+		mockStore.EXPECT().
+			Lock(path, fs.Exclusive, DefaultLockTimeout).
+			Return(mockLock, nil)
+
+		mockLock.EXPECT().
+			Release().
+			Return(nil)
+
 		mockStore.EXPECT().
 			Exists(path).
-			Return(true)
+			Return(false)
+
+		gomock.InOrder(
+			mockStore.EXPECT().
+				CreateTemp(path).
+				Return(mockFile, tmp, nil),
+			mockFile.EXPECT().
+				Write([]byte(csvHeader)).
+				Return(len(csvHeader), nil),
+			mockFile.EXPECT().
+				Sync().
+				Return(nil),
+			mockFile.EXPECT().
+				Close().
+				Return(nil),
+			mockStore.EXPECT().
+				Rename(tmp, path).
+				Return(nil),
+			mockStore.EXPECT().
+				SyncDir(path).
+				Return(nil),
+		)
+
+		_, err := store.Write([]models.User{}, AnyVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := true, err == nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("write users", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			user = models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}}
+			want = csvHeader + "f1,fred,smith\n"
+
+			mockStore = mock_fs.NewMockFilesystem(ctrl)
+			mockLock  = mock_fs.NewMockLock(ctrl)
+			mockFile  = mock_fs.NewMockFile(ctrl)
 
+			path  = "path/to/file"
+			tmp   = "path/to/file.tmp123"
+			store = New(mockStore, path, columns)
+		)
+
+		// Create some mocking expectations
 		mockStore.EXPECT().
-			Open(path).
-			Return(mockFile, nil)
+			Lock(path, fs.Exclusive, DefaultLockTimeout).
+			Return(mockLock, nil)
 
-		mockFile.EXPECT().
-			Close().
+		mockLock.EXPECT().
+			Release().
 			Return(nil)
 
-		err := store.Write([]models.User{})
+		mockStore.EXPECT().
+			Exists(path).
+			Return(false)
+
+		gomock.InOrder(
+			mockStore.EXPECT().
+				CreateTemp(path).
+				Return(mockFile, tmp, nil),
+			mockFile.EXPECT().
+				Write([]byte(want)).
+				Return(len(want), nil),
+			mockFile.EXPECT().
+				Sync().
+				Return(nil),
+			mockFile.EXPECT().
+				Close().
+				Return(nil),
+			mockStore.EXPECT().
+				Rename(tmp, path).
+				Return(nil),
+			mockStore.EXPECT().
+				SyncDir(path).
+				Return(nil),
+		)
+
+		_, err := store.Write([]models.User{
+			user,
+		}, AnyVersion)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -217,29 +377,366 @@ func TestRealWrite(t *testing.T) {
 		}
 	})
 
-	t.Run("write users", func(t *testing.T) {
+	t.Run("unable to create temporary file", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		defer ctrl.Finish()
 
 		var (
-			user = models.User{"fred", "smith"}
-			want = user.String()
+			mockStore = mock_fs.NewMockFilesystem(ctrl)
+			mockLock  = mock_fs.NewMockLock(ctrl)
 
+			path  = "path/to/file"
+			store = New(mockStore, path, columns)
+		)
+
+		// Create some mocking expectations
+		mockStore.EXPECT().
+			Lock(path, fs.Exclusive, DefaultLockTimeout).
+			Return(mockLock, nil)
+
+		mockLock.EXPECT().
+			Release().
+			Return(nil)
+
+		mockStore.EXPECT().
+			Exists(path).
+			Return(false)
+
+		mockStore.EXPECT().
+			CreateTemp(path).
+			Return(nil, "", errors.New("permissions"))
+
+		_, err := store.Write([]models.User{}, AnyVersion)
+
+		if expected, actual := false, err == nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("unable to write removes temporary file", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
 			mockStore = mock_fs.NewMockFilesystem(ctrl)
+			mockLock  = mock_fs.NewMockLock(ctrl)
 			mockFile  = mock_fs.NewMockFile(ctrl)
 
 			path  = "path/to/file"
-			store = New(mockStore, path)
+			tmp   = "path/to/file.tmp123"
+			store = New(mockStore, path, columns)
+		)
+
+		// Create some mocking expectations, notice that there is no rename.
+		mockStore.EXPECT().
+			Lock(path, fs.Exclusive, DefaultLockTimeout).
+			Return(mockLock, nil)
+
+		mockLock.EXPECT().
+			Release().
+			Return(nil)
+
+		mockStore.EXPECT().
+			Exists(path).
+			Return(false)
+
+		gomock.InOrder(
+			mockStore.EXPECT().
+				CreateTemp(path).
+				Return(mockFile, tmp, nil),
+			mockFile.EXPECT().
+				Write(gomock.Any()).
+				Return(0, errors.New("disk full")),
+			mockFile.EXPECT().
+				Close().
+				Return(nil),
+			mockStore.EXPECT().
+				Remove(tmp).
+				Return(nil),
+		)
+
+		_, err := store.Write([]models.User{
+			models.User{Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+		}, AnyVersion)
+
+		if expected, actual := false, err == nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("unable to sync removes temporary file", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore = mock_fs.NewMockFilesystem(ctrl)
+			mockLock  = mock_fs.NewMockLock(ctrl)
+			mockFile  = mock_fs.NewMockFile(ctrl)
+
+			path  = "path/to/file"
+			tmp   = "path/to/file.tmp123"
+			store = New(mockStore, path, columns)
 		)
 
 		// Create some mocking expectations
+		mockStore.EXPECT().
+			Lock(path, fs.Exclusive, DefaultLockTimeout).
+			Return(mockLock, nil)
+
+		mockLock.EXPECT().
+			Release().
+			Return(nil)
+
+		mockStore.EXPECT().
+			Exists(path).
+			Return(false)
+
+		gomock.InOrder(
+			mockStore.EXPECT().
+				CreateTemp(path).
+				Return(mockFile, tmp, nil),
+			mockFile.EXPECT().
+				Write([]byte(csvHeader)).
+				Return(len(csvHeader), nil),
+			mockFile.EXPECT().
+				Sync().
+				Return(errors.New("io error")),
+			mockFile.EXPECT().
+				Close().
+				Return(nil),
+			mockStore.EXPECT().
+				Remove(tmp).
+				Return(nil),
+		)
+
+		_, err := store.Write([]models.User{}, AnyVersion)
+
+		if expected, actual := false, err == nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("unable to rename removes temporary file", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore = mock_fs.NewMockFilesystem(ctrl)
+			mockLock  = mock_fs.NewMockLock(ctrl)
+			mockFile  = mock_fs.NewMockFile(ctrl)
+
+			path  = "path/to/file"
+			tmp   = "path/to/file.tmp123"
+			store = New(mockStore, path, columns)
+		)
+
+		// Create some mocking expectations, the file is already closed so it
+		// shouldn't be closed again.
+		mockStore.EXPECT().
+			Lock(path, fs.Exclusive, DefaultLockTimeout).
+			Return(mockLock, nil)
+
+		mockLock.EXPECT().
+			Release().
+			Return(nil)
+
+		mockStore.EXPECT().
+			Exists(path).
+			Return(false)
+
+		gomock.InOrder(
+			mockStore.EXPECT().
+				CreateTemp(path).
+				Return(mockFile, tmp, nil),
+			mockFile.EXPECT().
+				Write([]byte(csvHeader)).
+				Return(len(csvHeader), nil),
+			mockFile.EXPECT().
+				Sync().
+				Return(nil),
+			mockFile.EXPECT().
+				Close().
+				Return(nil),
+			mockStore.EXPECT().
+				Rename(tmp, path).
+				Return(errors.New("cross device")),
+			mockStore.EXPECT().
+				Remove(tmp).
+				Return(nil),
+		)
+
+		_, err := store.Write([]models.User{}, AnyVersion)
+
+		if expected, actual := false, err == nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("unable to sync the directory after renaming", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore = mock_fs.NewMockFilesystem(ctrl)
+			mockLock  = mock_fs.NewMockLock(ctrl)
+			mockFile  = mock_fs.NewMockFile(ctrl)
+
+			path  = "path/to/file"
+			tmp   = "path/to/file.tmp123"
+			store = New(mockStore, path, columns)
+		)
+
+		// Create some mocking expectations, the file has already been renamed
+		// so there is nothing to remove.
+		mockStore.EXPECT().
+			Lock(path, fs.Exclusive, DefaultLockTimeout).
+			Return(mockLock, nil)
+
+		mockLock.EXPECT().
+			Release().
+			Return(nil)
+
+		mockStore.EXPECT().
+			Exists(path).
+			Return(false)
+
+		gomock.InOrder(
+			mockStore.EXPECT().
+				CreateTemp(path).
+				Return(mockFile, tmp, nil),
+			mockFile.EXPECT().
+				Write([]byte(csvHeader)).
+				Return(len(csvHeader), nil),
+			mockFile.EXPECT().
+				Sync().
+				Return(nil),
+			mockFile.EXPECT().
+				Close().
+				Return(nil),
+			mockStore.EXPECT().
+				Rename(tmp, path).
+				Return(nil),
+			mockStore.EXPECT().
+				SyncDir(path).
+				Return(errors.New("io error")),
+		)
+
+		_, err := store.Write([]models.User{}, AnyVersion)
+
+		if expected, actual := false, err == nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("lock times out", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore = mock_fs.NewMockFilesystem(ctrl)
+
+			path  = "path/to/file"
+			store = New(mockStore, path, columns)
+		)
+
+		// Create some mocking expectations, notice that the file is never opened.
+		mockStore.EXPECT().
+			Lock(path, fs.Exclusive, DefaultLockTimeout).
+			Return(nil, &fs.LockTimeoutError{Path: path, Mode: fs.Exclusive, Timeout: DefaultLockTimeout})
+
+		_, err := store.Write([]models.User{}, AnyVersion)
+
+		if _, ok := fs.ErrLockTimeout(err); !ok {
+			t.Errorf("expected a lock timeout, actual %v", err)
+		}
+	})
+}
+
+func TestRealCheck(t *testing.T) {
+	t.Parallel()
+
+	t.Run("check neither reads nor writes the users", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore = mock_fs.NewMockFilesystem(ctrl)
+			mockLock  = mock_fs.NewMockLock(ctrl)
+			mockFile  = mock_fs.NewMockFile(ctrl)
+			checkFile = mock_fs.NewMockFile(ctrl)
+
+			path  = "path/to/file"
+			store = New(mockStore, path, columns)
+		)
+
+		// Create some mocking expectations, the file is only opened and
+		// closed, nothing is read from it or renamed over it.
 		mockStore.EXPECT().
 			Exists(path).
 			Return(true)
 
+		mockStore.EXPECT().
+			Lock(path, fs.Shared, DefaultLockTimeout).
+			Return(mockLock, nil)
+
+		mockLock.EXPECT().
+			Release().
+			Return(nil)
+
+		mockStore.EXPECT().
+			Open(path).
+			Return(mockFile, nil)
+
 		mockFile.EXPECT().
-			Write(gomock.Any()).
-			Return(len(want)*2, nil)
+			Close().
+			Return(nil)
+
+		mockStore.EXPECT().
+			CreateTemp(path).
+			Return(checkFile, path+".tmp123", nil)
+
+		checkFile.EXPECT().
+			Sync().
+			Return(nil)
+
+		checkFile.EXPECT().
+			Close().
+			Return(nil)
+
+		mockStore.EXPECT().
+			Remove(path + ".tmp123").
+			Return(nil)
+
+		if err := Check(store); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("unable to create file", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mockStore = mock_fs.NewMockFilesystem(ctrl)
+			mockLock  = mock_fs.NewMockLock(ctrl)
+			mockFile  = mock_fs.NewMockFile(ctrl)
+
+			path  = "path/to/file"
+			store = New(mockStore, path, columns)
+		)
+
+		// Create some mocking expectations
+		mockStore.EXPECT().
+			Exists(path).
+			Return(true)
+
+		mockStore.EXPECT().
+			Lock(path, fs.Shared, DefaultLockTimeout).
+			Return(mockLock, nil)
+
+		mockLock.EXPECT().
+			Release().
+			Return(nil)
 
 		mockStore.EXPECT().
 			Open(path).
@@ -249,17 +746,356 @@ func TestRealWrite(t *testing.T) {
 			Close().
 			Return(nil)
 
-		err := store.Write([]models.User{
-			user,
+		mockStore.EXPECT().
+			CreateTemp(path).
+			Return(nil, "", errors.New("disk full"))
+
+		if err := Check(store); err == nil {
+			t.Errorf("expected an error")
+		}
+	})
+}
+
+func TestRealWriteFilesystem(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Run("shorter writes replace the whole file", func(t *testing.T) {
+		var (
+			path  = filepath.Join(dir, "store.csv")
+			store = New(fs.New(), path, columns)
+		)
+
+		if _, err := store.Write([]models.User{
+			models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+			models.User{ID: "j2", Fields: models.Fields{"firstname": "jane", "surname": "doe"}},
+		}, AnyVersion); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Write([]models.User{
+			models.User{ID: "j3", Fields: models.Fields{"firstname": "joe", "surname": "bloggs"}},
+		}, AnyVersion); err != nil {
+			t.Fatal(err)
+		}
+
+		users, _, err := store.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []models.User{models.User{ID: "j3", Fields: models.Fields{"firstname": "joe", "surname": "bloggs"}}}
+		if expected, actual := want, users; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		if files, err := filepath.Glob(path + ".tmp*"); err != nil || len(files) > 0 {
+			t.Errorf("expected: temporary files to be removed, actual: %v %v", files, err)
+		}
+	})
+
+	t.Run("concurrent writers stage to their own files", func(t *testing.T) {
+		path := filepath.Join(dir, "concurrent.csv")
+
+		// Each store has a mutex and lock of its own, only the temporary files
+		// are shared between them.
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				store := New(fs.New(), path, columns)
+				if _, err := store.Write([]models.User{
+					models.User{ID: fmt.Sprintf("u%d", i), Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+				}, AnyVersion); err != nil {
+					t.Error(err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		users, _, err := New(fs.New(), path, columns).Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := 1, len(users); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if files, err := filepath.Glob(path + ".tmp*"); err != nil || len(files) > 0 {
+			t.Errorf("expected: temporary files to be removed, actual: %v %v", files, err)
+		}
+	})
+
+	t.Run("files without ids are migrated", func(t *testing.T) {
+		var (
+			path  = filepath.Join(dir, "legacy.csv")
+			store = New(fs.New(), path, columns)
+		)
+
+		if err := ioutil.WriteFile(path, []byte("fred,smith\njane,doe\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		users, _, err := store.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := 2, len(users); expected != actual {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := "jane", users[1].Get("firstname"); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if users[0].ID == "" || users[1].ID == "" {
+			t.Errorf("expected: ids, actual: %v", users)
+		}
+
+		// The ids are written straight away, so they're the same next time.
+		again, _, err := store.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := users, again; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := csvHeader + users[0].ID + ",fred,smith\n" + users[1].ID + ",jane,doe\n"
+		if expected, actual := want, string(b); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("scan migrates files without ids", func(t *testing.T) {
+		var (
+			path  = filepath.Join(dir, "scan.csv")
+			store = New(fs.New(), path, columns)
+		)
+
+		if err := ioutil.WriteFile(path, []byte(csvHeader+"f1,fred,smith\n,jane,doe\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		users := make([]models.User, 0)
+		version, err := store.Scan(func(user models.User) error {
+			users = append(users, user)
+			return nil
 		})
 		if err != nil {
 			t.Fatal(err)
 		}
 
-		if expected, actual := true, err == nil; expected != actual {
+		// Every user is only scanned once, even though the scan started again
+		// once the file was migrated.
+		if expected, actual := 2, len(users); expected != actual {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := "f1", users[0].ID; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if users[1].ID == "" {
+			t.Errorf("expected: an id, actual: %v", users[1])
+		}
+
+		again, current, err := store.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := users, again; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := current, version; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("write with current version", func(t *testing.T) {
+		var (
+			path  = filepath.Join(dir, "current.csv")
+			store = New(fs.New(), path, columns)
+		)
+
+		version, err := store.Write([]models.User{
+			models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+		}, AnyVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, readVersion, err := store.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := version, readVersion; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		newVersion, err := store.Write([]models.User{
+			models.User{ID: "j2", Fields: models.Fields{"firstname": "jane", "surname": "doe"}},
+		}, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := false, version == newVersion; expected != actual {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
 		}
 	})
+
+	t.Run("write with stale version", func(t *testing.T) {
+		var (
+			path  = filepath.Join(dir, "stale.csv")
+			store = New(fs.New(), path, columns)
+		)
+
+		stale, err := store.Write([]models.User{
+			models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+		}, AnyVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = store.Write([]models.User{
+			models.User{ID: "j2", Fields: models.Fields{"firstname": "jane", "surname": "doe"}},
+		}, stale); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = store.Write([]models.User{
+			models.User{ID: "j3", Fields: models.Fields{"firstname": "joe", "surname": "bloggs"}},
+		}, stale)
+		conflict, ok := ErrConflict(err)
+		if !ok {
+			t.Fatalf("expected: conflict error, actual: %v", err)
+		}
+
+		want := []models.User{models.User{ID: "j2", Fields: models.Fields{"firstname": "jane", "surname": "doe"}}}
+		if expected, actual := want, conflict.Users; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		users, _, err := store.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := want, users; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("columns round trip", func(t *testing.T) {
+		path := filepath.Join(dir, "roundtrip.csv")
+		if err := ioutil.WriteFile(path, []byte("#formed-csv:2\nsurname,id,firstname\nsmith,f1,fred\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		store := New(fs.New(), path, columns)
+		users, version, err := store.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Write(users, version); err != nil {
+			t.Fatal(err)
+		}
+
+		reread, _, err := store.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := users, reread; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := csvHeader+"f1,fred,smith\n", string(b); expected != actual {
+			t.Errorf("expected: %q, actual: %q", expected, actual)
+		}
+	})
+
+	t.Run("unknown columns round trip", func(t *testing.T) {
+		var (
+			path  = filepath.Join(dir, "unknown.csv")
+			input = "#formed-csv:2\nid,firstname,surname,age\nf1,fred,smith,42\nj2,jane,doe,\n"
+		)
+		if err := ioutil.WriteFile(path, []byte(input), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		store := New(fs.New(), path, columns)
+		users, version, err := store.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Write(users, version); err != nil {
+			t.Fatal(err)
+		}
+
+		reread, _, err := store.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := users, reread; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := input, string(b); expected != actual {
+			t.Errorf("expected: %q, actual: %q", expected, actual)
+		}
+	})
+
+	t.Run("unknown columns are kept for users without them", func(t *testing.T) {
+		path := filepath.Join(dir, "kept.csv")
+		if err := ioutil.WriteFile(path, []byte("#formed-csv:2\nid,firstname,surname,age\nf1,fred,smith,42\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// The users sent back by the form only hold the fields of the schema.
+		store := New(fs.New(), path, columns)
+		if _, err := store.Write([]models.User{
+			models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "bloggs"}},
+			models.User{ID: "j2", Fields: models.Fields{"firstname": "jane", "surname": "doe"}},
+		}, AnyVersion); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := "#formed-csv:2\nid,firstname,surname,age\nf1,fred,bloggs,42\nj2,jane,doe,\n", string(b); expected != actual {
+			t.Errorf("expected: %q, actual: %q", expected, actual)
+		}
+	})
+
+	t.Run("write with version to missing file", func(t *testing.T) {
+		var (
+			path  = filepath.Join(dir, "missing.csv")
+			store = New(fs.New(), path, columns)
+		)
+
+		empty, err := versionOf(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := store.Write([]models.User{
+			models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+		}, empty); err != nil {
+			t.Fatal(err)
+		}
+	})
 }
 
 // stubFile is a file implementation that allows us to define what the Read
@@ -289,3 +1125,15 @@ func (f *stubFile) Write(b []byte) (int, error) {
 func (f *stubFile) Close() error {
 	return nil
 }
+
+func (f *stubFile) Sync() error {
+	return nil
+}
+
+func (f *stubFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, nil
+}
+
+func (f *stubFile) Truncate(size int64) error {
+	return nil
+}
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SimonRichardson/formed/pkg/fs"
+	"github.com/pkg/errors"
+)
+
+// Opener creates a Store for the location described by the URL. The
+// filesystem is supplied for backends that store their data in plain files,
+// the columns are the names of the fields held by every user for backends
+// that store their values by position.
+type Opener func(fsys fs.Filesystem, u *url.URL, columns []string) (Store, error)
+
+var (
+	openersMutex sync.RWMutex
+	openers      = make(map[string]Opener)
+)
+
+// Register makes a storage backend available for the scheme. If Register is
+// called twice with the same scheme, it panics.
+func Register(scheme string, opener Opener) {
+	openersMutex.Lock()
+	defer openersMutex.Unlock()
+
+	scheme = strings.ToLower(scheme)
+	if _, ok := openers[scheme]; ok {
+		panic("store: Register called twice for scheme " + scheme)
+	}
+	openers[scheme] = opener
+}
+
+// Schemes returns a sorted list of the schemes that have been registered.
+func Schemes() []string {
+	openersMutex.RLock()
+	defer openersMutex.RUnlock()
+
+	schemes := make([]string, 0, len(openers))
+	for scheme := range openers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Open creates a Store from the location, using the backend registered for
+// the scheme of the location, i.e. "json:///path/to/store.json".
+// A location without a scheme is treated as a path to a csv file.
+func Open(fsys fs.Filesystem, location string, columns []string) (Store, error) {
+	u, err := parseLocation(location)
+	if err != nil {
+		return nil, err
+	}
+
+	openersMutex.RLock()
+	opener, ok := openers[strings.ToLower(u.Scheme)]
+	openersMutex.RUnlock()
+	if !ok {
+		return nil, errors.Errorf("unknown store scheme %q, expected one of %s", u.Scheme, strings.Join(Schemes(), ", "))
+	}
+
+	return opener(fsys, u, columns)
+}
+
+// LockTimeout returns how long the store at the location waits for a lock
+// held by another process, from the "lock_timeout" query of the location. It's
+// DefaultLockTimeout if the location doesn't set one.
+func LockTimeout(location string) (time.Duration, error) {
+	u, err := parseLocation(location)
+	if err != nil {
+		return 0, err
+	}
+	return lockTimeout(u)
+}
+
+// parseLocation parses the location as a URL. A plain path, or a windows style
+// path (c:\path), is a csv file, any query after the path is still read, i.e.
+// "./data/store.csv?lock_timeout=30s".
+func parseLocation(location string) (*url.URL, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid store location %q", location)
+	}
+
+	if u.Scheme == "" || len(u.Scheme) == 1 {
+		path, query := location, ""
+		if i := strings.IndexByte(location, '?'); i >= 0 {
+			path, query = location[:i], location[i+1:]
+		}
+		u = &url.URL{Scheme: "csv", Opaque: path, RawQuery: query}
+	}
+	return u, nil
+}
+
+// locationPath gets the file path from the URL, it allows both absolute
+// (csv:///path/to/file) and relative (csv://./path/to/file or csv:path/to/file)
+// paths.
+func locationPath(u *url.URL) (string, error) {
+	path := u.Opaque
+	if path == "" {
+		path = u.Host + u.Path
+	}
+	if path == "" {
+		return "", errors.Errorf("expected a path for %q", u.String())
+	}
+	return path, nil
+}
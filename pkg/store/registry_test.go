@@ -0,0 +1,178 @@
+package store
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/SimonRichardson/formed/pkg/fs"
+)
+
+func TestOpen(t *testing.T) {
+	t.Parallel()
+
+	t.Run("plain path is csv", func(t *testing.T) {
+		s, err := Open(fs.New(), "./data/store.csv", columns)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store, ok := s.(*realStore)
+		if !ok {
+			t.Fatalf("expected: *realStore, actual: %T", s)
+		}
+		if expected, actual := "./data/store.csv", store.path; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := (csvCodec{columns: columns}), store.codec; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		s, err := Open(fs.New(), "json:///tmp/store.json", columns)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store, ok := s.(*realStore)
+		if !ok {
+			t.Fatalf("expected: *realStore, actual: %T", s)
+		}
+		if expected, actual := (jsonCodec{}), store.codec; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("lock timeout", func(t *testing.T) {
+		s, err := Open(fs.New(), "jsonl:./data/store.jsonl?lock_timeout=30s", columns)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store, ok := s.(*realStore)
+		if !ok {
+			t.Fatalf("expected: *realStore, actual: %T", s)
+		}
+		if expected, actual := "./data/store.jsonl", store.path; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 30*time.Second, store.lockTimeout; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("lock timeout of a plain path", func(t *testing.T) {
+		s, err := Open(fs.New(), "./data/store.csv?lock_timeout=30s", columns)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store, ok := s.(*realStore)
+		if !ok {
+			t.Fatalf("expected: *realStore, actual: %T", s)
+		}
+		if expected, actual := "./data/store.csv", store.path; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 30*time.Second, store.lockTimeout; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("invalid lock timeout", func(t *testing.T) {
+		_, err := Open(fs.New(), "csv:./data/store.csv?lock_timeout=soon", columns)
+
+		if expected, actual := false, err == nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("mem", func(t *testing.T) {
+		s, err := Open(fs.New(), "mem://", columns)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := s.(*memStore); !ok {
+			t.Fatalf("expected: *memStore, actual: %T", s)
+		}
+	})
+
+	t.Run("unknown scheme", func(t *testing.T) {
+		_, err := Open(fs.New(), "bolt:///tmp/store.db", columns)
+
+		if expected, actual := false, err == nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("missing path", func(t *testing.T) {
+		_, err := Open(fs.New(), "csv://", columns)
+
+		if expected, actual := false, err == nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestLockTimeout(t *testing.T) {
+	t.Parallel()
+
+	for location, want := range map[string]time.Duration{
+		"./data/store.csv":                     DefaultLockTimeout,
+		"./data/store.csv?lock_timeout=30s":    30 * time.Second,
+		"wal:./data/store.wal?lock_timeout=1m": time.Minute,
+		"mem://":                               DefaultLockTimeout,
+	} {
+		timeout, err := LockTimeout(location)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := want, timeout; expected != actual {
+			t.Errorf("%s: expected: %v, actual: %v", location, expected, actual)
+		}
+	}
+
+	if _, err := LockTimeout("./data/store.csv?lock_timeout=soon"); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestLocationPath(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		location string
+		path     string
+	}{
+		{"csv:///path/to/store.csv", "/path/to/store.csv"},
+		{"csv://./path/to/store.csv", "./path/to/store.csv"},
+		{"csv:path/to/store.csv", "path/to/store.csv"},
+		{"json://store.json", "store.json"},
+	} {
+		u, err := url.Parse(testcase.location)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		path, err := locationPath(u)
+		if err != nil {
+			t.Errorf("%q: %v", testcase.location, err)
+			continue
+		}
+		if expected, actual := testcase.path, path; expected != actual {
+			t.Errorf("%q: expected: %v, actual: %v", testcase.location, expected, actual)
+		}
+	}
+}
+
+func TestSchemes(t *testing.T) {
+	t.Parallel()
+
+	want := []string{"csv", "json", "jsonl", "mem", "sqlite", "wal"}
+	if expected, actual := want, Schemes(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+}
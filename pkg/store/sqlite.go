@@ -0,0 +1,239 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/SimonRichardson/formed/pkg/fs"
+	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/pkg/errors"
+
+	// Pure go sqlite driver, so no cgo is required.
+	_ "modernc.org/sqlite"
+)
+
+func init() {
+	Register("sqlite", func(_ fs.Filesystem, u *url.URL, _ []string) (Store, error) {
+		path, err := locationPath(u)
+		if err != nil {
+			return nil, err
+		}
+		return NewSQLite(path)
+	})
+}
+
+const (
+	sqliteSchema = `CREATE TABLE IF NOT EXISTS users (
+		position INTEGER PRIMARY KEY,
+		data     TEXT NOT NULL
+	)`
+)
+
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// NewSQLite creates a store where the users are stored in a sqlite database
+// found at path, the database is created if it doesn't exist.
+func NewSQLite(path string) (Store, error) {
+	// Transactions are started immediately, so that the version check and the
+	// write happen under the same lock, even across processes.
+	dsn := fmt.Sprintf("file:%s?_txlock=immediate&_pragma=busy_timeout(5000)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open database at %q", path)
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, errors.Wrapf(err, "unable to create schema in database at %q", path)
+	}
+
+	s := &sqliteStore{
+		db: db,
+	}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, errors.Wrapf(err, "unable to migrate database at %q", path)
+	}
+	return s, nil
+}
+
+// Read reads all the user models from the storage along with the version
+// of what was read, or it returns an error if there issue.
+func (s *sqliteStore) Read() ([]models.User, Version, error) {
+	users, err := s.read(s.db)
+	if err != nil {
+		return nil, AnyVersion, err
+	}
+
+	version, err := versionOf(users)
+	if err != nil {
+		return nil, AnyVersion, err
+	}
+
+	return users, version, nil
+}
+
+// Scan calls fn with every user held by the storage in order, reading one
+// user at a time from the database. If fn returns an error the scan stops and
+// the error is returned as it is. The version of the users that were scanned
+// is returned.
+func (s *sqliteStore) Scan(fn func(models.User) error) (Version, error) {
+	hash := newVersionHash()
+	if err := s.scan(s.db, func(user models.User) error {
+		if err := hash.add(user); err != nil {
+			return err
+		}
+		return fn(user)
+	}); err != nil {
+		return AnyVersion, err
+	}
+	return hash.version(), nil
+}
+
+// Write, writes users to the underlying storage, as long as the storage is
+// still at the version supplied. If the users have changed underneath then
+// nothing is written and a *ConflictError is returned. Passing AnyVersion
+// writes the users unconditionally. The new version is returned.
+// Any user without an id is given one.
+func (s *sqliteStore) Write(users []models.User, version Version) (Version, error) {
+	users, err := withIDs(users)
+	if err != nil {
+		return AnyVersion, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return AnyVersion, errors.Wrap(err, "unable to begin transaction")
+	}
+	defer tx.Rollback()
+
+	if version != AnyVersion {
+		current, err := s.read(tx)
+		if err != nil {
+			return AnyVersion, err
+		}
+		if err := checkVersion(current, version); err != nil {
+			return AnyVersion, err
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM users`); err != nil {
+		return AnyVersion, errors.Wrap(err, "unable to delete users")
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO users (position, data) VALUES (?, ?)`)
+	if err != nil {
+		return AnyVersion, errors.Wrap(err, "unable to prepare insert")
+	}
+	defer stmt.Close()
+
+	for k, v := range users {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return AnyVersion, errors.Wrapf(err, "unable to marshal user at index %d", k)
+		}
+		if _, err := stmt.Exec(k, string(data)); err != nil {
+			return AnyVersion, errors.Wrapf(err, "unable to insert user at index %d", k)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return AnyVersion, errors.Wrap(err, "unable to commit transaction")
+	}
+
+	return versionOf(users)
+}
+
+// Check makes sure the users can be read and that the write lock of the
+// database can be taken, the transaction is rolled back straight away so
+// nothing is written.
+func (s *sqliteStore) Check() error {
+	rows, err := s.db.Query(`SELECT position FROM users LIMIT 1`)
+	if err != nil {
+		return errors.Wrap(err, "unable to read")
+	}
+	rows.Close()
+
+	// Transactions are started immediately, which takes the write lock.
+	tx, err := s.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "unable to write")
+	}
+	return tx.Rollback()
+}
+
+// migrate gives every user written before users had ids an id.
+func (s *sqliteStore) migrate() error {
+	users, err := s.read(s.db)
+	if err != nil {
+		return err
+	}
+	if !models.MissingIDs(users) {
+		return nil
+	}
+
+	version, err := versionOf(users)
+	if err != nil {
+		return err
+	}
+	// Somebody else writing in the meantime will have given out the ids.
+	if _, err := s.Write(users, version); err != nil {
+		if _, ok := ErrConflict(err); ok {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// Close closes the database, waiting for any query that has already started
+// to finish.
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+// querier allows reading from both the database and a transaction.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (s *sqliteStore) read(q querier) ([]models.User, error) {
+	users := make([]models.User, 0)
+	if err := s.scan(q, func(user models.User) error {
+		users = append(users, user)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// scan calls fn with every user in order, only one row is held in memory at a
+// time.
+func (s *sqliteStore) scan(q querier, fn func(models.User) error) error {
+	rows, err := q.Query(`SELECT data FROM users ORDER BY position`)
+	if err != nil {
+		return errors.Wrap(err, "unable to query users")
+	}
+	defer rows.Close()
+
+	for index := 0; rows.Next(); index++ {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return errors.Wrap(err, "unable to scan user")
+		}
+
+		var user models.User
+		if err := json.Unmarshal([]byte(data), &user); err != nil {
+			return errors.Wrapf(err, "unable to parse user for index %d", index)
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
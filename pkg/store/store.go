@@ -1,15 +1,90 @@
 package store
 
-import "github.com/SimonRichardson/formed/pkg/models"
+import (
+	"io"
+
+	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/pkg/errors"
+)
 
 // Store is an abstraction over a underlying storage system, that allows us to
 // create different implementations including mock implementation for better
 // unit testing.
 type Store interface {
-	// Read reads all the user models from the storage, or it returns an error
-	// if there issue.
-	Read() ([]models.User, error)
+	// Read reads all the user models from the storage along with the version
+	// of what was read, or it returns an error if there issue.
+	Read() ([]models.User, Version, error)
+
+	// Write, writes users to the underlying storage, as long as the storage is
+	// still at the version supplied. If the users have changed underneath then
+	// nothing is written and a *ConflictError is returned. Passing AnyVersion
+	// writes the users unconditionally. The new version is returned.
+	Write([]models.User, Version) (Version, error)
+
+	// Scan calls fn with every user held by the storage in order, without
+	// reading all of the users in to memory where the storage allows it. If fn
+	// returns an error the scan stops and the error is returned as it is. The
+	// version of the users that were scanned is returned. The store can't be
+	// used from within fn.
+	Scan(fn func(models.User) error) (Version, error)
+}
+
+// Close closes the store if it holds on to anything, i.e. an open file or a
+// database, otherwise nothing happens. The store can't be used afterwards.
+func Close(s Store) error {
+	if closer, ok := s.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// checker is implemented by the stores that can check they're still usable
+// without reading or writing any of the users.
+type checker interface {
+	Check() error
+}
+
+// Check makes sure the store can be read from and written to, without
+// changing anything held by it. Stores that can check themselves do so, i.e.
+// by writing a file alongside the users, otherwise the users are scanned.
+// Nothing is ever written back, as checking is expected to be cheap and
+// frequent.
+func Check(s Store) error {
+	if c, ok := s.(checker); ok {
+		return c.Check()
+	}
+	if _, err := s.Scan(func(models.User) error { return nil }); err != nil {
+		return errors.Wrap(err, "unable to read")
+	}
+	return nil
+}
+
+// scanUsers calls fn with a copy of every user, for the stores that already
+// hold all of the users in memory.
+func scanUsers(users []models.User, fn func(models.User) error) (Version, error) {
+	hash := newVersionHash()
+	for _, v := range users {
+		if err := hash.add(v); err != nil {
+			return AnyVersion, err
+		}
+		if err := fn(v.Copy()); err != nil {
+			return AnyVersion, err
+		}
+	}
+	return hash.version(), nil
+}
+
+// withIDs gives every user without an id a new one, making sure that no two
+// users share the same id.
+func withIDs(users []models.User) ([]models.User, error) {
+	users = models.EnsureIDs(users)
 
-	// Write, writes users to the underlying storage.
-	Write([]models.User) error
+	ids := make(map[string]struct{}, len(users))
+	for k, v := range users {
+		if _, ok := ids[v.ID]; ok {
+			return nil, errors.Errorf("duplicate id %q for user at index %d", v.ID, k)
+		}
+		ids[v.ID] = struct{}{}
+	}
+	return users, nil
 }
@@ -0,0 +1,318 @@
+// Package storetest provides a conformance suite that every store.Store
+// implementation is expected to pass.
+package storetest
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/SimonRichardson/formed/pkg/store"
+)
+
+// Factory creates a new, empty store for each test that is run.
+type Factory func(t *testing.T) store.Store
+
+// Test runs the conformance suite against the stores created by the factory.
+func Test(t *testing.T, factory Factory) {
+	t.Run("write then read", func(t *testing.T) {
+		var (
+			s    = factory(t)
+			want = []models.User{
+				models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+				models.User{ID: "j2", Fields: models.Fields{"firstname": "jane", "surname": "doe"}},
+			}
+		)
+
+		version := write(t, s, want, store.AnyVersion)
+
+		users, readVersion := read(t, s)
+		if expected, actual := want, users; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := version, readVersion; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("write nothing", func(t *testing.T) {
+		s := factory(t)
+
+		write(t, s, []models.User{
+			models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+		}, store.AnyVersion)
+		write(t, s, []models.User{}, store.AnyVersion)
+
+		users, _ := read(t, s)
+		if expected, actual := 0, len(users); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("shorter writes replace everything", func(t *testing.T) {
+		var (
+			s    = factory(t)
+			want = []models.User{
+				models.User{ID: "j3", Fields: models.Fields{"firstname": "joe", "surname": "bloggs"}},
+			}
+		)
+
+		write(t, s, []models.User{
+			models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+			models.User{ID: "j2", Fields: models.Fields{"firstname": "jane", "surname": "doe"}},
+		}, store.AnyVersion)
+		write(t, s, want, store.AnyVersion)
+
+		users, _ := read(t, s)
+		if expected, actual := want, users; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("versions follow the users", func(t *testing.T) {
+		var (
+			s     = factory(t)
+			users = []models.User{
+				models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+			}
+		)
+
+		first := write(t, s, users, store.AnyVersion)
+		second := write(t, s, []models.User{
+			models.User{ID: "j2", Fields: models.Fields{"firstname": "jane", "surname": "doe"}},
+		}, first)
+		if first == second {
+			t.Errorf("expected: different versions, actual: %v", first)
+		}
+
+		third := write(t, s, users, second)
+		if expected, actual := first, third; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("read does not share memory", func(t *testing.T) {
+		s := factory(t)
+
+		write(t, s, []models.User{
+			models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+		}, store.AnyVersion)
+
+		users, _ := read(t, s)
+		users[0].Set("firstname", "changed")
+
+		users, _ = read(t, s)
+		if expected, actual := "fred", users[0].Get("firstname"); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("scan matches read", func(t *testing.T) {
+		var (
+			s    = factory(t)
+			want = []models.User{
+				models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+				models.User{ID: "j2", Fields: models.Fields{"firstname": "jane", "surname": "doe"}},
+			}
+		)
+
+		version := write(t, s, want, store.AnyVersion)
+
+		users := make([]models.User, 0)
+		scanned, err := s.Scan(func(user models.User) error {
+			users = append(users, user)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := want, users; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := version, scanned; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("scan stops on error", func(t *testing.T) {
+		s := factory(t)
+
+		write(t, s, []models.User{
+			models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+			models.User{ID: "j2", Fields: models.Fields{"firstname": "jane", "surname": "doe"}},
+		}, store.AnyVersion)
+
+		var (
+			stop  = errors.New("stop")
+			calls int
+		)
+		_, err := s.Scan(func(models.User) error {
+			calls++
+			return stop
+		})
+		if expected, actual := stop, err; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 1, calls; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		// The store can still be used afterwards.
+		read(t, s)
+	})
+
+	t.Run("users are given ids", func(t *testing.T) {
+		s := factory(t)
+
+		write(t, s, []models.User{
+			models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+			models.User{Fields: models.Fields{"firstname": "jane", "surname": "doe"}},
+		}, store.AnyVersion)
+
+		users, _ := read(t, s)
+		if expected, actual := "f1", users[0].ID; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if users[1].ID == "" {
+			t.Errorf("expected: an id, actual: %v", users[1])
+		}
+
+		// The ids don't change between reads.
+		again, _ := read(t, s)
+		if expected, actual := users, again; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("duplicate ids are rejected", func(t *testing.T) {
+		s := factory(t)
+
+		_, err := s.Write([]models.User{
+			models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+			models.User{ID: "f1", Fields: models.Fields{"firstname": "jane", "surname": "doe"}},
+		}, store.AnyVersion)
+		if expected, actual := true, err != nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("check leaves the users alone", func(t *testing.T) {
+		var (
+			s     = factory(t)
+			users = []models.User{
+				models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+			}
+		)
+
+		version := write(t, s, users, store.AnyVersion)
+		if err := store.Check(s); err != nil {
+			t.Fatal(err)
+		}
+
+		actual, actualVersion := read(t, s)
+		if expected := users; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected := version; expected != actualVersion {
+			t.Errorf("expected: %v, actual: %v", expected, actualVersion)
+		}
+	})
+
+	t.Run("stale write conflicts", func(t *testing.T) {
+		var (
+			s       = factory(t)
+			current = []models.User{
+				models.User{ID: "j2", Fields: models.Fields{"firstname": "jane", "surname": "doe"}},
+			}
+		)
+
+		stale := write(t, s, []models.User{
+			models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+		}, store.AnyVersion)
+		latest := write(t, s, current, stale)
+
+		_, err := s.Write([]models.User{
+			models.User{ID: "j3", Fields: models.Fields{"firstname": "joe", "surname": "bloggs"}},
+		}, stale)
+		conflict, ok := store.ErrConflict(err)
+		if !ok {
+			t.Fatalf("expected: conflict error, actual: %v", err)
+		}
+		if expected, actual := stale, conflict.Expected; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := latest, conflict.Actual; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := current, conflict.Users; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		users, _ := read(t, s)
+		if expected, actual := current, users; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("concurrent writes with the same version", func(t *testing.T) {
+		s := factory(t)
+
+		version := write(t, s, []models.User{
+			models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+		}, store.AnyVersion)
+
+		const writers = 8
+		var (
+			wg        sync.WaitGroup
+			mutex     sync.Mutex
+			succeeded int
+			conflicts int
+		)
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				_, err := s.Write([]models.User{
+					models.User{ID: "f1", Fields: models.Fields{"firstname": "writer", "surname": string('a' + rune(i))}},
+				}, version)
+
+				mutex.Lock()
+				defer mutex.Unlock()
+				if _, ok := store.ErrConflict(err); ok {
+					conflicts++
+				} else if err == nil {
+					succeeded++
+				} else {
+					t.Error(err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		if expected, actual := 1, succeeded; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := writers-1, conflicts; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func read(t *testing.T, s store.Store) ([]models.User, store.Version) {
+	users, version, err := s.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return users, version
+}
+
+func write(t *testing.T, s store.Store, users []models.User, version store.Version) store.Version {
+	version, err := s.Write(users, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+
+	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/pkg/errors"
+)
+
+// Version identifies the state of the users held in a store at a point in
+// time. It changes whenever the users change, so it can be used in a similar
+// way to an ETag.
+type Version string
+
+// AnyVersion tells the store to skip the version check when writing.
+const AnyVersion Version = ""
+
+// versionOf computes the version from the users themselves, so the same users
+// always produce the same version regardless of the underlying storage.
+func versionOf(users []models.User) (Version, error) {
+	hash := newVersionHash()
+	for _, v := range users {
+		if err := hash.add(v); err != nil {
+			return AnyVersion, err
+		}
+	}
+	return hash.version(), nil
+}
+
+// versionHash computes the version one user at a time, so the version of a
+// store can be worked out without holding all of the users in memory.
+type versionHash struct {
+	hash  hash.Hash
+	index int
+}
+
+func newVersionHash() *versionHash {
+	return &versionHash{
+		hash: sha256.New(),
+	}
+}
+
+func (h *versionHash) add(user models.User) error {
+	// The fields are marshalled in the order of their names, so the same
+	// fields always hash the same way.
+	b, err := json.Marshal(user)
+	if err != nil {
+		return errors.Wrapf(err, "unable to marshal user at index %d", h.index)
+	}
+	h.hash.Write(b)
+	h.hash.Write([]byte{'\n'})
+	h.index++
+	return nil
+}
+
+func (h *versionHash) version() Version {
+	return Version(hex.EncodeToString(h.hash.Sum(nil))[:32])
+}
+
+// checkVersion makes sure the current users are still at the expected version,
+// otherwise a *ConflictError is returned. AnyVersion is always expected.
+func checkVersion(current []models.User, expected Version) error {
+	if expected == AnyVersion {
+		return nil
+	}
+
+	actual, err := versionOf(current)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return &ConflictError{
+			Expected: expected,
+			Actual:   actual,
+			Users:    current,
+		}
+	}
+	return nil
+}
+
+// ConflictError is returned when a write is attempted against a version of
+// the store that is no longer current. It holds the current users, so the
+// conflict can be shown to whoever attempted the write.
+type ConflictError struct {
+	Expected, Actual Version
+	Users            []models.User
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("store has changed: expected version %q, actual version %q", e.Expected, e.Actual)
+}
+
+// ErrConflict returns the *ConflictError held within the error if there is
+// one.
+func ErrConflict(err error) (*ConflictError, bool) {
+	conflict, ok := errors.Cause(err).(*ConflictError)
+	return conflict, ok
+}
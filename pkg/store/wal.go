@@ -0,0 +1,629 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SimonRichardson/formed/pkg/fs"
+	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	Register("wal", func(fsys fs.Filesystem, u *url.URL, _ []string) (Store, error) {
+		path, err := locationPath(u)
+		if err != nil {
+			return nil, err
+		}
+
+		compactEvery := defaultCompactEvery
+		if value := u.Query().Get("compact"); value != "" {
+			if compactEvery, err = strconv.Atoi(value); err != nil || compactEvery <= 0 {
+				return nil, errors.Errorf("expected compact to be a positive number, actual %q", value)
+			}
+		}
+
+		timeout, err := lockTimeout(u)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewWAL(fsys, path, compactEvery, timeout)
+	})
+}
+
+const (
+	defaultCompactEvery = 1000
+
+	walLogSuffix = ".log"
+)
+
+type walOp string
+
+const (
+	walCreate walOp = "create"
+	walUpdate walOp = "update"
+	walDelete walOp = "delete"
+	walMove   walOp = "move"
+)
+
+// walRecord is a single mutation held in the log. A Write can produce many
+// records, only the last of which is marked as the commit, so that a write
+// is only ever replayed in full.
+// Users are addressed by their id, the index is the position a user is
+// created at or moved to. Records written before users had ids address the
+// user by the index instead.
+type walRecord struct {
+	Seq    uint64       `json:"seq"`
+	Op     walOp        `json:"op"`
+	ID     string       `json:"id,omitempty"`
+	Index  int          `json:"index"`
+	User   *models.User `json:"user,omitempty"`
+	Commit bool         `json:"commit,omitempty"`
+}
+
+// walSnapshot is the materialised state of the store up to and including the
+// record with the sequence number.
+type walSnapshot struct {
+	Seq   uint64        `json:"seq"`
+	Users []models.User `json:"users"`
+}
+
+type walStore struct {
+	mutex        sync.Mutex
+	fsys         fs.Filesystem
+	path         string
+	logPath      string
+	log          fs.File
+	lockTimeout  time.Duration
+	size         int64
+	users        []models.User
+	seq          uint64
+	snapshotSeq  uint64
+	pending      int
+	compactEvery int
+}
+
+// NewWAL creates a store that appends every mutation of the users to a log
+// (path + ".log") and keeps the current users in memory. Every compactEvery
+// records the users are written as a snapshot to path and the log is
+// truncated. Opening the store recovers the users from the snapshot and the
+// log, a torn record at the end of the log from a crash is discarded.
+// Every operation takes a lock on path, shared to read and exclusive to
+// write, and first catches up with whatever other processes have appended to
+// the log or compacted in to a snapshot since. So the store can be open in
+// more than one process at a time, i.e. the server and the users mode.
+func NewWAL(fsys fs.Filesystem, path string, compactEvery int, lockTimeout time.Duration) (Store, error) {
+	w := &walStore{
+		fsys:         fsys,
+		path:         path,
+		logPath:      fmt.Sprintf("%s%s", path, walLogSuffix),
+		lockTimeout:  lockTimeout,
+		users:        make([]models.User, 0),
+		compactEvery: compactEvery,
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// open recovers the users and then opens the log for appending.
+func (w *walStore) open() error {
+	lock, err := w.lock(fs.Exclusive)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	if err := w.recover(); err != nil {
+		return err
+	}
+
+	log, err := w.fsys.Append(w.logPath)
+	if err != nil {
+		return errors.Wrapf(err, "unable to open log at %q", w.logPath)
+	}
+	w.log = log
+
+	// Users recovered from before users had ids are given one, which is made
+	// durable straight away with a snapshot.
+	if models.MissingIDs(w.users) {
+		w.users = models.EnsureIDs(w.users)
+		if err := w.compact(); err != nil {
+			log.Close()
+			return errors.Wrap(err, "unable to migrate ids")
+		}
+	}
+	return nil
+}
+
+// Read reads all the user models from the storage along with the version
+// of what was read, or it returns an error if there issue.
+func (w *walStore) Read() ([]models.User, Version, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if err := w.catchUpShared(); err != nil {
+		return nil, AnyVersion, err
+	}
+
+	version, err := versionOf(w.users)
+	if err != nil {
+		return nil, AnyVersion, err
+	}
+
+	return copyUsers(w.users), version, nil
+}
+
+// Scan calls fn with every user held by the storage in order. If fn returns
+// an error the scan stops and the error is returned as it is. The version of
+// the users that were scanned is returned.
+func (w *walStore) Scan(fn func(models.User) error) (Version, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if err := w.catchUpShared(); err != nil {
+		return AnyVersion, err
+	}
+
+	return scanUsers(w.users, fn)
+}
+
+// Write, writes users to the underlying storage, as long as the storage is
+// still at the version supplied. If the users have changed underneath then
+// nothing is written and a *ConflictError is returned. Passing AnyVersion
+// writes the users unconditionally. The new version is returned.
+// Only the differences between the current users and the new users are
+// appended to the log. Any user without an id is given one.
+func (w *walStore) Write(users []models.User, version Version) (Version, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	users, err := withIDs(users)
+	if err != nil {
+		return AnyVersion, err
+	}
+
+	lock, err := w.lock(fs.Exclusive)
+	if err != nil {
+		return AnyVersion, err
+	}
+	defer lock.Release()
+
+	if err := w.catchUp(); err != nil {
+		return AnyVersion, err
+	}
+
+	if err := checkVersion(copyUsers(w.users), version); err != nil {
+		return AnyVersion, err
+	}
+
+	records := diffUsers(w.users, users, w.seq+1)
+	if len(records) == 0 {
+		return versionOf(w.users)
+	}
+
+	var buf bytes.Buffer
+	for _, record := range records {
+		if err := encodeWALRecord(&buf, record); err != nil {
+			return AnyVersion, err
+		}
+	}
+
+	if err := w.append(buf.Bytes()); err != nil {
+		return AnyVersion, err
+	}
+
+	w.users = copyUsers(users)
+	w.seq = records[len(records)-1].Seq
+	w.pending += len(records)
+
+	// The write is already durable in the log, so failing to compact
+	// shouldn't fail the write. Compaction will be attempted again on the
+	// next write.
+	if w.pending >= w.compactEvery {
+		w.compact()
+	}
+
+	return versionOf(w.users)
+}
+
+// Check makes sure a snapshot can still be written next to the log. The users
+// are already held in memory, so there is nothing to read.
+func (w *walStore) Check() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return checkWritable(w.fsys, w.path)
+}
+
+// Close waits for any write in progress to finish and then closes the log.
+func (w *walStore) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if err := w.log.Close(); err != nil {
+		return errors.Wrapf(err, "unable to close log at %q", w.logPath)
+	}
+	return nil
+}
+
+func (w *walStore) lock(mode fs.LockMode) (fs.Lock, error) {
+	return w.fsys.Lock(w.path, mode, w.lockTimeout)
+}
+
+// catchUpShared catches up under a shared lock, for reading.
+func (w *walStore) catchUpShared() error {
+	lock, err := w.lock(fs.Shared)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	return w.catchUp()
+}
+
+// catchUp brings the users held in memory up to date with what other
+// processes have written since, it expects the store to be locked. If the
+// log has been compacted the users are recovered from the new snapshot,
+// otherwise only the records appended after the last one seen are replayed.
+func (w *walStore) catchUp() error {
+	seq, err := w.readSnapshotSeq()
+	if err != nil {
+		return err
+	}
+	if seq != w.snapshotSeq {
+		return w.recover()
+	}
+	return w.replay()
+}
+
+// append writes the bytes to the end of the log and syncs them. Anything
+// after the last commit, a torn or uncommitted record left by a crash, is
+// dropped first so that the new records don't follow it. If anything fails
+// the log is truncated back to where it was, so that the next append doesn't
+// follow a partial write.
+func (w *walStore) append(b []byte) error {
+	if err := w.log.Truncate(w.size); err != nil {
+		return errors.Wrapf(err, "unable to truncate log at %q", w.logPath)
+	}
+	if _, err := w.log.Write(b); err != nil {
+		w.log.Truncate(w.size)
+		return errors.Wrapf(err, "unable to append to log at %q", w.logPath)
+	}
+	if err := w.log.Sync(); err != nil {
+		w.log.Truncate(w.size)
+		return errors.Wrapf(err, "unable to sync log at %q", w.logPath)
+	}
+	w.size += int64(len(b))
+	return nil
+}
+
+// compact writes the current users as a snapshot and then truncates the log.
+// If a crash happens after the snapshot, but before the truncation, then the
+// records already held in the snapshot are skipped on recovery.
+func (w *walStore) compact() error {
+	snapshot := walSnapshot{
+		Seq:   w.seq,
+		Users: w.users,
+	}
+	if err := writeAtomic(w.fsys, w.path, func(writer io.Writer) error {
+		return json.NewEncoder(writer).Encode(snapshot)
+	}); err != nil {
+		return err
+	}
+	w.snapshotSeq = w.seq
+
+	if err := w.log.Truncate(0); err != nil {
+		return errors.Wrapf(err, "unable to truncate log at %q", w.logPath)
+	}
+	if err := w.log.Sync(); err != nil {
+		return errors.Wrapf(err, "unable to sync log at %q", w.logPath)
+	}
+
+	w.size = 0
+	w.pending = 0
+	return nil
+}
+
+// recover loads the latest snapshot and then replays the committed records
+// in the log that came after it.
+func (w *walStore) recover() error {
+	w.users = make([]models.User, 0)
+	w.seq, w.snapshotSeq = 0, 0
+	w.size, w.pending = 0, 0
+
+	if w.fsys.Exists(w.path) {
+		file, err := w.fsys.Open(w.path)
+		if err != nil {
+			return errors.Wrapf(err, "unable to open snapshot at %q", w.path)
+		}
+		defer file.Close()
+
+		var snapshot walSnapshot
+		if err := json.NewDecoder(file).Decode(&snapshot); err != nil {
+			return errors.Wrapf(err, "unable to read snapshot at %q", w.path)
+		}
+		if snapshot.Users != nil {
+			w.users = snapshot.Users
+		}
+		w.seq, w.snapshotSeq = snapshot.Seq, snapshot.Seq
+	}
+
+	return w.replay()
+}
+
+// replay applies the committed records in the log from the offset already
+// replayed up to. Anything after the last commit is left alone, the next
+// append drops it.
+func (w *walStore) replay() error {
+	if !w.fsys.Exists(w.logPath) {
+		return nil
+	}
+
+	file, err := w.fsys.Open(w.logPath)
+	if err != nil {
+		return errors.Wrapf(err, "unable to open log at %q", w.logPath)
+	}
+	defer file.Close()
+
+	end, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return errors.Wrapf(err, "unable to seek log at %q", w.logPath)
+	}
+	// Only a compaction truncates the log and that also writes a snapshot,
+	// but if the log is shorter anyway then start again from the snapshot.
+	if end < w.size {
+		return w.recover()
+	}
+	if _, err := file.Seek(w.size, io.SeekStart); err != nil {
+		return errors.Wrapf(err, "unable to seek log at %q", w.logPath)
+	}
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read log at %q", w.logPath)
+	}
+
+	records, offset, err := scanWAL(data)
+	if err != nil {
+		return errors.Wrapf(err, "unable to recover log at %q", w.logPath)
+	}
+
+	for _, record := range records {
+		// Already part of the snapshot.
+		if record.Seq <= w.seq {
+			continue
+		}
+		if expected := w.seq + 1; record.Seq != expected {
+			return errors.Errorf("unable to recover log at %q: expected sequence %d, actual %d", w.logPath, expected, record.Seq)
+		}
+		if w.users, err = applyWALRecord(w.users, record); err != nil {
+			return errors.Wrapf(err, "unable to recover log at %q", w.logPath)
+		}
+		w.seq = record.Seq
+		w.pending++
+	}
+	w.size += int64(offset)
+
+	return nil
+}
+
+// readSnapshotSeq reads only the sequence number at the start of the
+// snapshot, without the users, or 0 if there is no snapshot yet.
+func (w *walStore) readSnapshotSeq() (uint64, error) {
+	if !w.fsys.Exists(w.path) {
+		return 0, nil
+	}
+
+	file, err := w.fsys.Open(w.path)
+	if err != nil {
+		return 0, errors.Wrapf(err, "unable to open snapshot at %q", w.path)
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.UseNumber()
+
+	var tokens []json.Token
+	for i := 0; i < 3; i++ {
+		token, err := decoder.Token()
+		if err != nil {
+			return 0, errors.Wrapf(err, "unable to read snapshot at %q", w.path)
+		}
+		tokens = append(tokens, token)
+	}
+
+	number, ok := tokens[2].(json.Number)
+	if tokens[0] != json.Delim('{') || tokens[1] != "seq" || !ok {
+		return 0, errors.Errorf("unable to read snapshot at %q: expected the sequence first", w.path)
+	}
+	seq, err := strconv.ParseUint(number.String(), 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "unable to read snapshot at %q", w.path)
+	}
+	return seq, nil
+}
+
+// diffUsers works out the records required to go from the old users to the
+// new users, the sequence numbers start from seq. Users are matched by their
+// id, so only the users that were removed, added, changed or moved produce a
+// record.
+func diffUsers(old, new []models.User, seq uint64) []walRecord {
+	var records []walRecord
+	add := func(op walOp, id string, index int, user *models.User) {
+		records = append(records, walRecord{
+			Seq:   seq + uint64(len(records)),
+			Op:    op,
+			ID:    id,
+			Index: index,
+			User:  user,
+		})
+	}
+
+	ids := make(map[string]struct{}, len(new))
+	for _, v := range new {
+		ids[v.ID] = struct{}{}
+	}
+
+	// Remove the users that are no longer wanted, then walk the new users in
+	// order. Everything before the current index is already in place, so a
+	// user is either created or moved in to place and then updated.
+	current := make([]models.User, 0, len(old))
+	for _, v := range old {
+		if _, ok := ids[v.ID]; !ok {
+			add(walDelete, v.ID, 0, nil)
+			continue
+		}
+		current = append(current, v)
+	}
+
+	for i, v := range new {
+		user := v
+		j := indexOf(current, v.ID)
+		if j < 0 {
+			add(walCreate, v.ID, i, &user)
+			current = insertUser(current, i, v)
+			continue
+		}
+		if j != i {
+			add(walMove, v.ID, i, nil)
+			moved := current[j]
+			current = insertUser(append(current[:j], current[j+1:]...), i, moved)
+		}
+		if !current[i].Equal(v) {
+			add(walUpdate, v.ID, i, &user)
+			current[i] = v
+		}
+	}
+
+	if len(records) > 0 {
+		records[len(records)-1].Commit = true
+	}
+	return records
+}
+
+func applyWALRecord(users []models.User, record walRecord) ([]models.User, error) {
+	// Records written before users had ids address the user by the index.
+	index := record.Index
+	if record.ID != "" && record.Op != walCreate {
+		index = indexOf(users, record.ID)
+	}
+
+	switch record.Op {
+	case walCreate:
+		if record.User == nil || record.Index < 0 || record.Index > len(users) {
+			return nil, errors.Errorf("invalid create at sequence %d", record.Seq)
+		}
+		return insertUser(users, record.Index, *record.User), nil
+	case walUpdate:
+		if record.User == nil || index < 0 || index >= len(users) {
+			return nil, errors.Errorf("invalid update at sequence %d", record.Seq)
+		}
+		users[index] = *record.User
+		return users, nil
+	case walDelete:
+		if index < 0 || index >= len(users) {
+			return nil, errors.Errorf("invalid delete at sequence %d", record.Seq)
+		}
+		return append(users[:index], users[index+1:]...), nil
+	case walMove:
+		if index < 0 || index >= len(users) || record.Index < 0 || record.Index >= len(users) {
+			return nil, errors.Errorf("invalid move at sequence %d", record.Seq)
+		}
+		user := users[index]
+		return insertUser(append(users[:index], users[index+1:]...), record.Index, user), nil
+	default:
+		return nil, errors.Errorf("unknown operation %q at sequence %d", record.Op, record.Seq)
+	}
+}
+
+func indexOf(users []models.User, id string) int {
+	for k, v := range users {
+		if v.ID == id {
+			return k
+		}
+	}
+	return -1
+}
+
+func insertUser(users []models.User, index int, user models.User) []models.User {
+	users = append(users, models.User{})
+	copy(users[index+1:], users[index:])
+	users[index] = user
+	return users
+}
+
+// scanWAL reads all the committed records from the log, returning the offset
+// after the last commit. Only the final record in the log can be torn, a bad
+// record anywhere else means the log is corrupt.
+func scanWAL(data []byte) ([]walRecord, int, error) {
+	var (
+		committed, pending []walRecord
+		offset, end        int
+	)
+	for offset < len(data) {
+		n := bytes.IndexByte(data[offset:], '\n')
+		if n < 0 {
+			// Torn record, the newline never made it to disk.
+			break
+		}
+
+		record, err := decodeWALRecord(data[offset : offset+n])
+		if err != nil {
+			if offset+n+1 < len(data) {
+				return nil, 0, errors.Wrapf(err, "corrupt record at offset %d", offset)
+			}
+			break
+		}
+
+		offset += n + 1
+		pending = append(pending, record)
+		if record.Commit {
+			committed = append(committed, pending...)
+			pending = pending[:0]
+			end = offset
+		}
+	}
+	return committed, end, nil
+}
+
+// encodeWALRecord writes the record as a line, prefixed with the checksum of
+// the record.
+func encodeWALRecord(buf *bytes.Buffer, record walRecord) error {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrapf(err, "unable to marshal record at sequence %d", record.Seq)
+	}
+	fmt.Fprintf(buf, "%08x %s\n", crc32.ChecksumIEEE(payload), payload)
+	return nil
+}
+
+func decodeWALRecord(line []byte) (walRecord, error) {
+	var record walRecord
+	if len(line) < 10 || line[8] != ' ' {
+		return record, errors.New("malformed record")
+	}
+
+	checksum, err := strconv.ParseUint(string(line[:8]), 16, 32)
+	if err != nil {
+		return record, errors.Wrap(err, "malformed checksum")
+	}
+
+	payload := line[9:]
+	if actual := crc32.ChecksumIEEE(payload); uint32(checksum) != actual {
+		return record, errors.Errorf("checksum mismatch: expected %08x, actual %08x", checksum, actual)
+	}
+
+	err = json.Unmarshal(payload, &record)
+	return record, err
+}
@@ -0,0 +1,391 @@
+package store
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/SimonRichardson/formed/pkg/fs"
+	"github.com/SimonRichardson/formed/pkg/models"
+)
+
+func TestWAL(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Run("recover from log", func(t *testing.T) {
+		path := filepath.Join(dir, "recover")
+
+		want := []models.User{
+			models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+			models.User{ID: "j2", Fields: models.Fields{"firstname": "jane", "surname": "doe"}},
+		}
+		writeWAL(t, path, 100, want)
+
+		if expected, actual := want, readWAL(t, path, 100); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if fs.New().Exists(path) {
+			t.Errorf("expected: %q to not exist", path)
+		}
+	})
+
+	t.Run("recover from snapshot and log", func(t *testing.T) {
+		path := filepath.Join(dir, "snapshot")
+
+		want := []models.User{
+			models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+			models.User{ID: "j2", Fields: models.Fields{"firstname": "jane", "surname": "bloggs"}},
+		}
+		// Two records from the first write trigger a compaction, the single
+		// record from the second write then ends up in the log.
+		writeWAL(t, path, 2, []models.User{
+			models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+			models.User{ID: "j2", Fields: models.Fields{"firstname": "jane", "surname": "doe"}},
+		}, want)
+
+		if !fs.New().Exists(path) {
+			t.Errorf("expected: %q to exist", path)
+		}
+		info, err := os.Stat(path + walLogSuffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := true, info.Size() > 0; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := want, readWAL(t, path, 2); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("compaction truncates the log", func(t *testing.T) {
+		path := filepath.Join(dir, "compaction")
+
+		want := []models.User{
+			models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+		}
+		writeWAL(t, path, 1, want)
+
+		info, err := os.Stat(path + walLogSuffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := int64(0), info.Size(); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := want, readWAL(t, path, 1); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("torn final record", func(t *testing.T) {
+		path := filepath.Join(dir, "torn")
+
+		want := []models.User{
+			models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+		}
+		writeWAL(t, path, 100, want, []models.User{
+			models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+			models.User{ID: "j2", Fields: models.Fields{"firstname": "jane", "surname": "doe"}},
+		})
+
+		// Chop the last record in half, as if the process crashed mid write.
+		logPath := path + walLogSuffix
+		data, err := ioutil.ReadFile(logPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(logPath, data[:len(data)-10], 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := want, readWAL(t, path, 100); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		// The torn record should be gone, so new writes can be recovered.
+		writeWAL(t, path, 100, []models.User{
+			models.User{ID: "j3", Fields: models.Fields{"firstname": "joe", "surname": "bloggs"}},
+		})
+		if expected, actual := []models.User{models.User{ID: "j3", Fields: models.Fields{"firstname": "joe", "surname": "bloggs"}}}, readWAL(t, path, 100); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("uncommitted records", func(t *testing.T) {
+		path := filepath.Join(dir, "uncommitted")
+
+		want := []models.User{
+			models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+		}
+		writeWAL(t, path, 100, want)
+
+		// Append the first half of a write that was never committed.
+		var buf bytes.Buffer
+		if err := encodeWALRecord(&buf, walRecord{
+			Seq:   2,
+			Op:    walCreate,
+			Index: 1,
+			User:  &models.User{ID: "j2", Fields: models.Fields{"firstname": "jane", "surname": "doe"}},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		appendFile(t, path+walLogSuffix, buf.Bytes())
+
+		if expected, actual := want, readWAL(t, path, 100); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("corrupt record", func(t *testing.T) {
+		path := filepath.Join(dir, "corrupt")
+
+		writeWAL(t, path, 100, []models.User{
+			models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}},
+		}, []models.User{
+			models.User{ID: "j2", Fields: models.Fields{"firstname": "jane", "surname": "doe"}},
+		})
+
+		// Flip a byte in the first record, which isn't the final record.
+		logPath := path + walLogSuffix
+		data, err := ioutil.ReadFile(logPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[12] ^= 0xff
+		if err := ioutil.WriteFile(logPath, data, 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = NewWAL(fs.New(), path, 100, DefaultLockTimeout)
+
+		if expected, actual := false, err == nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestWALWithoutIDs(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A log written before users had ids, where users are addressed by their
+	// index.
+	path := filepath.Join(dir, "legacy")
+	var buf bytes.Buffer
+	for _, record := range []walRecord{
+		walRecord{Seq: 1, Op: walCreate, Index: 0, User: &models.User{Fields: models.Fields{"firstname": "fred", "surname": "smith"}}},
+		walRecord{Seq: 2, Op: walCreate, Index: 1, User: &models.User{Fields: models.Fields{"firstname": "jane", "surname": "doe"}}, Commit: true},
+		walRecord{Seq: 3, Op: walDelete, Index: 0, Commit: true},
+	} {
+		if err := encodeWALRecord(&buf, record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	appendFile(t, path+walLogSuffix, buf.Bytes())
+
+	users := readWAL(t, path, 100)
+	if expected, actual := 1, len(users); expected != actual {
+		t.Fatalf("expected: %v, actual: %v", expected, actual)
+	}
+	if expected, actual := "jane", users[0].Get("firstname"); expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+	if users[0].ID == "" {
+		t.Errorf("expected: an id, actual: %v", users[0])
+	}
+
+	// The ids are made durable, so they're the same when opened again.
+	if expected, actual := users, readWAL(t, path, 100); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+}
+
+func TestWALSharedBetweenProcesses(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		path = filepath.Join(dir, "store")
+
+		fred = models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}}
+		jane = models.User{ID: "j2", Fields: models.Fields{"firstname": "jane", "surname": "doe"}}
+		joe  = models.User{ID: "j3", Fields: models.Fields{"firstname": "joe", "surname": "bloggs"}}
+	)
+
+	// Compact on every other record, so that both a plain append and a
+	// compaction by the other process have to be caught up with.
+	server, err := NewWAL(fs.New(), path, 2, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Close(server)
+
+	cli, err := NewWAL(fs.New(), path, 2, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Close(cli)
+
+	version, err := server.Write([]models.User{fred}, AnyVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users, cliVersion, err := cli.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := []models.User{fred}, users; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+	if expected, actual := version, cliVersion; expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+
+	if _, err := cli.Write([]models.User{fred, jane, joe}, cliVersion); err != nil {
+		t.Fatal(err)
+	}
+
+	// The server has to catch up before it can see its version is stale.
+	_, err = server.Write([]models.User{jane}, version)
+	if _, ok := ErrConflict(err); !ok {
+		t.Errorf("expected a conflict, actual %v", err)
+	}
+
+	users, version, err = server.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := []models.User{fred, jane, joe}, users; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+
+	if _, err := server.Write([]models.User{joe}, version); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := []models.User{joe}, readWAL(t, path, 2); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+
+	var scanned []models.User
+	if _, err := cli.Scan(func(user models.User) error {
+		scanned = append(scanned, user)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := []models.User{joe}, scanned; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+}
+
+func TestDiffUsers(t *testing.T) {
+	t.Parallel()
+
+	var (
+		fred = models.User{ID: "f1", Fields: models.Fields{"firstname": "fred", "surname": "smith"}}
+		jane = models.User{ID: "j2", Fields: models.Fields{"firstname": "jane", "surname": "doe"}}
+		joe  = models.User{ID: "j3", Fields: models.Fields{"firstname": "joe", "surname": "bloggs"}}
+
+		changed = models.User{ID: "j2", Fields: models.Fields{"firstname": "jane", "surname": "smith"}}
+	)
+
+	for _, testcase := range []struct {
+		name     string
+		old, new []models.User
+	}{
+		{"nothing", nil, nil},
+		{"create", nil, []models.User{fred, jane}},
+		{"update", []models.User{fred, jane}, []models.User{fred, joe}},
+		{"delete", []models.User{fred, jane, joe}, []models.User{jane}},
+		{"all", []models.User{fred, jane}, []models.User{joe, jane, fred}},
+		{"move", []models.User{fred, jane, joe}, []models.User{joe, fred, jane}},
+		{"move and update", []models.User{fred, jane}, []models.User{changed, fred}},
+	} {
+		records := diffUsers(testcase.old, testcase.new, 1)
+
+		var (
+			users = copyUsers(testcase.old)
+			err   error
+		)
+		for _, record := range records {
+			if users, err = applyWALRecord(users, record); err != nil {
+				t.Fatalf("%s: %v", testcase.name, err)
+			}
+		}
+
+		if expected, actual := len(testcase.new), len(users); expected != actual {
+			t.Errorf("%s: expected: %v, actual: %v", testcase.name, expected, actual)
+		}
+		for k, v := range testcase.new {
+			if expected, actual := v, users[k]; !expected.Equal(actual) {
+				t.Errorf("%s: expected: %v, actual: %v", testcase.name, expected, actual)
+			}
+		}
+		if len(records) > 0 && !records[len(records)-1].Commit {
+			t.Errorf("%s: expected: last record to commit", testcase.name)
+		}
+	}
+}
+
+func writeWAL(t *testing.T, path string, compactEvery int, writes ...[]models.User) {
+	s, err := NewWAL(fs.New(), path, compactEvery, DefaultLockTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, users := range writes {
+		if _, err := s.Write(users, AnyVersion); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Crash without compacting.
+	s.(*walStore).log.Close()
+}
+
+func readWAL(t *testing.T, path string, compactEvery int) []models.User {
+	s, err := NewWAL(fs.New(), path, compactEvery, DefaultLockTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Close(s)
+
+	users, _, err := s.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return users
+}
+
+func appendFile(t *testing.T, path string, data []byte) {
+	file, err := fs.New().Append(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -188,6 +188,25 @@ func FSMustString(useLocal bool, name string) string {
 
 var _escData = map[string]*_escFile{
 
+	"/views/conflict.html": {
+		local:   "views/conflict.html",
+		size:    1669,
+		modtime: 1792306570,
+		compressed: `
+H4sIAAAAAAAC/5RVwW7bOBA9K18x0fqYSJucFgtaQBE3RQCjCeL0EAQ50ObIJCKRKjm2EQj694KiLEtt
+arcnUeS8N49vZkB2Pru/eXp++AySyiI7Y+EDwCRy4RcArETisJLcOqRpvKH88r+4OyJFBWa3xpYo4BJu
+jM4LtaJzloYTz5TuqdjSiPcOKK+yfTBL5VW3W2ULU6LRCFg4BMe3KIAkQm5sCTupCkfwbjawQ4uAQpHS
+a1CUsLTaE19nc07oKKBZKq/3WvkyKAp/dr8EqGuwXK8RksVKYsmTW4WFcNA0fQgjmdU1JHO+xAKahqUk
+RwSoxSGepQf6nnyycWjh/ykkncBD+IdiJsfUCK+mZUy+IEHylZcYZIk/ljU4Y+nAHVZljIO0mE9jf+cH
+ThKaJq1r2CmSfmPtk/mzb49zSO7z3CGFnUAaZzPlVtwKXy3rm0ev0QHXAhxxS8DXXGnIrSnb+hatIyzl
+2aiSzwPwoJJtN5RI0ohpXBlHMfAVKaOn8T9xdhZFTOlqQ0DvFU5jqYRAHYPmJU7jLVqnjI5hy4sNhgt+
+WtGG+6rGkJ6Ar5zNR9ibxePtk3lDfYD/7NNxRtOaN+Ls/Tytp1ClGoPnfmckpuvtu5k7KabiaxyxjYi6
+hhmv93MV+aVtv9GRgYrauI+GKYrGxFFo1yHdxJrdxWCQFptlqYiwR/wiYPJ2AZPcZ/eAye/0iADzOJUD
+fofJG/zrlR2xCk1V4IsfQ2t20DSvL0q8Ds0L43k36zwc3S2K+oDh/Iajv8ta1z38g/RD9q6SrbPihOGH
++qZ9gUe6XOt9n/B+i3ZnFWHo/eHYh7Qs9WMbXoTwELA0vDY/BgD/OIu5hQYAAA==
+`,
+	},
+
 	"/views/error.html": {
 		local:   "views/error.html",
 		size:    172,
@@ -199,16 +218,86 @@ o18A0QvRYqMPcRQgAAD//20acPysAAAA
 `,
 	},
 
+	"/views/forbidden.html": {
+		local:   "views/forbidden.html",
+		size:    402,
+		modtime: 1792302490,
+		compressed: `
+H4sIAAAAAAAC/1SQMW/CMBCF9/6KR5a2EmCxdTBZWpgqlYGl4yW+YKvERucLLUL571WagNTJ1nvPn++e
+nb19vO4/dxt4bY/lgx0PwHomN1wA27ISak+SWddFp83ipZgsDXrkcpukZYcFtkmq4BzHmTWjNaDMjWWr
+5C7TS78q72lr/GqST+XeM5okLerUHV18VFSM2nP9xQ5P1yuWG5Ek6PvnOXJCTOpDPMBTRsUckenMbmnN
+6Y7cBPUsuKROkDnnkOJfnH9OQdjNkQR6+/abMjJHRSOpBQ14FuSg/I9pCV64WRfDRDtSj743RfmeyGGQ
+9sP66HvQgUIERYesJIp0ZrGGyglmzViKNWP1vwMAg91csJIBAAA=
+`,
+	},
+
+	"/views/forms.html": {
+		local:   "views/forms.html",
+		size:    308,
+		modtime: 1792301371,
+		compressed: `
+H4sIAAAAAAAC/1yQP0/EMAzFdz7Fozu1bmPwZeHPyg1dGA11caW0ldLcgKJ8d5RLKgFT7Pj93kvM989v
+T8P75QUWF+/uuB4Am8pYCoAXjYJPk7BrPHfXOD08dm0U5+jVvW5h0ZGpdoWmA+ePbfxuYjvdlDuTndrV
+1dcCSAlB1i9Ff9Mg5zZgPzsWWNDp3KWE/iLRkDN1rnRDyUTOTOKY/PzLT/2uf30G06CQoFg3TCWn/8+s
+44Ew1dcx1T8w1eX8DAAFslC8NAEAAA==
+`,
+	},
+
+	"/views/history.html": {
+		local:   "views/history.html",
+		size:    1720,
+		modtime: 1792302490,
+		compressed: `
+H4sIAAAAAAAC/7SVUW/TMBDH3/kUh7XXxm3FEJrcSN3GAAnG1BYkHt36MltL4uJci6qQ744cp24zNjaQ
+eIpzd/7nd/84F/Hy8vPF4tvNW9BU5OkLES4AQqNUfgEgCiQJKy1dhTRhG8oGb1iXIkM5plfWFahgAHUN
+ycKHoGlgAO9NRdbtBA9lXpbvdcXSql2nokdpLNWjLrhOhQTtMJswL3sjSUPTcJaey9UdkO09THCZwk+I
+O/j3DbodZ+k0zyGzrqh8heDrIF7XcLJFVxlbwtkEkq/dumlimuwdhuTFfHa1aO8OaSfLW4RkhlvjN1b7
+lNDjHvZJ5NahQe6pP1xC07B0vxtiLEDqcbRgLreouk4LTLzRkoCNh8PXg+FoMBzD6PRs+OpseAqf5gsG
+TQPLXVs/w8ISTpVyre6h8R+GNCSXJssi9CYP2aPWTjYVurb9qVKo9qUAIjdpGzqUJvOVxkImVwZz5a1o
+DfQCyTskSK5lgdA0dQ1YqpYmN0cPDMHHAXwn2/sIXfB/Q6x0e22PQbu8h9EFn8IIMsk5ZtbhwzxA9pkq
+04z+vinB9y+5H69rMBkkXyp0h0NMchk+13Dn9kuAPyDGGkE6rWtIPsol5i0U6Z5Cz2vBD/oPvPwe2D/B
+qPTBgyA4qWdT9Yw8cudeyg8aKJC0VRO2thUxkCsytnxqFnCHPoIsmm7K9YaAdmucMG2UwpJBKQucsG5u
+MdjKfINBeRvnFwP+DI1V5bKeAHXz7bHt1WZZGIpbZgEX3G8TLAoI7t042JRXGH1ap9eWtClvQcsKlogl
+VO2g2yElx7Mqmit4+F0IHn5QvwYAjuCgWrgGAAA=
+`,
+	},
+
 	"/views/index.html": {
 		local:   "views/index.html",
-		size:    506,
-		modtime: 1498746896,
+		size:    5363,
+		modtime: 1792308018,
 		compressed: `
-H4sIAAAAAAAA/5SRsU4DMQyG5+tTGDPTrAxOFqALiCLBgqoOaeOSky6XU86HqE737ihNKVAmJjt/4s+x
-f7q4Xd68vD7dgZfQmBmVAECercsJAAUWC1tvU8+icZDd1TUer6SWhs0ipsCOVDnlavVVTpvo9sfHu5gC
-BBYfncYu9oJgt1LHVuMlmllVkdhNBlQ5TYdYkXizqFMv0NrApMR/6w/2XCZ1rBtHSLZ9Y5jDNJ0BnaG6
-7QYB2XesUfhD8IDR2HHsGl6tV7vcMmtrhHfbDKxxHGF++MmjDQzThKAMKXH/wfZD+gt9LuI58ucs3Loy
-B6nTjn5164dNqOWEXd5n1KwilZdeLClOkCoWfwYAAP//fK7OMPoBAAA=
+H4sIAAAAAAAC/8RXW2/bOhJ+ln/FlJsHuyeRtm/bRDbQNumeYrtNkPScxSJNAVoaR0RoUiUpO4ar/77g
+Rbc4cZvuw3myTM58M/PNheR2CzkumEAgSq4J1PUoiqLtFg6UXMPxFOKwlBoFGadaT53gbBR5OUXFLUL8
+niHPdZB1+ivKK7QIFin+Q6OK/4kG4k90iY1canIPZDXYAvAbxJ83JQLRyDEzjT9RlPoFEHSJU1KiLDle
+BzfjDyLHe6jrG7vSGLghHjO+xG8VU5hDXYMK39stoLArwXyUytIwKcB5PSVkliZ+pRHoQj13622sO7rW
+B6hr0oXUkFHX4MPoOxDEH7HnBUL8idfs6EKucchZVmB2N5f3PdaYKCsDZlPitLf9HBKbqIyqsAspBORX
+bVwOvBfWz3APyW40UsG4i0hUyzkqMumv5dQgmTwe4nYbpOr616LsCtcncM1MAfG/mbDuLpkYZLeNNEjR
+eydF7x+XGuQqROZKwmA5JVRsyP/H3l/DCEdxa4qf42Wf7PPi7XVGY4e5OFxIfzLJqW/SwbiJ0rKZYaiU
+VKRrvvJR8DRpBtSD9WZ5SHbB8hzFLs89jlk+oNbPxQ+nLj3JYBYKaSwjND8XfNNFMK+MkSIY1NV8yUxj
+kGY25ha+Ko/7tgkspFoKuaKc2R6a/VGmiUebPRs7l2uxH/1UrsWv4ytcyhXut3DpZB7YeCJ/aWLUbNRu
+pi9Oz999/u/FGRRmyWej1P8ApAXS3H4ApEs0FLKCKo1mSiqzOPoHCVuGGY6z91ItMYcjcE1ml1wp+U0L
+ljRo6Vzmm6BbvJoN5YtXYaecpRQKhYspSb5VqDYJmb3h3MWt04TO4Du0EhbjgpoC6jopmDZSbcjsd/9h
+ZV1JAwC0fXhmS94dW97aoBU0mV1wpBohk0rZk9YUaHU5Cug3VF2DUxjrCcyRy/WhrdSCiVsoqIY5ogBN
+V5jDBk3c9yLkZeDTBb3Frv8/S0P5roMlvcXAPMBVIdfWWFB5JythPEL8niltv8FIl5KPVIetMB+FFNg6
+AnLhE9c3Cg3u71RfKFwxWdmQh7wftMS7Dr78CHFPlsyaPzYNw7j78J/w3vwMdJAjM/uxC7nL8A7VbDEc
+JEN2FdL8SAq+ITMngDkztk4yKmz12yuPLQVbhE+lM7WbsERTyHxKSqkNAd/QU/I3d1V8cqRtt8lLuFCo
+tU0qCoMKNIpce6Muo2FsyEXryCFoCUt6h6ArZf2jxhWdjuFl4nAHc7kZNWG4nP+LgKFzd2BMydErAlQx
+euSnd7jpgDYbji4YZgM5BjrXklcGT4DjwhzD0evXr1+X9ydhbvcHz55DYYVK9wedTfOffq07A/boZ1ot
+Bsrvri7ff5Z32FN/2F37EeViodEMMM/d0k/5w9mSDZU/2pWBM+He/OFU/9AZ1+oPL9K7BA/INnTO0U95
+4weuP6JVdyQED66yApf0wVvFas38uJgj9xO8ePyqYSW7XX+m+I/WbmrsqAeWu2eS9u+k1gN7OzmEg0qj
+cm8re/rr7s1lcFlyapq32PggvpRrp+R1Jp1o51aaGH+6uM+Gi7TFsq7MORV3rS8PzMRv7W4gM2k293bt
+M05ymuc7J/ebPO8f2z/q1YfpTxOLNxtFqc4UK+2bKEngP8wUsjLg1zTgCtWmmR29keLGx7pgWQFMg0KR
+o8Ic6C1lwgG53rGiNoFhBOaxw2/B222qsBEBJqDkNMN4FI0XlXA8jCewHUXRiiovP4VcZtUShYlv0Zxx
+tJ9vNx/ysa+XyaFNksvXPlmf0MnJKIrYAsYvHPb37/DCa9qvMcmkMCgMsY659Yl3JlJoKiWscj0aRTbm
+T+45Ejiz9ebocGN2EKpGYSycXZQqt8O6kGsRj6KoidhS6tBC6NEbpegmLpU00qY4Xkh1RrMizijnY4sc
+ZwXjuUJxCC1trlHchA4oP4SJ3ZXpyr2SpXrD+Zhc24q8IZMeLnoWG9Ao/I+tJEyh/zdW6NI5Tr76q/yX
+6+uvX25uXn65SQ6hud4T+M37Cb8BufEpiaJ6cvKrTvuKda5PfS8NI/D7bQD+b+yfaFPo/+0COI5fHlif
+j1tvh37Wk7YY2pKjeX62QmE+Mm1QoBqTjLPsjvTJXHVU2gr3xi2NdiM2VN2icQZskQbXHNMvplNoJkUT
+SleV3hMH6WUeBqZLzsyYHJPJ9d9vDr22XHdSGZcatRkTo0JG9JqZrICxxwsmM3vfdRPquMHQMS1LFPk7
+W5Ljlgy2LKUyn2SOY9dJceitQ7C3hUlgc66Q3p10yP4V0wf3Kx5cyfUTelUZdCxttkrKcKMMM+CKzTkT
+t20NOGgmNCrzFhdSoW+fPZoh+49at2+7B/YF3pvn2H5EwbnzhN0cF7Ti5ni3DGyHulqycaAwp15y7IG6
+SXMyCkVcT9yfNGmOBntD9udjmvhX3v8GAHdQyBrzFAAA
 `,
 	},
 
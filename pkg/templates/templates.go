@@ -2,6 +2,12 @@ package templates
 
 import (
 	"html/template"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -10,9 +16,23 @@ import (
 // depending on the key required.
 // Note: it also has a fallback template if nothing if found so that we can
 // display a valid error to the user.
+// Templates loaded from views can be reloaded while they're being rendered,
+// every template is swapped in one go.
 type Templates struct {
+	mutex     sync.RWMutex
 	templates map[int]*template.Template
 	fallback  *template.Template
+	views     map[int]*loadedView
+}
+
+// fallbackKey is the key of the view of the fallback template.
+const fallbackKey = -1
+
+// loadedView is a view along with the state of its file when it was last
+// loaded.
+type loadedView struct {
+	view  View
+	state viewState
 }
 
 // NewTemplates creates a Template key, value store with an additional fallback
@@ -20,37 +40,252 @@ func NewTemplates(fallback *template.Template) *Templates {
 	return &Templates{
 		templates: make(map[int]*template.Template),
 		fallback:  fallback,
+		views:     make(map[int]*loadedView),
+	}
+}
+
+// Load creates a Template key, value store from the views, so that every
+// template can be reloaded once its view changes, see Reload.
+func Load(fallback View, views map[int]View) (*Templates, error) {
+	tmpl, err := fallback.Load()
+	if err != nil {
+		return nil, err
+	}
+	t := NewTemplates(tmpl)
+	t.views[fallbackKey] = &loadedView{view: fallback, state: fallback.state()}
+
+	for key, view := range views {
+		state := view.state()
+		tmpl, err := view.Load()
+		if err != nil {
+			return nil, err
+		}
+		t.templates[key] = tmpl
+		t.views[key] = &loadedView{view: view, state: state}
 	}
+	return t, nil
 }
 
 // Get returns a template depending on the key supplied, otherwise it will
 // return the fallback
 func (t *Templates) Get(key int) *template.Template {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
 	if t, ok := t.templates[key]; ok {
 		return t
 	}
 	return t.fallback
 }
 
+// Has returns true if a template has been set for the key, rather than
+// falling back
+func (t *Templates) Has(key int) bool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	_, ok := t.templates[key]
+	return ok
+}
+
 // Set provides a way to set a template for a specific key
 func (t *Templates) Set(key int, tmpl *template.Template) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
 	t.templates[key] = tmpl
+	delete(t.views, key)
 }
 
-// NewErrorTemplate provides a template for all generic errors
-func NewErrorTemplate(useLocal bool) (*template.Template, error) {
-	tmpl, err := FSString(useLocal, "/views/error.html")
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to load template")
+// Reload loads every view that has changed since it was last loaded, then
+// swaps in the new templates. A view that can't be loaded keeps its last
+// template and isn't loaded again until it changes again. It returns the
+// number of templates that were reloaded, along with the first error.
+func (t *Templates) Reload() (int, error) {
+	// Only the views are read under the lock, so that loading doesn't hold
+	// up rendering.
+	type change struct {
+		key   int
+		view  View
+		state viewState
+	}
+	var changes []change
+	t.mutex.RLock()
+	for key, v := range t.views {
+		if state := v.view.state(); state != v.state {
+			changes = append(changes, change{key: key, view: v.view, state: state})
+		}
+	}
+	t.mutex.RUnlock()
+
+	var (
+		loaded = make(map[int]*template.Template, len(changes))
+		first  error
+	)
+	for _, v := range changes {
+		tmpl, err := v.view.Load()
+		if err != nil {
+			if first == nil && v.state.path != "" {
+				first = errors.Wrapf(err, "%s", v.state.path)
+			} else if first == nil {
+				first = err
+			}
+			continue
+		}
+		loaded[v.key] = tmpl
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, v := range changes {
+		if view, ok := t.views[v.key]; ok {
+			view.state = v.state
+		}
+		tmpl, ok := loaded[v.key]
+		if !ok {
+			continue
+		}
+		if v.key == fallbackKey {
+			t.fallback = tmpl
+		} else {
+			t.templates[v.key] = tmpl
+		}
 	}
-	return template.New("error").Parse(tmpl)
+	return len(loaded), first
 }
 
-// NewFormTemplate provides a template for the form view
-func NewFormTemplate(useLocal bool) (*template.Template, error) {
-	tmpl, err := FSString(useLocal, "/views/index.html")
+// View describes the file a template is parsed from, so that it can be
+// loaded again.
+type View struct {
+	name     string
+	path     string
+	dir      string
+	useLocal bool
+}
+
+// Load parses the template from the view.
+func (v View) Load() (*template.Template, error) {
+	tmpl, err := viewString(v.dir, v.useLocal, v.path)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to load template")
 	}
-	return template.New("form").Parse(tmpl)
+	res, err := template.New(v.name).Parse(tmpl)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse template %q", v.path)
+	}
+	return res, nil
+}
+
+// viewState identifies the contents of the file of a view without reading
+// it, an embedded view never changes so it has no state.
+type viewState struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+func (v View) state() viewState {
+	var paths []string
+	if v.dir != "" {
+		paths = append(paths, filepath.Join(v.dir, path.Base(v.path)))
+	}
+	if v.useLocal {
+		if f, ok := _escData[path.Clean(v.path)]; ok {
+			paths = append(paths, f.local)
+		}
+	}
+	for _, p := range paths {
+		if info, err := os.Stat(p); err == nil {
+			return viewState{path: p, modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return viewState{}
+}
+
+// ErrorView is the view for all generic errors
+func ErrorView(useLocal bool) View {
+	return View{name: "error", path: "/views/error.html", useLocal: useLocal}
+}
+
+// FormView is the view for the form, found in dir if it isn't empty and has
+// the view, otherwise the default view is used.
+func FormView(dir string, useLocal bool) View {
+	return View{name: "form", path: "/views/index.html", dir: dir, useLocal: useLocal}
+}
+
+// ConflictView is the view for when the form was submitted against stale
+// data, found in dir if it isn't empty and has the view, otherwise the
+// default view is used.
+func ConflictView(dir string, useLocal bool) View {
+	return View{name: "conflict", path: "/views/conflict.html", dir: dir, useLocal: useLocal}
+}
+
+// ForbiddenView is the view for when the form was posted without the token
+// of the session, found in dir if it isn't empty and has the view, otherwise
+// the default view is used.
+func ForbiddenView(dir string, useLocal bool) View {
+	return View{name: "forbidden", path: "/views/forbidden.html", dir: dir, useLocal: useLocal}
+}
+
+// HistoryView is the view for the history, found in dir if it isn't empty
+// and has the view, otherwise the default view is used.
+func HistoryView(dir string, useLocal bool) View {
+	return View{name: "history", path: "/views/history.html", dir: dir, useLocal: useLocal}
+}
+
+// IndexView is the view listing all the forms
+func IndexView(useLocal bool) View {
+	return View{name: "index", path: "/views/forms.html", useLocal: useLocal}
+}
+
+// NewErrorTemplate provides a template for all generic errors
+func NewErrorTemplate(useLocal bool) (*template.Template, error) {
+	return ErrorView(useLocal).Load()
+}
+
+// NewFormTemplate provides a template for the form view, found in dir if it
+// isn't empty and has the view, otherwise the default view is used.
+func NewFormTemplate(dir string, useLocal bool) (*template.Template, error) {
+	return FormView(dir, useLocal).Load()
+}
+
+// NewConflictTemplate provides a template for when the form was submitted
+// against stale data, found in dir if it isn't empty and has the view,
+// otherwise the default view is used.
+func NewConflictTemplate(dir string, useLocal bool) (*template.Template, error) {
+	return ConflictView(dir, useLocal).Load()
+}
+
+// NewForbiddenTemplate provides a template for when the form was posted
+// without the token of the session, found in dir if it isn't empty and has the
+// view, otherwise the default view is used.
+func NewForbiddenTemplate(dir string, useLocal bool) (*template.Template, error) {
+	return ForbiddenView(dir, useLocal).Load()
+}
+
+// NewHistoryTemplate provides a template for the history view, found in dir
+// if it isn't empty and has the view, otherwise the default view is used.
+func NewHistoryTemplate(dir string, useLocal bool) (*template.Template, error) {
+	return HistoryView(dir, useLocal).Load()
+}
+
+// NewIndexTemplate provides a template for the view listing all the forms
+func NewIndexTemplate(useLocal bool) (*template.Template, error) {
+	return IndexView(useLocal).Load()
+}
+
+// viewString reads the view from dir if the view exists there, otherwise the
+// view is read from the embedded (or local) views.
+func viewString(dir string, useLocal bool, name string) (string, error) {
+	if dir != "" {
+		b, err := ioutil.ReadFile(filepath.Join(dir, path.Base(name)))
+		if err == nil {
+			return string(b), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return FSString(useLocal, name)
 }
@@ -0,0 +1,132 @@
+package templates
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReload(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		path    = filepath.Join(dir, "index.html")
+		modTime = time.Now().Add(-time.Hour)
+	)
+	writeView(t, path, "first", modTime)
+
+	templates, err := Load(ErrorView(false), map[int]View{
+		http.StatusOK: FormView(dir, false),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("loaded", func(t *testing.T) {
+		if expected, actual := "first", render(t, templates); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		reloaded, err := templates.Reload()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := 0, reloaded; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		writeView(t, path, "second", modTime.Add(time.Minute))
+
+		reloaded, err := templates.Reload()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := 1, reloaded; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := "second", render(t, templates); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("invalid keeps the last template", func(t *testing.T) {
+		writeView(t, path, "{{ .Broken", modTime.Add(2*time.Minute))
+
+		if _, err := templates.Reload(); err == nil {
+			t.Errorf("expected an error")
+		}
+		if expected, actual := "second", render(t, templates); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		// The view isn't loaded again until it changes again.
+		if _, err := templates.Reload(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("removed falls back to the default view", func(t *testing.T) {
+		if err := os.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+
+		reloaded, err := templates.Reload()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := 1, reloaded; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if templates.Get(http.StatusOK).Name() != "form" {
+			t.Errorf("expected the form template")
+		}
+	})
+
+	t.Run("set isn't reloaded", func(t *testing.T) {
+		writeView(t, path, "third", modTime.Add(3*time.Minute))
+
+		tmpl, err := NewErrorTemplate(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		templates.Set(http.StatusOK, tmpl)
+
+		if _, err := templates.Reload(); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := tmpl, templates.Get(http.StatusOK); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func render(t *testing.T, templates *Templates) string {
+	var buf bytes.Buffer
+	if err := templates.Get(http.StatusOK).Execute(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func writeView(t *testing.T, path, contents string, modTime time.Time) {
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,56 @@
+package templates
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// Watcher reloads templates whenever their views change, by checking the
+// views every interval. A view that fails to parse is logged, while the last
+// template that parsed keeps being rendered.
+type Watcher struct {
+	templates []*Templates
+	logger    log.Logger
+}
+
+// NewWatcher creates a Watcher for the templates.
+func NewWatcher(logger log.Logger, templates ...*Templates) *Watcher {
+	return &Watcher{
+		templates: templates,
+		logger:    logger,
+	}
+}
+
+// Add watches the templates as well.
+func (w *Watcher) Add(templates ...*Templates) {
+	w.templates = append(w.templates, templates...)
+}
+
+// Run checks the views for changes every interval, until stop is closed.
+func (w *Watcher) Run(interval time.Duration, stop <-chan struct{}) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.reload()
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+func (w *Watcher) reload() {
+	for _, t := range w.templates {
+		reloaded, err := t.Reload()
+		if err != nil {
+			level.Error(w.logger).Log("err", err)
+		}
+		if reloaded > 0 {
+			level.Info(w.logger).Log("templates", reloaded, "msg", "reloaded")
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package transfer
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Encoding is the character encoding of the text of a csv file.
+type Encoding string
+
+// These are the encodings that a csv file can be read and written in.
+const (
+	UTF8 Encoding = "utf-8"
+
+	// UTF8BOM is UTF-8 starting with a byte order mark, which spreadsheets
+	// need to tell that a csv file isn't in the encoding of the system.
+	UTF8BOM Encoding = "utf-8-bom"
+
+	// Latin1 is ISO-8859-1, where every byte is the code point of the same
+	// value.
+	Latin1 Encoding = "latin1"
+
+	// Windows1252 is Latin1, except for 0x80 to 0x9f which hold punctuation
+	// and a few letters, as written by spreadsheets on Windows.
+	Windows1252 Encoding = "windows-1252"
+)
+
+var encodingAliases = map[string]Encoding{
+	"":             UTF8,
+	"utf8":         UTF8,
+	"utf-8":        UTF8,
+	"utf8-bom":     UTF8BOM,
+	"utf-8-bom":    UTF8BOM,
+	"latin1":       Latin1,
+	"latin-1":      Latin1,
+	"iso-8859-1":   Latin1,
+	"cp1252":       Windows1252,
+	"windows1252":  Windows1252,
+	"windows-1252": Windows1252,
+}
+
+// ParseEncoding returns the encoding for the name, an empty name is UTF-8.
+func ParseEncoding(name string) (Encoding, error) {
+	if encoding, ok := encodingAliases[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return encoding, nil
+	}
+	return "", errors.Errorf("unknown encoding %q, expected one of %s, %s, %s or %s", name, UTF8, UTF8BOM, Latin1, Windows1252)
+}
+
+var bom = []byte{0xef, 0xbb, 0xbf}
+
+// windows1252 holds the code points for 0x80 to 0x9f, the bytes that aren't
+// defined are kept as the control character of the same value.
+var windows1252 = [32]rune{
+	0x20ac, 0x0081, 0x201a, 0x0192, 0x201e, 0x2026, 0x2020, 0x2021,
+	0x02c6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008d, 0x017d, 0x008f,
+	0x0090, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014,
+	0x02dc, 0x2122, 0x0161, 0x203a, 0x0153, 0x009d, 0x017e, 0x0178,
+}
+
+// decode returns the text in the encoding as UTF-8. A byte order mark at the
+// start of UTF-8 is dropped.
+func decode(b []byte, encoding Encoding) ([]byte, error) {
+	switch encoding {
+	case UTF8, UTF8BOM:
+		b = bytes.TrimPrefix(b, bom)
+		if !utf8.Valid(b) {
+			return nil, errors.Errorf("invalid %s, try another encoding", encoding)
+		}
+		return b, nil
+	case Latin1, Windows1252:
+		var buf bytes.Buffer
+		buf.Grow(len(b))
+		for _, v := range b {
+			r := rune(v)
+			if encoding == Windows1252 && v >= 0x80 && v <= 0x9f {
+				r = windows1252[v-0x80]
+			}
+			buf.WriteRune(r)
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, errors.Errorf("unknown encoding %q", encoding)
+}
+
+// encoder writes UTF-8 to the underlying writer in the encoding. A rune split
+// across writes is held on to until the rest of it is written.
+type encoder struct {
+	writer   io.Writer
+	encoding Encoding
+	pending  []byte
+	started  bool
+}
+
+func newEncoder(w io.Writer, encoding Encoding) *encoder {
+	return &encoder{
+		writer:   w,
+		encoding: encoding,
+	}
+}
+
+func (e *encoder) Write(p []byte) (int, error) {
+	if !e.started {
+		e.started = true
+		if e.encoding == UTF8BOM {
+			if _, err := e.writer.Write(bom); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	switch e.encoding {
+	case UTF8, UTF8BOM:
+		return e.writer.Write(p)
+	case Latin1, Windows1252:
+	default:
+		return 0, errors.Errorf("unknown encoding %q", e.encoding)
+	}
+
+	b := append(e.pending, p...)
+	out := make([]byte, 0, len(b))
+	for len(b) > 0 {
+		if !utf8.FullRune(b) {
+			break
+		}
+		r, size := utf8.DecodeRune(b)
+		c, ok := e.encodeRune(r)
+		if !ok {
+			return 0, errors.Errorf("unable to write %q as %s", r, e.encoding)
+		}
+		out = append(out, c)
+		b = b[size:]
+	}
+	e.pending = append(e.pending[:0], b...)
+
+	if _, err := e.writer.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (e *encoder) encodeRune(r rune) (byte, bool) {
+	if e.encoding == Windows1252 {
+		if r >= 0x80 && r <= 0x9f {
+			// Only the bytes that aren't defined are kept as control
+			// characters.
+			return byte(r), windows1252[r-0x80] == r
+		}
+		for k, v := range windows1252 {
+			if v == r {
+				return byte(0x80 + k), true
+			}
+		}
+	}
+	if r > 0xff {
+		return 0, false
+	}
+	return byte(r), true
+}
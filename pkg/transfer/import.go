@@ -0,0 +1,192 @@
+package transfer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/SimonRichardson/formed/pkg/schema"
+	"github.com/pkg/errors"
+)
+
+// Mode is how imported users are combined with the users already held.
+type Mode string
+
+// These are the modes of an import.
+const (
+	// Merge updates every user that shares an id with an imported user and
+	// adds the rest, nothing is removed.
+	Merge Mode = "merge"
+
+	// Replace leaves only the imported users, every other user is removed.
+	Replace Mode = "replace"
+)
+
+// ParseMode returns the mode for the name, an empty name is Merge.
+func ParseMode(name string) (Mode, error) {
+	switch mode := Mode(strings.ToLower(strings.TrimSpace(name))); mode {
+	case "":
+		return Merge, nil
+	case Merge, Replace:
+		return mode, nil
+	}
+	return "", errors.Errorf("unknown mode %q, expected one of %s or %s", name, Merge, Replace)
+}
+
+// Report describes what an import changed, or would change for a dry run.
+type Report struct {
+	Mode      Mode       `json:"mode"`
+	DryRun    bool       `json:"dry_run"`
+	Rows      int        `json:"rows"`
+	Added     int        `json:"added"`
+	Updated   int        `json:"updated"`
+	Removed   int        `json:"removed"`
+	Unchanged int        `json:"unchanged"`
+	Errors    []RowError `json:"errors,omitempty"`
+}
+
+// Valid returns true if every row can be imported.
+func (r Report) Valid() bool {
+	return len(r.Errors) == 0
+}
+
+// Changed returns true if importing changes any of the users.
+func (r Report) Changed() bool {
+	return r.Added > 0 || r.Updated > 0 || r.Removed > 0
+}
+
+func (r Report) String() string {
+	return fmt.Sprintf("%d row(s), %d added, %d updated, %d removed, %d unchanged, %d error(s)",
+		r.Rows, r.Added, r.Updated, r.Removed, r.Unchanged, len(r.Errors))
+}
+
+// RowError describes why a row can't be imported. The field and the rule are
+// only set for a violation of the schema.
+type RowError struct {
+	Row     int    `json:"row"`
+	ID      string `json:"id,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Rule    string `json:"rule,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e RowError) String() string {
+	if e.Field != "" {
+		return fmt.Sprintf("row %d: %s: %s", e.Row, e.Field, e.Message)
+	}
+	return fmt.Sprintf("row %d: %s", e.Row, e.Message)
+}
+
+// Import works out the users that are held once the rows are imported in to
+// the current users, along with a report of what changed.
+//
+// An imported user with the same id as a current user updates it, a column
+// that the file doesn't have keeps the current value. An imported user
+// without an id, or with an id that isn't known, is added with every column
+// that the file doesn't have left empty. Only the users that are added or
+// updated are validated against the schema.
+//
+// If the report isn't valid then nothing should be written, the report holds
+// every row that can't be imported.
+func Import(current []models.User, rows []Row, mode Mode, s schema.Schema) ([]models.User, Report) {
+	report := Report{
+		Mode: mode,
+		Rows: len(rows),
+	}
+
+	var (
+		existing  = make(map[string]models.User, len(current))
+		positions = make(map[string]int, len(current))
+		imported  = make(map[string]int, len(rows))
+		res       []models.User
+	)
+	for _, v := range current {
+		existing[v.ID] = v
+	}
+	if mode == Merge {
+		res = make([]models.User, len(current), len(current)+len(rows))
+		for k, v := range current {
+			res[k] = v
+			positions[v.ID] = k
+		}
+	}
+
+	for _, row := range rows {
+		if row.Err != nil {
+			report.Errors = append(report.Errors, RowError{
+				Row:     row.Number,
+				ID:      row.User.ID,
+				Message: row.Err.Error(),
+			})
+			continue
+		}
+
+		id := row.User.ID
+		if id != "" {
+			if number, ok := imported[id]; ok {
+				report.Errors = append(report.Errors, RowError{
+					Row:     row.Number,
+					ID:      id,
+					Message: fmt.Sprintf("duplicate id, already imported from row %d", number),
+				})
+				continue
+			}
+			imported[id] = row.Number
+		}
+
+		before, ok := existing[id]
+		user := before.Copy()
+		if !ok || id == "" {
+			user = s.New()
+			user.ID = id
+		}
+		for k, v := range row.User.Fields {
+			user.Set(k, v)
+		}
+
+		changed := !ok || !before.Equal(user)
+		if changed {
+			violations := s.Check(row.Number, user)
+			for _, v := range violations {
+				report.Errors = append(report.Errors, RowError{
+					Row:     row.Number,
+					ID:      id,
+					Field:   v.Field,
+					Rule:    v.Rule,
+					Message: v.Message,
+				})
+			}
+			if len(violations) > 0 {
+				continue
+			}
+		}
+
+		switch {
+		case !ok:
+			report.Added++
+		case changed:
+			report.Updated++
+		default:
+			report.Unchanged++
+		}
+
+		if user.ID == "" {
+			user.ID = models.NewID()
+		}
+		if position, ok := positions[user.ID]; ok {
+			res[position] = user
+			continue
+		}
+		positions[user.ID] = len(res)
+		res = append(res, user)
+	}
+
+	if mode == Replace {
+		for _, v := range current {
+			if _, ok := imported[v.ID]; !ok {
+				report.Removed++
+			}
+		}
+	}
+	return res, report
+}
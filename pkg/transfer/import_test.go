@@ -0,0 +1,95 @@
+package transfer
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/SimonRichardson/formed/pkg/schema"
+)
+
+func TestImport(t *testing.T) {
+	t.Parallel()
+
+	current := []models.User{
+		{ID: "1", Fields: models.Fields{"firstname": "Fred", "surname": "Smith"}},
+		{ID: "2", Fields: models.Fields{"firstname": "Jane", "surname": "Doe"}},
+		{ID: "3", Fields: models.Fields{"firstname": "", "surname": "Invalid"}},
+	}
+	rows := []Row{
+		{Number: 2, User: models.User{ID: "2", Fields: models.Fields{"surname": "Jones"}}},
+		{Number: 3, User: models.User{ID: "1", Fields: models.Fields{"firstname": "Fred", "surname": "Smith"}}},
+		{Number: 4, User: models.User{Fields: models.Fields{"firstname": "Ann", "surname": "Lee"}}},
+	}
+
+	t.Run("merge", func(t *testing.T) {
+		users, report := Import(current, rows, Merge, schema.Default())
+		if expected, actual := (Report{Mode: Merge, Rows: 3, Added: 1, Updated: 1, Unchanged: 1}), report; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 4, len(users); expected != actual {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+
+		// The columns that weren't imported are kept.
+		if expected, actual := (models.User{ID: "2", Fields: models.Fields{"firstname": "Jane", "surname": "Jones"}}), users[1]; !expected.Equal(actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := current[2], users[2]; !expected.Equal(actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if users[3].ID == "" || users[3].Get("firstname") != "Ann" {
+			t.Errorf("expected a new user, actual %v", users[3])
+		}
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		users, report := Import(current, rows, Replace, schema.Default())
+		if expected, actual := (Report{Mode: Replace, Rows: 3, Added: 1, Updated: 1, Removed: 1, Unchanged: 1}), report; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		ids := make([]string, 0, len(users))
+		for _, v := range users[:2] {
+			ids = append(ids, v.ID)
+		}
+		if expected, actual := []string{"2", "1"}, ids; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, report := Import(current, []Row{
+			{Number: 2, User: models.User{ID: "9", Fields: models.Fields{"firstname": "Ann", "surname": "Lee"}}},
+			{Number: 3, Err: errors.New("expected 3 values, actual 2")},
+			{Number: 4, User: models.User{ID: "9", Fields: models.Fields{"firstname": "Ann", "surname": "Lee"}}},
+			{Number: 5, User: models.User{Fields: models.Fields{"firstname": "Ann", "age": "3"}}},
+		}, Merge, schema.Default())
+
+		if report.Valid() {
+			t.Fatal("expected the report to be invalid")
+		}
+		if expected, actual := []RowError{
+			{Row: 3, Message: "expected 3 values, actual 2"},
+			{Row: 4, ID: "9", Message: "duplicate id, already imported from row 2"},
+			{Row: 5, Field: "age", Rule: schema.RuleUnexpected, Message: `unexpected field "age"`},
+			{Row: 5, Field: "surname", Rule: schema.RuleRequired, Message: "expected Last name to not be empty"},
+		}, report.Errors; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestParseMode(t *testing.T) {
+	t.Parallel()
+
+	for name, expected := range map[string]Mode{"": Merge, "merge": Merge, "Replace": Replace} {
+		if actual, err := ParseMode(name); err != nil || expected != actual {
+			t.Errorf("%q: expected: %v, actual: %v (%v)", name, expected, actual, err)
+		}
+	}
+	if _, err := ParseMode("append"); err == nil {
+		t.Errorf("expected an error")
+	}
+}
@@ -0,0 +1,317 @@
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/SimonRichardson/formed/pkg/models"
+	"github.com/pkg/errors"
+)
+
+// Format is a file format that users can be imported from and exported to.
+type Format string
+
+// These are the formats that users can be imported from and exported to.
+const (
+	CSV    Format = "csv"
+	JSON   Format = "json"
+	NDJSON Format = "ndjson"
+	XLSX   Format = "xlsx"
+)
+
+// Formats returns every format.
+func Formats() []Format {
+	return []Format{CSV, JSON, NDJSON, XLSX}
+}
+
+// ParseFormat returns the format for the name, which is also the extension of
+// a file in the format.
+func ParseFormat(name string) (Format, error) {
+	name = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), ".")
+	for _, v := range Formats() {
+		if string(v) == name {
+			return v, nil
+		}
+	}
+	if name == "jsonl" {
+		return NDJSON, nil
+	}
+	return "", errors.Errorf("unknown format %q, expected one of csv, json, ndjson or xlsx", name)
+}
+
+// ContentType returns the media type of a file in the format.
+func ContentType(format Format, options Options) string {
+	switch format {
+	case CSV:
+		if encoding := options.encoding(); encoding == Latin1 || encoding == Windows1252 {
+			return "text/csv; charset=" + string(encoding)
+		}
+		return "text/csv; charset=utf-8"
+	case JSON:
+		return "application/json; charset=utf-8"
+	case NDJSON:
+		return "application/x-ndjson; charset=utf-8"
+	case XLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "application/octet-stream"
+}
+
+// Options change how a csv file is read and written, they have no effect on
+// any other format, which is always UTF-8.
+type Options struct {
+	// Delimiter separates the values of a record, a comma if it's zero.
+	Delimiter rune
+
+	// Encoding is the encoding of the text, UTF-8 if it's empty.
+	Encoding Encoding
+}
+
+func (o Options) delimiter() rune {
+	if o.Delimiter == 0 {
+		return ','
+	}
+	return o.Delimiter
+}
+
+func (o Options) encoding() Encoding {
+	if o.Encoding == "" {
+		return UTF8
+	}
+	return o.Encoding
+}
+
+// ParseDelimiter returns the delimiter for the name, which is either a single
+// character or "tab". An empty name is a comma.
+func ParseDelimiter(name string) (rune, error) {
+	switch name {
+	case "":
+		return ',', nil
+	case "tab", `\t`:
+		return '\t', nil
+	}
+
+	r, size := utf8.DecodeRuneInString(name)
+	if size != len(name) || r == utf8.RuneError || r == '"' || r == '\r' || r == '\n' {
+		return 0, errors.Errorf("invalid delimiter %q, expected a single character or tab", name)
+	}
+	return r, nil
+}
+
+// Export writes the users in the format. A csv or xlsx file starts with a
+// header row naming the columns, the id always comes first, followed by a row
+// for each user.
+func Export(w io.Writer, format Format, columns []string, users []models.User, options Options) error {
+	switch format {
+	case CSV, XLSX:
+		records, err := records(columns, users)
+		if err != nil {
+			return err
+		}
+		if format == XLSX {
+			return writeXLSX(w, records)
+		}
+
+		encoder := newEncoder(w, options.encoding())
+		writer := csv.NewWriter(encoder)
+		writer.Comma = options.delimiter()
+		if err := writer.WriteAll(records); err != nil {
+			return errors.Wrap(err, "unable to write csv")
+		}
+		return nil
+
+	case JSON:
+		if users == nil {
+			users = []models.User{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return errors.Wrap(encoder.Encode(users), "unable to write json")
+
+	case NDJSON:
+		encoder := json.NewEncoder(w)
+		for _, v := range users {
+			if err := encoder.Encode(v); err != nil {
+				return errors.Wrap(err, "unable to write ndjson")
+			}
+		}
+		return nil
+	}
+	return errors.Errorf("unknown format %q", format)
+}
+
+func records(columns []string, users []models.User) ([][]string, error) {
+	header := append([]string{models.IDField}, columns...)
+
+	res := make([][]string, 0, len(users)+1)
+	res = append(res, header)
+	for k, v := range users {
+		record, err := v.Marshal(header)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to marshal user at index %d", k)
+		}
+		res = append(res, record)
+	}
+	return res, nil
+}
+
+// Row is a user read from a file, along with where it was found.
+type Row struct {
+	// Number is the row of the file that the user was read from, see Read.
+	Number int
+
+	User models.User
+
+	// Err is set if the row couldn't be read as a user, the rows that follow
+	// are still read.
+	Err error
+}
+
+// Read reads the users in the format, checking only that they can be read,
+// any column or field is left for the schema to validate.
+//
+// A csv or xlsx file starts with a header row naming the columns, where the
+// id column is optional, followed by a row for each user. The rows are
+// numbered as a spreadsheet would, so the first user is row 2. JSON is a list
+// of users numbered from 1 and ndjson is a user per line, numbered by line.
+//
+// An error is only returned if the file can't be read at all, i.e. the header
+// names a column that isn't one of the columns.
+func Read(r io.Reader, format Format, columns []string, options Options) ([]Row, error) {
+	switch format {
+	case CSV:
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read csv")
+		}
+		if b, err = decode(b, options.encoding()); err != nil {
+			return nil, err
+		}
+
+		reader := csv.NewReader(bytes.NewReader(b))
+		reader.Comma = options.delimiter()
+		reader.FieldsPerRecord = -1
+
+		var records []numbered
+		for number := 1; ; number++ {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				if number == 1 {
+					return nil, errors.Wrap(err, "unable to read the header")
+				}
+				records = append(records, numbered{number: number, err: err})
+				continue
+			}
+			records = append(records, numbered{number: number, values: record})
+		}
+		return readRecords(records, columns)
+
+	case XLSX:
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read xlsx")
+		}
+		records, err := readXLSX(b)
+		if err != nil {
+			return nil, err
+		}
+		return readRecords(records, columns)
+
+	case JSON:
+		var raw []json.RawMessage
+		if err := json.NewDecoder(r).Decode(&raw); err != nil {
+			return nil, errors.Wrap(err, "expected a list of users")
+		}
+
+		res := make([]Row, len(raw))
+		for k, v := range raw {
+			res[k] = readJSON(k+1, v)
+		}
+		return res, nil
+
+	case NDJSON:
+		var res []Row
+
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for number := 1; scanner.Scan(); number++ {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if number == 1 {
+				line = bytes.TrimPrefix(line, bom)
+			}
+			if len(line) == 0 {
+				continue
+			}
+			res = append(res, readJSON(number, line))
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, errors.Wrap(err, "unable to read ndjson")
+		}
+		return res, nil
+	}
+	return nil, errors.Errorf("unknown format %q", format)
+}
+
+// numbered is a record of a csv or xlsx file along with its row number, or
+// the reason it couldn't be read.
+type numbered struct {
+	number int
+	values []string
+	err    error
+}
+
+func readRecords(records []numbered, columns []string) ([]Row, error) {
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	header := records[0].values
+	known := make(map[string]struct{}, len(columns)+1)
+	known[models.IDField] = struct{}{}
+	for _, v := range columns {
+		known[v] = struct{}{}
+	}
+	seen := make(map[string]struct{}, len(header))
+	for k, v := range header {
+		v = strings.TrimSpace(v)
+		if _, ok := known[v]; !ok {
+			return nil, errors.Errorf("unexpected column %q in the header, expected one of %s", v, strings.Join(columns, ", "))
+		}
+		if _, ok := seen[v]; ok {
+			return nil, errors.Errorf("duplicate column %q in the header", v)
+		}
+		seen[v] = struct{}{}
+		header[k] = v
+	}
+
+	res := make([]Row, 0, len(records)-1)
+	for _, v := range records[1:] {
+		row := Row{Number: v.number, Err: v.err}
+		if row.Err == nil {
+			if len(v.values) != len(header) {
+				row.Err = errors.Errorf("expected %d values, actual %d", len(header), len(v.values))
+			} else if err := row.User.Unmarshal(header, v.values); err != nil {
+				row.Err = err
+			}
+		}
+		res = append(res, row)
+	}
+	return res, nil
+}
+
+func readJSON(number int, b []byte) Row {
+	row := Row{Number: number}
+	if err := json.Unmarshal(b, &row.User); err != nil {
+		row.Err = errors.Wrap(err, "invalid user")
+	}
+	return row
+}
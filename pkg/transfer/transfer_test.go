@@ -0,0 +1,196 @@
+package transfer
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SimonRichardson/formed/pkg/models"
+)
+
+var (
+	testColumns = []string{"firstname", "surname"}
+	testUsers   = []models.User{
+		{ID: "1", Fields: models.Fields{"firstname": "Fred", "surname": "Smith"}},
+		{ID: "2", Fields: models.Fields{"firstname": "Zoë", "surname": "Doe, \"Jr\""}},
+	}
+)
+
+func TestExport(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name    string
+		format  Format
+		options Options
+		output  string
+	}{
+		{"csv", CSV, Options{}, "id,firstname,surname\n1,Fred,Smith\n2,Zoë,\"Doe, \"\"Jr\"\"\"\n"},
+		{"csv with a delimiter", CSV, Options{Delimiter: ';'}, "id;firstname;surname\n1;Fred;Smith\n2;Zoë;\"Doe, \"\"Jr\"\"\"\n"},
+		{"csv with a bom", CSV, Options{Encoding: UTF8BOM}, "\xef\xbb\xbfid,firstname,surname\n1,Fred,Smith\n2,Zoë,\"Doe, \"\"Jr\"\"\"\n"},
+		{"csv in latin1", CSV, Options{Encoding: Latin1}, "id,firstname,surname\n1,Fred,Smith\n2,Zo\xeb,\"Doe, \"\"Jr\"\"\"\n"},
+		{"ndjson", NDJSON, Options{}, `{"firstname":"Fred","id":"1","surname":"Smith"}` + "\n" + `{"firstname":"Zoë","id":"2","surname":"Doe, \"Jr\""}` + "\n"},
+	} {
+		var buf bytes.Buffer
+		if err := Export(&buf, testcase.format, testColumns, testUsers, testcase.options); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := testcase.output, buf.String(); expected != actual {
+			t.Errorf("%s: expected: %q, actual: %q", testcase.name, expected, actual)
+		}
+	}
+
+	t.Run("unable to encode", func(t *testing.T) {
+		users := []models.User{{ID: "1", Fields: models.Fields{"firstname": "日本"}}}
+		if err := Export(&bytes.Buffer{}, CSV, testColumns, users, Options{Encoding: Latin1}); err == nil {
+			t.Errorf("expected an error")
+		}
+	})
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		format  Format
+		options Options
+		numbers []int
+	}{
+		{CSV, Options{}, []int{2, 3}},
+		{CSV, Options{Delimiter: '\t', Encoding: Windows1252}, []int{2, 3}},
+		{JSON, Options{}, []int{1, 2}},
+		{NDJSON, Options{}, []int{1, 2}},
+		{XLSX, Options{}, []int{2, 3}},
+	} {
+		var buf bytes.Buffer
+		if err := Export(&buf, testcase.format, testColumns, testUsers, testcase.options); err != nil {
+			t.Fatal(err)
+		}
+
+		rows, err := Read(&buf, testcase.format, testColumns, testcase.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := make([]Row, len(testUsers))
+		for k, v := range testUsers {
+			expected[k] = Row{Number: testcase.numbers[k], User: v}
+		}
+		if actual := rows; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("%s: expected: %v, actual: %v", testcase.format, expected, actual)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	t.Parallel()
+
+	t.Run("csv by column name", func(t *testing.T) {
+		rows, err := Read(strings.NewReader("\xef\xbb\xbfsurname,firstname\nSmith,Fred\nDoe\n"), CSV, testColumns, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := 2, len(rows); expected != actual {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := (Row{Number: 2, User: models.User{Fields: models.Fields{"firstname": "Fred", "surname": "Smith"}}}), rows[0]; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 3, rows[1].Number; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if rows[1].Err == nil {
+			t.Errorf("expected an error for the short row")
+		}
+	})
+
+	t.Run("ndjson skips blank lines", func(t *testing.T) {
+		rows, err := Read(strings.NewReader("{\"firstname\":\"Fred\"}\n\nnot json\n"), NDJSON, testColumns, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := 2, len(rows); expected != actual {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 3, rows[1].Number; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if rows[0].Err != nil || rows[1].Err == nil {
+			t.Errorf("expected only the last row to have an error, actual %v", rows)
+		}
+	})
+
+	for _, testcase := range []struct {
+		name   string
+		format Format
+		input  string
+	}{
+		{"unknown column", CSV, "firstname,age\nFred,1\n"},
+		{"duplicate column", CSV, "firstname,firstname\nFred,Fred\n"},
+		{"invalid utf-8", CSV, "firstname\nZo\xeb\n"},
+		{"not a list", JSON, `{"firstname":"Fred"}`},
+		{"not a zip", XLSX, "firstname\nFred\n"},
+	} {
+		if _, err := Read(strings.NewReader(testcase.input), testcase.format, testColumns, Options{}); err == nil {
+			t.Errorf("%s: expected an error", testcase.name)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	for name, expected := range map[string]Format{"CSV": CSV, ".xlsx": XLSX, "jsonl": NDJSON} {
+		if actual, err := ParseFormat(name); err != nil || expected != actual {
+			t.Errorf("%s: expected: %v, actual: %v (%v)", name, expected, actual, err)
+		}
+	}
+	for name, expected := range map[string]rune{"": ',', ";": ';', "tab": '\t', "|": '|'} {
+		if actual, err := ParseDelimiter(name); err != nil || expected != actual {
+			t.Errorf("%q: expected: %q, actual: %q (%v)", name, expected, actual, err)
+		}
+	}
+	for name, expected := range map[string]Encoding{"": UTF8, "UTF8": UTF8, "iso-8859-1": Latin1, "cp1252": Windows1252} {
+		if actual, err := ParseEncoding(name); err != nil || expected != actual {
+			t.Errorf("%q: expected: %v, actual: %v (%v)", name, expected, actual, err)
+		}
+	}
+
+	if _, err := ParseFormat("pdf"); err == nil {
+		t.Errorf("expected an error")
+	}
+	if _, err := ParseDelimiter(";;"); err == nil {
+		t.Errorf("expected an error")
+	}
+	if _, err := ParseEncoding("ebcdic"); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	t.Parallel()
+
+	// A rune split across writes is still written as a single character.
+	var (
+		buf     bytes.Buffer
+		encoder = newEncoder(&buf, Windows1252)
+		euro    = []byte("€")
+	)
+	for _, v := range [][]byte{euro[:1], euro[1:], []byte("ë")} {
+		if _, err := encoder.Write(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if expected, actual := "\x80\xeb", buf.String(); expected != actual {
+		t.Errorf("expected: %q, actual: %q", expected, actual)
+	}
+
+	decoded, err := decode(buf.Bytes(), Windows1252)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "€ë", string(decoded); expected != actual {
+		t.Errorf("expected: %q, actual: %q", expected, actual)
+	}
+}
@@ -0,0 +1,324 @@
+package transfer
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// An xlsx file is a zip of xml parts, only the parts needed for a single
+// sheet of text are written. Every value is written as an inline string, so
+// that nothing is turned in to a number or a date by the spreadsheet.
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`
+
+	xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="users" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`
+
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`
+
+	xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetEnd = `</sheetData></worksheet>`
+)
+
+// maxXLSXPart is the most that any part of an xlsx file is uncompressed to,
+// so that a small file can't expand to fill the memory.
+const maxXLSXPart = 64 << 20
+
+func writeXLSX(w io.Writer, records [][]string) error {
+	archive := zip.NewWriter(w)
+
+	for _, part := range []struct {
+		name, contents string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	} {
+		file, err := archive.Create(part.name)
+		if err != nil {
+			return errors.Wrap(err, "unable to write xlsx")
+		}
+		if _, err := io.WriteString(file, part.contents); err != nil {
+			return errors.Wrap(err, "unable to write xlsx")
+		}
+	}
+
+	file, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return errors.Wrap(err, "unable to write xlsx")
+	}
+	if err := writeSheet(file, records); err != nil {
+		return errors.Wrap(err, "unable to write xlsx")
+	}
+
+	return errors.Wrap(archive.Close(), "unable to write xlsx")
+}
+
+func writeSheet(w io.Writer, records [][]string) error {
+	var buf bytes.Buffer
+	buf.WriteString(xlsxSheetStart)
+	for k, record := range records {
+		row := strconv.Itoa(k + 1)
+		buf.WriteString(`<row r="` + row + `">`)
+		for i, v := range record {
+			buf.WriteString(`<c r="` + columnName(i) + row + `" t="inlineStr"><is><t xml:space="preserve">`)
+			if err := xml.EscapeText(&buf, []byte(v)); err != nil {
+				return err
+			}
+			buf.WriteString(`</t></is></c>`)
+		}
+		buf.WriteString(`</row>`)
+
+		// Don't hold on to the whole sheet.
+		if buf.Len() > 64*1024 {
+			if _, err := buf.WriteTo(w); err != nil {
+				return err
+			}
+		}
+	}
+	buf.WriteString(xlsxSheetEnd)
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// columnName returns the name of the column at index, i.e. 0 is A and 26 is
+// AA.
+func columnName(index int) string {
+	var name []byte
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = append([]byte{byte('A' + (index-1)%26)}, name...)
+	}
+	return string(name)
+}
+
+// columnIndex returns the index of the column of a cell reference, i.e. B3
+// is 1, or -1 if the reference doesn't start with a column.
+func columnIndex(ref string) int {
+	index := 0
+	for k, v := range ref {
+		if v < 'A' || v > 'Z' {
+			if k == 0 {
+				return -1
+			}
+			break
+		}
+		index = index*26 + int(v-'A') + 1
+	}
+	return index - 1
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Type   string `xml:"Type,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// target returns the part of the relationship with the type ending in kind,
+// or with the id if the id isn't empty.
+func (r xlsxRelationships) target(dir, id, kind string) (string, bool) {
+	for _, v := range r.Relationships {
+		if (id != "" && v.ID == id) || (id == "" && strings.HasSuffix(v.Type, "/"+kind)) {
+			if strings.HasPrefix(v.Target, "/") {
+				return strings.TrimPrefix(v.Target, "/"), true
+			}
+			return path.Join(dir, v.Target), true
+		}
+	}
+	return "", false
+}
+
+type xlsxWorkbookSheets struct {
+	Sheets []struct {
+		ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+// xlsxText is either plain text, or rich text made up of runs of text.
+type xlsxText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var res strings.Builder
+	for _, v := range t.Runs {
+		res.WriteString(v.Text)
+	}
+	return res.String()
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Number int `xml:"r,attr"`
+		Cells  []struct {
+			Ref    string    `xml:"r,attr"`
+			Type   string    `xml:"t,attr"`
+			Value  string    `xml:"v"`
+			Inline *xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSX reads the values of the first sheet of the workbook, every value
+// is read as the text that was stored, so a date is the number of days since
+// 1900.
+func readXLSX(b []byte) ([]numbered, error) {
+	archive, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid xlsx")
+	}
+	parts := make(map[string]*zip.File, len(archive.File))
+	for _, v := range archive.File {
+		parts[v.Name] = v
+	}
+	unmarshal := func(name string, v interface{}) error {
+		part, ok := parts[name]
+		if !ok {
+			return errors.Errorf("invalid xlsx: missing %s", name)
+		}
+		file, err := part.Open()
+		if err != nil {
+			return errors.Wrapf(err, "invalid xlsx: %s", name)
+		}
+		defer file.Close()
+
+		contents, err := ioutil.ReadAll(io.LimitReader(file, maxXLSXPart+1))
+		if err != nil {
+			return errors.Wrapf(err, "invalid xlsx: %s", name)
+		}
+		if len(contents) > maxXLSXPart {
+			return errors.Errorf("invalid xlsx: %s is too large", name)
+		}
+		return errors.Wrapf(xml.Unmarshal(contents, v), "invalid xlsx: %s", name)
+	}
+
+	// Follow the relationships from the package to the first sheet.
+	var rels xlsxRelationships
+	if err := unmarshal("_rels/.rels", &rels); err != nil {
+		return nil, err
+	}
+	workbookPath, ok := rels.target("", "", "officeDocument")
+	if !ok {
+		return nil, errors.New("invalid xlsx: no workbook")
+	}
+
+	var workbook xlsxWorkbookSheets
+	if err := unmarshal(workbookPath, &workbook); err != nil {
+		return nil, err
+	}
+	if len(workbook.Sheets) == 0 {
+		return nil, errors.New("invalid xlsx: no sheets")
+	}
+
+	var (
+		dir          = path.Dir(workbookPath)
+		workbookRels xlsxRelationships
+	)
+	if err := unmarshal(path.Join(dir, "_rels", path.Base(workbookPath)+".rels"), &workbookRels); err != nil {
+		return nil, err
+	}
+	sheetPath, ok := workbookRels.target(dir, workbook.Sheets[0].ID, "")
+	if !ok {
+		return nil, errors.New("invalid xlsx: no sheet")
+	}
+
+	var shared xlsxSharedStrings
+	if sharedPath, ok := workbookRels.target(dir, "", "sharedStrings"); ok {
+		if err := unmarshal(sharedPath, &shared); err != nil {
+			return nil, err
+		}
+	}
+
+	var sheet xlsxSheet
+	if err := unmarshal(sheetPath, &sheet); err != nil {
+		return nil, err
+	}
+
+	res := make([]numbered, 0, len(sheet.Rows))
+	for k, row := range sheet.Rows {
+		record := numbered{number: row.Number}
+		if record.number == 0 {
+			record.number = k + 1
+		}
+
+		// Empty cells are left out, so each value is placed by its
+		// reference.
+		for i, cell := range row.Cells {
+			index := columnIndex(cell.Ref)
+			if index < 0 {
+				index = i
+			}
+			for len(record.values) <= index {
+				record.values = append(record.values, "")
+			}
+
+			value := cell.Value
+			switch cell.Type {
+			case "s":
+				n, err := strconv.Atoi(cell.Value)
+				if err != nil || n < 0 || n >= len(shared.Items) {
+					record.err = errors.Errorf("invalid shared string %q in %s", cell.Value, cell.Ref)
+					break
+				}
+				value = shared.Items[n].String()
+			case "inlineStr":
+				if cell.Inline != nil {
+					value = cell.Inline.String()
+				}
+			case "b":
+				value = strconv.FormatBool(cell.Value == "1")
+			}
+			record.values[index] = value
+		}
+		res = append(res, record)
+	}
+
+	// The header decides how many values every row has, trailing empty
+	// cells are left out.
+	if len(res) > 0 {
+		for k := range res[1:] {
+			for len(res[k+1].values) < len(res[0].values) {
+				res[k+1].values = append(res[k+1].values, "")
+			}
+		}
+	}
+	return res, nil
+}
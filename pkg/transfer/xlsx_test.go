@@ -0,0 +1,90 @@
+package transfer
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestColumnName(t *testing.T) {
+	t.Parallel()
+
+	for index, name := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if expected, actual := name, columnName(index); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := index, columnIndex(name+"12"); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	}
+}
+
+func TestReadXLSX(t *testing.T) {
+	t.Parallel()
+
+	// Spreadsheets write shared strings, rich text, numbers and leave empty
+	// cells out altogether.
+	b := zipParts(t, map[string]string{
+		"_rels/.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+			<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="/xl/workbook.xml"/>
+		</Relationships>`,
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+			<sheets><sheet name="People" sheetId="1" r:id="rId3"/><sheet name="Other" sheetId="2" r:id="rId4"/></sheets>
+		</workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+			<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/sharedStrings" Target="sharedStrings.xml"/>
+			<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/people.xml"/>
+			<Relationship Id="rId4" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/other.xml"/>
+		</Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+			<si><t>firstname</t></si>
+			<si><t>surname</t></si>
+			<si><r><t>Fr</t></r><r><t>ed</t></r></si>
+		</sst>`,
+		"xl/worksheets/people.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+			<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row>
+			<row r="3"><c r="A3" t="s"><v>2</v></c><c r="B3"><v>42</v></c></row>
+			<row r="4"><c r="B4" t="inlineStr"><is><t>Smith</t></is></c></row>
+			<row r="5"><c r="A5" t="s"><v>9</v></c></row>
+		</sheetData></worksheet>`,
+	})
+
+	records, err := readXLSX(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 4, len(records); expected != actual {
+		t.Fatalf("expected: %v, actual: %v", expected, actual)
+	}
+	for k, expected := range []numbered{
+		{number: 1, values: []string{"firstname", "surname"}},
+		{number: 3, values: []string{"Fred", "42"}},
+		{number: 4, values: []string{"", "Smith"}},
+	} {
+		if actual := records[k]; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	}
+	if records[3].err == nil {
+		t.Errorf("expected an error for the missing shared string")
+	}
+}
+
+func zipParts(t *testing.T, parts map[string]string) []byte {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, contents := range parts {
+		file, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := file.Write([]byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}